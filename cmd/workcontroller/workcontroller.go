@@ -20,7 +20,12 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -35,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
 	"sigs.k8s.io/work-api/pkg/controllers"
 )
 
@@ -50,17 +56,156 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var probeAddr string
+	var cacheSyncTimeout time.Duration
 	var enableLeaderElection bool
+	var gracefulShutdownTimeout time.Duration
 	var hubkubeconfig string
 	var hubsecret string
+	var hubSecretNamespace string
+	var hubSecretKey string
+	var hubInCluster bool
 	var workNamespace string
+	var clusterNamespace string
+	var stabilizationWindow time.Duration
+	var requireAvailable bool
+	var forceReapplyInterval time.Duration
+	var resyncPeriod time.Duration
+	var auditLog string
+	var spokeProxyURL string
+	var spokeDialTimeout time.Duration
+	var spokeKeepAlive time.Duration
+	var applyTimeout time.Duration
+	var applyTimeoutByKind string
+	var statusTimeout time.Duration
+	var finalizeTimeout time.Duration
+	var applyQPS float64
+	var applyBurst int
+	var triggerAddr string
+	var triggerTokenFile string
+	var triggerCertDir string
+	var instanceID string
+	var fieldManager string
+	var pruneLimit controllers.PruneLimit
+	var applyModeByKind string
+	var propagatedLabels string
+	var watchAppliedResources bool
+	var propagatedAnnotations string
+	var preservedAnnotationPrefixes string
+	var maxObjectSize int
+	var enableWebhook bool
+	var webhookCertDir string
+	var webhookDefaultNamespace string
+	var spokeName string
+	var spokeKubeconfigs string
+	var spokeLabels string
+	var appliedWorkResync time.Duration
+	var maxConcurrentReconciles int
+	var logLevel string
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081",
+		"The address the /healthz and /readyz probe endpoints bind to. /readyz only succeeds once the caches of the hub and "+
+			"spoke managers are synced. Empty disables the probes.")
+	flag.DurationVar(&cacheSyncTimeout, "cache-sync-timeout", 2*time.Minute,
+		"How long the controllers wait for the caches of the hub and spoke clusters to sync before they fail to start.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"How long the in-progress reconciles have to finish when the controller shuts down.")
 	flag.StringVar(&hubkubeconfig, "hub-kubeconfig", "", "Paths to a kubeconfig connect to hub.")
 	flag.StringVar(&hubsecret, "hub-secret", "", "the name of the secret that contains the hub kubeconfig")
+	flag.StringVar(&hubSecretNamespace, "hub-kubeconfig-secret-namespace", "fleet-system",
+		"The namespace of the hub-secret on the spoke cluster.")
+	flag.StringVar(&hubSecretKey, "hub-kubeconfig-secret-key", "kubeconfig",
+		"The key of the hub kubeconfig in the data of the hub-secret.")
+	flag.BoolVar(&hubInCluster, "hub-in-cluster", false,
+		"Use the cluster the controller runs in as the hub, for controllers deployed on the hub itself. The hub-kubeconfig and hub-secret are not used.")
 	flag.StringVar(&workNamespace, "work-namespace", "", "Namespace to watch for work.")
+	flag.StringVar(&clusterNamespace, "cluster-namespace", "",
+		"The hub namespace of the works of the spoke cluster, the AppliedWorks created by older versions without the namespace of their work are mapped to it. "+
+			"Empty means --work-namespace.")
+	flag.DurationVar(&stabilizationWindow, "stabilization-window", 0,
+		"How long a work has to stay unchanged before it is applied. Zero applies every change immediately.")
+	flag.BoolVar(&requireAvailable, "require-available", false,
+		"Only mark a work as applied once all of its manifests are available, e.g. its deployments are ready.")
+	flag.DurationVar(&forceReapplyInterval, "force-reapply-interval", 0,
+		"How often all the manifests of a work are re-applied even if they didn't change. Zero disables the periodic re-apply.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 0,
+		"How often the applied resources are checked for out-of-band edits, which are corrected by re-applying their manifests. Zero disables the checks.")
+	flag.BoolVar(&watchAppliedResources, "watch-applied-resources", false,
+		"Watch the kinds of the applied resources so that the resources edited or deleted out-of-band are corrected right away "+
+			"instead of at the next resync. Every object of those kinds on the spoke cluster is cached.")
+	flag.StringVar(&auditLog, "audit-log", "",
+		"Path of a file to append the apply and delete audit records to as JSON lines, '-' writes them to stdout. Empty disables auditing.")
+	flag.StringVar(&spokeProxyURL, "spoke-proxy-url", "",
+		"URL of the proxy to reach the spoke cluster through. The HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used if it's empty.")
+	flag.DurationVar(&spokeDialTimeout, "spoke-dial-timeout", 30*time.Second,
+		"How long to wait for a connection to the spoke cluster to be established.")
+	flag.DurationVar(&spokeKeepAlive, "spoke-keepalive", 30*time.Second,
+		"The TCP keepalive period of the connections to the spoke cluster. Keep it below the idle timeout of any load balancer in front of the spoke api server.")
+	flag.DurationVar(&applyTimeout, "apply-timeout", 0,
+		"How long a single manifest may take to be applied on the spoke cluster. Zero means no timeout.")
+	flag.StringVar(&applyTimeoutByKind, "apply-timeout-by-kind", "",
+		"Comma separated kind=duration pairs that override the apply-timeout for some kinds, e.g. 'ConfigMap=5s,CustomResourceDefinition.apiextensions.k8s.io=1m'.")
+	flag.DurationVar(&statusTimeout, "status-timeout", 0,
+		"How long reading or deleting a single applied resource may take when the status of a work is synced. Zero means no timeout.")
+	flag.DurationVar(&finalizeTimeout, "finalize-timeout", 0,
+		"How long the finalizer of a deleted work waits for its applied resources to be deleted before logging the ones holding it up and checking less often. Zero removes the finalizer right away.")
+	flag.Float64Var(&applyQPS, "apply-qps", 0,
+		"The maximum rate of the calls made to each spoke cluster to apply and track the manifests, shared by all the works. Zero keeps the client default of 5.")
+	flag.IntVar(&applyBurst, "apply-burst", 10,
+		"How many calls to a spoke cluster can go over the apply-qps rate at once.")
+	flag.StringVar(&triggerAddr, "trigger-addr", "",
+		"The address of the endpoint that triggers the reconcile of a work, e.g. ':8090'. Empty disables the endpoint. "+
+			"Without --trigger-cert-dir an address without a host only listens on localhost.")
+	flag.StringVar(&triggerTokenFile, "trigger-token-file", "",
+		"Path of a file that contains the bearer token callers of the trigger endpoint have to present.")
+	flag.StringVar(&triggerCertDir, "trigger-cert-dir", "",
+		"The directory that contains the tls.crt and tls.key the trigger endpoint is served with. Empty serves plain http.")
+	flag.StringVar(&instanceID, "instance-id", os.Getenv("POD_NAME"),
+		"The identity of this controller instance stamped on the resources it applies. Defaults to the POD_NAME environment variable.")
+	flag.StringVar(&fieldManager, "field-manager", controllers.DefaultFieldManager,
+		"The field manager the manifests are written with, unless their work sets the field-manager annotation. "+
+			"Give each controller writing to the same spoke cluster its own so that they don't fight over the fields.")
+	flag.IntVar(&pruneLimit.MaxResources, "prune-max-resources", 0,
+		"The maximum number of resources of a work pruned in a single reconcile. Zero means no limit.")
+	flag.IntVar(&pruneLimit.MaxPercent, "prune-max-percent", 0,
+		"The maximum percentage of the applied resources of a work pruned in a single reconcile. Zero means no limit.")
+	flag.StringVar(&applyModeByKind, "apply-mode-by-kind", "",
+		"Comma separated kind=mode pairs that pick the apply mode of some kinds when their work doesn't, e.g. 'ConfigMap=StrategicMergePatch'. "+
+			"The modes are ServerSideApply, ClientSideApply and StrategicMergePatch.")
+	flag.StringVar(&propagatedLabels, "propagated-labels", "",
+		"Comma separated key=value labels set on every applied resource whose manifest doesn't set them, "+
+			"e.g. 'multicluster.x-k8s.io/work-name=${WORK_NAME},multicluster.x-k8s.io/work-namespace=${WORK_NAMESPACE}'. "+
+			"The values can reference the variables of the manifests.")
+	flag.StringVar(&propagatedAnnotations, "propagated-annotations", "",
+		"Comma separated key=value annotations set on every applied resource whose manifest doesn't set them, "+
+			"the values can reference the variables of the manifests like the ones of --propagated-labels.")
+	flag.StringVar(&preservedAnnotationPrefixes, "preserved-annotation-prefixes", strings.Join(controllers.DefaultPreservedAnnotationPrefixes, ","),
+		"Comma separated prefixes of the annotations other controllers set on the applied resources, e.g. 'kubectl.kubernetes.io/'. "+
+			"They keep their value when the manifest doesn't set them and their changes are not corrected as drifts. Empty preserves none.")
+	flag.IntVar(&maxObjectSize, "max-object-size", 1024*1024,
+		"The largest serialized size in bytes of a manifest that is applied, it should be below the etcd value limit of the spoke cluster. Zero means no limit.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false,
+		"Serve the admission webhooks that reject the works with malformed or duplicated manifests and default the namespace of their "+
+			"namespaced manifests. The hub api server must be able to reach them.")
+	flag.StringVar(&webhookDefaultNamespace, "webhook-default-namespace", "",
+		"The namespace the webhook sets on the namespaced manifests without one. Empty uses the namespace of their work.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"The directory that contains the tls.crt and tls.key of the webhook server. Empty uses the default directory of controller-runtime.")
+	flag.StringVar(&spokeName, "spoke-name", "",
+		"The name of the spoke cluster the controller runs against, the works target it by this name. The works without a target cluster are applied to it.")
+	flag.StringVar(&spokeKubeconfigs, "spoke-kubeconfigs", "",
+		"Comma separated name=path pairs of the kubeconfigs of additional spoke clusters to apply the works targeting them to, e.g. 'east=/etc/east/kubeconfig'.")
+	flag.StringVar(&spokeLabels, "spoke-labels", "",
+		"Comma separated key=value labels of the spoke-name cluster, the works with a cluster selector are only applied to it if the selector matches them, e.g. 'env=prod,region=east'.")
+	flag.DurationVar(&appliedWorkResync, "applied-work-resync", time.Minute,
+		"How often the resources of each AppliedWork are checked to still exist on the spoke cluster. Raise it to lower the load of large fleets.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many works each of the apply, status and finalize controllers of a spoke cluster reconcile at once.")
+	flag.StringVar(&logLevel, "log-level", "",
+		"How much the controllers log: info, debug for the decisions made about each work or trace for every object applied. It overrides -v when set.")
 
 	klog.InitFlags(nil)
 
@@ -71,44 +216,193 @@ func main() {
 		MetricsBindAddress: metricsAddr,
 		LeaderElection:     enableLeaderElection,
 		Port:               9443,
+		CertDir:            webhookCertDir,
 		Namespace:          workNamespace,
+		// the in-progress applies use this window to record that they were interrupted
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
+		HealthProbeBindAddress:  probeAddr,
 	}
+	opts.Controller.CacheSyncTimeout = &cacheSyncTimeout
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	if len(logLevel) != 0 {
+		verbosity, err := controllers.LogVerbosity(logLevel)
+		if err != nil {
+			setupLog.Error(err, "invalid log level", "logLevel", logLevel)
+			os.Exit(1)
+		}
+		if err := flag.Set("v", verbosity.String()); err != nil {
+			setupLog.Error(err, "unable to set the log verbosity", "logLevel", logLevel)
+			os.Exit(1)
+		}
+	}
+	if applyQPS < 0 || (applyQPS > 0 && applyBurst < 1) {
+		setupLog.Error(fmt.Errorf("invalid apply rate limit qps %v burst %d", applyQPS, applyBurst), "the qps must not be negative and the burst must be positive")
+		os.Exit(1)
+	}
+	if appliedWorkResync <= 0 {
+		setupLog.Error(fmt.Errorf("invalid applied work resync %v", appliedWorkResync), "the applied work resync must be positive")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateFieldManager(fieldManager); err != nil {
+		setupLog.Error(err, "invalid field manager", "fieldManager", fieldManager)
+		os.Exit(1)
+	}
+	if maxConcurrentReconciles < 1 {
+		setupLog.Error(fmt.Errorf("invalid max concurrent reconciles %d", maxConcurrentReconciles), "the max concurrent reconciles must be positive")
+		os.Exit(1)
+	}
+	if pruneLimit.MaxResources < 0 || pruneLimit.MaxPercent < 0 || pruneLimit.MaxPercent > 100 {
+		setupLog.Error(fmt.Errorf("invalid prune limit %+v", pruneLimit), "the prune limits must not be negative and the percentage must not be over 100")
+		os.Exit(1)
+	}
 	var hubConfig *restclient.Config
 	var err error
 
-	if len(hubkubeconfig) != 0 {
+	switch {
+	case hubInCluster && len(hubkubeconfig) != 0:
+		err = fmt.Errorf("the hub-in-cluster and hub-kubeconfig flags are mutually exclusive")
+	case hubInCluster:
+		// the hub gets its own copy so that the spoke settings below don't apply to it
+		setupLog.Info("use the cluster the controller runs in as the hub")
+		hubConfig, err = ctrl.GetConfig()
+	case len(hubkubeconfig) != 0:
 		setupLog.Info("read kubeconfig from file")
 		hubConfig, err = clientcmd.BuildConfigFromFlags("", hubkubeconfig)
-	} else {
+	default:
 		setupLog.Info("read kubeconfig from secret")
-		hubConfig, err = getKubeConfig(hubsecret)
+		hubConfig, err = getKubeConfig(hubSecretNamespace, hubsecret, hubSecretKey)
 	}
 	if err != nil {
 		setupLog.Error(err, "error reading kubeconfig to connect to hub")
 		os.Exit(1)
 	}
 
-	if err := controllers.Start(ctrl.SetupSignalHandler(), hubConfig, ctrl.GetConfigOrDie(), setupLog, opts); err != nil {
+	spokeConfig := ctrl.GetConfigOrDie()
+	if len(spokeProxyURL) != 0 {
+		proxyURL, err := parseProxyURL(spokeProxyURL)
+		if err != nil {
+			setupLog.Error(err, "invalid spoke proxy url", "url", spokeProxyURL)
+			os.Exit(1)
+		}
+		spokeConfig.Proxy = http.ProxyURL(proxyURL)
+	}
+	if spokeDialTimeout <= 0 || spokeKeepAlive <= 0 {
+		setupLog.Error(fmt.Errorf("invalid spoke dialer settings"), "the spoke dial timeout and keepalive must be positive",
+			"dialTimeout", spokeDialTimeout, "keepAlive", spokeKeepAlive)
+		os.Exit(1)
+	}
+	spokeConfig.Dial = (&net.Dialer{Timeout: spokeDialTimeout, KeepAlive: spokeKeepAlive}).DialContext
+
+	additionalSpokes, err := loadSpokeConfigs(spokeKubeconfigs, spokeConfig)
+	if err != nil {
+		setupLog.Error(err, "invalid additional spoke clusters", "kubeconfigs", spokeKubeconfigs)
+		os.Exit(1)
+	}
+	if _, found := additionalSpokes[spokeName]; found {
+		setupLog.Error(fmt.Errorf("duplicated spoke cluster %q", spokeName), "an additional spoke cluster has the name of the default one")
+		os.Exit(1)
+	}
+
+	defaultSpokeLabels, err := parseKeyValues(spokeLabels)
+	if err != nil {
+		setupLog.Error(err, "invalid spoke labels", "labels", spokeLabels)
+		os.Exit(1)
+	}
+
+	kindTimeouts, err := parseKindTimeouts(applyTimeoutByKind)
+	if err != nil {
+		setupLog.Error(err, "invalid apply timeouts by kind", "timeouts", applyTimeoutByKind)
+		os.Exit(1)
+	}
+	kindModes, err := parseKeyValues(applyModeByKind)
+	if err != nil {
+		setupLog.Error(err, "invalid apply modes by kind", "modes", applyModeByKind)
+		os.Exit(1)
+	}
+	labels, err := parseKeyValues(propagatedLabels)
+	if err != nil {
+		setupLog.Error(err, "invalid propagated labels", "labels", propagatedLabels)
+		os.Exit(1)
+	}
+	annotations, err := parseKeyValues(propagatedAnnotations)
+	if err != nil {
+		setupLog.Error(err, "invalid propagated annotations", "annotations", propagatedAnnotations)
+		os.Exit(1)
+	}
+
+	controllerOpts := controllers.ControllerOptions{
+		StabilizationWindow:  stabilizationWindow,
+		RequireAvailable:     requireAvailable,
+		ForceReapplyInterval: forceReapplyInterval,
+		ResyncPeriod:         resyncPeriod,
+		ApplyTimeout:         applyTimeout,
+		ApplyTimeoutByKind:   kindTimeouts,
+		StatusTimeout:        statusTimeout,
+		FinalizeTimeout:      finalizeTimeout,
+		ApplyQPS:             float32(applyQPS),
+		ApplyBurst:           applyBurst,
+		InstanceID:           instanceID,
+		PruneLimit:           pruneLimit,
+		ApplyModeByKind:      kindModes,
+		MaxObjectSize:        maxObjectSize,
+		EnableWebhook:        enableWebhook,
+		SpokeName:            spokeName,
+		AdditionalSpokes:     additionalSpokes,
+	}
+	controllerOpts.MaxConcurrentReconciles = maxConcurrentReconciles
+	controllerOpts.WebhookDefaultNamespace = webhookDefaultNamespace
+	controllerOpts.ClusterNamespace = clusterNamespace
+	controllerOpts.PropagatedLabels = labels
+	controllerOpts.PropagatedAnnotations = annotations
+	controllerOpts.PreservedAnnotationPrefixes = parseList(preservedAnnotationPrefixes)
+	controllerOpts.FieldManager = fieldManager
+	controllerOpts.AppliedWorkResyncPeriod = appliedWorkResync
+	controllerOpts.WatchAppliedResources = watchAppliedResources
+	controllerOpts.SpokeLabels = map[string]map[string]string{spokeName: defaultSpokeLabels}
+	if len(triggerAddr) != 0 {
+		token, err := os.ReadFile(triggerTokenFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read the trigger token", "path", triggerTokenFile)
+			os.Exit(1)
+		}
+		controllerOpts.TriggerAddr = triggerAddr
+		controllerOpts.TriggerToken = strings.TrimSpace(string(token))
+		controllerOpts.TriggerCertDir = triggerCertDir
+	}
+	if len(auditLog) != 0 {
+		auditSink, closer, err := audit.NewFileSink(auditLog)
+		if err != nil {
+			setupLog.Error(err, "unable to open the audit log", "path", auditLog)
+			os.Exit(1)
+		}
+		defer closer.Close()
+		controllerOpts.AuditSink = auditSink
+	}
+
+	if err := controllers.Start(ctrl.SetupSignalHandler(), hubConfig, spokeConfig, setupLog, opts, controllerOpts); err != nil {
 		setupLog.Error(err, "problem running controllers")
 		os.Exit(1)
 	}
 }
 
-func getKubeConfig(hubkubeconfig string) (*restclient.Config, error) {
+// getKubeConfig reads the hub kubeconfig from the key of a secret on the spoke cluster.
+func getKubeConfig(namespace, name, key string) (*restclient.Config, error) {
+	if len(name) == 0 {
+		return nil, fmt.Errorf("neither the hub-kubeconfig nor the hub-secret is set")
+	}
 	spokeClientSet, err := kubernetes.NewForConfig(ctrl.GetConfigOrDie())
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot create the spoke client")
 	}
 
-	secret, err := spokeClientSet.CoreV1().Secrets("fleet-system").Get(context.Background(), hubkubeconfig, metav1.GetOptions{})
+	secret, err := spokeClientSet.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot find kubeconfig secrete")
+		return nil, errors.Wrapf(err, "cannot find the kubeconfig secret %s/%s", namespace, name)
 	}
 
-	kubeConfigData, ok := secret.Data["kubeconfig"]
+	kubeConfigData, ok := secret.Data[key]
 	if !ok || len(kubeConfigData) == 0 {
-		return nil, fmt.Errorf("wrong formatted kube config")
+		return nil, fmt.Errorf("the kubeconfig secret %s/%s has no %q key", namespace, name, key)
 	}
 
 	kubeConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeConfigData)
@@ -118,3 +412,87 @@ func getKubeConfig(hubkubeconfig string) (*restclient.Config, error) {
 
 	return kubeConfig, nil
 }
+
+// parseProxyURL parses and validates the url of a proxy.
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse the proxy url")
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, it must be http, https or socks5", proxyURL.Scheme)
+	}
+	if len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("the proxy url %q has no host", proxy)
+	}
+	return proxyURL, nil
+}
+
+// parseList parses a comma separated list, the empty items are dropped.
+func parseList(items string) []string {
+	var list []string
+	for _, item := range strings.Split(items, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseKeyValues parses comma separated key=value pairs.
+func parseKeyValues(pairs string) (map[string]string, error) {
+	kindValues := make(map[string]string)
+	if len(pairs) == 0 {
+		return kindValues, nil
+	}
+	for _, pair := range strings.Split(pairs, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return nil, fmt.Errorf("%q is not in the key=value format", pair)
+		}
+		kindValues[parts[0]] = parts[1]
+	}
+	return kindValues, nil
+}
+
+// loadSpokeConfigs loads the configs of the additional spoke clusters from comma separated name=kubeconfig pairs.
+// They reach their api servers the same way as the default spoke cluster.
+func loadSpokeConfigs(pairs string, defaultConfig *restclient.Config) (map[string]*restclient.Config, error) {
+	kubeconfigs, err := parseKeyValues(pairs)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]*restclient.Config, len(kubeconfigs))
+	for name, kubeconfig := range kubeconfigs {
+		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read the kubeconfig of spoke cluster %s", name)
+		}
+		config.Proxy = defaultConfig.Proxy
+		config.Dial = defaultConfig.Dial
+		configs[name] = config
+	}
+	return configs, nil
+}
+
+// parseKindTimeouts parses comma separated kind=duration pairs.
+func parseKindTimeouts(timeouts string) (map[string]time.Duration, error) {
+	kindValues, err := parseKeyValues(timeouts)
+	if err != nil {
+		return nil, err
+	}
+	kindTimeouts := make(map[string]time.Duration)
+	for kind, value := range kindValues {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout of kind %s", kind)
+		}
+		if timeout < 0 {
+			return nil, fmt.Errorf("the timeout of kind %s can't be negative", kind)
+		}
+		kindTimeouts[kind] = timeout
+	}
+	return kindTimeouts, nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/controllers"
+	"sigs.k8s.io/work-api/pkg/webhook"
+)
+
+const usage = `workctl checks Work definitions before they reach the hub cluster.
+
+Usage:
+  workctl validate [--offline] [--kubeconfig <path>] <file>...
+
+The files hold one or more Works in YAML or JSON, "-" reads them from stdin.
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "validate" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	os.Exit(validate(os.Args[2:]))
+}
+
+// validate runs the checks of the validating webhook on the works of the files and, unless offline, checks that the
+// kinds of their manifests are served by the cluster of the kubeconfig. It returns the exit code of the command.
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	offline := flags.Bool("offline", false,
+		"Only check that the manifests decode, without looking up their kinds on a cluster.")
+	kubeconfig := flags.String("kubeconfig", "",
+		"Path to the kubeconfig of the spoke cluster the kinds of the manifests are looked up on. "+
+			"Empty uses $KUBECONFIG or ~/.kube/config.")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var restMapper meta.RESTMapper
+	if !*offline {
+		var err error
+		if restMapper, err = newRESTMapper(*kubeconfig); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to look up the kinds of the manifests, use --offline to skip it: %v\n", err)
+			return 1
+		}
+	}
+
+	invalid := false
+	for _, path := range flags.Args() {
+		works, err := readWorks(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			invalid = true
+			continue
+		}
+		for i := range works {
+			work := &works[i]
+			errs := webhook.ValidateWork(work)
+			if restMapper != nil {
+				errs = append(errs, controllers.ValidateManifestMappings(restMapper, work.Spec.Workload)...)
+			}
+			printResult(path, work, errs)
+			invalid = invalid || len(errs) != 0
+		}
+	}
+	if invalid {
+		return 1
+	}
+	return 0
+}
+
+// newRESTMapper discovers the kinds served by the cluster of the kubeconfig.
+func newRESTMapper(kubeconfig string) (meta.RESTMapper, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return apiutil.NewDynamicRESTMapper(cfg, apiutil.WithLazyDiscovery)
+}
+
+// readWorks decodes the works of a file, it fails on the documents that are not works.
+func readWorks(path string) ([]workv1alpha1.Work, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+	var works []workv1alpha1.Work
+	for {
+		work := workv1alpha1.Work{}
+		if err := decoder.Decode(&work); err == io.EOF {
+			return works, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "document %d can't be decoded", len(works))
+		}
+		if work.APIVersion == "" && work.Kind == "" {
+			// an empty document, e.g. after a trailing separator
+			continue
+		}
+		if gvk := work.GroupVersionKind(); gvk != workv1alpha1.SchemeGroupVersion.WithKind("Work") {
+			return nil, fmt.Errorf("document %d is a %s, not a Work", len(works), gvk)
+		}
+		works = append(works, work)
+	}
+}
+
+func printResult(path string, work *workv1alpha1.Work, errs field.ErrorList) {
+	name := work.Name
+	if len(work.Namespace) != 0 {
+		name = work.Namespace + "/" + work.Name
+	}
+	if len(errs) == 0 {
+		fmt.Printf("%s: work %s is valid\n", path, name)
+		return
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: work %s: %v\n", path, name, err)
+	}
+}
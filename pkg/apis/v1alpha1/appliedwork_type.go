@@ -44,6 +44,14 @@ type AppliedtWorkStatus struct {
 	// However, the resource will not be undeleted, so it can be removed from this list and eventual consistency is preserved.
 	// +optional
 	AppliedResources []AppliedResourceMeta `json:"appliedResources,omitempty"`
+
+	// AppliedResourceCount is the number of resources in AppliedResources, so that it can be shown without listing them.
+	// +optional
+	AppliedResourceCount int `json:"appliedResourceCount,omitempty"`
+
+	// LastReconcileTime is the last time the controller updated the resources tracked by the appliedWork.
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
 }
 
 // AppliedResourceMeta represents the group, version, resource, name and namespace of a resource.
@@ -51,17 +59,30 @@ type AppliedtWorkStatus struct {
 type AppliedResourceMeta struct {
 	ResourceIdentifier `json:",inline"`
 
-	// UID is set on successful deletion of the Kubernetes resource by controller. The
-	// resource might be still visible on the managed cluster after this field is set.
+	// UID is the UID of the Kubernetes resource on the managed cluster, recorded when the controller
+	// applies it. A resource whose UID differs from it was deleted and recreated by someone else.
 	// It is not directly settable by a client.
 	// +optional
 	UID types.UID `json:"uid,omitempty"`
+
+	// ObservedGeneration is the generation of the resource right after the controller last applied it.
+	// A resource whose generation moved past it was modified by someone else since then.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastAppliedTime is the last time the controller wrote the resource on the managed cluster.
+	// +optional
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
 }
 
 // +genclient
 // +genclient:nonNamespaced
 // +kubebuilder:subresource:status
-// +kubebuilder:resource:scope=Cluster,categories={fleet}
+// +kubebuilder:resource:scope=Cluster,categories={fleet},shortName=aw
+// +kubebuilder:printcolumn:name="Work",type=string,JSONPath=`.spec.workName`
+// +kubebuilder:printcolumn:name="Work Namespace",type=string,JSONPath=`.spec.workNamespace`
+// +kubebuilder:printcolumn:name="Resources",type=integer,JSONPath=`.status.appliedResourceCount`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +kubebuilder:object:root=true
 
 // AppliedWork represents an applied work on managed cluster that is placed
@@ -69,7 +90,7 @@ type AppliedResourceMeta struct {
 // deployed in the managed cluster.
 // When the agent is removed from managed cluster, cluster-admin on managed cluster
 // can delete appliedmanifestwork to remove resources deployed by the agent.
-// The name of the appliedwork must be the same as {manifestwork name}
+// The name of the appliedwork must be the same as {work namespace}.{work name}
 // The namespace of the appliedwork should be the same as the resource applied on
 // the managed cluster.
 type AppliedWork struct {
@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// HelmReleaseNameAnnotation names the Helm release a resource belongs to.
+	HelmReleaseNameAnnotation = "meta.helm.sh/release-name"
+	// HelmReleaseNamespaceAnnotation is the namespace of the Helm release a resource belongs to.
+	HelmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	// HelmManagedByLabel is set to HelmManagedByValue on the resources of a Helm release.
+	HelmManagedByLabel = "app.kubernetes.io/managed-by"
+	// HelmManagedByValue is the value of HelmManagedByLabel on the resources of a Helm release.
+	HelmManagedByValue = "Helm"
+)
+
+// NewWork builds a Work whose manifests are the given objects, in order.
+func NewWork(name, namespace string, objs ...runtime.Object) (*Work, error) {
+	work := &Work{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       "Work",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	for i, obj := range objs {
+		manifest, err := NewManifest(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build manifest %d of work %s/%s: %w", i, namespace, name, err)
+		}
+		work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests, manifest)
+	}
+	return work, nil
+}
+
+// NewManifest marshals an object into a manifest.
+// The typed objects built without their apiVersion and kind get the ones the client-go scheme registers them with,
+// since the spoke cluster can't tell what a manifest is without them.
+func NewManifest(obj runtime.Object) (Manifest, error) {
+	obj = obj.DeepCopyObject()
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if len(gvk.Kind) == 0 || len(gvk.Version) == 0 {
+		gvks, _, err := clientgoscheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("unable to find the apiVersion and kind of %T: %w", obj, err)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return Manifest{RawExtension: runtime.RawExtension{Raw: raw}}, nil
+}
+
+// SetHelmRelease tags every manifest of the work with the metadata of the Helm release they were rendered from,
+// so that the helm CLI recognizes the applied resources as part of the release. Each document of a multi-document
+// manifest is tagged, the manifests are re-encoded as JSON.
+func (w *Work) SetHelmRelease(name, namespace string) error {
+	for i := range w.Spec.Workload.Manifests {
+		docs, err := w.Spec.Workload.Manifests[i].Documents()
+		if err != nil {
+			return fmt.Errorf("failed to decode manifest %d: %w", i, err)
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		var tagged [][]byte
+		for _, doc := range docs {
+			obj, err := doc.AsUnstructured()
+			if err != nil {
+				return fmt.Errorf("failed to decode manifest %d: %w", i, err)
+			}
+			annotations := obj.GetAnnotations()
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[HelmReleaseNameAnnotation] = name
+			annotations[HelmReleaseNamespaceAnnotation] = namespace
+			obj.SetAnnotations(annotations)
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[HelmManagedByLabel] = HelmManagedByValue
+			obj.SetLabels(labels)
+			raw, err := obj.MarshalJSON()
+			if err != nil {
+				return fmt.Errorf("failed to encode manifest %d: %w", i, err)
+			}
+			tagged = append(tagged, raw)
+		}
+		// a JSON document is a YAML document too, so the documents are kept together as a YAML stream
+		w.Spec.Workload.Manifests[i] = Manifest{RawExtension: runtime.RawExtension{Raw: bytes.Join(tagged, []byte("\n---\n"))}}
+	}
+	return nil
+}
+
+// AsUnstructured decodes the manifest into the object it describes.
+// The manifest can be JSON or YAML, and the YAML can be a string as pasted in a hand-written work.
+func (m *Manifest) AsUnstructured() (*unstructured.Unstructured, error) {
+	raw := m.Raw
+	if len(raw) == 0 && m.Object != nil {
+		// the manifest was built in memory rather than read from the api server
+		data, err := json.Marshal(m.Object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode object: %w", err)
+		}
+		raw = data
+	}
+	docs, err := manifestDocuments(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	if len(docs) != 1 {
+		return nil, fmt.Errorf("failed to decode object: the manifest has %d documents, want 1", len(docs))
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(docs[0]); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	return obj, nil
+}
+
+// Documents splits a manifest holding a stream of YAML documents into a manifest per document, the empty documents
+// are skipped. A manifest with a single document is returned as is.
+func (m *Manifest) Documents() ([]Manifest, error) {
+	if len(m.Raw) == 0 {
+		return []Manifest{*m}, nil
+	}
+	docs, err := manifestDocuments(m.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	if len(docs) == 1 {
+		return []Manifest{*m}, nil
+	}
+	manifests := make([]Manifest, 0, len(docs))
+	for _, doc := range docs {
+		manifests = append(manifests, Manifest{RawExtension: runtime.RawExtension{Raw: doc}})
+	}
+	return manifests, nil
+}
+
+// manifestDocuments returns the JSON of each document of a JSON or YAML manifest, the empty documents are skipped.
+func manifestDocuments(raw []byte) ([][]byte, error) {
+	data := bytes.TrimSpace(raw)
+	if len(data) != 0 && data[0] == '"' {
+		// the YAML was pasted in the work as a string
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return nil, err
+		}
+		data = []byte(text)
+	}
+	var docs [][]byte
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		jsonDoc, err := utilyaml.ToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		// a document with nothing but comments is null
+		if jsonDoc = bytes.TrimSpace(jsonDoc); len(jsonDoc) == 0 || bytes.Equal(jsonDoc, []byte("null")) {
+			continue
+		}
+		docs = append(docs, jsonDoc)
+	}
+}
+
+// GVKs returns the group, version and kind of each manifest, in order.
+// The manifests that can't be decoded have an empty one.
+func (w *WorkloadTemplate) GVKs() []schema.GroupVersionKind {
+	gvks := make([]schema.GroupVersionKind, len(w.Manifests))
+	for i := range w.Manifests {
+		if obj, err := w.Manifests[i].AsUnstructured(); err == nil {
+			gvks[i] = obj.GroupVersionKind()
+		}
+	}
+	return gvks
+}
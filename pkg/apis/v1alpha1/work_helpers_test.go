@@ -0,0 +1,266 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/pointer"
+)
+
+// notRegistered is a kind the client-go scheme doesn't know.
+type notRegistered struct {
+	metav1.TypeMeta `json:",inline"`
+}
+
+func (in *notRegistered) DeepCopyObject() runtime.Object {
+	out := *in
+	return &out
+}
+
+func TestNewWorkRoundTrip(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(3)},
+	}
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetName("widget")
+
+	work, err := NewWork("work", "cluster-a", configMap, deployment, widget)
+	if err != nil {
+		t.Fatalf("NewWork() error = %v", err)
+	}
+	if work.APIVersion != GroupVersion.String() || work.Kind != "Work" || work.Name != "work" || work.Namespace != "cluster-a" {
+		t.Errorf("NewWork() built the work %+v, want work cluster-a/work", work.ObjectMeta)
+	}
+	if len(configMap.APIVersion) != 0 || len(configMap.Kind) != 0 {
+		t.Errorf("NewWork() changed the type of the given object to %v", configMap.GroupVersionKind())
+	}
+
+	wantKinds := []schema.GroupVersionKind{
+		{Version: "v1", Kind: "ConfigMap"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{Group: "example.com", Version: "v1", Kind: "Widget"},
+	}
+	if len(work.Spec.Workload.Manifests) != len(wantKinds) {
+		t.Fatalf("NewWork() built %d manifests, want %d", len(work.Spec.Workload.Manifests), len(wantKinds))
+	}
+	for i, manifest := range work.Spec.Workload.Manifests {
+		decoded := &unstructured.Unstructured{}
+		if err := decoded.UnmarshalJSON(manifest.Raw); err != nil {
+			t.Fatalf("failed to decode manifest %d: %v", i, err)
+		}
+		if decoded.GroupVersionKind() != wantKinds[i] {
+			t.Errorf("manifest %d has kind %v, want %v", i, decoded.GroupVersionKind(), wantKinds[i])
+		}
+	}
+
+	decodedConfigMap := &corev1.ConfigMap{}
+	if err := json.Unmarshal(work.Spec.Workload.Manifests[0].Raw, decodedConfigMap); err != nil {
+		t.Fatalf("failed to decode the config map: %v", err)
+	}
+	if decodedConfigMap.Name != "config" || decodedConfigMap.Data["key"] != "value" {
+		t.Errorf("decoded config map %+v, want %+v", decodedConfigMap, configMap)
+	}
+	decodedDeployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(work.Spec.Workload.Manifests[1].Raw, decodedDeployment); err != nil {
+		t.Fatalf("failed to decode the deployment: %v", err)
+	}
+	if decodedDeployment.Spec.Replicas == nil || *decodedDeployment.Spec.Replicas != 3 {
+		t.Errorf("decoded deployment replicas = %v, want 3", decodedDeployment.Spec.Replicas)
+	}
+}
+
+func TestNewWorkRejectsUnknownKinds(t *testing.T) {
+	if _, err := NewWork("work", "cluster-a", &notRegistered{}); err == nil {
+		t.Errorf("NewWork() accepted an object without a kind the scheme knows")
+	}
+}
+
+func TestManifestAsUnstructured(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+	}
+	tests := map[string]struct {
+		manifest Manifest
+		wantErr  bool
+	}{
+		"raw manifest": {
+			manifest: Manifest{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"default"}}`)}},
+		},
+		"manifest built in memory": {
+			manifest: Manifest{RawExtension: runtime.RawExtension{Object: configMap}},
+		},
+		"manifest that is not json": {
+			manifest: Manifest{RawExtension: runtime.RawExtension{Raw: []byte(`not json`)}},
+			wantErr:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj, err := tt.manifest.AsUnstructured()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("AsUnstructured() = %v, want an error", obj)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AsUnstructured() error = %v", err)
+			}
+			if obj.GetKind() != "ConfigMap" || obj.GetNamespace() != "default" || obj.GetName() != "config" {
+				t.Errorf("AsUnstructured() = %v, want the config map default/config", obj)
+			}
+		})
+	}
+}
+
+func TestWorkloadTemplateGVKs(t *testing.T) {
+	work, err := NewWork("work", "cluster-a",
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}})
+	if err != nil {
+		t.Fatalf("NewWork() error = %v", err)
+	}
+	work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests,
+		Manifest{RawExtension: runtime.RawExtension{Raw: []byte(`not json`)}})
+
+	want := []schema.GroupVersionKind{
+		{Version: "v1", Kind: "ConfigMap"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+		{},
+	}
+	got := work.Spec.Workload.GVKs()
+	if len(got) != len(want) {
+		t.Fatalf("GVKs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GVKs()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestManifestAsUnstructuredFromYAML(t *testing.T) {
+	configMapYAML := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: default\ndata:\n  key: value\n"
+	quoted, err := json.Marshal(configMapYAML)
+	if err != nil {
+		t.Fatalf("failed to quote the yaml: %v", err)
+	}
+	tests := map[string]struct {
+		raw     string
+		wantErr bool
+	}{
+		"raw yaml": {
+			raw: configMapYAML,
+		},
+		"yaml string": {
+			raw: string(quoted),
+		},
+		"yaml with a document marker and comments": {
+			raw: "# the config of the app\n---\n" + configMapYAML + "---\n# nothing else\n",
+		},
+		"multi-document yaml": {
+			raw:     configMapYAML + "---\n" + configMapYAML,
+			wantErr: true,
+		},
+		"empty yaml": {
+			raw:     "---\n",
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			manifest := Manifest{RawExtension: runtime.RawExtension{Raw: []byte(tt.raw)}}
+			obj, err := manifest.AsUnstructured()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("AsUnstructured() = %v, want an error", obj)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AsUnstructured() error = %v", err)
+			}
+			data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+			if obj.GetKind() != "ConfigMap" || obj.GetName() != "config" || data["key"] != "value" {
+				t.Errorf("AsUnstructured() = %v, want the config map default/config", obj)
+			}
+		})
+	}
+}
+
+func TestWorkSetHelmRelease(t *testing.T) {
+	configMapYAML := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: default\n  labels:\n    app: web\n"
+	secretYAML := "apiVersion: v1\nkind: Secret\nmetadata:\n  name: secret\n  namespace: default\n"
+	work, err := NewWork("work", "cluster-a", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "typed", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("NewWork() error = %v", err)
+	}
+	work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests,
+		Manifest{RawExtension: runtime.RawExtension{Raw: []byte(configMapYAML + "---\n" + secretYAML)}})
+
+	if err := work.SetHelmRelease("web", "apps"); err != nil {
+		t.Fatalf("SetHelmRelease() error = %v", err)
+	}
+	if len(work.Spec.Workload.Manifests) != 2 {
+		t.Fatalf("SetHelmRelease() left %d manifests, want 2", len(work.Spec.Workload.Manifests))
+	}
+	var objs []*unstructured.Unstructured
+	for i := range work.Spec.Workload.Manifests {
+		docs, err := work.Spec.Workload.Manifests[i].Documents()
+		if err != nil {
+			t.Fatalf("failed to split manifest %d: %v", i, err)
+		}
+		for _, doc := range docs {
+			obj, err := doc.AsUnstructured()
+			if err != nil {
+				t.Fatalf("failed to decode manifest %d: %v", i, err)
+			}
+			objs = append(objs, obj)
+		}
+	}
+	if len(objs) != 3 {
+		t.Fatalf("SetHelmRelease() left %d documents, want 3", len(objs))
+	}
+	for _, obj := range objs {
+		annotations := obj.GetAnnotations()
+		if annotations[HelmReleaseNameAnnotation] != "web" || annotations[HelmReleaseNamespaceAnnotation] != "apps" {
+			t.Errorf("%s annotations = %v, want the release web in apps", obj.GetName(), annotations)
+		}
+		if obj.GetLabels()[HelmManagedByLabel] != HelmManagedByValue {
+			t.Errorf("%s labels = %v, want it managed by Helm", obj.GetName(), obj.GetLabels())
+		}
+	}
+	if objs[1].GetLabels()["app"] != "web" {
+		t.Errorf("SetHelmRelease() dropped the labels of the manifest: %v", objs[1].GetLabels())
+	}
+}
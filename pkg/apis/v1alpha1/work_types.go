@@ -25,18 +25,274 @@ import (
 type WorkSpec struct {
 	// Workload represents the manifest workload to be deployed on spoke cluster
 	Workload WorkloadTemplate `json:"workload,omitempty"`
+
+	// WorkloadRef points to a ConfigMap or a Secret in the namespace of the work whose keys hold more manifests, so
+	// that large manifests don't have to be inlined in the work. Its manifests are applied after the ones of the
+	// workload, in the order of their keys, and are applied again whenever the referenced object changes.
+	// +optional
+	WorkloadRef *WorkloadReference `json:"workloadRef,omitempty"`
+
+	// ApplyStrategy is how the manifests are written to the spoke cluster.
+	// When it's not set, server side apply is tried first and an update is used if it fails.
+	// +optional
+	ApplyStrategy ApplyStrategyType `json:"applyStrategy,omitempty"`
+
+	// ForceConflicts makes server side apply take over the fields owned by other field managers
+	// instead of failing on the conflicts. The resources whose conflicts were forced are noted in their conditions.
+	// When it's set it wins over the force-conflicts annotation, false makes the conflicts fail.
+	// +optional
+	ForceConflicts *bool `json:"forceConflicts,omitempty"`
+
+	// DryRun makes the spoke cluster validate the manifests without persisting them. The conditions of the
+	// manifests tell whether applying them would create or update the resources.
+	// When it's set it wins over the dry-run annotation, false applies the manifests.
+	// +optional
+	DryRun *bool `json:"dryRun,omitempty"`
+
+	// TargetCluster is the name of the spoke cluster the work is applied to, when a controller serves several.
+	// When it's not set, the work goes to the default spoke cluster of the controller.
+	// +optional
+	TargetCluster string `json:"targetCluster,omitempty"`
+
+	// ClusterSelector restricts the work to the spoke clusters whose labels match it. A work that doesn't select the
+	// spoke cluster it targets is skipped until it does. When it's not set, the work is applied to its target cluster.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// DeletePolicy is what happens to the applied resources when the work is deleted.
+	// The work keeps its finalizer until the policy is carried out on the spoke cluster.
+	// When it's not set, the resources are deleted in the foreground.
+	// +optional
+	DeletePolicy DeletePolicyType `json:"deletePolicy,omitempty"`
+
+	// StaleDeletePropagation is how the dependents of the resources pruned from the work are deleted on the spoke
+	// cluster, e.g. Foreground keeps a pruned deployment around until its pods are gone.
+	// When it's not set, the dependents are deleted in the background.
+	// +optional
+	StaleDeletePropagation StaleDeletePropagationType `json:"staleDeletePropagation,omitempty"`
+
+	// NamespaceOverride is the namespace the namespaced manifests are applied to on the spoke cluster instead of their own.
+	// The identifiers in the status point to the resources in this namespace. The cluster scoped manifests are left untouched.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	NamespaceOverride string `json:"namespaceOverride,omitempty"`
+
+	// AdoptExisting lets the work take over the resources that already exist on the spoke cluster without being owned
+	// by it. When it's not set, such a resource is left untouched and its manifest fails with the NotOwned reason.
+	// +optional
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+
+	// PreserveFields are the paths of the fields, e.g. `spec.replicas`, that keep their value on the spoke cluster when
+	// a manifest that doesn't set them is applied over an existing resource. The fields allocated by the spoke cluster,
+	// like the cluster IP and the node ports of a service, are always preserved.
+	// +optional
+	PreserveFields []string `json:"preserveFields,omitempty"`
+
+	// ApplyPolicy is what happens to the manifests applied in a reconcile when another manifest of the work fails.
+	// When it's not set, the manifests that can be applied are kept.
+	// +optional
+	ApplyPolicy ApplyPolicyType `json:"applyPolicy,omitempty"`
+
+	// Paused freezes the work: its manifests are neither applied nor pruned and its status is left as it is, so the
+	// resources stay as they were last applied. The manifests are re-applied once the work is resumed.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
 }
 
+// ApplyStrategyType is how the manifests of a work are written to the spoke cluster.
+// +kubebuilder:validation:Enum=ClientSideApply;ServerSideApply
+type ApplyStrategyType string
+
+const (
+	// ApplyStrategyClientSideApply updates the existing resources with a plain update.
+	ApplyStrategyClientSideApply ApplyStrategyType = "ClientSideApply"
+
+	// ApplyStrategyServerSideApply creates and updates the resources with server side apply,
+	// and fails on conflicts with other field managers.
+	ApplyStrategyServerSideApply ApplyStrategyType = "ServerSideApply"
+)
+
+// ApplyPolicyType is what happens to the manifests of a work that were applied when others failed.
+// +kubebuilder:validation:Enum=AllOrNothing;BestEffort
+type ApplyPolicyType string
+
+const (
+	// ApplyPolicyAllOrNothing deletes the resources created in a reconcile if any manifest of the work fails for a
+	// reason that won't go away by itself, so that the work is applied as a whole or not at all.
+	// The resources that already existed are not reverted.
+	ApplyPolicyAllOrNothing ApplyPolicyType = "AllOrNothing"
+
+	// ApplyPolicyBestEffort applies every manifest it can and reports the ones that failed.
+	ApplyPolicyBestEffort ApplyPolicyType = "BestEffort"
+)
+
+// DeletePolicyType is what happens to the applied resources of a work when the work is deleted.
+// +kubebuilder:validation:Enum=Foreground;Orphan;Background
+type DeletePolicyType string
+
+const (
+	// DeletePolicyForeground deletes the applied resources before the applied work tracking them goes away.
+	DeletePolicyForeground DeletePolicyType = "Foreground"
+
+	// DeletePolicyOrphan leaves the applied resources on the spoke cluster, they are no longer owned by the work.
+	DeletePolicyOrphan DeletePolicyType = "Orphan"
+
+	// DeletePolicyBackground deletes the applied work tracking the resources right away and lets the spoke cluster
+	// delete the applied resources in the background.
+	DeletePolicyBackground DeletePolicyType = "Background"
+)
+
+// StaleDeletePropagationType is how the dependents of the resources pruned from a work are deleted.
+// +kubebuilder:validation:Enum=Foreground;Background
+type StaleDeletePropagationType string
+
+const (
+	// StaleDeletePropagationForeground deletes the dependents of a pruned resource before the resource itself.
+	StaleDeletePropagationForeground StaleDeletePropagationType = "Foreground"
+
+	// StaleDeletePropagationBackground deletes a pruned resource right away and lets the spoke cluster delete its
+	// dependents in the background.
+	StaleDeletePropagationBackground StaleDeletePropagationType = "Background"
+)
+
 // WorkloadTemplate represents the manifest workload to be deployed on spoke cluster
 type WorkloadTemplate struct {
 	// Manifests represents a list of kuberenetes resources to be deployed on the spoke cluster.
 	// +optional
 	Manifests []Manifest `json:"manifests,omitempty"`
+
+	// Dependencies lists the manifests that have to be applied before others, e.g. a CRD before its CRs.
+	// The manifests without dependencies are applied in the order of the list, the namespaces and CRDs first.
+	// They are not part of the manifests since a manifest is the raw resource.
+	// +optional
+	Dependencies []ManifestDependency `json:"dependencies,omitempty"`
+
+	// ApplyVersions pins the version some manifests are applied as when the spoke cluster serves their kind in several,
+	// e.g. while a CRD is migrated to a new version. The other manifests are applied as the version they declare.
+	// +optional
+	ApplyVersions []ManifestApplyVersion `json:"applyVersions,omitempty"`
+
+	// ApplyModes tell how some manifests are applied, e.g. only to create the default config a user may edit later.
+	// The other manifests are reconciled, their resources are kept matching them.
+	// +optional
+	ApplyModes []ManifestApplyMode `json:"applyModes,omitempty"`
+
+	// HealthChecks tell when some manifests are available, for the kinds whose availability the controller can't
+	// tell by itself, e.g. custom resources. The other manifests are available once they exist or are ready.
+	// +optional
+	HealthChecks []ManifestHealthCheck `json:"healthChecks,omitempty"`
+
+	// Overlays patch some manifests before they are applied, e.g. to scale a deployment on a single spoke cluster of
+	// a work distributed to several. The overlays of a manifest are applied in the order of the list.
+	// +optional
+	Overlays []ManifestOverlay `json:"overlays,omitempty"`
 }
 
-// Manifest represents a resource to be deployed on spoke cluster
+// WorkloadReference is a ConfigMap or a Secret on the hub cluster whose keys each hold the JSON or YAML of a manifest.
+type WorkloadReference struct {
+	// Kind is the kind of the referenced object.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+
+	// Name is the name of the referenced object in the namespace of the work.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ManifestHealthCheck is a CEL expression that tells if the live object of a manifest is healthy.
+type ManifestHealthCheck struct {
+	// Ordinal is the index of the manifest in the manifests list.
+	Ordinal int `json:"ordinal"`
+
+	// Expression is a CEL expression evaluated against the live object of the manifest, bound to `object`.
+	// The manifest is available when it evaluates to true, e.g. `object.status.phase == "Ready"`.
+	// +kubebuilder:validation:MinLength=1
+	Expression string `json:"expression"`
+}
+
+// ManifestOverlay is a JSON patch applied to a manifest before it is applied to the spoke cluster.
+type ManifestOverlay struct {
+	// Ordinal is the index of the manifest in the manifests list.
+	Ordinal int `json:"ordinal"`
+
+	// Clusters are the names of the spoke clusters the overlay is applied on.
+	// When it's empty, the overlay is applied on every spoke cluster.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+
+	// Patch is the RFC 6902 JSON patch applied to the manifest, e.g. a replace of /spec/replicas.
+	// It can't change the apiVersion or the kind of the manifest.
+	// +kubebuilder:validation:MinItems=1
+	Patch []JSONPatchOperation `json:"patch"`
+}
+
+// JSONPatchOperation is an operation of an RFC 6902 JSON patch.
+type JSONPatchOperation struct {
+	// Op is the operation.
+	// +kubebuilder:validation:Enum=add;remove;replace;move;copy;test
+	Op string `json:"op"`
+
+	// Path is the JSON pointer to the field the operation applies to, e.g. /spec/replicas.
+	Path string `json:"path"`
+
+	// From is the JSON pointer to the field a move or a copy takes its value from.
+	// +optional
+	From string `json:"from,omitempty"`
+
+	// Value is the JSON value an add, a replace or a test uses.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	Value *runtime.RawExtension `json:"value,omitempty"`
+}
+
+// ManifestApplyVersion is the version a manifest is applied as.
+type ManifestApplyVersion struct {
+	// Ordinal is the index of the manifest in the manifests list.
+	Ordinal int `json:"ordinal"`
+
+	// Version is the version of the kind of the manifest to apply it as, e.g. v1beta1.
+	// The manifest fails to apply if the spoke cluster doesn't serve its kind in this version.
+	// +kubebuilder:validation:MinLength=1
+	Version string `json:"version"`
+}
+
+// ManifestApplyModeType is how a manifest is applied to the spoke cluster.
+// +kubebuilder:validation:Enum=Reconcile;CreateOnly
+type ManifestApplyModeType string
+
+const (
+	// ManifestApplyModeReconcile creates the resource of the manifest and keeps it matching the manifest.
+	ManifestApplyModeReconcile ManifestApplyModeType = "Reconcile"
+
+	// ManifestApplyModeCreateOnly creates the resource of the manifest if it doesn't exist and never updates it.
+	ManifestApplyModeCreateOnly ManifestApplyModeType = "CreateOnly"
+)
+
+// ManifestApplyMode is how a manifest is applied.
+type ManifestApplyMode struct {
+	// Ordinal is the index of the manifest in the manifests list.
+	Ordinal int `json:"ordinal"`
+
+	// Mode is how the manifest is applied. A CreateOnly manifest leaves the existing resource untouched, even if
+	// the manifest or the resource changes, and is reported with the CreateOnlySkipped reason.
+	Mode ManifestApplyModeType `json:"mode"`
+}
+
+// ManifestDependency is the manifests one manifest depends on.
+type ManifestDependency struct {
+	// Ordinal is the index of the dependent manifest in the manifests list.
+	Ordinal int `json:"ordinal"`
+
+	// DependsOn are the indexes of the manifests that have to be applied before the dependent one.
+	// The dependent manifest isn't applied until they are all applied successfully.
+	DependsOn []int `json:"dependsOn"`
+}
+
+// Manifest represents a resource to be deployed on spoke cluster.
+// It is either the resource itself or a string with the YAML of the resource.
 type Manifest struct {
-	// +kubebuilder:validation:EmbeddedResource
 	// +kubebuilder:pruning:PreserveUnknownFields
 	runtime.RawExtension `json:",inline"`
 }
@@ -56,6 +312,45 @@ type WorkStatus struct {
 	// spoke cluster.
 	// +optional
 	ManifestConditions []ManifestCondition `json:"manifestConditions,omitempty"`
+
+	// LastError is the truncated message of the most recent failure to apply the work.
+	// It is cleared once the work is applied successfully.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// LastErrorTime is the time when LastError was first observed.
+	// +optional
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+
+	// LastFullApplyTime is the last time all the manifests were re-applied regardless of whether they changed.
+	// It is only set when the controller is configured to periodically re-apply works.
+	// +optional
+	LastFullApplyTime *metav1.Time `json:"lastFullApplyTime,omitempty"`
+
+	// PendingChanges are the changes to the spoke cluster waiting for the work to be approved.
+	// It is only set when the work requires an approval, and cleared once the changes are applied.
+	// +optional
+	PendingChanges []PendingChange `json:"pendingChanges,omitempty"`
+
+	// FailedResources are the manifests whose Applied condition is not true, so the failures of a work can be
+	// found without going through all of its manifest conditions.
+	// +optional
+	FailedResources []ResourceIdentifier `json:"failedResources,omitempty"`
+
+	// DeletingResources are the resources pruned from the work that are still on the spoke cluster, e.g. waiting on
+	// their finalizers. They are kept here until they are gone so that a stuck deletion doesn't go unnoticed.
+	// +optional
+	DeletingResources []ResourceIdentifier `json:"deletingResources,omitempty"`
+
+	// ManifestCount is the number of manifests in the work, after its multi-document manifests are split.
+	// +optional
+	ManifestCount int `json:"manifestCount,omitempty"`
+
+	// History records the outcomes of the last applies of the work, oldest first. An apply is only recorded when its
+	// outcome differs from the last one, so a work failing or succeeding the same way keeps a single record.
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	History []ReconcileRecord `json:"history,omitempty"`
 }
 
 // ResourceIdentifier provides the identifiers needed to interact with any arbitrary object.
@@ -84,6 +379,35 @@ type ResourceIdentifier struct {
 	Name string `json:"name,omitempty"`
 }
 
+// PendingChange is a change to a resource on the spoke cluster that is not applied yet.
+type PendingChange struct {
+	// Identifier is the resource the change applies to.
+	Identifier ResourceIdentifier `json:"identifier"`
+
+	// Action is what applying the change does to the resource, either Create or Update.
+	Action string `json:"action"`
+
+	// Diff is the JSON of the fields of the manifest that differ from the resource on the spoke cluster.
+	// It is truncated if too long.
+	// +optional
+	Diff string `json:"diff,omitempty"`
+}
+
+// ReconcileRecord is the outcome of applying a generation of the work.
+type ReconcileRecord struct {
+	// Time is when the work was applied.
+	Time metav1.Time `json:"time"`
+
+	// ObservedGeneration is the generation of the work that was applied.
+	ObservedGeneration int64 `json:"observedGeneration"`
+
+	// Succeeded is the number of manifests that were applied.
+	Succeeded int `json:"succeeded"`
+
+	// Failed is the number of manifests that failed to apply.
+	Failed int `json:"failed"`
+}
+
 // ManifestCondition represents the conditions of the resources deployed on
 // spoke cluster
 type ManifestCondition struct {
@@ -94,11 +418,24 @@ type ManifestCondition struct {
 	// Conditions represents the conditions of this resource on spoke cluster
 	// +required
 	Conditions []metav1.Condition `json:"conditions"`
+
+	// ApplyStrategy is how the resource was last written to the spoke cluster.
+	// +optional
+	ApplyStrategy string `json:"applyStrategy,omitempty"`
+
+	// ObservedHash is the hash of the manifest we last applied, it matches the multicluster.x-k8s.io/spec-hash
+	// annotation of the resource on the spoke cluster unless the resource was edited out-of-band since.
+	// +optional
+	ObservedHash string `json:"observedHash,omitempty"`
 }
 
 // +genclient
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=wk
+// +kubebuilder:printcolumn:name="Applied",type=string,JSONPath=`.status.conditions[?(@.type=="Applied")].status`
+// +kubebuilder:printcolumn:name="Manifests",type=integer,JSONPath=`.status.manifestCount`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Work is the Schema for the works API
 type Work struct {
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package appliedwork helps the consumers of the work api update the AppliedWorks of a spoke cluster
+// without racing the work controllers that update them too.
+package appliedwork
+
+import (
+	"context"
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	clientset "sigs.k8s.io/work-api/pkg/client/clientset/versioned"
+)
+
+// Client updates the AppliedWorks of a spoke cluster through the generated clientset.
+type Client struct {
+	workClient clientset.Interface
+}
+
+// NewClient creates a Client that uses the work clientset of the spoke cluster.
+func NewClient(workClient clientset.Interface) *Client {
+	return &Client{workClient: workClient}
+}
+
+// UpdateAppliedResources replaces the applied resources of the named AppliedWork with what mutate returns.
+// mutate is called with a copy of the latest applied resources, and again if the AppliedWork changed before its
+// update went through, so it must not have side effects. Nothing is written if mutate returns the same resources.
+func (c *Client) UpdateAppliedResources(ctx context.Context, name string,
+	mutate func([]workv1alpha1.AppliedResourceMeta) []workv1alpha1.AppliedResourceMeta) error {
+	appliedWorks := c.workClient.MulticlusterV1alpha1().AppliedWorks()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		appliedWork, err := appliedWorks.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current := appliedWork.DeepCopy().Status.AppliedResources
+		updated := mutate(current)
+		if reflect.DeepEqual(updated, appliedWork.Status.AppliedResources) {
+			return nil
+		}
+		now := metav1.Now()
+		appliedWork.Status.AppliedResources = updated
+		appliedWork.Status.AppliedResourceCount = len(updated)
+		appliedWork.Status.LastReconcileTime = &now
+		if _, err = appliedWorks.UpdateStatus(ctx, appliedWork, metav1.UpdateOptions{}); err != nil {
+			klog.V(3).InfoS("failed to update the applied resources", "appliedWork", name, "err", err)
+			return err
+		}
+		return nil
+	})
+}
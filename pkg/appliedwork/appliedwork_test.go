@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package appliedwork
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clienttesting "k8s.io/client-go/testing"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	fakeworkclient "sigs.k8s.io/work-api/pkg/client/clientset/versioned/fake"
+)
+
+func newResource(name string) workv1alpha1.AppliedResourceMeta {
+	return workv1alpha1.AppliedResourceMeta{ResourceIdentifier: workv1alpha1.ResourceIdentifier{
+		Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: name,
+	}}
+}
+
+func TestUpdateAppliedResourcesRetriesOnConflict(t *testing.T) {
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-a.work"},
+		Status: workv1alpha1.AppliedtWorkStatus{
+			AppliedResources: []workv1alpha1.AppliedResourceMeta{newResource("first")},
+		},
+	}
+	workClient := fakeworkclient.NewSimpleClientset(appliedWork)
+	conflicts := 1
+	updates := 0
+	workClient.PrependReactor("update", "appliedworks", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" {
+			t.Errorf("updated the appliedWork without the status subresource")
+		}
+		updates++
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "appliedworks"}, appliedWork.Name, nil)
+		}
+		return false, nil, nil
+	})
+
+	calls := 0
+	err := NewClient(workClient).UpdateAppliedResources(context.Background(), appliedWork.Name,
+		func(resources []workv1alpha1.AppliedResourceMeta) []workv1alpha1.AppliedResourceMeta {
+			calls++
+			return append(resources, newResource("second"))
+		})
+	if err != nil {
+		t.Fatalf("UpdateAppliedResources() error = %v", err)
+	}
+	if calls != 2 || updates != 2 {
+		t.Errorf("UpdateAppliedResources() mutated %d times and updated %d times, want 2 of each", calls, updates)
+	}
+
+	got, err := workClient.MulticlusterV1alpha1().AppliedWorks().Get(context.Background(), appliedWork.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the appliedWork: %v", err)
+	}
+	if len(got.Status.AppliedResources) != 2 || got.Status.AppliedResources[1].Name != "second" {
+		t.Errorf("applied resources = %+v, want first and second", got.Status.AppliedResources)
+	}
+}
+
+func TestUpdateAppliedResourcesSkipsNoop(t *testing.T) {
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-a.work"},
+		Status: workv1alpha1.AppliedtWorkStatus{
+			AppliedResources: []workv1alpha1.AppliedResourceMeta{newResource("first")},
+		},
+	}
+	workClient := fakeworkclient.NewSimpleClientset(appliedWork)
+	workClient.PrependReactor("update", "appliedworks", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		t.Errorf("updated the appliedWork although its resources didn't change")
+		return false, nil, nil
+	})
+
+	err := NewClient(workClient).UpdateAppliedResources(context.Background(), appliedWork.Name,
+		func(resources []workv1alpha1.AppliedResourceMeta) []workv1alpha1.AppliedResourceMeta {
+			return resources
+		})
+	if err != nil {
+		t.Fatalf("UpdateAppliedResources() error = %v", err)
+	}
+}
+
+func TestUpdateAppliedResourcesNotFound(t *testing.T) {
+	err := NewClient(fakeworkclient.NewSimpleClientset()).UpdateAppliedResources(context.Background(), "missing",
+		func(resources []workv1alpha1.AppliedResourceMeta) []workv1alpha1.AppliedResourceMeta {
+			t.Errorf("mutated the resources of a missing appliedWork")
+			return resources
+		})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("UpdateAppliedResources() error = %v, want not found", err)
+	}
+}
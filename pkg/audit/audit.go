@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records the apply and delete decisions the work controllers make on the spoke cluster
+// so that they can be retained long term, separately from metrics and events.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// Action is what the controller did to a resource.
+type Action string
+
+const (
+	// ActionApply means the resource was created or updated on the spoke cluster.
+	ActionApply Action = "Apply"
+	// ActionDelete means the resource was deleted from the spoke cluster.
+	ActionDelete Action = "Delete"
+)
+
+// Outcome is the result of an action.
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "Succeeded"
+	OutcomeFailed    Outcome = "Failed"
+)
+
+// Record is a single audited decision.
+type Record struct {
+	Timestamp     time.Time                       `json:"timestamp"`
+	WorkNamespace string                          `json:"workNamespace"`
+	WorkName      string                          `json:"workName"`
+	Resource      workv1alpha1.ResourceIdentifier `json:"resource"`
+	Action        Action                          `json:"action"`
+	Outcome       Outcome                         `json:"outcome"`
+	// Message explains why the action failed.
+	Message string `json:"message,omitempty"`
+}
+
+// Sink receives the audit records. Implementations must be safe for concurrent use.
+type Sink interface {
+	Record(record Record)
+}
+
+// jsonLinesSink writes each record as a line of JSON.
+type jsonLinesSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONLinesSink returns a sink that writes each record to w as a line of JSON.
+func NewJSONLinesSink(w io.Writer) Sink {
+	return &jsonLinesSink{encoder: json.NewEncoder(w)}
+}
+
+// Record writes the record, failures are logged since auditing must not block reconciling.
+func (s *jsonLinesSink) Record(record Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.encoder.Encode(record); err != nil {
+		klog.ErrorS(err, "failed to write an audit record", "work", record.WorkName, "namespace", record.WorkNamespace)
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// NewFileSink returns a sink that appends JSON lines to the file at path, "-" writes them to stdout.
+// The returned closer closes the file.
+func NewFileSink(path string) (Sink, io.Closer, error) {
+	if path == "-" {
+		return NewJSONLinesSink(os.Stdout), nopCloser{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewJSONLinesSink(file), file, nil
+}
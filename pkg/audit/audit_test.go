@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	timestamp := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	resource := workv1alpha1.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "config"}
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	sink.Record(Record{Timestamp: timestamp, WorkNamespace: "cluster-a", WorkName: "work", Resource: resource,
+		Action: ActionApply, Outcome: OutcomeSucceeded})
+	sink.Record(Record{Timestamp: timestamp, WorkNamespace: "cluster-a", WorkName: "work", Resource: resource,
+		Action: ActionDelete, Outcome: OutcomeFailed, Message: "forbidden"})
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("NewJSONLinesSink() wrote %q, want two lines", buf.String())
+	}
+	// a succeeded record leaves the message out
+	want := `{"timestamp":"2021-09-01T12:00:00Z","workNamespace":"cluster-a","workName":"work",` +
+		`"resource":{"version":"v1","kind":"ConfigMap","resource":"configmaps","namespace":"default","name":"config"},` +
+		`"action":"Apply","outcome":"Succeeded"}`
+	if lines[0] != want {
+		t.Errorf("first line = %s, want %s", lines[0], want)
+	}
+	var got Record
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatalf("failed to decode the second line %q: %v", lines[1], err)
+	}
+	if got.Action != ActionDelete || got.Outcome != OutcomeFailed || got.Message != "forbidden" || got.Resource != resource {
+		t.Errorf("second record = %+v, want the failed delete of the config map", got)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestJSONLinesSinkWriteError(t *testing.T) {
+	// a failed write is only logged, it must not stop the controller
+	NewJSONLinesSink(failingWriter{}).Record(Record{WorkNamespace: "cluster-a", WorkName: "work", Action: ActionApply})
+}
+
+func TestNewFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, workName := range []string{"first", "second"} {
+		sink, closer, err := NewFileSink(path)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+		sink.Record(Record{WorkNamespace: "cluster-a", WorkName: workName, Action: ActionApply, Outcome: OutcomeSucceeded})
+		if err := closer.Close(); err != nil {
+			t.Fatalf("failed to close the audit log: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the audit log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"workName":"first"`) || !strings.Contains(lines[1], `"workName":"second"`) {
+		t.Errorf("audit log = %q, want the records appended in order", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat the audit log: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", perm)
+	}
+}
+
+func TestNewFileSinkErrors(t *testing.T) {
+	if _, _, err := NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Errorf("NewFileSink() succeeded, want an error for a directory that doesn't exist")
+	}
+	sink, closer, err := NewFileSink("-")
+	if err != nil || sink == nil {
+		t.Fatalf("NewFileSink(-) = %v, %v, want a sink writing to stdout", sink, err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Errorf("closing the stdout sink error = %v, want none", err)
+	}
+}
@@ -18,25 +18,41 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
 )
 
+// defaultAppliedWorkResyncPeriod is how often we check that the resources of an appliedWork still exist by default.
+const defaultAppliedWorkResyncPeriod = time.Minute
+
 // AppliedWorkReconciler reconciles an AppliedWork object
 type AppliedWorkReconciler struct {
 	appliedResourceTracker
+	// clusterNameSpace is the hub namespace of the works of our spoke cluster, the appliedWorks created by older
+	// versions that don't record the namespace of their work are mapped to it
 	clusterNameSpace string
+	// resyncPeriod is how often we check that the resources of an appliedWork still exist
+	resyncPeriod time.Duration
+	// triggers makes the work controller re-apply a work whose resources were deleted behind our back, it can be nil
+	triggers chan<- event.GenericEvent
+	// watcher watches the kinds of the applied resources for out-of-band changes, it can be nil
+	watcher *appliedResourceWatcher
+	// clusterName is the name of the spoke cluster, it tells our controller apart from those of the other spoke clusters
+	clusterName string
 }
 
 func newAppliedWorkReconciler(clusterNameSpace string, hubClient client.Client, spokeClient client.Client,
@@ -49,15 +65,36 @@ func newAppliedWorkReconciler(clusterNameSpace string, hubClient client.Client,
 			restMapper:         restMapper,
 		},
 		clusterNameSpace: clusterNameSpace,
+		resyncPeriod:     defaultAppliedWorkResyncPeriod,
 	}
 }
 
 // Reconcile implement the control loop logic for AppliedWork object.
 func (r *AppliedWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	klog.InfoS("applied work reconcile loop triggered", "item", req.NamespacedName)
-	nsWorkName := req.NamespacedName
-	nsWorkName.Namespace = r.clusterNameSpace
-	_, appliedWork, err := r.fetchWorks(ctx, nsWorkName)
+	klog.InfoS("applied work reconcile loop triggered", workKeys(req.Namespace, req.Name)...)
+	appliedWork := &workapi.AppliedWork{}
+	err := r.spokeClient.Get(ctx, req.NamespacedName, appliedWork)
+	switch {
+	case errors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	case err != nil:
+		return ctrl.Result{}, err
+	}
+	if len(appliedWork.Spec.WorkNamespace) == 0 {
+		if err = r.mapToClusterNamespace(ctx, appliedWork); err != nil || len(appliedWork.Spec.WorkNamespace) == 0 {
+			return ctrl.Result{}, err
+		}
+	}
+	// the appliedWork name is derived from the work so we look up the work through its spec
+	nsWorkName := types.NamespacedName{Namespace: appliedWork.Spec.WorkNamespace, Name: appliedWork.Spec.WorkName}
+	if !hasExpectedName(appliedWork) {
+		return ctrl.Result{}, r.repairMisnamedAppliedWork(ctx, appliedWork, nsWorkName)
+	}
+	if r.watcher != nil {
+		r.watcher.watch(appliedWork.Status.AppliedResources)
+	}
+	var work *workapi.Work
+	work, appliedWork, err = r.fetchWorks(ctx, nsWorkName)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -66,22 +103,51 @@ func (r *AppliedWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	_, err = r.collectDisappearedWorks(ctx, appliedWork)
+	// the resources of a paused work are left alone, they are checked again once it is resumed
+	if work != nil && work.Spec.Paused {
+		return ctrl.Result{RequeueAfter: r.resyncPeriod}, nil
+	}
+
+	disappeared, recreated, err := r.collectDisappearedWorks(ctx, appliedWork)
 	if err != nil {
-		klog.ErrorS(err, "failed to delete all the stale work", "work", req.NamespacedName)
+		klog.ErrorS(err, "failed to delete all the stale work", workKeys(req.Namespace, req.Name)...)
 		// we can't proceed to update the applied
 		return ctrl.Result{}, err
 	}
+	// the resources deleted or recreated out-of-band are restored by re-applying their manifests
+	if changed := stillInWork(work, append(disappeared, recreated...)); len(changed) != 0 {
+		r.triggerReapply(work, changed)
+	}
 
 	// we want to periodically check if what we've applied matches what is recorded
-	return ctrl.Result{RequeueAfter: time.Minute}, nil
+	return ctrl.Result{RequeueAfter: r.resyncPeriod}, nil
 }
 
-// collectDisappearedWorks returns the list of resource that does not exist in the appliedWork
-func (r *AppliedWorkReconciler) collectDisappearedWorks(
-	ctx context.Context, appliedWork *workapi.AppliedWork) ([]workapi.AppliedResourceMeta, error) {
+// mapToClusterNamespace records the cluster namespace as the namespace of the work of an appliedWork created by an
+// older version that doesn't have one, so that the appliedWork is found when its work is looked up by its namespace.
+// The appliedWork is left alone if no cluster namespace is configured.
+func (r *AppliedWorkReconciler) mapToClusterNamespace(ctx context.Context, appliedWork *workapi.AppliedWork) error {
+	if len(r.clusterNameSpace) == 0 {
+		klog.ErrorS(fmt.Errorf("appliedWork %s doesn't record the namespace of its work", appliedWork.Name),
+			"can't map an appliedWork to its work without a cluster namespace", "appliedWork", appliedWork.Name, "work", appliedWork.Spec.WorkName)
+		return nil
+	}
+	appliedWork.Spec.WorkNamespace = r.clusterNameSpace
+	if err := r.spokeClient.Update(ctx, appliedWork, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "failed to record the namespace of the work of an appliedWork",
+			workKeys(r.clusterNameSpace, appliedWork.Spec.WorkName, "appliedWork", appliedWork.Name)...)
+		return err
+	}
+	klog.InfoS("mapped an appliedWork to the cluster namespace", workKeys(r.clusterNameSpace, appliedWork.Spec.WorkName, "appliedWork", appliedWork.Name)...)
+	return nil
+}
+
+// collectDisappearedWorks returns the list of resource that does not exist in the appliedWork, and the list of those
+// recreated with another UID than the one recorded. The new UIDs are recorded in the appliedWork.
+func (r *AppliedWorkReconciler) collectDisappearedWorks(ctx context.Context,
+	appliedWork *workapi.AppliedWork) ([]workapi.AppliedResourceMeta, []workapi.AppliedResourceMeta, error) {
 	var errs []error
-	var disappearedWorks, newRes []workapi.AppliedResourceMeta
+	var disappearedWorks, recreatedWorks, newRes []workapi.AppliedResourceMeta
 	workUIDChanged := false
 	for _, resourceMeta := range appliedWork.Status.AppliedResources {
 		gvr := schema.GroupVersionResource{
@@ -92,21 +158,22 @@ func (r *AppliedWorkReconciler) collectDisappearedWorks(
 		obj, err := r.spokeDynamicClient.Resource(gvr).Namespace(resourceMeta.Namespace).Get(ctx, resourceMeta.Name, metav1.GetOptions{})
 		if err != nil {
 			if errors.IsNotFound(err) {
-				klog.InfoS("found a disappeared work", "work", resourceMeta)
+				klog.InfoS("found a disappeared resource", "appliedWork", appliedWork.Name, "resource", resourceMeta)
 				disappearedWorks = append(disappearedWorks, resourceMeta)
 			} else {
-				klog.ErrorS(err, "failed to get a work", "work", resourceMeta)
+				klog.ErrorS(err, "failed to get an applied resource", "appliedWork", appliedWork.Name, "resource", resourceMeta)
 				errs = append(errs, err)
 			}
 		} else {
 			if resourceMeta.UID != obj.GetUID() {
 				workUIDChanged = true
 				if len(resourceMeta.UID) != 0 {
-					klog.InfoS("found a re-created work", "work",
-						resourceMeta, "old UID", resourceMeta.UID, "new UID", obj.GetUID())
+					klog.InfoS("found a re-created resource", "appliedWork", appliedWork.Name,
+						"resource", resourceMeta, "old UID", resourceMeta.UID, "new UID", obj.GetUID())
+					recreatedWorks = append(recreatedWorks, resourceMeta)
 				} else {
-					klog.InfoS("attach to a newly created work", "work",
-						resourceMeta, "new UID", obj.GetUID())
+					klog.InfoS("attach to a newly created resource", "appliedWork", appliedWork.Name,
+						"resource", resourceMeta, "new UID", obj.GetUID())
 				}
 			}
 			// set the UID back
@@ -117,18 +184,139 @@ func (r *AppliedWorkReconciler) collectDisappearedWorks(
 
 	if workUIDChanged && len(errs) == 0 {
 		appliedWork.Status.AppliedResources = newRes
-		klog.InfoS("Update an appliedWork status with new object UID", "work", appliedWork.GetName())
+		klog.InfoS("Update an appliedWork status with new object UID", "appliedWork", appliedWork.GetName())
+		summarizeAppliedResources(appliedWork)
 		if err := r.spokeClient.Status().Update(ctx, appliedWork, &client.UpdateOptions{}); err != nil {
 			klog.ErrorS(err, "update appliedWork status failed", "appliedWork", appliedWork.GetName())
-			return disappearedWorks, err
+			return disappearedWorks, recreatedWorks, err
 		}
 	}
 
-	return disappearedWorks, utilerrors.NewAggregate(errs)
+	return disappearedWorks, recreatedWorks, utilerrors.NewAggregate(errs)
+
+}
 
+// repairMisnamedAppliedWork moves the resources tracked by an appliedWork that is not named after its work to an
+// appliedWork that is, and deletes the misnamed one once it no longer owns anything.
+// Nothing looks up the misnamed appliedWork so the resources it owns would otherwise never be updated or cleaned up.
+func (r *AppliedWorkReconciler) repairMisnamedAppliedWork(ctx context.Context, misnamed *workapi.AppliedWork,
+	nsWorkName types.NamespacedName) error {
+	expectedName := appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)
+	klog.ErrorS(fmt.Errorf("appliedWork %s is not named after work %s", misnamed.Name, nsWorkName),
+		"found a misnamed appliedWork", workKeys(nsWorkName.Namespace, nsWorkName.Name, "appliedWork", misnamed.Name, "expected", expectedName)...)
+
+	work := &workapi.Work{}
+	if err := r.hubClient.Get(ctx, nsWorkName, work); err != nil {
+		if errors.IsNotFound(err) {
+			// deleting it would delete the resources it owns, we leave that decision to the admin
+			klog.InfoS("the work of the misnamed appliedWork is gone, leave it alone",
+				workKeys(nsWorkName.Namespace, nsWorkName.Name, "appliedWork", misnamed.Name)...)
+			return nil
+		}
+		return err
+	}
+
+	expected, err := r.ensureAppliedWork(ctx, expectedName, nsWorkName)
+	if err != nil {
+		r.reportAppliedWorkMismatch(ctx, work, metav1.ConditionTrue, ReasonAppliedWorkMisnamed,
+			fmt.Sprintf("AppliedWork %s is not named after the work and can't be replaced by %s: %v", misnamed.Name, expectedName, err))
+		return err
+	}
+	if err := r.transferAppliedResources(ctx, misnamed, expected, misnamed.Status.AppliedResources); err != nil {
+		r.reportAppliedWorkMismatch(ctx, work, metav1.ConditionTrue, ReasonAppliedWorkMisnamed,
+			fmt.Sprintf("AppliedWork %s is not named after the work, failed to move its resources to %s: %v", misnamed.Name, expectedName, err))
+		return err
+	}
+	if err := r.spokeClient.Delete(ctx, misnamed); err != nil && !errors.IsNotFound(err) {
+		klog.ErrorS(err, "failed to delete the misnamed appliedWork", "appliedWork", misnamed.Name)
+		return err
+	}
+	klog.InfoS("replaced a misnamed appliedWork", "appliedWork", misnamed.Name, "replacement", expectedName)
+	r.reportAppliedWorkMismatch(ctx, work, metav1.ConditionFalse, ReasonAppliedWorkRecreated,
+		fmt.Sprintf("AppliedWork %s was not named after the work, it was replaced by %s", misnamed.Name, expectedName))
+	return nil
+}
+
+// ensureAppliedWork gets the appliedWork with the given name, creating it if it doesn't exist.
+// It fails if the appliedWork tracks another work.
+func (r *AppliedWorkReconciler) ensureAppliedWork(ctx context.Context, name string,
+	nsWorkName types.NamespacedName) (*workapi.AppliedWork, error) {
+	appliedWork := &workapi.AppliedWork{}
+	err := r.spokeClient.Get(ctx, types.NamespacedName{Name: name}, appliedWork)
+	switch {
+	case errors.IsNotFound(err):
+		appliedWork = &workapi.AppliedWork{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: workapi.AppliedWorkSpec{
+				WorkName:      nsWorkName.Name,
+				WorkNamespace: nsWorkName.Namespace,
+			},
+		}
+		if err := r.spokeClient.Create(ctx, appliedWork); err != nil {
+			return nil, err
+		}
+		klog.InfoS("created the appliedWork to replace a misnamed one", "appliedWork", name)
+		return appliedWork, nil
+	case err != nil:
+		return nil, err
+	}
+	if !isAppliedWorkOf(appliedWork, nsWorkName) {
+		return nil, fmt.Errorf("appliedWork %s already exists for work %s/%s", name,
+			appliedWork.Spec.WorkNamespace, appliedWork.Spec.WorkName)
+	}
+	return appliedWork, nil
+}
+
+// reportAppliedWorkMismatch records on the work whether its appliedWork on the spoke cluster had to be repaired.
+func (r *AppliedWorkReconciler) reportAppliedWorkMismatch(ctx context.Context, work *workapi.Work,
+	status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeAppliedWorkMismatch,
+		Status:             status,
+		ObservedGeneration: work.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	if err := r.hubClient.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "update work status failed", workKeys(work.Namespace, work.Name)...)
+	}
+}
+
+// stillInWork returns the resources that the work still has a manifest for.
+func stillInWork(work *workapi.Work, resources []workapi.AppliedResourceMeta) []workapi.AppliedResourceMeta {
+	var inWork []workapi.AppliedResourceMeta
+	for _, resourceMeta := range resources {
+		for _, manifestCond := range work.Status.ManifestConditions {
+			if isSameResource(resourceMeta, manifestCond.Identifier) {
+				inWork = append(inWork, resourceMeta)
+				break
+			}
+		}
+	}
+	return inWork
+}
+
+// triggerReapply asks the work controller to re-apply the work so that its resources deleted or recreated out-of-band
+// match their manifests again. We never block on the work controller, the resources are still off at the next resync
+// if the trigger is dropped.
+func (r *AppliedWorkReconciler) triggerReapply(work *workapi.Work, changed []workapi.AppliedResourceMeta) {
+	if r.triggers == nil {
+		klog.V(logLevelDebug).InfoS("the resources of the work were deleted or recreated out-of-band, they are restored when the work is applied again",
+			workKeys(work.Namespace, work.Name, "changed", len(changed))...)
+		return
+	}
+	select {
+	case r.triggers <- event.GenericEvent{Object: work}:
+		klog.InfoS("re-apply the work to restore the resources deleted or recreated out-of-band",
+			workKeys(work.Namespace, work.Name, "changed", len(changed))...)
+	default:
+		klog.V(logLevelDebug).InfoS("too many pending reconciles, re-apply the work at the next resync",
+			workKeys(work.Namespace, work.Name)...)
+	}
 }
 
 // SetupWithManager wires up the controller.
 func (r *AppliedWorkReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).For(&workapi.AppliedWork{}).Complete(r)
+	return ctrl.NewControllerManagedBy(mgr).Named(controllerName("appliedwork", r.clusterName)).
+		For(&workapi.AppliedWork{}).Complete(r)
 }
@@ -0,0 +1,294 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestHasExpectedName(t *testing.T) {
+	spec := workv1alpha1.AppliedWorkSpec{WorkNamespace: "cluster-a", WorkName: "work"}
+	tests := map[string]struct {
+		name string
+		want bool
+	}{
+		"named after the work namespace and name": {
+			name: "cluster-a.work",
+			want: true,
+		},
+		"legacy name": {
+			name: "work",
+			want: true,
+		},
+		"named after another work": {
+			name: "cluster-a.other",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			appliedWork := &workv1alpha1.AppliedWork{ObjectMeta: metav1.ObjectMeta{Name: tt.name}, Spec: spec}
+			if got := hasExpectedName(appliedWork); got != tt.want {
+				t.Errorf("hasExpectedName(%s) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppliedWorkReconcilerRepairsMisnamedAppliedWork(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	misnamed := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "misnamed", UID: "misnamed-uid"},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+		Status: workv1alpha1.AppliedtWorkStatus{
+			AppliedResources: []workv1alpha1.AppliedResourceMeta{{
+				ResourceIdentifier: workv1alpha1.ResourceIdentifier{
+					Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "config",
+				},
+			}},
+		},
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	configMap.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: workv1alpha1.GroupVersion.String(), Kind: "AppliedWork", Name: misnamed.Name, UID: misnamed.UID,
+	}})
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name}}
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(misnamed).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	r := newAppliedWorkReconciler(nsWorkName.Namespace, hubClient, spokeClient, dynamicClient, newTestRESTMapper())
+
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Name: misnamed.Name}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	ctx := context.Background()
+	if err := spokeClient.Get(ctx, types.NamespacedName{Name: misnamed.Name}, &workv1alpha1.AppliedWork{}); !errors.IsNotFound(err) {
+		t.Errorf("get the misnamed appliedWork error = %v, want it deleted", err)
+	}
+	expected := &workv1alpha1.AppliedWork{}
+	expectedName := appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)
+	if err := spokeClient.Get(ctx, types.NamespacedName{Name: expectedName}, expected); err != nil {
+		t.Fatalf("failed to get the replacement appliedWork: %v", err)
+	}
+	if !isAppliedWorkOf(expected, nsWorkName) {
+		t.Errorf("replacement appliedWork spec = %+v, want it to track %s", expected.Spec, nsWorkName)
+	}
+	if len(expected.Status.AppliedResources) != 1 || expected.Status.AppliedResources[0].Name != "config" {
+		t.Errorf("replacement appliedWork resources = %+v, want the config map", expected.Status.AppliedResources)
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	got, err := dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the config map: %v", err)
+	}
+	owners := got.GetOwnerReferences()
+	if len(owners) != 1 || owners[0].Name != expectedName {
+		t.Errorf("config map owner references = %+v, want only the replacement appliedWork", owners)
+	}
+
+	gotWork := &workv1alpha1.Work{}
+	if err := hubClient.Get(ctx, nsWorkName, gotWork); err != nil {
+		t.Fatalf("failed to get the work: %v", err)
+	}
+	cond := meta.FindStatusCondition(gotWork.Status.Conditions, ConditionTypeAppliedWorkMismatch)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonAppliedWorkRecreated {
+		t.Errorf("work mismatch condition = %+v, want the appliedWork recreated", cond)
+	}
+}
+
+func TestAppliedWorkReconcilerResyncPeriod(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name}}
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build()
+	r := newAppliedWorkReconciler(nsWorkName.Namespace, hubClient, spokeClient,
+		fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), newTestRESTMapper())
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: appliedWork.Name}}
+
+	got, err := r.Reconcile(context.Background(), req)
+	if err != nil || got.RequeueAfter != defaultAppliedWorkResyncPeriod {
+		t.Errorf("Reconcile() = %+v, %v, want a requeue after the default %v", got, err, defaultAppliedWorkResyncPeriod)
+	}
+
+	r.resyncPeriod = 10 * time.Minute
+	got, err = r.Reconcile(context.Background(), req)
+	if err != nil || got.RequeueAfter != 10*time.Minute {
+		t.Errorf("Reconcile() = %+v, %v, want a requeue after %v", got, err, 10*time.Minute)
+	}
+}
+
+func TestAppliedWorkReconcilerReappliesRecreatedResource(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	identifier := workv1alpha1.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "config"}
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+		Status: workv1alpha1.AppliedtWorkStatus{
+			AppliedResources: []workv1alpha1.AppliedResourceMeta{{ResourceIdentifier: identifier}},
+		},
+	}
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name},
+		Status:     workv1alpha1.WorkStatus{ManifestConditions: []workv1alpha1.ManifestCondition{{Identifier: identifier}}},
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	configMap.SetUID("first-uid")
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	triggers := make(chan event.GenericEvent, 1)
+	r := newAppliedWorkReconciler(nsWorkName.Namespace, hubClient, spokeClient, dynamicClient, newTestRESTMapper())
+	r.triggers = triggers
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: appliedWork.Name}}
+	recordedUID := func() types.UID {
+		got := &workv1alpha1.AppliedWork{}
+		if err := spokeClient.Get(ctx, req.NamespacedName, got); err != nil {
+			t.Fatalf("failed to get the appliedWork: %v", err)
+		}
+		return got.Status.AppliedResources[0].UID
+	}
+
+	// a resource tracked without its UID is not recreated, we only record its UID
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if uid := recordedUID(); uid != "first-uid" {
+		t.Errorf("recorded UID = %q, want first-uid", uid)
+	}
+	if len(triggers) != 0 {
+		t.Errorf("the work is re-applied while its resource was not recreated")
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if err := dynamicClient.Resource(gvr).Namespace("default").Delete(ctx, "config", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete the config map: %v", err)
+	}
+	configMap.SetUID("second-uid")
+	if _, err := dynamicClient.Resource(gvr).Namespace("default").Create(ctx, configMap, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to recreate the config map: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if uid := recordedUID(); uid != "second-uid" {
+		t.Errorf("recorded UID = %q, want second-uid", uid)
+	}
+	select {
+	case trigger := <-triggers:
+		if trigger.Object.GetName() != nsWorkName.Name {
+			t.Errorf("re-applied work %s, want %s", trigger.Object.GetName(), nsWorkName.Name)
+		}
+	default:
+		t.Errorf("the work is not re-applied after its resource was recreated")
+	}
+}
+
+func TestAppliedWorkReconcilerMapsLegacyAppliedWork(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"}}
+
+	tests := map[string]struct {
+		clusterNamespace string
+		wantNamespace    string
+		wantRequeue      bool
+	}{
+		"mapped to the cluster namespace":        {clusterNamespace: "cluster-a", wantNamespace: "cluster-a", wantRequeue: true},
+		"left alone without a cluster namespace": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// created by an older version, named after the work without recording its namespace
+			legacy := &workv1alpha1.AppliedWork{
+				ObjectMeta: metav1.ObjectMeta{Name: "work"},
+				Spec:       workv1alpha1.AppliedWorkSpec{WorkName: "work"},
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work.DeepCopy()).Build()
+			spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(legacy).Build()
+			r := newAppliedWorkReconciler(tt.clusterNamespace, hubClient, spokeClient,
+				fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), newTestRESTMapper())
+
+			ctx := context.Background()
+			got, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: legacy.Name}})
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if gotRequeue := got.RequeueAfter != 0; gotRequeue != tt.wantRequeue {
+				t.Errorf("Reconcile() = %+v, want a requeue %v", got, tt.wantRequeue)
+			}
+			gotAppliedWork := &workv1alpha1.AppliedWork{}
+			if err := spokeClient.Get(ctx, types.NamespacedName{Name: legacy.Name}, gotAppliedWork); err != nil {
+				t.Fatalf("failed to get the appliedWork: %v", err)
+			}
+			if gotAppliedWork.Spec.WorkNamespace != tt.wantNamespace {
+				t.Errorf("appliedWork work namespace = %q, want %q", gotAppliedWork.Spec.WorkNamespace, tt.wantNamespace)
+			}
+			if len(tt.wantNamespace) != 0 && !isAppliedWorkOf(gotAppliedWork, types.NamespacedName{Namespace: work.Namespace, Name: work.Name}) {
+				t.Errorf("appliedWork spec = %+v, want it to track %s/%s", gotAppliedWork.Spec, work.Namespace, work.Name)
+			}
+		})
+	}
+}
+
+func TestClusterNamespaceOf(t *testing.T) {
+	tests := map[string]struct {
+		watched, configured, want string
+	}{
+		"configured":                  {watched: "cluster-a", configured: "cluster-b", want: "cluster-b"},
+		"the watched namespace":       {watched: "cluster-a", want: "cluster-a"},
+		"all the namespaces watched":  {configured: "cluster-b", want: "cluster-b"},
+		"nothing to map the works to": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := clusterNamespaceOf(ctrl.Options{Namespace: tt.watched}, ControllerOptions{ClusterNamespace: tt.configured})
+			if got != tt.want {
+				t.Errorf("clusterNamespaceOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
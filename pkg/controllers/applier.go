@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// appliedWorkResource is the resource of the appliedWorks on the spoke cluster.
+var appliedWorkResource = workv1alpha1.SchemeGroupVersion.WithResource("appliedworks")
+
+// Applier applies the manifests of a work to a cluster in-process, without a manager or a hub cluster.
+// It runs the same apply engine as the work agent so that test frameworks and other controllers can embed it.
+type Applier struct {
+	reconciler *ApplyWorkReconciler
+	// RequireAvailable gates the Applied condition of the work on the availability of its manifests
+	RequireAvailable bool
+}
+
+// NewApplier creates an Applier that applies the manifests with the dynamic client and finds their
+// resources with the rest mapper.
+func NewApplier(dynamicClient dynamic.Interface, restMapper meta.RESTMapper) *Applier {
+	return &Applier{
+		reconciler: &ApplyWorkReconciler{
+			spokeDynamicClient:          dynamicClient,
+			restMapper:                  restMapper,
+			preservedAnnotationPrefixes: DefaultPreservedAnnotationPrefixes,
+		},
+	}
+}
+
+// Apply applies the manifests of the work to the cluster and returns the status the work agent would report for it.
+// The applied resources are owned by the appliedWork of the work, which Apply creates if it doesn't exist yet, so
+// deleting the appliedWork garbage collects them. The work itself is not modified, and the error aggregates the
+// manifests that failed to apply. A paused work is not applied, its status only gets the Paused condition, and
+// neither is a work waiting for an approval, its status lists the pending changes instead.
+// The workload of the work has to be inlined, a workload reference fails the apply.
+func (a *Applier) Apply(ctx context.Context, work *workv1alpha1.Work) (workv1alpha1.WorkStatus, error) {
+	work = work.DeepCopy()
+	if work.Spec.Paused {
+		meta.SetStatusCondition(&work.Status.Conditions, buildWorkPausedCondition(work.Generation))
+		return work.Status, nil
+	}
+	if work.Spec.WorkloadRef != nil {
+		// there is no hub cluster to read the referenced object from
+		return work.Status, fmt.Errorf("work %s/%s references its workload from %s %s, which can't be applied in-process",
+			work.Namespace, work.Name, work.Spec.WorkloadRef.Kind, work.Spec.WorkloadRef.Name)
+	}
+	owner, err := a.ensureAppliedWork(ctx, work)
+	if err != nil {
+		return work.Status, fmt.Errorf("failed to get the appliedWork of work %s/%s: %w", work.Namespace, work.Name, err)
+	}
+
+	reconciler := *a.reconciler
+	reconciler.requireAvailable = a.RequireAvailable
+	outcome, err := reconciler.applyWork(ctx, work, expandWorkload(work.Spec.Workload), owner, false)
+	if err != nil {
+		return work.Status, fmt.Errorf("failed to compute the pending changes of work %s/%s: %w", work.Namespace, work.Name, err)
+	}
+	if outcome.interrupted {
+		return work.Status, ctx.Err()
+	}
+	var errs []error
+	for _, result := range outcome.results {
+		if result.err != nil {
+			errs = append(errs, fmt.Errorf("failed to apply %s: %w", describeResource(result.identifier), redactApplyError(result.identifier, result.err)))
+		}
+	}
+	return work.Status, utilerrors.NewAggregate(errs)
+}
+
+// ensureAppliedWork gets or creates the appliedWork of the work and returns the owner reference to it.
+func (a *Applier) ensureAppliedWork(ctx context.Context, work *workv1alpha1.Work) (metav1.OwnerReference, error) {
+	name := appliedWorkName(work.Namespace, work.Name)
+	appliedWorks := a.reconciler.spokeDynamicClient.Resource(appliedWorkResource)
+	obj, err := appliedWorks.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		appliedWork := &workv1alpha1.AppliedWork{
+			TypeMeta:   metav1.TypeMeta{APIVersion: workv1alpha1.GroupVersion.String(), Kind: "AppliedWork"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: workv1alpha1.AppliedWorkSpec{
+				WorkName:      work.Name,
+				WorkNamespace: work.Namespace,
+			},
+		}
+		content, convertErr := runtime.DefaultUnstructuredConverter.ToUnstructured(appliedWork)
+		if convertErr != nil {
+			return metav1.OwnerReference{}, convertErr
+		}
+		obj, err = appliedWorks.Create(ctx, &unstructured.Unstructured{Object: content}, metav1.CreateOptions{})
+		if err == nil {
+			klog.V(logLevelDebug).InfoS("created the appliedWork of an in-process apply", "appliedWork", name)
+		}
+	}
+	if err != nil {
+		return metav1.OwnerReference{}, err
+	}
+	existing := &workv1alpha1.AppliedWork{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, existing); err != nil {
+		return metav1.OwnerReference{}, err
+	}
+	// the resources we apply would otherwise be owned, and garbage collected, along with another work
+	if !isAppliedWorkOf(existing, types.NamespacedName{Namespace: work.Namespace, Name: work.Name}) {
+		return metav1.OwnerReference{}, fmt.Errorf("appliedWork %s already exists for work %s/%s", name,
+			existing.Spec.WorkNamespace, existing.Spec.WorkName)
+	}
+	return metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+	}, nil
+}
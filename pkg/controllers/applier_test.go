@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestApplierApply(t *testing.T) {
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	applier := NewApplier(dynamicClient, newTestRESTMapper())
+	unknown := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work", Generation: 2},
+		Spec: workv1alpha1.WorkSpec{
+			Workload: workv1alpha1.WorkloadTemplate{
+				Manifests: []workv1alpha1.Manifest{
+					newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config")),
+					newTestManifest(t, unknown),
+				},
+			},
+		},
+	}
+
+	status, err := applier.Apply(context.Background(), work)
+	if err == nil {
+		t.Fatalf("Apply() error = nil, want the widget of an unknown kind to fail")
+	}
+	if len(status.ManifestConditions) != 2 {
+		t.Fatalf("Apply() returned %d manifest conditions, want 2", len(status.ManifestConditions))
+	}
+	if !meta.IsStatusConditionTrue(status.ManifestConditions[0].Conditions, ConditionTypeApplied) {
+		t.Errorf("Apply() conditions of the config map = %+v, want it applied", status.ManifestConditions[0].Conditions)
+	}
+	if !meta.IsStatusConditionFalse(status.ManifestConditions[1].Conditions, ConditionTypeApplied) {
+		t.Errorf("Apply() conditions of the widget = %+v, want it failed", status.ManifestConditions[1].Conditions)
+	}
+	cond := meta.FindStatusCondition(status.Conditions, ConditionTypeApplied)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.ObservedGeneration != 2 {
+		t.Errorf("Apply() work condition = %+v, want a failed apply of generation 2", cond)
+	}
+	if len(work.Status.ManifestConditions) != 0 {
+		t.Errorf("Apply() modified the status of the work: %+v", work.Status)
+	}
+
+	if _, err := dynamicClient.Resource(appliedWorkResource).Get(context.Background(), "cluster-a.work", metav1.GetOptions{}); err != nil {
+		t.Fatalf("Apply() didn't create the appliedWork: %v", err)
+	}
+	configMap, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).
+		Namespace("default").Get(context.Background(), "config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Apply() didn't create the config map: %v", err)
+	}
+	owners := configMap.GetOwnerReferences()
+	if len(owners) != 1 || owners[0].Kind != "AppliedWork" || owners[0].Name != "cluster-a.work" {
+		t.Errorf("config map owner references = %+v, want the appliedWork", owners)
+	}
+
+	// applying the work again reuses the appliedWork and leaves the config map as it is
+	work.Status = status
+	if _, err := applier.Apply(context.Background(), work); err == nil {
+		t.Errorf("Apply() again error = nil, want the widget to fail again")
+	}
+}
+
+func TestApplierApplyWaitsForApproval(t *testing.T) {
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	applier := NewApplier(dynamicClient, newTestRESTMapper())
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work", Generation: 2,
+			Annotations: map[string]string{RequireApprovalAnnotation: "true", ApprovedGenerationAnnotation: "1"}},
+		Spec: workv1alpha1.WorkSpec{
+			Workload: workv1alpha1.WorkloadTemplate{
+				Manifests: []workv1alpha1.Manifest{newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config"))},
+			},
+		},
+	}
+
+	status, err := applier.Apply(context.Background(), work)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(status.PendingChanges) != 1 || status.PendingChanges[0].Action != PendingChangeCreate {
+		t.Errorf("Apply() pending changes = %+v, want the config map to be created", status.PendingChanges)
+	}
+	if cond := meta.FindStatusCondition(status.Conditions, ConditionTypeApplied); cond == nil || cond.Reason != ReasonPendingApproval {
+		t.Errorf("Apply() work condition = %+v, want it pending approval", cond)
+	}
+	if _, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).
+		Namespace("default").Get(context.Background(), "config", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("get the config map error = %v, want it not applied before the approval", err)
+	}
+}
+
+func TestApplierApplyRollsBackAllOrNothing(t *testing.T) {
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	applier := NewApplier(dynamicClient, newTestRESTMapper())
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work", Generation: 1},
+		Spec: workv1alpha1.WorkSpec{
+			ApplyPolicy: workv1alpha1.ApplyPolicyAllOrNothing,
+			Workload: workv1alpha1.WorkloadTemplate{
+				Manifests: []workv1alpha1.Manifest{
+					newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config")),
+					{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion": "v1", "metadata": {"name": "no-kind"}}`)}},
+				},
+			},
+		},
+	}
+
+	status, err := applier.Apply(context.Background(), work)
+	if err == nil {
+		t.Fatalf("Apply() error = nil, want the manifest without a kind to fail")
+	}
+	if cond := meta.FindStatusCondition(status.ManifestConditions[0].Conditions, ConditionTypeApplied); cond == nil || cond.Reason != ReasonRolledBack {
+		t.Errorf("Apply() condition of the config map = %+v, want it rolled back", cond)
+	}
+	if _, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).
+		Namespace("default").Get(context.Background(), "config", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("get the config map error = %v, want it rolled back", err)
+	}
+}
+
+func TestApplierApplyRefusesAppliedWorkOfAnotherWork(t *testing.T) {
+	other := &unstructured.Unstructured{}
+	other.SetAPIVersion(workv1alpha1.GroupVersion.String())
+	other.SetKind("AppliedWork")
+	other.SetName("cluster-a.work")
+	other.Object["spec"] = map[string]interface{}{"workNamespace": "cluster-b", "workName": "work"}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), other)
+	applier := NewApplier(dynamicClient, newTestRESTMapper())
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+		Spec: workv1alpha1.WorkSpec{
+			Workload: workv1alpha1.WorkloadTemplate{
+				Manifests: []workv1alpha1.Manifest{newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config"))},
+			},
+		},
+	}
+
+	if _, err := applier.Apply(context.Background(), work); err == nil {
+		t.Fatalf("Apply() error = nil, want the appliedWork of another work to be refused")
+	}
+	if _, err := dynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).
+		Namespace("default").Get(context.Background(), "config", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("get the config map error = %v, want nothing applied", err)
+	}
+}
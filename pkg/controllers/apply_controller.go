@@ -21,9 +21,13 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,16 +35,24 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
+	"sigs.k8s.io/work-api/pkg/overlay"
 )
 
 // ApplyWorkReconciler reconciles a Work object
@@ -50,23 +62,120 @@ type ApplyWorkReconciler struct {
 	spokeClient        client.Client
 	log                logr.Logger
 	restMapper         meta.RESTMapper
+	// listMapKeys finds the keys the lists of the custom resources are merged by, it can be nil
+	listMapKeys *listMapKeyResolver
+	// resourceTypes tells whether the spoke cluster serves the kinds that don't map, it can be nil
+	resourceTypes *resourceTypeChecker
+	// stabilizationWindow is how long a work has to stay unchanged before we apply it
+	stabilizationWindow time.Duration
+	// requireAvailable gates the Applied condition of the work on the availability of its manifests
+	requireAvailable bool
+	// forceReapplyInterval is how often we re-apply all the manifests even if they didn't change
+	forceReapplyInterval time.Duration
+	// resyncPeriod is how often we check the applied resources for out-of-band edits, zero disables the checks
+	resyncPeriod time.Duration
+	// watchAppliedResources checks the applied resources for out-of-band edits when their changes trigger a reconcile
+	watchAppliedResources bool
+	// auditSink receives a record of every apply we make, it can be nil
+	auditSink audit.Sink
+	// backoff decides when to retry a work that failed to apply
+	backoff *workBackoff
+	// transientBackoff decides when to retry a work whose manifests failed for a transient reason
+	transientBackoff *workBackoff
+	// applyTimeout is how long we wait for a manifest to be applied, zero means no timeout
+	applyTimeout time.Duration
+	// applyTimeoutByKind overrides applyTimeout for some kinds, keyed by kind or kind.group
+	applyTimeoutByKind map[string]time.Duration
+	// maxObjectSize is the largest serialized size of an object we apply, zero means no limit
+	maxObjectSize int
+	// applyModeByKind is the apply mode of the kinds whose work doesn't pick one, keyed by kind or kind.group
+	applyModeByKind map[string]string
+	// triggers receives the works to reconcile right away, it can be nil
+	triggers <-chan event.GenericEvent
+	// recorder emits the events of the applied manifests on the work
+	recorder record.EventRecorder
+	// instanceID identifies this controller instance on the resources we apply, it can be empty
+	instanceID string
+	// fieldManager is the field manager we write the manifests with unless their work picks one, empty means the default
+	fieldManager string
+	// clusterName is the name of the spoke cluster, the overlays of the works can be limited to some clusters
+	clusterName string
+	// propagatedLabels and propagatedAnnotations are set on every object we apply, their values can reference the variables
+	propagatedLabels      map[string]string
+	propagatedAnnotations map[string]string
+	// preservedAnnotationPrefixes are the prefixes of the annotations set by others that our updates keep
+	preservedAnnotationPrefixes []string
+	// workFilter only lets the works applied to our spoke cluster through, it can be nil
+	workFilter predicate.Predicate
+	// maxConcurrentReconciles is how many works we apply at once, zero applies one at a time
+	maxConcurrentReconciles int
+}
+
+// maxLastErrorLength is the maximum length of the last error message we record in the work status.
+const maxLastErrorLength = 1024
+
+// maxReconcileHistory is the maximum number of apply outcomes we keep in the history of the work status.
+const maxReconcileHistory = 10
+
+// interruptedStatusTimeout is how long we try to mark a work as interrupted when the controller shuts down.
+const interruptedStatusTimeout = 5 * time.Second
+
+// transientRetryInterval is how soon we first retry the manifests that failed for a transient reason,
+// e.g. their kind is not known to the spoke cluster yet or the spoke cluster was too slow to apply them.
+// The retries back off up to transientRetryMaxInterval while the failures last.
+const (
+	transientRetryInterval    = 5 * time.Second
+	transientRetryMaxInterval = 5 * time.Minute
+)
+
+// availabilityRequeueInterval is how often we check the availability of a work that is applied but not available yet.
+const availabilityRequeueInterval = 10 * time.Second
+
+// applyAction is how a manifest was written to the spoke cluster.
+type applyAction struct {
+	// strategy is the apply strategy the manifest was written with, empty if it didn't need to be written
+	strategy string
+	// conflictsForced is set if server side apply took over the fields owned by other field managers
+	conflictsForced bool
+	// created is set if the resource didn't exist on the spoke cluster before
+	created bool
+	// driftCorrected is set if the resource was edited out-of-band and we re-applied the manifest over it
+	driftCorrected bool
+	// createOnlySkipped is set if the manifest is only applied to create its resource and the resource exists
+	createOnlySkipped bool
 }
 
 type applyResult struct {
-	identifier workv1alpha1.ResourceIdentifier
-	generation int64
-	updated    bool
-	err        error
+	identifier      workv1alpha1.ResourceIdentifier
+	generation      int64
+	uid             types.UID
+	updated         bool
+	action          applyAction
+	available       bool
+	availableMsg    string
+	kindUnavailable bool
+	// paused is set if the manifest is frozen by the paused annotation and was skipped
+	paused bool
+	// hash is the spec hash of the manifest we applied, it is set on the resource as the spec hash annotation
+	hash string
+	// scopeReason and scopeMessage tell how we changed the namespace of the manifest to fit the scope of its kind
+	scopeReason  string
+	scopeMessage string
+	err          error
 }
 
 // Reconcile implement the control loop logic for Work object.
 func (r *ApplyWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	klog.InfoS("work reconcile loop triggered", "item", req.NamespacedName)
+	klog.InfoS("work reconcile loop triggered", workKeys(req.Namespace, req.Name)...)
 
 	work := &workv1alpha1.Work{}
 	err := r.client.Get(ctx, req.NamespacedName, work)
 	switch {
 	case apierrors.IsNotFound(err):
+		r.backoff.reset(req.NamespacedName)
+		if r.transientBackoff != nil {
+			r.transientBackoff.reset(req.NamespacedName)
+		}
 		return ctrl.Result{}, nil
 	case err != nil:
 		return ctrl.Result{}, err
@@ -75,15 +184,36 @@ func (r *ApplyWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	// do nothing if the finalizer is not present
 	// it ensures all maintained resources will be cleaned once work is deleted
 	if !controllerutil.ContainsFinalizer(work, workFinalizer) {
-		klog.InfoS("the work has no finalizer yet, the work finalizer will create it", "item", req.NamespacedName)
+		klog.InfoS("the work has no finalizer yet, the work finalizer will create it", workKeys(req.Namespace, req.Name)...)
 		return ctrl.Result{}, nil
 	}
 
+	// a paused work keeps whatever is applied until it is resumed
+	if work.Spec.Paused {
+		return ctrl.Result{}, r.markPaused(ctx, work)
+	}
+
+	// coalesce rapid edits of the work by waiting until it stops changing for the stabilization window
+	if remaining, changed := r.checkStabilization(work); remaining > 0 {
+		klog.V(logLevelDebug).InfoS("the work is still stabilizing, wait before applying it", workKeys(req.Namespace, req.Name, "remaining", remaining)...)
+		// the requeues within the window have nothing new to record
+		if changed {
+			if err := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+				klog.ErrorS(err, "update work status failed", workKeys(req.Namespace, req.Name)...)
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
 	// we created the AppliedWork before setting the finalizer so it should exist
-	appliedWork := &workv1alpha1.AppliedWork{}
-	if err := r.spokeClient.Get(ctx, types.NamespacedName{Name: req.Name}, appliedWork); err != nil {
-		klog.ErrorS(err, "failed to get the appliedWork", "name", req.Name)
-		return ctrl.Result{}, errors.Wrap(err, fmt.Sprintf("failed to get the appliedWork %s", req.Name))
+	appliedWork, err := fetchAppliedWork(ctx, r.spokeClient, req.NamespacedName)
+	if err != nil {
+		klog.ErrorS(err, "failed to get the appliedWork", workKeys(req.Namespace, req.Name)...)
+		if isRetryableAPIError(err) {
+			return ctrl.Result{RequeueAfter: r.retryDelay(req.NamespacedName, work.Generation, []error{err})}, nil
+		}
+		return ctrl.Result{}, errors.Wrap(err, fmt.Sprintf("failed to get the appliedWork of work %s", req.NamespacedName))
 	}
 
 	owner := metav1.OwnerReference{
@@ -93,180 +223,1032 @@ func (r *ApplyWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		UID:        appliedWork.GetUID(),
 	}
 
-	results := r.applyManifests(work.Spec.Workload.Manifests, work.Status.ManifestConditions, owner)
+	workload, err := resolveWorkload(ctx, r.client, work)
+	if err != nil {
+		klog.ErrorS(err, "failed to read the workload reference of the work", workKeys(req.Namespace, req.Name)...)
+		if markErr := r.markWorkloadRefFailed(ctx, work, err); markErr != nil || apierrors.IsNotFound(err) {
+			return ctrl.Result{}, markErr
+		}
+		return ctrl.Result{}, err
+	}
+	// every document of a multi-document manifest is applied and reported on its own
+	workload = expandWorkload(workload)
+
+	previousConditions := work.Status.ManifestConditions
+	outcome, err := r.applyWork(ctx, work, workload, owner, r.isForceReapplyDue(work))
+	if err != nil {
+		klog.ErrorS(err, "failed to compute the pending changes of the work", workKeys(req.Namespace, req.Name)...)
+		return ctrl.Result{}, err
+	}
+	if outcome.pendingApproval {
+		return r.waitForApproval(ctx, work)
+	}
+	workManifestCount.Observe(float64(len(workload.Manifests)))
+	if outcome.interrupted {
+		// the controller is shutting down, the failures are caused by that rather than the manifests
+		return ctrl.Result{}, r.markInterrupted(work)
+	}
+	if outcome.rolledBack != 0 {
+		r.recorder.Eventf(work, corev1.EventTypeWarning, "RolledBack",
+			"Deleted the %d resources created by this apply since some manifests of the work failed", outcome.rolledBack)
+	}
+	opts := outcome.opts
 	errs := []error{}
+	transientFailure := false
+	permanentFailure := false
 
-	// Update manifestCondition based on the results
-	var manifestConditions []workv1alpha1.ManifestCondition
-	for _, result := range results {
+	for _, result := range outcome.results {
 		if result.err != nil {
-			errs = append(errs, result.err)
+			// a kind that is not established yet or a slow spoke cluster is retried soon rather than backed off
+			// and a manifest that can't succeed until the work changes isn't retried at all
+			switch {
+			case isTransientFailure(result.err):
+				transientFailure = true
+			case isPermanentFailure(result.err):
+				permanentFailure = true
+			default:
+				errs = append(errs, result.err)
+			}
 		}
-		appliedCondition := buildAppliedStatusCondition(result.err, result.generation)
-		manifestCondition := workv1alpha1.ManifestCondition{
-			Identifier: result.identifier,
-			Conditions: []metav1.Condition{appliedCondition},
+		if result.err != nil || result.updated {
+			recordAudit(r.auditSink, req.NamespacedName, result.identifier, audit.ActionApply, redactApplyError(result.identifier, result.err))
 		}
-		foundmanifestCondition := findManifestConditionByIdentifier(result.identifier, work.Status.ManifestConditions)
-		if foundmanifestCondition != nil {
-			manifestCondition.Conditions = foundmanifestCondition.Conditions
-			meta.SetStatusCondition(&manifestCondition.Conditions, appliedCondition)
+		switch {
+		case result.err != nil:
+			r.recorder.Eventf(work, corev1.EventTypeWarning, "ApplyFailed", "Failed to apply %s: %v",
+				describeResource(result.identifier), redactApplyError(result.identifier, result.err))
+		case result.action.created && !opts.dryRun && tracksResource(appliedWork, result.identifier):
+			// we applied the resource before so it was deleted behind our back
+			r.recorder.Eventf(work, corev1.EventTypeNormal, "ResourceRecreated", "Recreated %s deleted out-of-band%s",
+				describeResource(result.identifier), r.appliedBy())
+		case result.action.driftCorrected && result.updated:
+			r.recorder.Eventf(work, corev1.EventTypeNormal, "DriftCorrected", "Re-applied %s over its out-of-band edits%s",
+				describeResource(result.identifier), r.appliedBy())
+		case result.updated:
+			r.recorder.Eventf(work, corev1.EventTypeNormal, "AppliedManifest", "Applied %s%s",
+				describeResource(result.identifier), r.appliedBy())
 		}
-		manifestConditions = append(manifestConditions, manifestCondition)
 	}
 
-	work.Status.ManifestConditions = manifestConditions
+	// the appliedWork has to track what we applied before the work status stops listing it, otherwise a manifest
+	// removed from the work before the status controller caught up would leave its resource behind
+	tracked := trackAppliedResources(appliedWork, previousConditions, work.Status.ManifestConditions)
+	if recordAppliedGenerations(appliedWork, outcome.results, metav1.Now()) || tracked {
+		summarizeAppliedResources(appliedWork)
+		if err := r.spokeClient.Status().Update(ctx, appliedWork, &client.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "failed to track the applied resources in the appliedWork",
+				workKeys(req.Namespace, req.Name, "appliedWork", appliedWork.GetName())...)
+			if isRetryableAPIError(err) {
+				return ctrl.Result{RequeueAfter: r.retryDelay(req.NamespacedName, work.Generation, []error{err})}, nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
 
-	// Update status condition of work
-	workCond := generateWorkAppliedStatusCondition(manifestConditions, work.Generation)
-	meta.SetStatusCondition(&work.Status.Conditions, workCond)
+	if opts.forceApply && len(errs) == 0 && !permanentFailure && !opts.dryRun {
+		now := metav1.Now()
+		work.Status.LastFullApplyTime = &now
+	}
 
 	err = r.client.Status().Update(ctx, work, &client.UpdateOptions{})
 	if err != nil {
-		klog.ErrorS(err, "update work status failed", "work", req.NamespacedName)
+		klog.ErrorS(err, "update work status failed", workKeys(req.Namespace, req.Name)...)
 		errs = append(errs, err)
 	}
 
 	if len(errs) != 0 {
-		klog.InfoS("we didn't apply all the manifest works successfully, queue the next reconcile", "work", req.NamespacedName)
-		return ctrl.Result{}, utilerrors.NewAggregate(errs)
+		// we requeue with our own backoff instead of returning the error so that it restarts when the work changes
+		retryAfter := r.retryDelay(req.NamespacedName, work.Generation, errs)
+		klog.ErrorS(utilerrors.NewAggregate(errs), "we didn't apply all the manifest works successfully, queue the next reconcile",
+			workKeys(req.Namespace, req.Name, "retryAfter", retryAfter)...)
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+	r.backoff.reset(req.NamespacedName)
+	if permanentFailure {
+		klog.V(logLevelDebug).InfoS("some manifests of the work can't be applied until the work changes, not retrying them", workKeys(req.Namespace, req.Name)...)
+	}
+
+	var requeueAfter time.Duration
+	// the spoke objects don't trigger a reconcile when they become available so we need to check back
+	if r.requireAvailable && availabilityPending(work.Status.ManifestConditions) {
+		klog.V(logLevelDebug).InfoS("the work is applied but not available yet, check it later", workKeys(req.Namespace, req.Name)...)
+		requeueAfter = availabilityRequeueInterval
+	}
+	if transientFailure {
+		retryAfter := r.transientRetryDelay(req.NamespacedName, work.Generation)
+		klog.V(logLevelDebug).InfoS("some manifests of the work failed for a transient reason, retry them later",
+			workKeys(req.Namespace, req.Name, "retryAfter", retryAfter)...)
+		if requeueAfter == 0 || retryAfter < requeueAfter {
+			requeueAfter = retryAfter
+		}
+	} else if r.transientBackoff != nil {
+		r.transientBackoff.reset(req.NamespacedName)
+	}
+	if nextReapply := r.nextForceReapply(work); nextReapply > 0 {
+		if requeueAfter == 0 || nextReapply < requeueAfter {
+			requeueAfter = nextReapply
+		}
+	}
+	// the out-of-band edits of the spoke objects don't trigger a reconcile either
+	if r.resyncPeriod > 0 && (requeueAfter == 0 || r.resyncPeriod < requeueAfter) {
+		requeueAfter = r.resyncPeriod
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// workApplyOutcome is what applying the manifests of a work did.
+type workApplyOutcome struct {
+	// opts are the options the manifests were applied with
+	opts applyOptions
+	// results are the results of the manifests, in the order of the manifests
+	results []applyResult
+	// pendingApproval is set if the changes of the work wait for an approval, nothing was applied
+	pendingApproval bool
+	// interrupted is set if the apply was cut short by the context, the manifest conditions of the work are left as they were
+	interrupted bool
+	// rolledBack is how many resources created by the apply were deleted since some manifests of the work failed
+	rolledBack int
+}
+
+// applyWork applies the manifests of the expanded workload of a work on behalf of the appliedWork the owner points
+// to, and records the outcome in the status of the work: the conditions of the manifests along with the Applied,
+// MappingPending and ResourceTypeUnavailable conditions of the work. A work waiting for an approval only gets its
+// pending changes instead. The work agent and the in-process Applier both apply the works with it, they only differ
+// in how they save the status and report the outcome.
+func (r *ApplyWorkReconciler) applyWork(ctx context.Context, work *workv1alpha1.Work, workload workv1alpha1.WorkloadTemplate,
+	owner metav1.OwnerReference, forceApply bool) (workApplyOutcome, error) {
+	opts := buildApplyOptions(work)
+	if len(opts.fieldManager) == 0 {
+		opts.fieldManager = r.fieldManager
+	}
+	opts.forceApply = forceApply
+	opts.detectDrift = r.resyncPeriod > 0 || r.watchAppliedResources
+	opts.applyVersions = applyVersionsOf(workload)
+	opts.applyModes = applyModesOf(workload)
+	opts.overlays = overlaysOf(workload, r.clusterName)
+	// the status controller checks the availability with the same health checks, so both agree on it
+	opts.healthChecks = compileHealthChecks(workload)
+	opts.variables = manifestVariables(work)
+	opts.labels = expandPropagatedMetadata(r.propagatedLabels, opts.variables)
+	opts.annotations = expandPropagatedMetadata(r.propagatedAnnotations, opts.variables)
+	opts.preservedAnnotationPrefixes = r.preservedAnnotationPrefixes
+
+	if requiresApproval(work) {
+		// the changes are computed on the manifests as they would be applied, so that what is approved is what is applied
+		pending, err := r.computePendingChanges(ctx, workload.Manifests, opts)
+		if err != nil {
+			return workApplyOutcome{}, err
+		}
+		if len(pending) != 0 {
+			setPendingChanges(work, pending)
+			return workApplyOutcome{pendingApproval: true}, nil
+		}
+	}
+
+	// the resources may have drifted while the work was paused, so we re-apply all of them once it is resumed
+	if meta.FindStatusCondition(work.Status.Conditions, ConditionTypePaused) != nil {
+		klog.InfoS("the work is resumed, re-apply all of its manifests", workKeys(work.Namespace, work.Name)...)
+		meta.RemoveStatusCondition(&work.Status.Conditions, ConditionTypePaused)
+		opts.forceApply = true
+	}
+	results := r.applyManifests(ctx, workload.Manifests, workload.Dependencies,
+		work.Status.ManifestConditions, owner, opts)
+	outcome := workApplyOutcome{opts: opts, results: results}
+	if ctx.Err() != nil {
+		outcome.interrupted = true
+		return outcome, nil
+	}
+	if opts.allOrNothing && !opts.dryRun {
+		outcome.rolledBack = r.rollBackCreated(ctx, types.NamespacedName{Namespace: work.Namespace, Name: work.Name}, results)
+	}
+
+	failed := false
+	var manifestConditions []workv1alpha1.ManifestCondition
+	for _, result := range results {
+		failed = failed || result.err != nil
+		manifestConditions = append(manifestConditions, buildManifestCondition(result, work.Status.ManifestConditions, opts.dryRun))
+	}
+	work.Status.ManifestConditions = manifestConditions
+	setLastError(&work.Status, results)
+	work.Status.FailedResources = failedResourcesOf(manifestConditions)
+	work.Status.ManifestCount = len(workload.Manifests)
+	work.Status.PendingChanges = nil
+	if !opts.dryRun {
+		recordReconcile(&work.Status, work.Generation, results, metav1.Now())
+	}
+
+	workCond := generateWorkAppliedStatusCondition(manifestConditions, work.Generation, r.requireAvailable)
+	if opts.dryRun && !failed {
+		workCond.Reason = ReasonDryRunComplete
+		workCond.Message = "The manifests were validated by the spoke cluster but not applied, see the conditions of the manifests"
+	}
+	meta.SetStatusCondition(&work.Status.Conditions, workCond)
+	setMappingPendingCondition(&work.Status, results, work.Generation)
+	setResourceTypeUnavailableCondition(&work.Status, results, work.Generation)
+	return outcome, nil
+}
+
+// retryDelay records a failure to reconcile a work and returns how long to wait before retrying it.
+// We wait at least as long as the spoke cluster asked us to if it throttled us or timed out.
+func (r *ApplyWorkReconciler) retryDelay(key types.NamespacedName, generation int64, errs []error) time.Duration {
+	delay := r.backoff.next(key, generation)
+	for _, err := range errs {
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+			if suggested := time.Duration(seconds) * time.Second; suggested > delay {
+				delay = suggested
+			}
+		}
+	}
+	return delay
+}
+
+// transientRetryDelay records a transient failure of a work and returns how long to wait before retrying it.
+// The delay grows while the failures last, so that a kind whose CRD is never established isn't looked up forever
+// at the same pace.
+func (r *ApplyWorkReconciler) transientRetryDelay(key types.NamespacedName, generation int64) time.Duration {
+	if r.transientBackoff == nil {
+		return transientRetryInterval
+	}
+	return r.transientBackoff.next(key, generation)
+}
+
+// rollBackCreated deletes the resources created by this apply if any other manifest failed for a reason that won't go
+// away by itself, so that an AllOrNothing work is never left half applied. The transient failures are retried first,
+// otherwise a work creating a CRD and its custom resources would never get past the CRD.
+// The results of the deleted resources are turned into RolledBack failures, it returns how many were deleted.
+func (r *ApplyWorkReconciler) rollBackCreated(ctx context.Context, nsWorkName types.NamespacedName, results []applyResult) int {
+	failed := -1
+	for i, result := range results {
+		if result.err != nil && !isTransientFailure(result.err) {
+			failed = i
+			break
+		}
+	}
+	if failed < 0 {
+		return 0
+	}
+	rolledBack := 0
+	for i := range results {
+		result := &results[i]
+		if result.err != nil || !result.action.created {
+			continue
+		}
+		gvr := schema.GroupVersionResource{
+			Group:    result.identifier.Group,
+			Version:  result.identifier.Version,
+			Resource: result.identifier.Resource,
+		}
+		err := r.spokeDynamicClient.Resource(gvr).Namespace(result.identifier.Namespace).
+			Delete(ctx, result.identifier.Name, metav1.DeleteOptions{})
+		recordAudit(r.auditSink, nsWorkName, result.identifier, audit.ActionDelete, err)
+		if err != nil && !apierrors.IsNotFound(err) {
+			// the resource stays applied and tracked, we roll it back with the next apply
+			klog.ErrorS(err, "failed to roll back a created resource", workKeys(nsWorkName.Namespace, nsWorkName.Name, "resource", result.identifier)...)
+			continue
+		}
+		klog.V(logLevelDebug).InfoS("rolled back a created resource", workKeys(nsWorkName.Namespace, nsWorkName.Name, "resource", result.identifier)...)
+		rolledBack++
+		*result = applyResult{
+			identifier: result.identifier,
+			err: newManifestError(ReasonRolledBack, fmt.Errorf("the manifest was applied and rolled back since manifest %d failed",
+				results[failed].identifier.Ordinal)),
+		}
+	}
+	return rolledBack
+}
+
+// appliedBy describes the controller instance applying the manifests in the events, empty if it has no identity.
+func (r *ApplyWorkReconciler) appliedBy() string {
+	if len(r.instanceID) == 0 {
+		return ""
+	}
+	return " by " + r.instanceID
+}
+
+// markInterrupted marks a work whose apply was cut short by the controller shutting down,
+// so that it doesn't look stuck in the middle of an apply until the controller restarts.
+func (r *ApplyWorkReconciler) markInterrupted(work *workv1alpha1.Work) error {
+	// the reconcile context is already cancelled, the manager gives us until its graceful shutdown timeout
+	ctx, cancel := context.WithTimeout(context.Background(), interruptedStatusTimeout)
+	defer cancel()
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: work.Generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReconcileInterrupted,
+		Message:            "The controller shut down while applying the work, it's applied again once the controller restarts",
+	})
+	if err := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "failed to mark the work as interrupted", workKeys(work.Namespace, work.Name)...)
+		return err
+	}
+	klog.InfoS("marked the work as interrupted by the shutdown", workKeys(work.Namespace, work.Name)...)
+	return nil
+}
+
+// markPaused sets the Paused condition of a paused work, nothing else in its status changes while it is paused.
+func (r *ApplyWorkReconciler) markPaused(ctx context.Context, work *workv1alpha1.Work) error {
+	if meta.IsStatusConditionTrue(work.Status.Conditions, ConditionTypePaused) {
+		return nil
+	}
+	meta.SetStatusCondition(&work.Status.Conditions, buildWorkPausedCondition(work.Generation))
+	if err := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "failed to mark the work as paused", workKeys(work.Namespace, work.Name)...)
+		return err
 	}
+	klog.InfoS("the work is paused, leave its manifests as they are", workKeys(work.Namespace, work.Name)...)
+	return nil
+}
 
-	return ctrl.Result{}, nil
+// isForceReapplyDue checks if it's time to re-apply all the manifests of the work regardless of their spec hash.
+func (r *ApplyWorkReconciler) isForceReapplyDue(work *workv1alpha1.Work) bool {
+	if r.forceReapplyInterval <= 0 {
+		return false
+	}
+	lastFullApply := work.Status.LastFullApplyTime
+	return lastFullApply == nil || time.Since(lastFullApply.Time) >= r.forceReapplyInterval
 }
 
-func (r *ApplyWorkReconciler) applyManifests(manifests []workv1alpha1.Manifest,
-	manifestConditions []workv1alpha1.ManifestCondition, owner metav1.OwnerReference) []applyResult {
-	var results []applyResult
+// nextForceReapply returns how long to wait before the next forced re-apply of the work, zero means there is none.
+// A forced re-apply that ended with permanent failures doesn't move the last full apply time, so it is overdue
+// right away; we try it again a full interval later instead of requeueing with a negative delay, which would
+// never requeue the work.
+func (r *ApplyWorkReconciler) nextForceReapply(work *workv1alpha1.Work) time.Duration {
+	if r.forceReapplyInterval <= 0 || work.Status.LastFullApplyTime == nil {
+		return 0
+	}
+	nextReapply := time.Until(work.Status.LastFullApplyTime.Add(r.forceReapplyInterval))
+	if nextReapply <= 0 {
+		return r.forceReapplyInterval
+	}
+	return nextReapply
+}
 
-	for index, manifest := range manifests {
+// checkStabilization checks if the current generation of the work has stayed unchanged for the stabilization window.
+// It returns how much longer we need to wait before applying the work, zero means the work can be applied now,
+// and whether the Stabilizing condition of the work changed.
+// The start of the window is recorded in the Stabilizing condition of the work so that it survives restarts.
+func (r *ApplyWorkReconciler) checkStabilization(work *workv1alpha1.Work) (time.Duration, bool) {
+	if r.stabilizationWindow <= 0 {
+		return 0, false
+	}
+	cond := meta.FindStatusCondition(work.Status.Conditions, ConditionTypeStabilizing)
+	if cond == nil || cond.ObservedGeneration != work.Generation {
+		// the work has changed, (re)start the window
+		meta.RemoveStatusCondition(&work.Status.Conditions, ConditionTypeStabilizing)
+		meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+			Type:               ConditionTypeStabilizing,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			ObservedGeneration: work.Generation,
+			Reason:             ReasonWorkChanged,
+			Message:            fmt.Sprintf("Waiting for the work to stay unchanged for %s", r.stabilizationWindow),
+		})
+		return r.stabilizationWindow, true
+	}
+	if cond.Status != metav1.ConditionTrue {
+		return 0, false
+	}
+	if remaining := time.Until(cond.LastTransitionTime.Add(r.stabilizationWindow)); remaining > 0 {
+		return remaining, false
+	}
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeStabilizing,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: work.Generation,
+		Reason:             ReasonWorkStable,
+		Message:            "The work stayed unchanged for the stabilization window",
+	})
+	return 0, true
+}
+
+func (r *ApplyWorkReconciler) applyManifests(ctx context.Context, manifests []workv1alpha1.Manifest,
+	dependencies []workv1alpha1.ManifestDependency, manifestConditions []workv1alpha1.ManifestCondition,
+	owner metav1.OwnerReference, opts applyOptions) []applyResult {
+	// the results keep the order of the manifests whatever order we apply them in
+	results := make([]applyResult, len(manifests))
+	deps := buildDependencies(len(manifests), dependencies)
+	// the namespaces and CRDs go first so that the manifests in them don't fail just because of their place in the list
+	order, cyclic := applyOrder(len(manifests), deps, findPrerequisites(manifests))
+	// remapped is the manifest that landed on each resource once its namespace was overridden
+	remapped := make(map[workv1alpha1.ResourceIdentifier]int)
+	var crdKinds map[schema.GroupKind]bool
+	if r.resourceTypes != nil {
+		crdKinds = crdKindsOf(manifests)
+	}
+
+	for _, index := range order {
+		manifest := manifests[index]
 		result := applyResult{
 			identifier: workv1alpha1.ResourceIdentifier{Ordinal: index},
 		}
-		gvr, rawObj, err := r.decodeUnstructured(manifest)
-		if err != nil {
+		gvr, rawObj, scopeReason, scopeMessage, err := r.prepareManifest(manifest, index, opts)
+		switch {
+		case isNoMatchError(err) && rawObj != nil:
+			// the kind may have been removed from the spoke, e.g. its CRD was uninstalled, we skip the manifest
+			// if we applied it before so that it doesn't fail the rest of the work, and keep tracking what we applied
+			if len(rawObj.GetNamespace()) != 0 && len(opts.namespaceOverride) != 0 {
+				rawObj.SetNamespace(opts.namespaceOverride)
+			}
+			if previous := findPreviouslyAppliedIdentifier(index, rawObj, manifestConditions); previous != nil {
+				klog.InfoS("the kind of a previously applied manifest is not served anymore, skip it",
+					objectKeys(rawObj)...)
+				result.identifier = *previous
+				result.kindUnavailable = true
+			} else if r.isResourceTypeUnavailable(rawObj.GroupVersionKind(), crdKinds) {
+				// there is no CRD on the way, so the manifest waits for the API to be installed with the backoff
+				result.err = newManifestError(ReasonResourceTypeUnavailable,
+					fmt.Errorf("the spoke cluster doesn't serve the %s resource type: %w", rawObj.GroupVersionKind(), err))
+			} else {
+				// the kind may not be established yet, e.g. its CRD was just applied, so we retry it soon
+				result.err = newManifestError(ReasonMappingNotFound, err)
+			}
+		case err != nil:
 			result.err = err
-		} else {
+		default:
 			var obj *unstructured.Unstructured
-			result.identifier = buildResourceIdentifier(index, rawObj, gvr)
+			result.scopeReason, result.scopeMessage = scopeReason, scopeMessage
+			identifier := buildResourceIdentifier(index, rawObj, gvr)
+			if len(opts.namespaceOverride) != 0 {
+				// two manifests from different namespaces can't be moved onto the same resource
+				key := identifier
+				key.Ordinal = 0
+				if other, found := remapped[key]; found {
+					result.err = newManifestError(ReasonNamespaceCollision, fmt.Errorf(
+						"the manifest is the same resource as manifest %d in namespace %s", other, opts.namespaceOverride))
+					break
+				}
+				remapped[key] = index
+			}
+			result.identifier = identifier
 			rawObj.SetOwnerReferences(insertOwnerReference(rawObj.GetOwnerReferences(), owner))
+			r.removeNamespacedOwnerReferences(rawObj)
+			// the skipped manifests still get their full identifier so that what we applied before isn't pruned
+			if isPausedManifest(rawObj) {
+				klog.V(logLevelDebug).InfoS("skip a paused manifest", objectKeys(rawObj)...)
+				result.paused = true
+				break
+			}
+			if cyclic[index] {
+				result.err = newManifestError(ReasonDependencyCycle, fmt.Errorf("the manifest is in or depends on a dependency cycle"))
+				break
+			}
+			if result.err = checkDependencies(index, deps, results); result.err != nil {
+				klog.V(logLevelDebug).InfoS("skip a manifest whose dependencies are not applied", objectKeys(rawObj, "err", result.err)...)
+				break
+			}
 			observedGeneration := findObservedGenerationOfManifest(result.identifier, manifestConditions)
-			obj, result.updated, result.err = r.applyUnstructured(gvr, rawObj, observedGeneration)
+			manifestOpts := r.applyOptionsOf(rawObj.GroupVersionKind().GroupKind(), opts)
+			manifestOpts.createOnly = opts.applyModes[index] == workv1alpha1.ManifestApplyModeCreateOnly
+			applyStart := time.Now()
+			obj, result.action, result.err = r.applyUnstructuredWithTimeout(ctx, gvr, rawObj, observedGeneration, manifestOpts)
+			// nothing is written to the spoke cluster in a dry run
+			result.updated = len(result.action.strategy) != 0 && !opts.dryRun
+			recordApplyMetrics(rawObj.GroupVersionKind(), result.updated, result.err, time.Since(applyStart))
 			if result.err == nil {
 				result.generation = obj.GetGeneration()
-				klog.V(5).InfoS("applied an unstructrued object", "gvr", gvr, "obj", obj.GetName(), "new observedGeneration", result.generation)
+				result.uid = obj.GetUID()
+				if !result.action.createOnlySkipped {
+					// the object of a skipped manifest doesn't have the hash of the manifest
+					result.hash = rawObj.GetAnnotations()[specHashAnnotation]
+				}
+				result.available, result.availableMsg = checkManifestAvailability(obj, opts.healthChecks[index])
+				klog.V(logLevelTrace).InfoS("applied an unstructrued object", objectKeys(obj, "new observedGeneration", result.generation)...)
 			} else {
-				klog.ErrorS(err, "Failed to apply an unstructrued object", "gvr", gvr, "obj", rawObj.GetName())
+				klog.ErrorS(result.err, "Failed to apply an unstructrued object", objectKeys(rawObj)...)
 			}
 		}
-		results = append(results, result)
+		results[index] = result
 	}
 	return results
 }
 
-func (r *ApplyWorkReconciler) decodeUnstructured(manifest workv1alpha1.Manifest) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
-	unstructuredObj := &unstructured.Unstructured{}
-	err := unstructuredObj.UnmarshalJSON(manifest.Raw)
+// prepareManifest builds the object a manifest is applied as: decoded as the version it is pinned to, patched by its
+// overlays, with the variables substituted, its namespace fitted to the scope of its kind then overridden, and the
+// propagated labels and annotations set. It returns the reason and the message of the scope change of its namespace,
+// empty if it didn't change. The decoded object is returned along with the errors to decode or patch it, so that
+// the caller can still tell what the manifest is.
+func (r *ApplyWorkReconciler) prepareManifest(manifest workv1alpha1.Manifest, index int, opts applyOptions) (
+	schema.GroupVersionResource, *unstructured.Unstructured, string, string, error) {
+	var versions []string
+	if version, pinned := opts.applyVersions[index]; pinned {
+		versions = []string{version}
+	}
+	gvr, obj, err := r.decodeUnstructured(manifest, versions...)
+	if obj == nil {
+		return gvr, nil, "", "", err
+	}
+	// the overlays patch the manifest as written, so their values can reference the variables too
+	if overlayErr := overlay.Apply(obj, opts.overlays[index]); overlayErr != nil {
+		err = newManifestError(ReasonOverlayFailed, overlayErr)
+	}
+	substituteVariables(obj.Object, opts.variables)
 	if err != nil {
-		return schema.GroupVersionResource{}, nil, fmt.Errorf("failed to decode object: %w", err)
+		return gvr, obj, "", "", err
 	}
-	mapping, err := r.restMapper.RESTMapping(unstructuredObj.GroupVersionKind().GroupKind(), unstructuredObj.GroupVersionKind().Version)
+	scopeReason, scopeMessage, err := r.normalizeNamespace(obj, opts.defaultNamespace)
 	if err != nil {
-		return schema.GroupVersionResource{}, nil, fmt.Errorf("failed to find gvr from restmapping: %w", err)
+		return gvr, nil, "", "", err
 	}
+	if err = r.overrideNamespace(obj, opts.namespaceOverride); err != nil {
+		return gvr, nil, "", "", err
+	}
+	propagateMetadata(obj, opts.labels, opts.annotations)
+	return gvr, obj, scopeReason, scopeMessage, nil
+}
+
+func (r *ApplyWorkReconciler) decodeUnstructured(manifest workv1alpha1.Manifest, versions ...string) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
+	return decodeUnstructured(r.restMapper, manifest, versions...)
+}
 
+// decodeUnstructured decodes a manifest and finds the resource of its kind on the spoke cluster.
+// The manifest is applied as the first of the versions served by the spoke cluster if any are given,
+// otherwise as the version it declares.
+func decodeUnstructured(restMapper meta.RESTMapper, manifest workv1alpha1.Manifest, versions ...string) (schema.GroupVersionResource, *unstructured.Unstructured, error) {
+	unstructuredObj, err := manifest.AsUnstructured()
+	if err != nil {
+		return schema.GroupVersionResource{}, nil, newManifestError(ReasonDecodeFailed, err)
+	}
+	gvk := unstructuredObj.GroupVersionKind()
+	if len(versions) == 0 {
+		versions = []string{gvk.Version}
+	}
+	mapping, err := restMapper.RESTMapping(gvk.GroupKind(), versions...)
+	if isNoMatchError(err) && resetRESTMapper(restMapper) {
+		// the kind may have been added after the mapper discovered the spoke cluster, e.g. by a CRD of the same work
+		mapping, err = restMapper.RESTMapping(gvk.GroupKind(), versions...)
+	}
+	if isNoMatchError(err) && (len(versions) != 1 || versions[0] != gvk.Version) {
+		// the kind may still be served in the version the manifest declares, so this is not a missing kind
+		return schema.GroupVersionResource{}, unstructuredObj, newManifestError(ReasonVersionNotServed,
+			fmt.Errorf("the spoke cluster doesn't serve %s in version %s", gvk.GroupKind(), strings.Join(versions, " or ")))
+	}
+	if err != nil {
+		// return the decoded object so the caller can still tell what the manifest is
+		return schema.GroupVersionResource{}, unstructuredObj, fmt.Errorf("failed to find gvr from restmapping: %w", err)
+	}
+	// the object has to declare the version we apply it as or the api server rejects it
+	unstructuredObj.SetAPIVersion(mapping.GroupVersionKind.GroupVersion().String())
 	return mapping.Resource, unstructuredObj, nil
 }
 
+// isResourceTypeUnavailable checks with the discovery of the spoke cluster whether a kind that doesn't map is not
+// served at all. The kinds defined by the CRDs of the work are never unavailable, nor are the kinds we can't check.
+func (r *ApplyWorkReconciler) isResourceTypeUnavailable(gvk schema.GroupVersionKind, crdKinds map[schema.GroupKind]bool) bool {
+	if r.resourceTypes == nil || crdKinds[gvk.GroupKind()] {
+		return false
+	}
+	served, err := r.resourceTypes.isServed(gvk)
+	if err != nil {
+		klog.V(logLevelDebug).InfoS("failed to check if the spoke cluster serves a kind", "gvk", gvk, "err", err)
+		return false
+	}
+	return !served
+}
+
+// ValidateManifestMappings decodes the manifests of a workload the way they are decoded before they are applied and
+// checks that the rest mapper finds the resources of their kinds, in the versions they are pinned to if any.
+// Each document of a multi-document manifest is checked.
+func ValidateManifestMappings(restMapper meta.RESTMapper, workload workv1alpha1.WorkloadTemplate) field.ErrorList {
+	var errs field.ErrorList
+	versions := applyVersionsOf(workload)
+	manifestsPath := field.NewPath("spec", "workload", "manifests")
+	for index, manifest := range workload.Manifests {
+		path := manifestsPath.Index(index)
+		docs, err := manifest.Documents()
+		if err != nil {
+			errs = append(errs, field.Invalid(path, string(manifest.Raw), err.Error()))
+			continue
+		}
+		var pinned []string
+		if version, found := versions[index]; found {
+			pinned = []string{version}
+		}
+		for _, doc := range docs {
+			_, obj, err := decodeUnstructured(restMapper, doc, pinned...)
+			switch {
+			case err != nil && obj != nil:
+				errs = append(errs, field.Invalid(path.Child("kind"), obj.GroupVersionKind().String(), err.Error()))
+			case err != nil:
+				errs = append(errs, field.Invalid(path, string(doc.Raw), err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// checkObjectSize fails if the serialized object is larger than the size limit.
+func (r *ApplyWorkReconciler) checkObjectSize(obj *unstructured.Unstructured) error {
+	if r.maxObjectSize <= 0 {
+		return nil
+	}
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if len(data) > r.maxObjectSize {
+		return newManifestError(ReasonObjectTooLarge,
+			fmt.Errorf("the object is %d bytes, larger than the limit of %d bytes", len(data), r.maxObjectSize))
+	}
+	return nil
+}
+
+// removeNamespacedOwnerReferences drops the owner references of a cluster scoped object that point to a namespaced owner.
+// The api server rejects them since a cluster scoped object can't be owned by a namespaced one.
+func (r *ApplyWorkReconciler) removeNamespacedOwnerReferences(obj *unstructured.Unstructured) {
+	namespaced, err := r.isNamespaced(obj.GroupVersionKind())
+	if err != nil || namespaced {
+		return
+	}
+	var owners []metav1.OwnerReference
+	for _, owner := range obj.GetOwnerReferences() {
+		if gv, err := schema.ParseGroupVersion(owner.APIVersion); err == nil {
+			if ownerNamespaced, err := r.isNamespaced(gv.WithKind(owner.Kind)); err == nil && ownerNamespaced {
+				klog.InfoS("skip a namespaced owner reference of a cluster scoped object",
+					objectKeys(obj, "owner kind", owner.Kind, "owner", owner.Name)...)
+				continue
+			}
+		}
+		owners = append(owners, owner)
+	}
+	obj.SetOwnerReferences(owners)
+}
+
+// isNamespaced checks if objects of the given kind are namespaced on the spoke cluster.
+func (r *ApplyWorkReconciler) isNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := r.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// normalizeNamespace makes the namespace of an object fit the scope of its kind. The namespace of a cluster scoped
+// object is dropped and a namespaced object without a namespace goes to the default namespace. It returns the reason
+// and the message of the change for the applied condition of the manifest, empty if nothing changed.
+func (r *ApplyWorkReconciler) normalizeNamespace(obj *unstructured.Unstructured, defaultNamespace string) (string, string, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := r.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return "", "", err
+	}
+	if mapping.Scope == nil {
+		return "", "", nil
+	}
+	switch mapping.Scope.Name() {
+	case meta.RESTScopeNameRoot:
+		if namespace := obj.GetNamespace(); len(namespace) != 0 {
+			obj.SetNamespace("")
+			return ReasonNamespaceIgnored, fmt.Sprintf("%s is cluster scoped, its namespace %s is ignored", gvk.Kind, namespace), nil
+		}
+	case meta.RESTScopeNameNamespace:
+		if len(obj.GetNamespace()) == 0 && len(defaultNamespace) != 0 {
+			obj.SetNamespace(defaultNamespace)
+			return ReasonNamespaceDefaulted, fmt.Sprintf("%s is namespaced, it is applied to the namespace %s of the work", gvk.Kind, defaultNamespace), nil
+		}
+	}
+	return "", "", nil
+}
+
+// overrideNamespace moves a namespaced object to the override namespace, the cluster scoped objects are left untouched.
+func (r *ApplyWorkReconciler) overrideNamespace(obj *unstructured.Unstructured, namespace string) error {
+	if len(namespace) == 0 {
+		return nil
+	}
+	namespaced, err := r.isNamespaced(obj.GroupVersionKind())
+	if err != nil {
+		return err
+	}
+	if namespaced {
+		obj.SetNamespace(namespace)
+	}
+	return nil
+}
+
+// applyUnstructuredWithTimeout applies a manifest within the apply timeout of its kind.
+func (r *ApplyWorkReconciler) applyUnstructuredWithTimeout(ctx context.Context, gvr schema.GroupVersionResource,
+	workObj *unstructured.Unstructured, observedGeneration int64, opts applyOptions) (*unstructured.Unstructured, applyAction, error) {
+	timeout := r.applyTimeoutOf(workObj.GroupVersionKind().GroupKind())
+	if timeout <= 0 {
+		return r.applyUnstructured(ctx, gvr, workObj, observedGeneration, opts)
+	}
+	applyCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	obj, action, err := r.applyUnstructured(applyCtx, gvr, workObj, observedGeneration, opts)
+	// only our own deadline is a timeout, the reconcile context is done when the controller shuts down
+	if err != nil && applyCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, applyAction{}, newManifestError(ReasonApplyTimeout,
+			fmt.Errorf("the manifest was not applied within %s: %w", timeout, err))
+	}
+	return obj, action, err
+}
+
+// applyTimeoutOf returns how long we wait for a manifest of the given kind to be applied.
+// An override for kind.group wins over one for the kind alone, and both win over the global timeout.
+func (r *ApplyWorkReconciler) applyTimeoutOf(gk schema.GroupKind) time.Duration {
+	for _, key := range kindKeys(gk) {
+		if timeout, ok := r.applyTimeoutByKind[key]; ok {
+			return timeout
+		}
+	}
+	return r.applyTimeout
+}
+
+// applyOptionsOf returns the options to apply a manifest of the given kind with.
+// The apply mode picked by the work wins over the one configured for the kind.
+func (r *ApplyWorkReconciler) applyOptionsOf(gk schema.GroupKind, opts applyOptions) applyOptions {
+	if len(opts.mode) != 0 {
+		return opts
+	}
+	for _, key := range kindKeys(gk) {
+		if mode, ok := r.applyModeByKind[key]; ok {
+			opts.mode = mode
+			return opts
+		}
+	}
+	return opts
+}
+
+// applyUnstructured writes the object to the spoke cluster if it changed.
+// It returns how it wrote the object, the strategy is empty if the object didn't need to be written.
 func (r *ApplyWorkReconciler) applyUnstructured(
+	ctx context.Context,
 	gvr schema.GroupVersionResource,
 	workObj *unstructured.Unstructured,
-	observedGeneration int64) (*unstructured.Unstructured, bool, error) {
+	observedGeneration int64, opts applyOptions) (*unstructured.Unstructured, applyAction, error) {
 
 	err := setSpecHashAnnotation(workObj)
 	if err != nil {
-		return nil, false, err
+		return nil, applyAction{}, err
+	}
+	// the spec hash doesn't cover the metadata so the instance annotation doesn't count as a change
+	setAppliedByAnnotation(workObj, r.instanceID)
+	// catch the objects the api server would reject for their size with a clear reason before applying them
+	if err = r.checkObjectSize(workObj); err != nil {
+		return nil, applyAction{}, err
 	}
 
 	curObj, err := r.spokeDynamicClient.
 		Resource(gvr).
 		Namespace(workObj.GetNamespace()).
-		Get(context.TODO(), workObj.GetName(), metav1.GetOptions{})
+		Get(ctx, workObj.GetName(), metav1.GetOptions{})
 	if apierrors.IsNotFound(err) {
+		if opts.mode == ApplyModeServerSide {
+			// create the object with server side apply too so that we own its fields from the start
+			actual, action, err := r.serverSideApply(ctx, gvr, workObj, opts)
+			action.created = err == nil
+			return actual, action, err
+		}
+		if opts.mode == ApplyModeClientSide {
+			// the next updates of the object are three-way merges against the manifest we create it from
+			if err := r.setLastApplied(workObj, workObj); err != nil {
+				return nil, applyAction{}, err
+			}
+		}
 		actual, err := r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).Create(
-			context.TODO(), workObj, metav1.CreateOptions{})
-		return actual, true, err
+			ctx, workObj, metav1.CreateOptions{FieldManager: opts.fieldManagerName(), DryRun: opts.dryRunOption()})
+		return actual, applyAction{strategy: ApplyModeClientSide, created: err == nil}, err
 	}
 	if err != nil {
-		return nil, false, err
+		return nil, applyAction{}, err
 	}
 
+	adopting := false
 	if !hasSharedOwnerReference(curObj.GetOwnerReferences(), workObj.GetOwnerReferences()[0]) {
-		// TODO: Block All Owner reference in the Work Manifest.
-		err = fmt.Errorf("this object is not owned by the work-api")
-		klog.V(5).InfoS("This object is not owned by the work-api.", "gvr", gvr, "obj", workObj.GetName(), "err", err)
-		return nil, false, err
+		if opts.createOnly {
+			// adopting the resource would be an update, and we would delete it along with the work
+			err = newManifestError(ReasonNotOwned, fmt.Errorf("the existing object is not owned by the work, a create only manifest can't take it over"))
+			klog.V(logLevelTrace).InfoS("This object is not owned by the work-api.", objectKeys(workObj, "err", err)...)
+			return nil, applyAction{}, err
+		}
+		if !opts.adoptExisting {
+			// the resource belongs to someone else, we leave it alone rather than hijack it
+			err = newManifestError(ReasonNotOwned, fmt.Errorf("the existing object is not owned by the work, set adoptExisting to take it over"))
+			klog.V(logLevelTrace).InfoS("This object is not owned by the work-api.", objectKeys(workObj, "err", err)...)
+			return nil, applyAction{}, err
+		}
+		klog.V(logLevelDebug).InfoS("adopt an existing object", objectKeys(workObj, "owners", curObj.GetOwnerReferences())...)
+		adopting = true
+	}
+
+	if opts.createOnly {
+		// the resource may have been edited on purpose, e.g. a default config, so neither changes nor drifts count
+		klog.V(logLevelDebug).InfoS("skip the existing object of a create only manifest", objectKeys(workObj)...)
+		return curObj, applyAction{createOnlySkipped: true}, nil
 	}
 
 	// Compare the unstructured object and update if needed.
-	updateWarranted := isUpdateWarranted(workObj, curObj)
-	if err != nil {
-		return nil, false, err
+	specChanged := isUpdateWarranted(workObj, curObj) || adopting
+	drifted := !specChanged && opts.detectDrift && hasDrifted(curObj, opts.preservedAnnotationPrefixes)
+	if !opts.forceApply && !specChanged && !drifted {
+		return curObj, applyAction{}, nil
+	}
+	if !drifted {
+		klog.V(logLevelTrace).InfoS("work object's specification has changed", objectKeys(workObj)...)
+		return r.updateUnstructured(ctx, gvr, workObj, curObj, opts)
 	}
 
-	if updateWarranted {
-		klog.V(5).InfoS("work object's specification has changed", "gvr", gvr, "obj", workObj.GetName())
-		workObj.SetAnnotations(mergeMapOverrideWithDst(curObj.GetAnnotations(), workObj.GetAnnotations()))
-		workObj.SetLabels(mergeMapOverrideWithDst(curObj.GetLabels(), workObj.GetLabels()))
-		workObj.SetOwnerReferences(mergeOwnerReference(curObj.GetOwnerReferences(), workObj.GetOwnerReferences()))
+	// the manifest didn't change but the object did, we take back our fields without forcing the conflicts
+	// so that the fields another field manager legitimately took over are reported rather than fought over
+	klog.V(logLevelTrace).InfoS("work object drifted from its manifest", objectKeys(workObj)...)
+	opts.forceConflicts = false
+	actual, action, err := r.updateUnstructured(ctx, gvr, workObj, curObj, opts)
+	if err != nil {
+		return actual, action, err
 	}
+	if actual.GetResourceVersion() == curObj.GetResourceVersion() {
+		// the spec only differs by the fields defaulted by the api server, nothing was written
+		return actual, applyAction{}, nil
+	}
+	action.driftCorrected = true
+	return actual, action, nil
+}
+
+// updateUnstructured writes the manifest over the current object on the spoke cluster.
+func (r *ApplyWorkReconciler) updateUnstructured(ctx context.Context, gvr schema.GroupVersionResource,
+	workObj, curObj *unstructured.Unstructured, opts applyOptions) (*unstructured.Unstructured, applyAction, error) {
+	// the last applied configuration is the manifest as written, without the live values we preserve
+	manifest := workObj.DeepCopy()
+	preserveFields(workObj, curObj, opts.preserveFields)
+	preserveAnnotations(workObj, curObj, opts.preservedAnnotationPrefixes)
+	// the three-way merge needs the manifest as is to tell the labels and annotations we stopped setting
+	desired := workObj.DeepCopy()
+	annotations := mergeMapOverrideWithDst(curObj.GetAnnotations(), workObj.GetAnnotations())
+	// only the three-way merge records the manifest, the other strategies don't carry a stale copy of it along
+	delete(annotations, lastAppliedAnnotation)
+	workObj.SetAnnotations(annotations)
+	workObj.SetLabels(mergeMapOverrideWithDst(curObj.GetLabels(), workObj.GetLabels()))
+	workObj.SetOwnerReferences(mergeOwnerReference(curObj.GetOwnerReferences(), workObj.GetOwnerReferences()))
+	desired.SetOwnerReferences(workObj.GetOwnerReferences())
 
-	if updateWarranted {
-		var actual *unstructured.Unstructured
-		newData, err := workObj.MarshalJSON()
+	switch opts.mode {
+	case ApplyModeStrategicMerge:
+		// only the fields the manifest sets are patched, so the fields set by others are left alone
+		patchType, patch, err := buildStrategicMergePatch(workObj, curObj, r.listMapKeysOf(workObj.GroupVersionKind()))
 		if err != nil {
-			klog.ErrorS(err, "work object json marshal failed", "gvr", gvr, "obj", workObj.GetName())
-			return nil, false, err
+			klog.ErrorS(err, "failed to compute the strategic merge patch", objectKeys(workObj)...)
+			return nil, applyAction{}, err
 		}
+		if string(patch) == "{}" {
+			// the live object already has what the manifest sets
+			return curObj, applyAction{strategy: ApplyModeStrategicMerge}, nil
+		}
+		actual, err := r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).
+			Patch(ctx, workObj.GetName(), patchType, patch,
+				metav1.PatchOptions{FieldManager: opts.fieldManagerName(), DryRun: opts.dryRunOption()})
+		klog.V(logLevelTrace).InfoS("work object strategic merge patched", objectKeys(workObj, "patchType", patchType, "err", err)...)
+		return actual, applyAction{strategy: ApplyModeStrategicMerge}, err
+	case ApplyModeServerSide:
+		// don't fall back to an update if the user only wants server side apply
+		return r.serverSideApply(ctx, gvr, workObj, opts)
+	case ApplyModeClientSide:
+	default:
 		// try to use severside apply to be safe
-		actual, err = r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).
-			Patch(context.TODO(), workObj.GetName(), types.ApplyPatchType, newData,
-				metav1.PatchOptions{Force: pointer.Bool(true), FieldManager: "work-api agent"})
-
-		if err != nil {
-			klog.ErrorS(err, "work object patched failed", "gvr", gvr, "obj", workObj.GetName())
-			workObj.SetResourceVersion(curObj.GetResourceVersion())
-			actual, err = r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).Update(
-				context.TODO(), workObj, metav1.UpdateOptions{})
-			klog.V(5).InfoS("work object updated", "gvr", gvr, "obj", workObj.GetName(), "err", err)
-		} else {
-			klog.V(5).InfoS("work object patched", "gvr", gvr, "obj", workObj.GetName())
+		actual, action, err := r.serverSideApply(ctx, gvr, workObj, opts)
+		// an update would override the fields of the other managers that we are not allowed to take over
+		if err == nil || applyFailureReason(err) == ReasonApplyConflict {
+			return actual, action, err
 		}
-		return actual, true, err
 	}
 
-	return curObj, false, nil
+	// only patch the fields the manifest manages so that the fields set by other controllers survive
+	return r.threeWayMergeUpdate(ctx, gvr, desired, curObj, manifest, opts)
+}
+
+// listMapKeysOf returns the list map keys of a kind, they are nil if we can't find them and the lists of
+// the kind are then replaced as a whole by a merge patch.
+func (r *ApplyWorkReconciler) listMapKeysOf(gvk schema.GroupVersionKind) listMapKeys {
+	if r.listMapKeys == nil {
+		return nil
+	}
+	keys, err := r.listMapKeys.keysOf(gvk)
+	if err != nil {
+		klog.ErrorS(err, "failed to get the OpenAPI schema of the spoke cluster", "gvk", gvk)
+		return nil
+	}
+	return keys
+}
+
+// serverSideApply writes the object with server side apply.
+// The apply never forces at first so that we can tell if it conflicts with other field managers. A conflict is
+// then either force resolved if the options allow it, or reported as an ApplyConflict rather than a generic failure.
+func (r *ApplyWorkReconciler) serverSideApply(ctx context.Context, gvr schema.GroupVersionResource,
+	workObj *unstructured.Unstructured, opts applyOptions) (*unstructured.Unstructured, applyAction, error) {
+	newData, err := workObj.MarshalJSON()
+	if err != nil {
+		klog.ErrorS(err, "work object json marshal failed", objectKeys(workObj)...)
+		return nil, applyAction{}, err
+	}
+	action := applyAction{strategy: ApplyModeServerSide}
+	actual, err := r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).
+		Patch(ctx, workObj.GetName(), types.ApplyPatchType, newData,
+			metav1.PatchOptions{Force: pointer.Bool(false), FieldManager: opts.fieldManagerName(), DryRun: opts.dryRunOption()})
+	if apierrors.IsConflict(err) && opts.forceConflicts {
+		klog.V(logLevelDebug).InfoS("force the conflicts with other field managers", objectKeys(workObj, "conflict", err)...)
+		action.conflictsForced = true
+		actual, err = r.spokeDynamicClient.Resource(gvr).Namespace(workObj.GetNamespace()).
+			Patch(ctx, workObj.GetName(), types.ApplyPatchType, newData,
+				metav1.PatchOptions{Force: pointer.Bool(true), FieldManager: opts.fieldManagerName(), DryRun: opts.dryRunOption()})
+	}
+	if err != nil {
+		klog.ErrorS(err, "work object patched failed", objectKeys(workObj)...)
+		if apierrors.IsConflict(err) {
+			return nil, applyAction{}, newManifestError(ReasonApplyConflict, err)
+		}
+		return nil, applyAction{}, err
+	}
+	klog.V(logLevelTrace).InfoS("work object patched", objectKeys(workObj)...)
+	return actual, action, nil
 }
 
 // SetupWithManager wires up the controller.
 func (r *ApplyWorkReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).For(&workv1alpha1.Work{},
-		builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).Complete(r)
+	predicates := []predicate.Predicate{predicate.ResourceVersionChangedPredicate{}}
+	if r.workFilter != nil {
+		predicates = append(predicates, r.workFilter)
+	}
+	blder := ctrl.NewControllerManagedBy(mgr).Named(controllerName("work-apply", r.clusterName)).
+		For(&workv1alpha1.Work{}, builder.WithPredicates(predicates...)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles})
+	if r.triggers != nil {
+		blder = blder.Watches(&source.Channel{Source: r.triggers}, &handler.EnqueueRequestForObject{})
+	}
+	// the works are applied again when the objects their workload reference points to change
+	blder = blder.Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+		handler.EnqueueRequestsFromMapFunc(r.worksReferencing(workloadRefKindConfigMap))).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.worksReferencing(workloadRefKindSecret)))
+	return blder.Complete(r)
 }
 
 // Determines if differences between two unstructured.Unstructured objects
 // differ in ways that warrant the update (reapply) of the object.
 func isUpdateWarranted(obj1, obj2 *unstructured.Unstructured) bool {
-	return obj1.GetAnnotations()[specHashAnnotation] == obj2.GetAnnotations()[specHashAnnotation]
+	return obj1.GetAnnotations()[specHashAnnotation] != obj2.GetAnnotations()[specHashAnnotation]
+}
+
+// hasDrifted checks if the spec of an object on the spoke cluster no longer matches the spec hash we applied it with.
+// The objects we didn't stamp with a spec hash are never considered drifted, nor are the changes to the annotations
+// with the preserved prefixes. Only the objects written with a three-way merge have the last applied configuration
+// that tells the fields we applied, all the fields of the others are compared and re-applying them is a no-op if
+// they didn't drift.
+func hasDrifted(curObj *unstructured.Unstructured, preservedAnnotationPrefixes []string) bool {
+	appliedHash, found := curObj.GetAnnotations()[specHashAnnotation]
+	if !found {
+		return false
+	}
+	live := curObj
+	var appliedAnnotations map[string]string
+	if lastApplied := curObj.GetAnnotations()[lastAppliedAnnotation]; len(lastApplied) != 0 {
+		applied := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(lastApplied), &applied); err == nil {
+			// only the fields we applied can drift, the ones the api server or others added to the object are left out
+			live = &unstructured.Unstructured{Object: pruneToDesired(curObj.Object, applied).(map[string]interface{})}
+			appliedAnnotations = (&unstructured.Unstructured{Object: applied}).GetAnnotations()
+		}
+	}
+	if len(preservedAnnotationPrefixes) != 0 {
+		live = live.DeepCopy()
+		live.SetAnnotations(withAppliedPreservedAnnotations(live.GetAnnotations(), appliedAnnotations, preservedAnnotationPrefixes))
+	}
+	liveHash, err := generateSpecHash(live)
+	if err != nil {
+		klog.ErrorS(err, "failed to compute the spec hash of a spoke object", objectKeys(curObj)...)
+		return false
+	}
+	return liveHash != appliedHash
+}
+
+// specHashIgnoredFields are the fields the api server, other controllers or we ourselves set on an object,
+// they are left out of the spec hash so that a round-trip through the spoke cluster doesn't change it.
+var specHashIgnoredFields = [][]string{
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "generation"},
+	{"metadata", "selfLink"},
+	{"metadata", "deletionTimestamp"},
+	{"metadata", "deletionGracePeriodSeconds"},
+	{"metadata", "ownerReferences"},
+	{"metadata", "finalizers"},
+	{"metadata", "annotations", specHashAnnotation},
+	{"metadata", "annotations", lastAppliedAnnotation},
+	{"metadata", "annotations", AppliedByAnnotation},
+	{"status"},
 }
 
 // Generates a hash of the spec annotation from a unstructured object.
+// The hash covers the labels and annotations of the object but not the fields in specHashIgnoredFields.
 func generateSpecHash(obj *unstructured.Unstructured) (string, error) {
 	data := obj.DeepCopy().Object
-	delete(data, "metadata")
-	delete(data, "status")
+	for _, field := range specHashIgnoredFields {
+		unstructured.RemoveNestedField(data, field...)
+	}
 
-	jsonBytes, err := json.Marshal(data)
+	jsonBytes, err := json.Marshal(pruneEmptyValues(data))
 	if err != nil {
 		return "", err
 	}
@@ -274,6 +1256,36 @@ func generateSpecHash(obj *unstructured.Unstructured) (string, error) {
 	return fmt.Sprintf("%x", sha256.Sum256(jsonBytes)), nil
 }
 
+// pruneEmptyValues drops the null values and the empty maps and lists of an object, the api server drops them as
+// well so an object keeps its hash whether or not it went through the api server.
+func pruneEmptyValues(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(typed))
+		for key, field := range typed {
+			if field = pruneEmptyValues(field); field != nil {
+				pruned[key] = field
+			}
+		}
+		if len(pruned) == 0 {
+			return nil
+		}
+		return pruned
+	case []interface{}:
+		if len(typed) == 0 {
+			return nil
+		}
+		pruned := make([]interface{}, len(typed))
+		for i, item := range typed {
+			// the items keep their position even if they are empty
+			pruned[i] = pruneEmptyValues(item)
+		}
+		return pruned
+	default:
+		return value
+	}
+}
+
 // MergeMapOverrideWithDst merges two could be nil maps. Keep the dst for any conflicts,
 func mergeMapOverrideWithDst(src, dst map[string]string) map[string]string {
 	if src == nil && dst == nil {
@@ -377,14 +1389,29 @@ func setSpecHashAnnotation(obj *unstructured.Unstructured) error {
 	return nil
 }
 
+// setAppliedByAnnotation stamps the identity of the controller instance that applies the object.
+func setAppliedByAnnotation(obj *unstructured.Unstructured, instanceID string) {
+	if len(instanceID) == 0 {
+		return
+	}
+	annotation := obj.GetAnnotations()
+	if annotation == nil {
+		annotation = map[string]string{}
+	}
+	annotation[AppliedByAnnotation] = instanceID
+	obj.SetAnnotations(annotation)
+}
+
 // Builds a resource identifier for a given unstructured.Unstructured object.
+// The group and version come from the gvr we applied the object with rather than what the manifest declares,
+// so that the identifier always points to the same resource when we use it to find or delete the object later.
 func buildResourceIdentifier(index int, object *unstructured.Unstructured, gvr schema.GroupVersionResource) workv1alpha1.ResourceIdentifier {
 	identifier := workv1alpha1.ResourceIdentifier{
 		Ordinal: index,
 	}
 
-	identifier.Group = object.GroupVersionKind().Group
-	identifier.Version = object.GroupVersionKind().Version
+	identifier.Group = gvr.Group
+	identifier.Version = gvr.Version
 	identifier.Kind = object.GroupVersionKind().Kind
 	identifier.Namespace = object.GetNamespace()
 	identifier.Name = object.GetName()
@@ -393,14 +1420,264 @@ func buildResourceIdentifier(index int, object *unstructured.Unstructured, gvr s
 	return identifier
 }
 
+// setLastError records the apply failures of this reconcile in the work status, or clears them if everything is applied.
+// The time is only updated when the error changes so that a work failing the same way doesn't update its status every time.
+func setLastError(status *workv1alpha1.WorkStatus, results []applyResult) {
+	var msgs []string
+	for _, result := range results {
+		if result.err != nil {
+			msgs = append(msgs, describeApplyError(result))
+		}
+	}
+	if len(msgs) == 0 {
+		status.LastError = ""
+		status.LastErrorTime = nil
+		return
+	}
+	lastError := strings.Join(msgs, "; ")
+	if len(lastError) > maxLastErrorLength {
+		lastError = truncateOnRuneBoundary(lastError, maxLastErrorLength-3) + "..."
+	}
+	if lastError != status.LastError || status.LastErrorTime == nil {
+		now := metav1.Now()
+		status.LastError = lastError
+		status.LastErrorTime = &now
+	}
+}
+
+// truncateOnRuneBoundary cuts a string to at most maxLength bytes without splitting a rune, so that what we record in
+// the work status stays valid UTF-8.
+func truncateOnRuneBoundary(value string, maxLength int) string {
+	if len(value) <= maxLength {
+		return value
+	}
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
+
+// recordReconcile appends the outcome of this apply to the history of the work status, dropping the oldest records
+// beyond maxReconcileHistory. An outcome equal to the last one isn't recorded, every status update triggers another
+// reconcile so a record per reconcile would never let the work settle.
+func recordReconcile(status *workv1alpha1.WorkStatus, generation int64, results []applyResult, now metav1.Time) {
+	record := workv1alpha1.ReconcileRecord{Time: now, ObservedGeneration: generation}
+	for _, result := range results {
+		if result.err != nil {
+			record.Failed++
+		} else {
+			record.Succeeded++
+		}
+	}
+	if n := len(status.History); n > 0 {
+		last := status.History[n-1]
+		if last.ObservedGeneration == record.ObservedGeneration && last.Succeeded == record.Succeeded && last.Failed == record.Failed {
+			return
+		}
+	}
+	status.History = append(status.History, record)
+	if len(status.History) > maxReconcileHistory {
+		status.History = status.History[len(status.History)-maxReconcileHistory:]
+	}
+}
+
+// setMappingPendingCondition sets the MappingPending condition of the work while the spoke cluster doesn't serve the
+// kinds of some of its manifests yet and removes it once all of them are mapped. Those manifests are retried soon
+// without failing the rest of the work.
+func setMappingPendingCondition(status *workv1alpha1.WorkStatus, results []applyResult, generation int64) {
+	kinds := unmappedKindsOf(results, ReasonMappingNotFound)
+	if len(kinds) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, ConditionTypeMappingPending)
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionTypeMappingPending,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             ReasonMappingNotFound,
+		Message: fmt.Sprintf("The spoke cluster doesn't serve %s yet, the manifests are retried until it does",
+			strings.Join(kinds, ", ")),
+	})
+}
+
+// setResourceTypeUnavailableCondition sets the ResourceTypeUnavailable condition of the work while the discovery of
+// the spoke cluster says it doesn't serve the kinds of some of its manifests at all, and removes it once it does.
+func setResourceTypeUnavailableCondition(status *workv1alpha1.WorkStatus, results []applyResult, generation int64) {
+	kinds := unmappedKindsOf(results, ReasonResourceTypeUnavailable)
+	if len(kinds) == 0 {
+		meta.RemoveStatusCondition(&status.Conditions, ConditionTypeResourceTypeUnavailable)
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionTypeResourceTypeUnavailable,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             ReasonResourceTypeUnavailable,
+		Message: fmt.Sprintf("The spoke cluster doesn't serve %s, install their APIs or remove the manifests from the work",
+			strings.Join(kinds, ", ")),
+	})
+}
+
+// unmappedKindsOf returns the kinds of the manifests that failed to map for the reason, each kind once.
+func unmappedKindsOf(results []applyResult, reason string) []string {
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if applyFailureReason(result.err) != reason {
+			continue
+		}
+		kind := fmt.Sprintf("the kind of manifest %d", result.identifier.Ordinal)
+		var noKindMatch *meta.NoKindMatchError
+		var noResourceMatch *meta.NoResourceMatchError
+		if errors.As(result.err, &noKindMatch) {
+			kind = noKindMatch.GroupKind.String()
+		} else if errors.As(result.err, &noResourceMatch) {
+			kind = noResourceMatch.PartialResource.GroupResource().String()
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// failedResourcesOf returns the identifiers of the manifests whose Applied condition is not true, in order.
+func failedResourcesOf(manifestConditions []workv1alpha1.ManifestCondition) []workv1alpha1.ResourceIdentifier {
+	var failed []workv1alpha1.ResourceIdentifier
+	for _, manifestCondition := range manifestConditions {
+		if !meta.IsStatusConditionTrue(manifestCondition.Conditions, ConditionTypeApplied) &&
+			!meta.IsStatusConditionTrue(manifestCondition.Conditions, ConditionTypePaused) {
+			failed = append(failed, manifestCondition.Identifier)
+		}
+	}
+	return failed
+}
+
+// describeApplyError describes why a manifest failed to apply.
+func describeApplyError(result applyResult) string {
+	return fmt.Sprintf("manifest %d: %v", result.identifier.Ordinal, redactApplyError(result.identifier, result.err))
+}
+
+// redactApplyError returns the error of a manifest as we show it in the work status, the events and the audit records.
+// We never include the error of a secret since the api server may echo its data back in the error, only the reason
+// it failed for is kept.
+func redactApplyError(identifier workv1alpha1.ResourceIdentifier, err error) error {
+	if err == nil || identifier.Group != "" || identifier.Kind != "Secret" {
+		return err
+	}
+	return newManifestError(applyFailureReason(err),
+		fmt.Errorf("failed to apply secret %s/%s, its error is hidden since it may contain the secret data", identifier.Namespace, identifier.Name))
+}
+
+// isNoMatchError checks if the error, possibly wrapped, is because the RESTMapper doesn't know the kind.
+func isNoMatchError(err error) bool {
+	var noKindMatch *meta.NoKindMatchError
+	var noResourceMatch *meta.NoResourceMatchError
+	return errors.As(err, &noKindMatch) || errors.As(err, &noResourceMatch)
+}
+
+// findPreviouslyAppliedIdentifier returns the identifier the manifest at the index had when we applied it, nil if we never did.
+func findPreviouslyAppliedIdentifier(index int, obj *unstructured.Unstructured,
+	manifestConditions []workv1alpha1.ManifestCondition) *workv1alpha1.ResourceIdentifier {
+	for _, manifestCondition := range manifestConditions {
+		identifier := manifestCondition.Identifier
+		// the resource is only set once the kind was mapped successfully
+		if identifier.Ordinal == index && len(identifier.Resource) != 0 && identifier.Kind == obj.GetKind() &&
+			identifier.Namespace == obj.GetNamespace() && identifier.Name == obj.GetName() {
+			return &identifier
+		}
+	}
+	return nil
+}
+
+// buildKindUnavailableCondition builds the applied condition of a manifest whose kind is not served by the spoke anymore.
+// Its status is unknown so that it doesn't fail the whole work.
+func buildKindUnavailableCondition(identifier workv1alpha1.ResourceIdentifier) metav1.Condition {
+	return metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionUnknown,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonKindUnavailable,
+		Message:            fmt.Sprintf("The kind %s is not served by the spoke cluster anymore", identifier.Kind),
+	}
+}
+
+// buildKindUnavailableAvailableCondition builds the available condition of a manifest whose kind is not served by the
+// spoke anymore, it can't be available until the kind is served again.
+func buildKindUnavailableAvailableCondition(identifier workv1alpha1.ResourceIdentifier) metav1.Condition {
+	cond := buildKindUnavailableCondition(identifier)
+	cond.Type = ConditionTypeAvailable
+	cond.Status = metav1.ConditionFalse
+	return cond
+}
+
+// manifestError is an error applying a manifest with a more specific reason than a generic apply failure.
+type manifestError struct {
+	reason string
+	err    error
+}
+
+func newManifestError(reason string, err error) *manifestError {
+	return &manifestError{reason: reason, err: err}
+}
+
+func (e *manifestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *manifestError) Unwrap() error {
+	return e.err
+}
+
+// isTransientFailure checks if a manifest failed for a reason that is likely to go away by itself soon.
+func isTransientFailure(err error) bool {
+	switch applyFailureReason(err) {
+	case ReasonMappingNotFound, ReasonApplyTimeout:
+		return true
+	}
+	return false
+}
+
+// isPermanentFailure checks if a manifest failed for a reason that only changing the work can fix,
+// so there is no point in retrying it.
+func isPermanentFailure(err error) bool {
+	switch applyFailureReason(err) {
+	case ReasonDecodeFailed, ReasonObjectTooLarge, ReasonDependencyCycle, ReasonOverlayFailed:
+		return true
+	}
+	return false
+}
+
+// isRetryableAPIError checks if a request to an api server failed because the server was briefly unable to serve it.
+func isRetryableAPIError(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsConflict(err) || apierrors.IsServiceUnavailable(err)
+}
+
+// applyFailureReason returns the reason of the applied condition of a manifest that failed to apply.
+func applyFailureReason(err error) string {
+	var mErr *manifestError
+	if errors.As(err, &mErr) {
+		return mErr.reason
+	}
+	return ReasonAppliedManifestFailed
+}
+
 func buildAppliedStatusCondition(err error, observedGeneration int64) metav1.Condition {
 	if err != nil {
+		reason := applyFailureReason(err)
+		message := fmt.Sprintf("Failed to apply manifest: %v", err)
+		if reason == ReasonDecodeFailed {
+			message = fmt.Sprintf("Failed to decode manifest: %v", err)
+		}
 		return metav1.Condition{
 			Type:               ConditionTypeApplied,
 			Status:             metav1.ConditionFalse,
 			LastTransitionTime: metav1.Now(),
-			Reason:             "AppliedManifestFailed",
-			Message:            fmt.Sprintf("Failed to apply manifest: %v", err),
+			Reason:             reason,
+			Message:            message,
 		}
 	}
 
@@ -409,30 +1686,160 @@ func buildAppliedStatusCondition(err error, observedGeneration int64) metav1.Con
 		Status:             metav1.ConditionTrue,
 		LastTransitionTime: metav1.Now(),
 		ObservedGeneration: observedGeneration,
-		Reason:             "AppliedManifestComplete",
+		Reason:             ReasonAppliedManifestComplete,
 		Message:            "Apply manifest complete",
 	}
 }
 
+// buildDryRunCondition builds the applied condition of a manifest that was only dry run, it tells what applying
+// the manifest would do. The manifest is not applied so the condition is false.
+func buildDryRunCondition(action applyAction, observedGeneration int64) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		ObservedGeneration: observedGeneration,
+	}
+	switch {
+	case action.created:
+		condition.Reason = ReasonDryRunWouldCreate
+		condition.Message = "Applying the manifest would create the resource"
+	case len(action.strategy) != 0:
+		condition.Reason = ReasonDryRunWouldUpdate
+		condition.Message = fmt.Sprintf("Applying the manifest would update the resource with %s", action.strategy)
+	default:
+		condition.Reason = ReasonDryRunUnchanged
+		condition.Message = "The resource already matches the manifest"
+	}
+	return condition
+}
+
+// buildManifestCondition builds the condition of a manifest from the result of applying it, on top of
+// the condition the work reported for it before.
+func buildManifestCondition(result applyResult, previous []workv1alpha1.ManifestCondition, dryRun bool) workv1alpha1.ManifestCondition {
+	if result.paused {
+		return buildPausedManifestCondition(result, previous)
+	}
+	appliedCondition := buildAppliedStatusCondition(redactApplyError(result.identifier, result.err), result.generation)
+	if result.err == nil && result.action.conflictsForced {
+		appliedCondition.Reason = ReasonConflictsForceResolved
+		appliedCondition.Message = "Apply manifest complete, taking over the fields owned by other field managers"
+	}
+	if result.err == nil && len(result.scopeReason) != 0 {
+		appliedCondition.Reason = result.scopeReason
+		appliedCondition.Message = "Apply manifest complete, " + result.scopeMessage
+	}
+	if result.err == nil && result.action.createOnlySkipped {
+		appliedCondition.Reason = ReasonCreateOnlySkipped
+		appliedCondition.Message = "The resource already exists, the manifest is only applied to create it"
+	}
+	if result.err == nil && dryRun {
+		appliedCondition = buildDryRunCondition(result.action, result.generation)
+	}
+	if result.kindUnavailable {
+		appliedCondition = buildKindUnavailableCondition(result.identifier)
+	}
+	manifestCondition := workv1alpha1.ManifestCondition{
+		Identifier: result.identifier,
+		Conditions: []metav1.Condition{appliedCondition},
+	}
+	foundmanifestCondition := findManifestConditionByIdentifier(result.identifier, previous)
+	if foundmanifestCondition != nil {
+		manifestCondition.Conditions = foundmanifestCondition.Conditions
+		manifestCondition.ApplyStrategy = foundmanifestCondition.ApplyStrategy
+		manifestCondition.ObservedHash = foundmanifestCondition.ObservedHash
+		meta.SetStatusCondition(&manifestCondition.Conditions, appliedCondition)
+		meta.RemoveStatusCondition(&manifestCondition.Conditions, ConditionTypePaused)
+	}
+	// only a write changes how the resource was applied
+	if result.err == nil && len(result.action.strategy) != 0 && !dryRun {
+		manifestCondition.ApplyStrategy = result.action.strategy
+	}
+	// the hash lets the users match the status with the spec hash annotation of the live object
+	if result.err == nil && len(result.hash) != 0 && !dryRun {
+		manifestCondition.ObservedHash = result.hash
+	}
+	// we can only tell if the manifest is available once it is applied
+	switch {
+	case result.kindUnavailable:
+		meta.SetStatusCondition(&manifestCondition.Conditions, buildKindUnavailableAvailableCondition(result.identifier))
+	case result.err == nil && !dryRun:
+		meta.SetStatusCondition(&manifestCondition.Conditions,
+			buildAvailableStatusCondition(result.available, result.availableMsg, result.generation))
+	}
+	return manifestCondition
+}
+
+// buildWorkPausedCondition builds the Paused condition of a work whose spec pauses it.
+func buildWorkPausedCondition(observedGeneration int64) metav1.Condition {
+	return metav1.Condition{
+		Type:               ConditionTypePaused,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: observedGeneration,
+		Reason:             ReasonWorkPaused,
+		Message:            "The manifests are neither applied nor pruned until the work is resumed",
+	}
+}
+
+// buildPausedManifestCondition builds the condition of a manifest skipped for its paused annotation.
+// It keeps what we reported for the manifest before, so a paused manifest neither fails the work nor
+// loses the resource applied before it was paused.
+func buildPausedManifestCondition(result applyResult, previous []workv1alpha1.ManifestCondition) workv1alpha1.ManifestCondition {
+	manifestCondition := workv1alpha1.ManifestCondition{Identifier: result.identifier}
+	if found := findManifestConditionByIdentifier(result.identifier, previous); found != nil {
+		manifestCondition.Conditions = found.Conditions
+		manifestCondition.ApplyStrategy = found.ApplyStrategy
+		manifestCondition.ObservedHash = found.ObservedHash
+	}
+	meta.SetStatusCondition(&manifestCondition.Conditions, metav1.Condition{
+		Type:    ConditionTypePaused,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonManifestPaused,
+		Message: fmt.Sprintf("The manifest is not applied while it has the %s annotation", PausedAnnotation),
+	})
+	return manifestCondition
+}
+
 // generateWorkAppliedStatusCondition generate appied status condition for work.
 // If one of the manifests is applied failed on the spoke, the applied status condition of the work is false.
-func generateWorkAppliedStatusCondition(manifestConditions []workv1alpha1.ManifestCondition, observedGeneration int64) metav1.Condition {
+// If requireAvailable is set, the applied status condition of the work is also false until all the manifests are available.
+func generateWorkAppliedStatusCondition(manifestConditions []workv1alpha1.ManifestCondition, observedGeneration int64,
+	requireAvailable bool) metav1.Condition {
+	// every manifest is applied whatever the others do, so the condition counts all the failing ones
+	failed := 0
 	for _, manifestCond := range manifestConditions {
+		// a paused manifest is neutral whatever happened to it before it was paused
+		if meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypePaused) {
+			continue
+		}
 		if meta.IsStatusConditionFalse(manifestCond.Conditions, ConditionTypeApplied) {
-			return metav1.Condition{
-				Type:               ConditionTypeApplied,
-				Status:             metav1.ConditionFalse,
-				Reason:             "AppliedWorkFailed",
-				Message:            "Failed to apply work",
-				ObservedGeneration: observedGeneration,
-			}
+			failed++
+		}
+	}
+	if failed != 0 {
+		return metav1.Condition{
+			Type:               ConditionTypeApplied,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonAppliedWorkFailed,
+			Message:            fmt.Sprintf("Failed to apply %d of %d manifests of the work", failed, len(manifestConditions)),
+			ObservedGeneration: observedGeneration,
+		}
+	}
+
+	if requireAvailable && !allManifestsAvailable(manifestConditions) {
+		return metav1.Condition{
+			Type:               ConditionTypeApplied,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonAppliedWorkNotAvailable,
+			Message:            "Work is applied but not all of its manifests are available",
+			ObservedGeneration: observedGeneration,
 		}
 	}
 
 	return metav1.Condition{
 		Type:               ConditionTypeApplied,
 		Status:             metav1.ConditionTrue,
-		Reason:             "AppliedWorkComplete",
+		Reason:             ReasonAppliedWorkComplete,
 		Message:            "Apply work complete",
 		ObservedGeneration: observedGeneration,
 	}
@@ -0,0 +1,1817 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// newTestRESTMapper returns a RESTMapper that knows the kinds used in the tests.
+func newTestRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	restMapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	restMapper.Add(workv1alpha1.SchemeGroupVersion.WithKind("AppliedWork"), meta.RESTScopeRoot)
+	return restMapper
+}
+
+// typedPatchReactor applies the strategic merge patches of a resource to its typed object, the fake dynamic client
+// can't compute them on the unstructured objects it tracks.
+func typedPatchReactor(tracker clienttesting.ObjectTracker, gvr schema.GroupVersionResource, typed runtime.Object) clienttesting.ReactionFunc {
+	return func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(clienttesting.PatchAction)
+		if patchAction.GetPatchType() != types.StrategicMergePatchType {
+			return false, nil, nil
+		}
+		current, err := tracker.Get(gvr, patchAction.GetNamespace(), patchAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		currentData, err := json.Marshal(current)
+		if err != nil {
+			return true, nil, err
+		}
+		patchedData, err := strategicpatch.StrategicMergePatch(currentData, patchAction.GetPatch(), typed)
+		if err != nil {
+			return true, nil, err
+		}
+		patched := &unstructured.Unstructured{}
+		if err := patched.UnmarshalJSON(patchedData); err != nil {
+			return true, nil, err
+		}
+		return true, patched, tracker.Update(gvr, patched, patchAction.GetNamespace())
+	}
+}
+
+// newTestManifest marshals an unstructured object into a manifest.
+func newTestManifest(t *testing.T, obj *unstructured.Unstructured) workv1alpha1.Manifest {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("failed to marshal the manifest: %v", err)
+	}
+	return workv1alpha1.Manifest{RawExtension: runtime.RawExtension{Raw: raw}}
+}
+
+func TestIsUpdateWarranted(t *testing.T) {
+	withHash := func(hash string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAnnotations(map[string]string{specHashAnnotation: hash})
+		return obj
+	}
+	tests := map[string]struct {
+		manifest, live *unstructured.Unstructured
+		want           bool
+	}{
+		"same spec hash":      {manifest: withHash("a"), live: withHash("a"), want: false},
+		"different spec hash": {manifest: withHash("b"), live: withHash("a"), want: true},
+		"live object without a spec hash": {
+			manifest: withHash("a"), live: &unstructured.Unstructured{Object: map[string]interface{}{}}, want: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isUpdateWarranted(tt.manifest, tt.live); got != tt.want {
+				t.Errorf("isUpdateWarranted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextForceReapply(t *testing.T) {
+	interval := 10 * time.Minute
+	tests := map[string]struct {
+		interval     time.Duration
+		lastFullAgo  time.Duration
+		neverApplied bool
+		wantMin      time.Duration
+		wantMax      time.Duration
+	}{
+		"disabled":                 {lastFullAgo: time.Minute},
+		"never fully applied":      {interval: interval, neverApplied: true},
+		"due later":                {interval: interval, lastFullAgo: 4 * time.Minute, wantMin: 5 * time.Minute, wantMax: 6 * time.Minute},
+		"overdue after a failure":  {interval: interval, lastFullAgo: 25 * time.Minute, wantMin: interval, wantMax: interval},
+		"due exactly at the limit": {interval: interval, lastFullAgo: interval, wantMin: interval, wantMax: interval},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{}
+			if !tt.neverApplied {
+				lastFullApply := metav1.NewTime(time.Now().Add(-tt.lastFullAgo))
+				work.Status.LastFullApplyTime = &lastFullApply
+			}
+			r := &ApplyWorkReconciler{forceReapplyInterval: tt.interval}
+			if got := r.nextForceReapply(work); got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("nextForceReapply() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestApplyManifestsSkipsNamespacedOwnerOfClusterScopedObject(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	namespacedOwner := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       "owner",
+		UID:        "configmap-uid",
+	}
+	clusterRole := newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "", "reader")
+	clusterRole.SetOwnerReferences([]metav1.OwnerReference{namespacedOwner})
+
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+
+	results := r.applyManifests(context.Background(), []workv1alpha1.Manifest{newTestManifest(t, clusterRole)}, nil, nil, owner, applyOptions{})
+	if len(results) != 1 || results[0].err != nil {
+		t.Fatalf("applyManifests() = %+v, want the cluster role applied", results)
+	}
+
+	gvr := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	applied, err := dynamicClient.Resource(gvr).Get(context.Background(), "reader", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the applied cluster role: %v", err)
+	}
+	owners := applied.GetOwnerReferences()
+	if len(owners) != 1 || owners[0] != owner {
+		t.Errorf("cluster role owner references = %+v, want only the appliedWork %+v", owners, owner)
+	}
+}
+
+func TestApplyManifestsAppliesNamespaceFirst(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	var created []string
+	dynamicClient.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		created = append(created, action.GetResource().Resource)
+		return false, nil, nil
+	})
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+
+	// the config map comes first in the work but can only be created once its namespace exists
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "team", "config")),
+		newTestManifest(t, newUnstructured("v1", "Namespace", "", "team")),
+	}
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	for i, result := range results {
+		if result.err != nil {
+			t.Errorf("applyManifests() failed manifest %d: %v", i, result.err)
+		}
+		if result.identifier.Ordinal != i {
+			t.Errorf("applyManifests() result %d has ordinal %d, want the results in the order of the manifests", i, result.identifier.Ordinal)
+		}
+	}
+	if want := []string{"namespaces", "configmaps"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("applyManifests() created %v, want %v", created, want)
+	}
+}
+
+func TestApplyManifestsContinuesAfterAFailure(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	dynamicClient.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if obj.GetName() == "rejected" {
+			return true, nil, fmt.Errorf("rejected by the admission webhook")
+		}
+		return false, nil, nil
+	})
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "first")),
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "rejected")),
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "last")),
+	}
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	if len(results) != len(manifests) {
+		t.Fatalf("applyManifests() returned %d results, want %d", len(results), len(manifests))
+	}
+	if results[1].err == nil {
+		t.Errorf("applyManifests() applied the rejected manifest")
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	var manifestConditions []workv1alpha1.ManifestCondition
+	for i, result := range results {
+		manifestConditions = append(manifestConditions, workv1alpha1.ManifestCondition{
+			Identifier: result.identifier,
+			Conditions: []metav1.Condition{buildAppliedStatusCondition(result.err, result.generation)},
+		})
+		if i == 1 {
+			continue
+		}
+		if result.err != nil {
+			t.Errorf("applyManifests() failed manifest %d after the failure of another one: %v", i, result.err)
+			continue
+		}
+		if _, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), result.identifier.Name, metav1.GetOptions{}); err != nil {
+			t.Errorf("failed to get the config map of manifest %d: %v", i, err)
+		}
+	}
+
+	cond := generateWorkAppliedStatusCondition(manifestConditions, 1, false)
+	if cond.Status != metav1.ConditionFalse || cond.Message != "Failed to apply 1 of 3 manifests of the work" {
+		t.Errorf("generateWorkAppliedStatusCondition() = %+v, want false for the single failing manifest", cond)
+	}
+}
+
+func TestRollBackCreated(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	tests := map[string]struct {
+		policy         workv1alpha1.ApplyPolicyType
+		wantRolledBack int
+	}{
+		"all or nothing deletes the created resources": {
+			policy:         workv1alpha1.ApplyPolicyAllOrNothing,
+			wantRolledBack: 1,
+		},
+		"best effort keeps the created resources": {
+			policy: workv1alpha1.ApplyPolicyBestEffort,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			existing := newUnstructured("v1", "ConfigMap", "default", "existing")
+			existing.SetOwnerReferences([]metav1.OwnerReference{owner})
+			dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), existing)
+			dynamicClient.PrependReactor("create", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				obj := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+				if obj.GetName() == "rejected" {
+					return true, nil, fmt.Errorf("rejected by the admission webhook")
+				}
+				return false, nil, nil
+			})
+			dynamicClient.PrependReactor("patch", "configmaps", typedPatchReactor(dynamicClient.Tracker(), gvr, &corev1.ConfigMap{}))
+			r := &ApplyWorkReconciler{
+				spokeDynamicClient: dynamicClient,
+				restMapper:         newTestRESTMapper(),
+			}
+			work := &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{ApplyPolicy: tt.policy}}
+			opts := buildApplyOptions(work)
+
+			manifests := []workv1alpha1.Manifest{
+				newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "created")),
+				newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "rejected")),
+				newTestManifest(t, existing),
+			}
+			results := r.applyManifests(context.Background(), manifests, nil, nil, owner, opts)
+			rolledBack := 0
+			if opts.allOrNothing {
+				rolledBack = r.rollBackCreated(context.Background(), types.NamespacedName{Namespace: "cluster-a", Name: "work"}, results)
+			}
+			if rolledBack != tt.wantRolledBack {
+				t.Errorf("rolled back %d resources, want %d", rolledBack, tt.wantRolledBack)
+			}
+
+			_, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "created", metav1.GetOptions{})
+			if tt.wantRolledBack > 0 {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("get the created config map error = %v, want it rolled back", err)
+				}
+				if applyFailureReason(results[0].err) != ReasonRolledBack || results[0].updated {
+					t.Errorf("result of the created config map = %+v, want it rolled back", results[0])
+				}
+			} else {
+				if err != nil {
+					t.Errorf("failed to get the created config map: %v", err)
+				}
+				if results[0].err != nil {
+					t.Errorf("result of the created config map error = %v, want it applied", results[0].err)
+				}
+			}
+			// a resource that existed before the apply is never deleted
+			if _, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "existing", metav1.GetOptions{}); err != nil {
+				t.Errorf("failed to get the existing config map: %v", err)
+			}
+			if results[2].err != nil {
+				t.Errorf("result of the existing config map error = %v, want it applied", results[2].err)
+			}
+		})
+	}
+}
+
+func TestApplyManifestsReportsDecodeFailure(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+		restMapper:         newTestRESTMapper(),
+	}
+
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "first")),
+		{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion": "v1", "metadata": {"name": "no-kind"}}`)}},
+	}
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	if len(results) != len(manifests) {
+		t.Fatalf("applyManifests() returned %d results, want %d", len(results), len(manifests))
+	}
+	if results[0].err != nil {
+		t.Errorf("applyManifests() failed the valid manifest: %v", results[0].err)
+	}
+	if want := (workv1alpha1.ResourceIdentifier{Ordinal: 1}); results[1].identifier != want {
+		t.Errorf("applyManifests() identifier of the invalid manifest = %+v, want %+v", results[1].identifier, want)
+	}
+
+	cond := buildAppliedStatusCondition(results[1].err, 1)
+	if cond.Status != metav1.ConditionFalse || cond.Reason != ReasonDecodeFailed {
+		t.Errorf("buildAppliedStatusCondition() = %+v, want a false condition with the DecodeFailed reason", cond)
+	}
+	if !strings.HasPrefix(cond.Message, "Failed to decode manifest: ") || !strings.Contains(cond.Message, results[1].err.Error()) {
+		t.Errorf("buildAppliedStatusCondition() message = %q, want the decode error", cond.Message)
+	}
+}
+
+func TestFailedResourcesOf(t *testing.T) {
+	applied := workv1alpha1.ResourceIdentifier{Ordinal: 0, Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "applied"}
+	failed := workv1alpha1.ResourceIdentifier{Ordinal: 1, Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "failed"}
+	undecoded := workv1alpha1.ResourceIdentifier{Ordinal: 2}
+	manifestConditions := []workv1alpha1.ManifestCondition{
+		{
+			Identifier: applied,
+			Conditions: []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionTrue}},
+		},
+		{
+			Identifier: failed,
+			Conditions: []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionFalse}},
+		},
+		{
+			Identifier: undecoded,
+		},
+	}
+	got := failedResourcesOf(manifestConditions)
+	want := []workv1alpha1.ResourceIdentifier{failed, undecoded}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("failedResourcesOf() = %+v, want %+v", got, want)
+	}
+	if got := failedResourcesOf(manifestConditions[:1]); got != nil {
+		t.Errorf("failedResourcesOf() of an applied work = %+v, want nil", got)
+	}
+}
+
+func TestRecordReconcile(t *testing.T) {
+	succeeded := applyResult{}
+	failed := applyResult{err: fmt.Errorf("failed")}
+	status := &workv1alpha1.WorkStatus{}
+	now := metav1.Now()
+
+	recordReconcile(status, 1, []applyResult{succeeded, failed}, now)
+	want := []workv1alpha1.ReconcileRecord{{Time: now, ObservedGeneration: 1, Succeeded: 1, Failed: 1}}
+	if !reflect.DeepEqual(status.History, want) {
+		t.Fatalf("recordReconcile() history = %+v, want %+v", status.History, want)
+	}
+
+	// the same outcome is not recorded again
+	recordReconcile(status, 1, []applyResult{succeeded, failed}, metav1.NewTime(now.Add(time.Minute)))
+	if !reflect.DeepEqual(status.History, want) {
+		t.Errorf("recordReconcile() of the same outcome history = %+v, want %+v", status.History, want)
+	}
+
+	// the oldest records are dropped
+	for generation := int64(2); generation <= maxReconcileHistory+1; generation++ {
+		recordReconcile(status, generation, []applyResult{succeeded}, now)
+	}
+	if len(status.History) != maxReconcileHistory {
+		t.Fatalf("recordReconcile() kept %d records, want %d", len(status.History), maxReconcileHistory)
+	}
+	if first, last := status.History[0], status.History[maxReconcileHistory-1]; first.ObservedGeneration != 2 ||
+		last.ObservedGeneration != maxReconcileHistory+1 {
+		t.Errorf("recordReconcile() kept generations %d to %d, want 2 to %d", first.ObservedGeneration, last.ObservedGeneration,
+			maxReconcileHistory+1)
+	}
+}
+
+func TestSecretApplyErrorIsRedacted(t *testing.T) {
+	// the api server may echo the data of a secret back in its error
+	secretData := "c3VwZXItc2VjcmV0"
+	secret := applyResult{
+		identifier: workv1alpha1.ResourceIdentifier{Ordinal: 1, Version: "v1", Kind: "Secret", Namespace: "default", Name: "creds"},
+		err:        newManifestError(ReasonObjectTooLarge, fmt.Errorf("object is too large: data.password=%s", secretData)),
+	}
+	configMap := applyResult{
+		identifier: workv1alpha1.ResourceIdentifier{Ordinal: 0, Version: "v1", Kind: "ConfigMap", Namespace: "default", Name: "config"},
+		err:        fmt.Errorf("invalid data.key=visible"),
+	}
+
+	cond := meta.FindStatusCondition(buildManifestCondition(secret, nil, false).Conditions, ConditionTypeApplied)
+	if cond == nil || cond.Reason != ReasonObjectTooLarge {
+		t.Fatalf("buildManifestCondition() applied condition = %+v, want the %s reason kept", cond, ReasonObjectTooLarge)
+	}
+	if strings.Contains(cond.Message, secretData) || !strings.Contains(cond.Message, "default/creds") {
+		t.Errorf("buildManifestCondition() message = %q, want the secret named without its error", cond.Message)
+	}
+	cond = meta.FindStatusCondition(buildManifestCondition(configMap, nil, false).Conditions, ConditionTypeApplied)
+	if cond == nil || !strings.Contains(cond.Message, "visible") {
+		t.Errorf("buildManifestCondition() applied condition = %+v, want the error of the config map", cond)
+	}
+
+	status := &workv1alpha1.WorkStatus{}
+	setLastError(status, []applyResult{configMap, secret})
+	if strings.Contains(status.LastError, secretData) || !strings.Contains(status.LastError, "visible") {
+		t.Errorf("setLastError() = %q, want the error of the config map only", status.LastError)
+	}
+	if got := redactApplyError(secret.identifier, secret.err); !isPermanentFailure(got) || strings.Contains(got.Error(), secretData) {
+		t.Errorf("redactApplyError() = %v, want a permanent failure without the secret data", got)
+	}
+}
+
+func TestSetLastErrorTruncatesOnRuneBoundary(t *testing.T) {
+	status := &workv1alpha1.WorkStatus{}
+	setLastError(status, []applyResult{{err: fmt.Errorf("%s", strings.Repeat("é", maxLastErrorLength))}})
+	if len(status.LastError) > maxLastErrorLength || !strings.HasSuffix(status.LastError, "...") {
+		t.Errorf("setLastError() recorded %d bytes, want it cut to %d", len(status.LastError), maxLastErrorLength)
+	}
+	if !utf8.ValidString(status.LastError) {
+		t.Errorf("setLastError() = %q, want valid UTF-8", status.LastError)
+	}
+}
+
+// doneContextStatusClient fails the status updates made with a done context, like the client of a real hub cluster.
+type doneContextStatusClient struct {
+	client.Client
+}
+
+func (c doneContextStatusClient) Status() client.StatusWriter {
+	return doneContextStatusWriter{c.Client.Status()}
+}
+
+type doneContextStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w doneContextStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func TestReconcileMarksInterruptedOnShutdown(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name, Generation: 1, Finalizers: []string{workFinalizer}},
+	}
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+	}
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	r := &ApplyWorkReconciler{
+		client:             doneContextStatusClient{hubClient},
+		spokeClient:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build(),
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+		restMapper:         newTestRESTMapper(),
+		recorder:           record.NewFakeRecorder(10),
+		backoff:            newWorkBackoff(time.Second, time.Minute),
+	}
+
+	// the manager cancels the context of the reconciles in flight when it shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName}); err != nil {
+		t.Fatalf("Reconcile() error = %v, want the work marked as interrupted", err)
+	}
+
+	got := &workv1alpha1.Work{}
+	if err := hubClient.Get(context.Background(), nsWorkName, got); err != nil {
+		t.Fatalf("failed to get the work: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, ConditionTypeApplied)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != ReasonReconcileInterrupted || cond.ObservedGeneration != 1 {
+		t.Errorf("work applied condition = %+v, want an unknown %s condition", cond, ReasonReconcileInterrupted)
+	}
+}
+
+func TestApplyManifestsSkipsPausedManifest(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	paused := newUnstructured("v1", "ConfigMap", "default", "paused")
+	paused.SetAnnotations(map[string]string{PausedAnnotation: "true"})
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, paused),
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "applied")),
+	}
+	// the paused manifest was applied and then failed before it was paused
+	previous := []workv1alpha1.ManifestCondition{{
+		Identifier: workv1alpha1.ResourceIdentifier{Ordinal: 0, Version: "v1", Kind: "ConfigMap", Resource: "configmaps",
+			Namespace: "default", Name: "paused"},
+		Conditions:   []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionFalse, Reason: "ApplyFailed"}},
+		ObservedHash: "previous-hash",
+	}}
+	results := r.applyManifests(context.Background(), manifests, nil, previous, owner, applyOptions{})
+	if !results[0].paused || results[0].err != nil {
+		t.Errorf("applyManifests() result of the paused manifest = %+v, want it skipped", results[0])
+	}
+	if results[1].paused || results[1].err != nil {
+		t.Errorf("applyManifests() result of the other manifest = %+v, want it applied", results[1])
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if _, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "paused", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("get the paused config map error = %v, want it not applied", err)
+	}
+
+	var manifestConditions []workv1alpha1.ManifestCondition
+	for _, result := range results {
+		manifestConditions = append(manifestConditions, buildManifestCondition(result, previous, false))
+	}
+	if !meta.IsStatusConditionTrue(manifestConditions[0].Conditions, ConditionTypePaused) ||
+		manifestConditions[0].ObservedHash != "previous-hash" {
+		t.Errorf("buildManifestCondition() of the paused manifest = %+v, want it paused with its previous hash", manifestConditions[0])
+	}
+	if meta.FindStatusCondition(manifestConditions[1].Conditions, ConditionTypePaused) != nil {
+		t.Errorf("buildManifestCondition() of the other manifest = %+v, want it not paused", manifestConditions[1])
+	}
+	if got := failedResourcesOf(manifestConditions); got != nil {
+		t.Errorf("failedResourcesOf() = %+v, want the paused manifest to be neutral", got)
+	}
+	if cond := generateWorkAppliedStatusCondition(manifestConditions, 1, false); cond.Status != metav1.ConditionTrue {
+		t.Errorf("generateWorkAppliedStatusCondition() = %+v, want the paused manifest to be neutral", cond)
+	}
+}
+
+func TestApplyTimeoutOf(t *testing.T) {
+	r := &ApplyWorkReconciler{
+		applyTimeout: time.Minute,
+		applyTimeoutByKind: map[string]time.Duration{
+			"ConfigMap":                5 * time.Second,
+			"CustomResourceDefinition": 2 * time.Minute,
+			"CustomResourceDefinition.apiextensions.k8s.io": 5 * time.Minute,
+		},
+	}
+	tests := map[string]struct {
+		gk   schema.GroupKind
+		want time.Duration
+	}{
+		"kind override": {
+			gk:   schema.GroupKind{Kind: "ConfigMap"},
+			want: 5 * time.Second,
+		},
+		"kind with group override wins": {
+			gk:   schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"},
+			want: 5 * time.Minute,
+		},
+		"kind override of another group": {
+			gk:   schema.GroupKind{Group: "example.com", Kind: "CustomResourceDefinition"},
+			want: 2 * time.Minute,
+		},
+		"fall back to the global timeout": {
+			gk:   schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			want: time.Minute,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := r.applyTimeoutOf(tt.gk); got != tt.want {
+				t.Errorf("applyTimeoutOf(%v) = %v, want %v", tt.gk, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppliedByAnnotationIsNotDrift(t *testing.T) {
+	applied := newUnstructured("v1", "ConfigMap", "default", "cm")
+	if err := setSpecHashAnnotation(applied); err != nil {
+		t.Fatalf("setSpecHashAnnotation() = %v", err)
+	}
+	setAppliedByAnnotation(applied, "controller-0")
+
+	desired := newUnstructured("v1", "ConfigMap", "default", "cm")
+	if err := setSpecHashAnnotation(desired); err != nil {
+		t.Fatalf("setSpecHashAnnotation() = %v", err)
+	}
+	setAppliedByAnnotation(desired, "controller-1")
+
+	if got := desired.GetAnnotations()[AppliedByAnnotation]; got != "controller-1" {
+		t.Errorf("applied-by annotation = %q, want controller-1", got)
+	}
+	if isUpdateWarranted(desired, applied) {
+		t.Errorf("isUpdateWarranted() = true, want a different instance not to warrant an update")
+	}
+}
+
+func TestValidateApplyModeByKind(t *testing.T) {
+	tests := map[string]struct {
+		modes   map[string]string
+		wantErr bool
+	}{
+		"strategic merge of a core kind": {
+			modes: map[string]string{"ConfigMap": ApplyModeStrategicMerge},
+		},
+		"strategic merge of a kind with its group": {
+			modes: map[string]string{"Deployment.apps": ApplyModeStrategicMerge},
+		},
+		"server side apply of a custom kind": {
+			modes: map[string]string{"Widget.example.com": ApplyModeServerSide},
+		},
+		"strategic merge of a custom kind": {
+			modes:   map[string]string{"Widget.example.com": ApplyModeStrategicMerge},
+			wantErr: true,
+		},
+		"unknown mode": {
+			modes:   map[string]string{"ConfigMap": "Replace"},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateApplyModeByKind(tt.modes); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateApplyModeByKind() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyOptionsOf(t *testing.T) {
+	r := &ApplyWorkReconciler{
+		applyModeByKind: map[string]string{"Deployment.apps": ApplyModeStrategicMerge},
+	}
+	deployment := schema.GroupKind{Group: "apps", Kind: "Deployment"}
+	if got := r.applyOptionsOf(deployment, applyOptions{}).mode; got != ApplyModeStrategicMerge {
+		t.Errorf("applyOptionsOf() mode = %q, want the mode of the kind", got)
+	}
+	if got := r.applyOptionsOf(deployment, applyOptions{mode: ApplyModeServerSide}).mode; got != ApplyModeServerSide {
+		t.Errorf("applyOptionsOf() mode = %q, want the mode of the work", got)
+	}
+	if got := r.applyOptionsOf(schema.GroupKind{Kind: "ConfigMap"}, applyOptions{}).mode; got != "" {
+		t.Errorf("applyOptionsOf() mode = %q, want the default mode", got)
+	}
+}
+
+func TestCheckObjectSize(t *testing.T) {
+	obj := newUnstructured("v1", "ConfigMap", "default", "cm")
+	if err := unstructured.SetNestedField(obj.Object, strings.Repeat("x", 2048), "data", "big"); err != nil {
+		t.Fatalf("SetNestedField() = %v", err)
+	}
+
+	tests := map[string]struct {
+		maxObjectSize int
+		wantReason    string
+	}{
+		"no limit": {},
+		"under the limit": {
+			maxObjectSize: 4096,
+		},
+		"over the limit": {
+			maxObjectSize: 1024,
+			wantReason:    ReasonObjectTooLarge,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{maxObjectSize: tt.maxObjectSize}
+			err := r.checkObjectSize(obj)
+			if len(tt.wantReason) == 0 {
+				if err != nil {
+					t.Errorf("checkObjectSize() = %v, want no error", err)
+				}
+				return
+			}
+			if got := buildAppliedStatusCondition(err, 0).Reason; got != tt.wantReason {
+				t.Errorf("applied condition reason = %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+// discoveringRESTMapper learns a new kind when it's reset, like a mapper discovering a freshly established CRD.
+// It learns nothing while the new kind is empty, like a CRD that is not established yet.
+type discoveringRESTMapper struct {
+	*meta.DefaultRESTMapper
+	newKind schema.GroupVersionKind
+	resets  int
+}
+
+func (m *discoveringRESTMapper) Reset() {
+	m.resets++
+	if len(m.newKind.Kind) != 0 {
+		m.Add(m.newKind, meta.RESTScopeNamespace)
+	}
+}
+
+func TestDecodeUnstructuredResetsRESTMapper(t *testing.T) {
+	widget := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	manifest := newTestManifest(t, widget)
+
+	r := &ApplyWorkReconciler{restMapper: newTestRESTMapper()}
+	_, _, err := r.decodeUnstructured(manifest)
+	if !isNoMatchError(err) {
+		t.Fatalf("decodeUnstructured() = %v, want a no match error from a mapper that can't be reset", err)
+	}
+	if got := applyFailureReason(newManifestError(ReasonMappingNotFound, err)); got != ReasonMappingNotFound {
+		t.Errorf("applyFailureReason() = %q, want %s", got, ReasonMappingNotFound)
+	}
+
+	r.restMapper = &discoveringRESTMapper{
+		DefaultRESTMapper: meta.NewDefaultRESTMapper(nil),
+		newKind:           widget.GroupVersionKind(),
+	}
+	gvr, _, err := r.decodeUnstructured(manifest)
+	if err != nil {
+		t.Fatalf("decodeUnstructured() = %v, want the kind found after the reset", err)
+	}
+	if gvr.Resource != "widgets" {
+		t.Errorf("decodeUnstructured() resource = %q, want widgets", gvr.Resource)
+	}
+}
+
+func TestDecodeUnstructuredResetsSpokeRESTMapper(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "configmaps", Namespaced: true, Kind: "ConfigMap"}},
+		}},
+	}}
+	r := &ApplyWorkReconciler{restMapper: newSpokeRESTMapper(discoveryClient)}
+	if _, _, err := r.decodeUnstructured(newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config"))); err != nil {
+		t.Fatalf("decodeUnstructured() = %v, want the config map found", err)
+	}
+
+	// the CRD of the widgets is established after the mapper discovered the spoke cluster
+	discoveryClient.Resources = append(discoveryClient.Resources, &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "widgets", Namespaced: true, Kind: "Widget"}},
+	})
+	gvr, _, err := r.decodeUnstructured(newTestManifest(t, newUnstructured("example.com/v1", "Widget", "default", "widget")))
+	if err != nil {
+		t.Fatalf("decodeUnstructured() = %v, want the kind found after the reset", err)
+	}
+	if want := (schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}); gvr != want {
+		t.Errorf("decodeUnstructured() = %v, want %v", gvr, want)
+	}
+}
+
+func TestApplyManifestsMappingPending(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	restMapper := &discoveringRESTMapper{DefaultRESTMapper: meta.NewDefaultRESTMapper(nil)}
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+		restMapper:         restMapper,
+	}
+	widget := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config")),
+		newTestManifest(t, widget),
+	}
+
+	// the CRD of the widgets is not established yet
+	status := &workv1alpha1.WorkStatus{}
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	if results[0].err != nil {
+		t.Errorf("applyManifests() failed the config map: %v", results[0].err)
+	}
+	if got := applyFailureReason(results[1].err); got != ReasonMappingNotFound || !isTransientFailure(results[1].err) {
+		t.Errorf("applyManifests() failed the widget with %q (%v), want a transient %s", got, results[1].err, ReasonMappingNotFound)
+	}
+	if restMapper.resets != 1 {
+		t.Errorf("applyManifests() reset the mapper %d times, want only for the widget", restMapper.resets)
+	}
+	setMappingPendingCondition(status, results, 1)
+	cond := meta.FindStatusCondition(status.Conditions, ConditionTypeMappingPending)
+	if cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "Widget.example.com") {
+		t.Fatalf("setMappingPendingCondition() = %+v, want a true condition naming the widgets", cond)
+	}
+
+	// the CRD is established
+	restMapper.newKind = widget.GroupVersionKind()
+	results = r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	for i, result := range results {
+		if result.err != nil {
+			t.Errorf("applyManifests() failed manifest %d once the widgets are served: %v", i, result.err)
+		}
+	}
+	setMappingPendingCondition(status, results, 1)
+	if cond := meta.FindStatusCondition(status.Conditions, ConditionTypeMappingPending); cond != nil {
+		t.Errorf("setMappingPendingCondition() kept %+v once all the kinds are served", cond)
+	}
+}
+
+func TestApplyManifestsKindUnavailable(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	// the CRD of the widgets was uninstalled from the spoke cluster after we applied the widget
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+		restMapper:         restMapper,
+	}
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config")),
+		newTestManifest(t, newUnstructured("example.com/v1", "Widget", "default", "widget")),
+	}
+	widgetIdentifier := workv1alpha1.ResourceIdentifier{
+		Ordinal: 1, Group: "example.com", Version: "v1", Kind: "Widget", Resource: "widgets", Namespace: "default", Name: "widget",
+	}
+	previous := []workv1alpha1.ManifestCondition{{
+		Identifier: widgetIdentifier,
+		Conditions: []metav1.Condition{buildAppliedStatusCondition(nil, 1)},
+	}}
+
+	results := r.applyManifests(context.Background(), manifests, nil, previous, owner, applyOptions{})
+	if results[0].err != nil {
+		t.Errorf("applyManifests() failed the config map: %v", results[0].err)
+	}
+	if results[1].err != nil || !results[1].kindUnavailable || results[1].identifier != widgetIdentifier {
+		t.Fatalf("applyManifests() widget result = %+v, want it skipped with its previous identifier", results[1])
+	}
+	var manifestConditions []workv1alpha1.ManifestCondition
+	for _, result := range results {
+		manifestConditions = append(manifestConditions, buildManifestCondition(result, previous, false))
+	}
+	cond := meta.FindStatusCondition(manifestConditions[1].Conditions, ConditionTypeApplied)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != ReasonKindUnavailable {
+		t.Errorf("widget applied condition = %+v, want an unknown %s condition", cond, ReasonKindUnavailable)
+	}
+	cond = meta.FindStatusCondition(manifestConditions[1].Conditions, ConditionTypeAvailable)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonKindUnavailable {
+		t.Errorf("widget available condition = %+v, want a false %s condition", cond, ReasonKindUnavailable)
+	}
+	// the work doesn't wait for the widget to become available
+	if availabilityPending(manifestConditions) {
+		t.Errorf("availabilityPending() = true, want the widget left out")
+	}
+
+	// the widget stays tracked so that it is still cleaned up once it is removed from the work
+	work := &workv1alpha1.Work{Status: workv1alpha1.WorkStatus{ManifestConditions: manifestConditions}}
+	appliedWork := &workv1alpha1.AppliedWork{Status: workv1alpha1.AppliedtWorkStatus{
+		AppliedResources: []workv1alpha1.AppliedResourceMeta{{ResourceIdentifier: widgetIdentifier, UID: "widget-uid"}},
+	}}
+	statusReconciler := newWorkStatusReconciler(nil, nil, r.spokeDynamicClient, restMapper, nil, nil, PruneLimit{}, 0)
+	newRes, staleRes, _ := statusReconciler.calculateNewAppliedWork(context.Background(), work, appliedWork, nil)
+	if len(staleRes) != 0 {
+		t.Errorf("calculateNewAppliedWork() stale = %+v, want the widget kept", staleRes)
+	}
+	if !tracksResource(&workv1alpha1.AppliedWork{Status: workv1alpha1.AppliedtWorkStatus{AppliedResources: newRes}}, widgetIdentifier) {
+		t.Errorf("calculateNewAppliedWork() = %+v, want the widget still tracked", newRes)
+	}
+}
+
+func TestApplyManifestsOverlays(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	deployment := newUnstructured("apps/v1", "Deployment", "default", "web")
+	deployment.Object["spec"] = map[string]interface{}{"replicas": int64(2)}
+	workload := workv1alpha1.WorkloadTemplate{
+		Manifests: []workv1alpha1.Manifest{newTestManifest(t, deployment)},
+		Overlays: []workv1alpha1.ManifestOverlay{
+			{Ordinal: 0, Patch: []workv1alpha1.JSONPatchOperation{
+				{Op: "replace", Path: "/spec/replicas", Value: &runtime.RawExtension{Raw: []byte("3")}},
+			}},
+			{Ordinal: 0, Clusters: []string{"cluster-a"}, Patch: []workv1alpha1.JSONPatchOperation{
+				{Op: "replace", Path: "/spec/replicas", Value: &runtime.RawExtension{Raw: []byte("5")}},
+			}},
+		},
+	}
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	for cluster, want := range map[string]int64{"cluster-a": 5, "cluster-b": 3} {
+		t.Run(cluster, func(t *testing.T) {
+			dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+			r := &ApplyWorkReconciler{spokeDynamicClient: dynamicClient, restMapper: newTestRESTMapper(), clusterName: cluster}
+			opts := applyOptions{overlays: overlaysOf(workload, cluster)}
+			results := r.applyManifests(context.Background(), workload.Manifests, nil, nil, owner, opts)
+			if results[0].err != nil {
+				t.Fatalf("applyManifests() error = %v", results[0].err)
+			}
+			applied, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the deployment: %v", err)
+			}
+			if replicas, _, _ := unstructured.NestedInt64(applied.Object, "spec", "replicas"); replicas != want {
+				t.Errorf("applied replicas = %d, want %d", replicas, want)
+			}
+		})
+	}
+
+	r := &ApplyWorkReconciler{spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), restMapper: newTestRESTMapper()}
+	opts := applyOptions{overlays: map[int][]workv1alpha1.JSONPatchOperation{0: {
+		{Op: "replace", Path: "/spec/paused/value", Value: &runtime.RawExtension{Raw: []byte("true")}},
+	}}}
+	results := r.applyManifests(context.Background(), workload.Manifests, nil, nil, owner, opts)
+	if got := applyFailureReason(results[0].err); got != ReasonOverlayFailed || !isPermanentFailure(results[0].err) {
+		t.Errorf("applyManifests() failed the deployment with %q (%v), want a permanent %s", got, results[0].err, ReasonOverlayFailed)
+	}
+}
+
+func TestApplyManifestsHealthChecks(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	checked := newUnstructured("v1", "ConfigMap", "default", "checked")
+	checked.Object["data"] = map[string]interface{}{"ready": "false"}
+	unchecked := newUnstructured("v1", "ConfigMap", "default", "unchecked")
+	workload := workv1alpha1.WorkloadTemplate{
+		Manifests:    []workv1alpha1.Manifest{newTestManifest(t, checked), newTestManifest(t, unchecked)},
+		HealthChecks: []workv1alpha1.ManifestHealthCheck{{Ordinal: 0, Expression: `object.data.ready == "true"`}},
+	}
+	r := &ApplyWorkReconciler{spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), restMapper: newTestRESTMapper()}
+	results := r.applyManifests(context.Background(), workload.Manifests, nil, nil, owner,
+		applyOptions{healthChecks: compileHealthChecks(workload)})
+	if results[0].err != nil || results[0].available {
+		t.Errorf("applyManifests() result of the checked config map = %+v, want it applied but not available", results[0])
+	}
+	if results[1].err != nil || !results[1].available {
+		t.Errorf("applyManifests() result of the unchecked config map = %+v, want it available", results[1])
+	}
+}
+
+func TestDecodeUnstructuredPinnedVersion(t *testing.T) {
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Group: "example.com", Version: "v1beta1", Kind: "Widget"}, meta.RESTScopeNamespace)
+	r := &ApplyWorkReconciler{restMapper: restMapper}
+	manifest := newTestManifest(t, newUnstructured("example.com/v1", "Widget", "default", "widget"))
+
+	gvr, obj, err := r.decodeUnstructured(manifest, "v1beta1")
+	if err != nil {
+		t.Fatalf("decodeUnstructured() error = %v", err)
+	}
+	if gvr.Version != "v1beta1" || obj.GetAPIVersion() != "example.com/v1beta1" {
+		t.Errorf("decodeUnstructured() = %v, %s, want the widget applied as v1beta1", gvr, obj.GetAPIVersion())
+	}
+
+	_, _, err = r.decodeUnstructured(manifest, "v2")
+	if got := applyFailureReason(err); got != ReasonVersionNotServed || isNoMatchError(err) {
+		t.Errorf("decodeUnstructured() = %v with reason %q, want VersionNotServed", err, got)
+	}
+}
+
+func TestValidateManifestMappings(t *testing.T) {
+	configMap := newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config"))
+	widget := newTestManifest(t, newUnstructured("example.com/v1", "Widget", "default", "widget"))
+	tests := map[string]struct {
+		workload workv1alpha1.WorkloadTemplate
+		wantErrs int
+	}{
+		"served kinds": {
+			workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{configMap}},
+		},
+		"a kind that is not served": {
+			workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{configMap, widget}},
+			wantErrs: 1,
+		},
+		"a version that is not served": {
+			workload: workv1alpha1.WorkloadTemplate{
+				Manifests:     []workv1alpha1.Manifest{configMap},
+				ApplyVersions: []workv1alpha1.ManifestApplyVersion{{Ordinal: 0, Version: "v2"}},
+			},
+			wantErrs: 1,
+		},
+		"every document of a multi-document manifest": {
+			workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{{RawExtension: runtime.RawExtension{Raw: []byte(
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: widget\n")}}}},
+			wantErrs: 1,
+		},
+		"a manifest that doesn't decode": {
+			workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{{RawExtension: runtime.RawExtension{Raw: []byte("{")}}}},
+			wantErrs: 1,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if errs := ValidateManifestMappings(newTestRESTMapper(), tt.workload); len(errs) != tt.wantErrs {
+				t.Errorf("ValidateManifestMappings() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestBuildDryRunCondition(t *testing.T) {
+	tests := map[string]struct {
+		action     applyAction
+		wantReason string
+	}{
+		"would create": {
+			action:     applyAction{strategy: ApplyModeClientSide, created: true},
+			wantReason: ReasonDryRunWouldCreate,
+		},
+		"would update": {
+			action:     applyAction{strategy: ApplyModeServerSide},
+			wantReason: ReasonDryRunWouldUpdate,
+		},
+		"unchanged": {
+			wantReason: ReasonDryRunUnchanged,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cond := buildDryRunCondition(tt.action, 2)
+			if cond.Type != ConditionTypeApplied || cond.Status != metav1.ConditionFalse || cond.Reason != tt.wantReason {
+				t.Errorf("buildDryRunCondition() = %+v, want a false applied condition with reason %s", cond, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestIsTransientFailure(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"mapping not found": {
+			err:  newManifestError(ReasonMappingNotFound, fmt.Errorf("no matches for kind")),
+			want: true,
+		},
+		"apply timeout": {
+			err:  newManifestError(ReasonApplyTimeout, context.DeadlineExceeded),
+			want: true,
+		},
+		"apply conflict": {
+			err: newManifestError(ReasonApplyConflict, fmt.Errorf("conflict")),
+		},
+		"generic failure": {
+			err: fmt.Errorf("failed"),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isTransientFailure(tt.err); got != tt.want {
+				t.Errorf("isTransientFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanentFailure(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"decode failure": {
+			err:  newManifestError(ReasonDecodeFailed, fmt.Errorf("invalid character")),
+			want: true,
+		},
+		"dependency cycle": {
+			err:  newManifestError(ReasonDependencyCycle, fmt.Errorf("cycle")),
+			want: true,
+		},
+		"apply timeout": {
+			err: newManifestError(ReasonApplyTimeout, context.DeadlineExceeded),
+		},
+		"throttled": {
+			err: apierrors.NewTooManyRequests("slow down", 3),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isPermanentFailure(tt.err); got != tt.want {
+				t.Errorf("isPermanentFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryableAPIError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"server timeout": {
+			err:  apierrors.NewServerTimeout(gr, "get", 1),
+			want: true,
+		},
+		"too many requests": {
+			err:  apierrors.NewTooManyRequests("slow down", 1),
+			want: true,
+		},
+		"conflict": {
+			err:  apierrors.NewConflict(gr, "test", fmt.Errorf("the object has been modified")),
+			want: true,
+		},
+		"service unavailable": {
+			err:  apierrors.NewServiceUnavailable("unavailable"),
+			want: true,
+		},
+		"forbidden": {
+			err: apierrors.NewForbidden(gr, "test", fmt.Errorf("denied")),
+		},
+		"decode failure": {
+			err: newManifestError(ReasonDecodeFailed, fmt.Errorf("invalid character")),
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isRetryableAPIError(tt.err); got != tt.want {
+				t.Errorf("isRetryableAPIError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelayHonorsRetryAfter(t *testing.T) {
+	r := &ApplyWorkReconciler{backoff: newWorkBackoff(time.Second, time.Minute)}
+	key := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+
+	if got := r.retryDelay(key, 1, []error{fmt.Errorf("failed")}); got != time.Second {
+		t.Errorf("retryDelay() = %v, want the backoff %v", got, time.Second)
+	}
+	// the spoke cluster asked us to wait longer than our backoff
+	if got := r.retryDelay(key, 1, []error{apierrors.NewTooManyRequests("slow down", 10)}); got != 10*time.Second {
+		t.Errorf("retryDelay() of a throttled request = %v, want %v", got, 10*time.Second)
+	}
+	// the backoff keeps growing underneath
+	if got := r.retryDelay(key, 1, []error{fmt.Errorf("failed")}); got != 4*time.Second {
+		t.Errorf("retryDelay() = %v, want the backoff %v", got, 4*time.Second)
+	}
+}
+
+func TestHasDrifted(t *testing.T) {
+	applied := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	_ = unstructured.SetNestedField(applied.Object, "small", "spec", "size")
+	applied.SetLabels(map[string]string{"app": "widget"})
+	applied.SetAnnotations(map[string]string{"kubectl.kubernetes.io/restartedAt": "now"})
+	if err := setSpecHashAnnotation(applied); err != nil {
+		t.Fatalf("setSpecHashAnnotation() error = %v", err)
+	}
+	if err := setLastAppliedAnnotationOf(applied, applied); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+	edited := applied.DeepCopy()
+	_ = unstructured.SetNestedField(edited.Object, "large", "spec", "size")
+	relabeled := applied.DeepCopy()
+	relabeled.SetLabels(map[string]string{"app": "widget", "team": "a"})
+	labelEdited := applied.DeepCopy()
+	labelEdited.SetLabels(map[string]string{"app": "gadget"})
+	defaulted := applied.DeepCopy()
+	_ = unstructured.SetNestedField(defaulted.Object, "fast", "spec", "mode")
+	unstamped := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	restarted := applied.DeepCopy()
+	annotations := restarted.GetAnnotations()
+	annotations["kubectl.kubernetes.io/restartedAt"] = "later"
+	restarted.SetAnnotations(annotations)
+	preserved := []string{"kubectl.kubernetes.io/"}
+
+	tests := map[string]struct {
+		obj      *unstructured.Unstructured
+		prefixes []string
+		want     bool
+	}{
+		"unchanged":                           {obj: applied},
+		"spec edited":                         {obj: edited, want: true},
+		"label added by others":               {obj: relabeled},
+		"applied label edited":                {obj: labelEdited, want: true},
+		"spec field defaulted by a server":    {obj: defaulted},
+		"applied without a hash":              {obj: unstamped},
+		"applied annotation edited":           {obj: restarted, want: true},
+		"preserved annotation edited":         {obj: restarted, prefixes: preserved},
+		"spec edited with preserved prefixes": {obj: edited, prefixes: preserved, want: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := hasDrifted(tt.obj, tt.prefixes); got != tt.want {
+				t.Errorf("hasDrifted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSpecHashIsStableAcrossRoundTrips(t *testing.T) {
+	manifest := newUnstructured("apps/v1", "Deployment", "default", "nginx")
+	manifest.SetLabels(map[string]string{"app": "nginx"})
+	manifest.Object["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{}
+	_ = unstructured.SetNestedField(manifest.Object, int64(2), "spec", "replicas")
+	_ = unstructured.SetNestedField(manifest.Object, nil, "spec", "paused")
+	_ = unstructured.SetNestedSlice(manifest.Object, []interface{}{}, "spec", "template", "spec", "volumes")
+
+	// what the api server returns once the manifest is applied
+	live := manifest.DeepCopy()
+	unstructured.RemoveNestedField(live.Object, "metadata", "annotations")
+	unstructured.RemoveNestedField(live.Object, "spec", "paused")
+	unstructured.RemoveNestedField(live.Object, "spec", "template", "spec", "volumes")
+	live.SetResourceVersion("42")
+	live.SetUID("uid")
+	live.SetGeneration(3)
+	live.SetCreationTimestamp(metav1.NewTime(time.Now()))
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "work-api agent", Operation: metav1.ManagedFieldsOperationApply}})
+	live.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "owner-uid"}})
+	live.SetFinalizers([]string{"foregroundDeletion"})
+	live.SetAnnotations(map[string]string{AppliedByAnnotation: "controller-0"})
+	_ = unstructured.SetNestedField(live.Object, int64(2), "status", "readyReplicas")
+
+	want, err := generateSpecHash(manifest)
+	if err != nil {
+		t.Fatalf("generateSpecHash() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if got, err := generateSpecHash(live); err != nil || got != want {
+			t.Fatalf("generateSpecHash() of the live object = %s, %v, want %s", got, err, want)
+		}
+	}
+
+	relabeled := manifest.DeepCopy()
+	relabeled.SetLabels(map[string]string{"app": "nginx", "tier": "web"})
+	if got, _ := generateSpecHash(relabeled); got == want {
+		t.Errorf("generateSpecHash() doesn't change with the labels of the manifest")
+	}
+}
+
+func TestApplyUnstructuredCorrectsDrift(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	manifest := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	manifest.SetOwnerReferences([]metav1.OwnerReference{owner})
+	_ = unstructured.SetNestedField(manifest.Object, "small", "spec", "size")
+
+	live := manifest.DeepCopy()
+	if err := setSpecHashAnnotation(live); err != nil {
+		t.Fatalf("setSpecHashAnnotation() error = %v", err)
+	}
+	if err := setLastAppliedAnnotationOf(live, live); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+	// someone edits the object on the spoke cluster behind our back
+	_ = unstructured.SetNestedField(live.Object, "large", "spec", "size")
+
+	tests := map[string]struct {
+		detectDrift bool
+		wantSize    string
+	}{
+		"drift is left alone without the drift detection": {wantSize: "large"},
+		"drift is corrected":                              {detectDrift: true, wantSize: "small"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{
+				spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), live.DeepCopy()),
+			}
+			opts := applyOptions{mode: ApplyModeClientSide, detectDrift: tt.detectDrift}
+			if _, _, err := r.applyUnstructured(context.Background(), gvr, manifest.DeepCopy(), 0, opts); err != nil {
+				t.Fatalf("applyUnstructured() error = %v", err)
+			}
+			got, err := r.spokeDynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "widget", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the widget: %v", err)
+			}
+			if size, _, _ := unstructured.NestedString(got.Object, "spec", "size"); size != tt.wantSize {
+				t.Errorf("widget size = %s, want %s", size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestApplyUnstructuredCreateOnly(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	manifest := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	manifest.SetOwnerReferences([]metav1.OwnerReference{owner})
+	_ = unstructured.SetNestedField(manifest.Object, "small", "spec", "size")
+
+	// the user edited the object we created from an older manifest
+	live := manifest.DeepCopy()
+	if err := setSpecHashAnnotation(live); err != nil {
+		t.Fatalf("setSpecHashAnnotation() error = %v", err)
+	}
+	_ = unstructured.SetNestedField(live.Object, "large", "spec", "size")
+	_ = unstructured.SetNestedField(manifest.Object, "medium", "spec", "size")
+	notOwned := live.DeepCopy()
+	notOwned.SetOwnerReferences(nil)
+
+	tests := map[string]struct {
+		existing   []runtime.Object
+		createOnly bool
+		adopt      bool
+		wantSize   string
+		wantAction applyAction
+		wantReason string
+	}{
+		"create only creates a missing object": {
+			createOnly: true,
+			wantSize:   "medium",
+			wantAction: applyAction{strategy: ApplyModeClientSide, created: true},
+		},
+		"create only leaves an existing object untouched": {
+			existing:   []runtime.Object{live.DeepCopy()},
+			createOnly: true,
+			wantSize:   "large",
+			wantAction: applyAction{createOnlySkipped: true},
+		},
+		"create only doesn't take over an object of someone else": {
+			existing:   []runtime.Object{notOwned.DeepCopy()},
+			createOnly: true,
+			adopt:      true,
+			wantSize:   "large",
+			wantReason: ReasonNotOwned,
+		},
+		"reconcile updates an existing object": {
+			existing:   []runtime.Object{live.DeepCopy()},
+			wantSize:   "medium",
+			wantAction: applyAction{strategy: ApplyModeClientSide},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{
+				spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), tt.existing...),
+			}
+			opts := applyOptions{mode: ApplyModeClientSide, createOnly: tt.createOnly, adoptExisting: tt.adopt}
+			_, action, err := r.applyUnstructured(context.Background(), gvr, manifest.DeepCopy(), 0, opts)
+			if got := applyFailureReason(err); len(tt.wantReason) != 0 && got != tt.wantReason {
+				t.Errorf("applyUnstructured() failed with %q (%v), want %s", got, err, tt.wantReason)
+			}
+			if len(tt.wantReason) == 0 && err != nil {
+				t.Fatalf("applyUnstructured() error = %v", err)
+			}
+			if action != tt.wantAction {
+				t.Errorf("applyUnstructured() action = %+v, want %+v", action, tt.wantAction)
+			}
+			got, err := r.spokeDynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "widget", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the widget: %v", err)
+			}
+			if size, _, _ := unstructured.NestedString(got.Object, "spec", "size"); size != tt.wantSize {
+				t.Errorf("widget size = %s, want %s", size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestApplyManifestsCreateOnly(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	edited := newUnstructured("v1", "ConfigMap", "default", "defaults")
+	edited.SetOwnerReferences([]metav1.OwnerReference{owner})
+	edited.Object["data"] = map[string]interface{}{"color": "red"}
+	manifest := newUnstructured("v1", "ConfigMap", "default", "defaults")
+	manifest.Object["data"] = map[string]interface{}{"color": "blue"}
+	workload := workv1alpha1.WorkloadTemplate{
+		Manifests:  []workv1alpha1.Manifest{newTestManifest(t, manifest)},
+		ApplyModes: []workv1alpha1.ManifestApplyMode{{Ordinal: 0, Mode: workv1alpha1.ManifestApplyModeCreateOnly}},
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), edited)
+	r := &ApplyWorkReconciler{spokeDynamicClient: dynamicClient, restMapper: newTestRESTMapper()}
+
+	results := r.applyManifests(context.Background(), workload.Manifests, nil, nil, owner,
+		applyOptions{mode: ApplyModeClientSide, applyModes: applyModesOf(workload)})
+	if results[0].err != nil || results[0].updated || !results[0].action.createOnlySkipped {
+		t.Fatalf("applyManifests() result = %+v, want the existing config map skipped", results[0])
+	}
+	got, err := dynamicClient.Resource(corev1.SchemeGroupVersion.WithResource("configmaps")).Namespace("default").
+		Get(context.Background(), "defaults", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the config map: %v", err)
+	}
+	if color, _, _ := unstructured.NestedString(got.Object, "data", "color"); color != "red" {
+		t.Errorf("config map color = %s, want the edited red", color)
+	}
+	condition := buildManifestCondition(results[0], nil, false)
+	applied := meta.FindStatusCondition(condition.Conditions, ConditionTypeApplied)
+	if applied == nil || applied.Status != metav1.ConditionTrue || applied.Reason != ReasonCreateOnlySkipped {
+		t.Errorf("buildManifestCondition() applied condition = %+v, want true with %s", applied, ReasonCreateOnlySkipped)
+	}
+	if len(condition.ObservedHash) != 0 {
+		t.Errorf("buildManifestCondition() observed hash = %s, want none since the manifest wasn't applied", condition.ObservedHash)
+	}
+}
+
+func TestApplyManifestsOverridesNamespace(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "foo", "config")),
+		newTestManifest(t, newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "", "reader")),
+		newTestManifest(t, newUnstructured("v1", "ConfigMap", "bar", "config")),
+	}
+
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{namespaceOverride: "foo-tenant"})
+	if len(results) != len(manifests) {
+		t.Fatalf("applyManifests() returned %d results, want %d", len(results), len(manifests))
+	}
+	if results[0].err != nil || results[0].identifier.Namespace != "foo-tenant" {
+		t.Errorf("applyManifests() result of the config map = %+v, want it applied in foo-tenant", results[0])
+	}
+	if results[1].err != nil || results[1].identifier.Namespace != "" {
+		t.Errorf("applyManifests() result of the cluster role = %+v, want it applied without a namespace", results[1])
+	}
+	if results[2].err == nil || applyFailureReason(results[2].err) != ReasonNamespaceCollision {
+		t.Errorf("applyManifests() result of the colliding config map = %+v, want a NamespaceCollision", results[2])
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if _, err := dynamicClient.Resource(gvr).Namespace("foo-tenant").Get(context.Background(), "config", metav1.GetOptions{}); err != nil {
+		t.Errorf("failed to get the config map in the override namespace: %v", err)
+	}
+	if _, err := dynamicClient.Resource(gvr).Namespace("foo").Get(context.Background(), "config", metav1.GetOptions{}); err == nil {
+		t.Errorf("the config map was applied in its own namespace")
+	}
+}
+
+func TestNormalizeNamespace(t *testing.T) {
+	r := &ApplyWorkReconciler{restMapper: newTestRESTMapper()}
+	tests := map[string]struct {
+		obj           *unstructured.Unstructured
+		wantNamespace string
+		wantReason    string
+		wantErr       bool
+	}{
+		"namespaced object keeps its namespace": {
+			obj:           newUnstructured("v1", "ConfigMap", "app", "config"),
+			wantNamespace: "app",
+		},
+		"namespaced object without a namespace goes to the namespace of the work": {
+			obj:           newUnstructured("v1", "ConfigMap", "", "config"),
+			wantNamespace: "cluster-a",
+			wantReason:    ReasonNamespaceDefaulted,
+		},
+		"cluster scoped object drops its namespace": {
+			obj:        newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "app", "reader"),
+			wantReason: ReasonNamespaceIgnored,
+		},
+		"cluster scoped object without a namespace": {
+			obj: newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "", "reader"),
+		},
+		"unknown kind": {
+			obj:           newUnstructured("example.com/v1", "Widget", "app", "widget"),
+			wantNamespace: "app",
+			wantErr:       true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason, message, err := r.normalizeNamespace(tt.obj, "cluster-a")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reason != tt.wantReason || (len(reason) == 0) != (len(message) == 0) {
+				t.Errorf("normalizeNamespace() = %q, %q, want the reason %q", reason, message, tt.wantReason)
+			}
+			if got := tt.obj.GetNamespace(); got != tt.wantNamespace {
+				t.Errorf("normalizeNamespace() set the namespace %q, want %q", got, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestApplyUnstructuredNotOwned(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	otherOwner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other", UID: "other-uid"}
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	manifest := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	manifest.SetOwnerReferences([]metav1.OwnerReference{owner})
+	_ = unstructured.SetNestedField(manifest.Object, "new", "spec", "size")
+	live := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	live.SetOwnerReferences([]metav1.OwnerReference{otherOwner})
+	_ = unstructured.SetNestedField(live.Object, "old", "spec", "size")
+
+	tests := map[string]struct {
+		adoptExisting bool
+		wantReason    string
+		wantValue     string
+		wantOwners    []metav1.OwnerReference
+	}{
+		"an object owned by someone else is left alone": {
+			wantReason: ReasonNotOwned,
+			wantValue:  "old",
+			wantOwners: []metav1.OwnerReference{otherOwner},
+		},
+		"an object owned by someone else is adopted": {
+			adoptExisting: true,
+			wantValue:     "new",
+			wantOwners:    []metav1.OwnerReference{otherOwner, owner},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{
+				spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), live.DeepCopy()),
+			}
+			opts := applyOptions{mode: ApplyModeClientSide, adoptExisting: tt.adoptExisting}
+			_, _, err := r.applyUnstructured(context.Background(), gvr, manifest.DeepCopy(), 0, opts)
+			if len(tt.wantReason) != 0 {
+				if err == nil || applyFailureReason(err) != tt.wantReason {
+					t.Errorf("applyUnstructured() error = %v, want the %s reason", err, tt.wantReason)
+				}
+			} else if err != nil {
+				t.Fatalf("applyUnstructured() error = %v", err)
+			}
+
+			got, err := r.spokeDynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "widget", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the widget: %v", err)
+			}
+			if value, _, _ := unstructured.NestedString(got.Object, "spec", "size"); value != tt.wantValue {
+				t.Errorf("widget size = %s, want %s", value, tt.wantValue)
+			}
+			if owners := got.GetOwnerReferences(); !reflect.DeepEqual(owners, tt.wantOwners) {
+				t.Errorf("widget owners = %+v, want %+v", owners, tt.wantOwners)
+			}
+		})
+	}
+}
+
+func TestGenerateWorkAppliedStatusCondition(t *testing.T) {
+	applied := metav1.Condition{Type: ConditionTypeApplied, Status: metav1.ConditionTrue}
+	failed := metav1.Condition{Type: ConditionTypeApplied, Status: metav1.ConditionFalse}
+	available := metav1.Condition{Type: ConditionTypeAvailable, Status: metav1.ConditionTrue}
+	unavailable := metav1.Condition{Type: ConditionTypeAvailable, Status: metav1.ConditionFalse}
+	paused := metav1.Condition{Type: ConditionTypePaused, Status: metav1.ConditionTrue}
+	tests := map[string]struct {
+		conditions       [][]metav1.Condition
+		requireAvailable bool
+		wantStatus       metav1.ConditionStatus
+		wantReason       string
+	}{
+		"applied": {
+			conditions: [][]metav1.Condition{{applied, available}, {applied, unavailable}},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonAppliedWorkComplete,
+		},
+		"applied without the availability": {
+			conditions: [][]metav1.Condition{{applied}},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonAppliedWorkComplete,
+		},
+		"failed": {
+			conditions: [][]metav1.Condition{{applied, available}, {failed}},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonAppliedWorkFailed,
+		},
+		"available required and available": {
+			conditions:       [][]metav1.Condition{{applied, available}, {applied, available}},
+			requireAvailable: true,
+			wantStatus:       metav1.ConditionTrue,
+			wantReason:       ReasonAppliedWorkComplete,
+		},
+		"available required but not available": {
+			conditions:       [][]metav1.Condition{{applied, available}, {applied, unavailable}},
+			requireAvailable: true,
+			wantStatus:       metav1.ConditionFalse,
+			wantReason:       ReasonAppliedWorkNotAvailable,
+		},
+		"available required without the availability": {
+			conditions:       [][]metav1.Condition{{applied}},
+			requireAvailable: true,
+			wantStatus:       metav1.ConditionFalse,
+			wantReason:       ReasonAppliedWorkNotAvailable,
+		},
+		"available required but failed": {
+			conditions:       [][]metav1.Condition{{applied, unavailable}, {failed}},
+			requireAvailable: true,
+			wantStatus:       metav1.ConditionFalse,
+			wantReason:       ReasonAppliedWorkFailed,
+		},
+		"available required with a paused manifest": {
+			conditions:       [][]metav1.Condition{{applied, available}, {paused, failed}},
+			requireAvailable: true,
+			wantStatus:       metav1.ConditionTrue,
+			wantReason:       ReasonAppliedWorkComplete,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var manifestConditions []workv1alpha1.ManifestCondition
+			for _, conditions := range tt.conditions {
+				manifestConditions = append(manifestConditions, workv1alpha1.ManifestCondition{Conditions: conditions})
+			}
+			cond := generateWorkAppliedStatusCondition(manifestConditions, 3, tt.requireAvailable)
+			if cond.Type != ConditionTypeApplied || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason || cond.ObservedGeneration != 3 {
+				t.Errorf("generateWorkAppliedStatusCondition() = %+v, want %s with reason %s", cond, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCheckStabilization(t *testing.T) {
+	window := time.Minute
+	stabilizing := func(status metav1.ConditionStatus, generation int64, since time.Duration) []metav1.Condition {
+		return []metav1.Condition{{
+			Type: ConditionTypeStabilizing, Status: status, ObservedGeneration: generation,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-since)), Reason: ReasonWorkChanged,
+		}}
+	}
+	tests := map[string]struct {
+		window      time.Duration
+		conditions  []metav1.Condition
+		wantWait    bool
+		wantChanged bool
+		wantStatus  metav1.ConditionStatus
+		wantReason  string
+	}{
+		"no stabilization window": {},
+		"new generation starts the window": {
+			window:      window,
+			wantWait:    true,
+			wantChanged: true,
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  ReasonWorkChanged,
+		},
+		"changed generation restarts the window": {
+			window:      window,
+			conditions:  stabilizing(metav1.ConditionFalse, 1, 2*window),
+			wantWait:    true,
+			wantChanged: true,
+			wantStatus:  metav1.ConditionTrue,
+			wantReason:  ReasonWorkChanged,
+		},
+		"not stable yet": {
+			window:     window,
+			conditions: stabilizing(metav1.ConditionTrue, 2, window/2),
+			wantWait:   true,
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonWorkChanged,
+		},
+		"window timed out": {
+			window:      window,
+			conditions:  stabilizing(metav1.ConditionTrue, 2, 2*window),
+			wantChanged: true,
+			wantStatus:  metav1.ConditionFalse,
+			wantReason:  ReasonWorkStable,
+		},
+		"already stable": {
+			window:     window,
+			conditions: stabilizing(metav1.ConditionFalse, 2, 2*window),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonWorkChanged,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{stabilizationWindow: tt.window}
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Status:     workv1alpha1.WorkStatus{Conditions: tt.conditions},
+			}
+			remaining, changed := r.checkStabilization(work)
+			if (remaining > 0) != tt.wantWait || remaining > tt.window || changed != tt.wantChanged {
+				t.Errorf("checkStabilization() = %s, %t, want a wait %t and a change %t", remaining, changed, tt.wantWait, tt.wantChanged)
+			}
+			cond := meta.FindStatusCondition(work.Status.Conditions, ConditionTypeStabilizing)
+			if len(tt.wantStatus) == 0 {
+				if cond != nil {
+					t.Errorf("stabilizing condition = %+v, want none", cond)
+				}
+				return
+			}
+			if cond == nil || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason || cond.ObservedGeneration != 2 {
+				t.Errorf("stabilizing condition = %+v, want %s with reason %s", cond, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReconcileStabilizingSkipsUnchangedStatus(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name, Generation: 1, Finalizers: []string{workFinalizer}},
+	}
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	r := &ApplyWorkReconciler{client: hubClient, stabilizationWindow: time.Minute}
+	ctx := context.Background()
+
+	resourceVersion := func() string {
+		got := &workv1alpha1.Work{}
+		if err := hubClient.Get(ctx, nsWorkName, got); err != nil {
+			t.Fatalf("failed to get the work: %v", err)
+		}
+		return got.ResourceVersion
+	}
+	if result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName}); err != nil || result.RequeueAfter == 0 {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue at the end of the window", result, err)
+	}
+	started := resourceVersion()
+	// the requeue within the window finds the same condition and has nothing to write
+	if result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName}); err != nil || result.RequeueAfter == 0 {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue at the end of the window", result, err)
+	}
+	if got := resourceVersion(); got != started {
+		t.Errorf("work resource version = %s, want it unchanged at %s", got, started)
+	}
+}
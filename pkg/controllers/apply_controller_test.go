@@ -113,8 +113,157 @@ var _ = Describe("Work Controller", func() {
 					return fmt.Errorf("Exepect condition status of the work to be true")
 				}
 
+				// the hash reported on the hub is the one stamped on the live object
+				applied, err := k8sClient.CoreV1().ConfigMaps(cmNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				observedHash := resultWork.Status.ManifestConditions[0].ObservedHash
+				if len(observedHash) == 0 || observedHash != applied.Annotations[specHashAnnotation] {
+					return fmt.Errorf("Expect the observed hash %q to match the spec hash annotation %q",
+						observedHash, applied.Annotations[specHashAnnotation])
+				}
+
 				return nil
 			}, timeout, interval).Should(Succeed())
 		})
 	})
+
+	Context("Restore resources deleted out-of-band", func() {
+		It("Should recreate a configmap deleted behind the controller's back", func() {
+			cmName := "recreated-" + utilrand.String(5)
+			cm := &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: cmName, Namespace: workNamespace},
+				Data:       map[string]string{"test": "test"},
+			}
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "recreate-work", Namespace: workNamespace},
+				Spec: workv1alpha1.WorkSpec{
+					Workload: workv1alpha1.WorkloadTemplate{
+						Manifests: []workv1alpha1.Manifest{{RawExtension: runtime.RawExtension{Object: cm}}},
+					},
+				},
+			}
+			_, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			var original *corev1.ConfigMap
+			Eventually(func() error {
+				original, err = k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				return err
+			}, timeout, interval).Should(Succeed())
+			// wait for the appliedWork to track the configmap, it's only restored once we know we applied it
+			Eventually(func() error {
+				appliedWork, err := workClient.MulticlusterV1alpha1().AppliedWorks().Get(context.Background(),
+					appliedWorkName(workNamespace, work.Name), metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if len(appliedWork.Status.AppliedResources) != 1 || appliedWork.Status.AppliedResources[0].UID != original.UID {
+					return fmt.Errorf("the appliedWork doesn't track the configmap yet: %+v", appliedWork.Status.AppliedResources)
+				}
+				return nil
+			}, timeout, interval).Should(Succeed())
+
+			By("deleting the configmap out-of-band")
+			err = k8sClient.CoreV1().ConfigMaps(workNamespace).Delete(context.Background(), cmName, metav1.DeleteOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(func() error {
+				recreated, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if recreated.UID == original.UID {
+					return fmt.Errorf("the configmap is not deleted yet")
+				}
+				return nil
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() error {
+				events, err := k8sClient.CoreV1().Events(workNamespace).List(context.Background(), metav1.ListOptions{
+					FieldSelector: "involvedObject.name=" + work.Name,
+				})
+				if err != nil {
+					return err
+				}
+				for _, event := range events.Items {
+					if event.Reason == "ResourceRecreated" {
+						return nil
+					}
+				}
+				return fmt.Errorf("no ResourceRecreated event on the work")
+			}, timeout, interval).Should(Succeed())
+		})
+	})
+
+	Context("Pause a work", func() {
+		It("Should leave the configmap alone until the work is resumed", func() {
+			cmName := "paused-" + utilrand.String(5)
+			cm := &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: cmName, Namespace: workNamespace},
+				Data:       map[string]string{"test": "test"},
+			}
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "paused-work", Namespace: workNamespace},
+				Spec: workv1alpha1.WorkSpec{
+					Workload: workv1alpha1.WorkloadTemplate{
+						Manifests: []workv1alpha1.Manifest{{RawExtension: runtime.RawExtension{Object: cm}}},
+					},
+				},
+			}
+			_, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() error {
+				_, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				return err
+			}, timeout, interval).Should(Succeed())
+
+			// updateWork changes the pause and the data of the configmap in the work
+			updateWork := func(paused bool, data string) {
+				Eventually(func() error {
+					current, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+					if err != nil {
+						return err
+					}
+					updated := cm.DeepCopy()
+					updated.Data["test"] = data
+					current.Spec.Paused = paused
+					current.Spec.Workload.Manifests = []workv1alpha1.Manifest{{RawExtension: runtime.RawExtension{Object: updated}}}
+					_, err = workClient.MulticlusterV1alpha1().Works(workNamespace).Update(context.Background(), current, metav1.UpdateOptions{})
+					return err
+				}, timeout, interval).Should(Succeed())
+			}
+
+			By("pausing the work while changing its manifest")
+			updateWork(true, "paused")
+			Eventually(func() bool {
+				resultWork, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				return err == nil && meta.IsStatusConditionTrue(resultWork.Status.Conditions, ConditionTypePaused)
+			}, timeout, interval).Should(BeTrue())
+			Consistently(func() string {
+				current, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				if err != nil {
+					return err.Error()
+				}
+				return current.Data["test"]
+			}, 5*time.Second, interval).Should(Equal("test"))
+
+			By("resuming the work")
+			updateWork(false, "resumed")
+			Eventually(func() string {
+				current, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				if err != nil {
+					return err.Error()
+				}
+				return current.Data["test"]
+			}, timeout, interval).Should(Equal("resumed"))
+			Eventually(func() bool {
+				resultWork, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				return err == nil && meta.FindStatusCondition(resultWork.Status.Conditions, ConditionTypePaused) == nil
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
 })
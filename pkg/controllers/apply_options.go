@@ -0,0 +1,302 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// The annotations below can be set on a work to tune how its manifests are applied without changing the work spec.
+// If a work spec field controlling the same option is set, the spec field takes precedence over the annotation.
+const (
+	// ApplyModeAnnotation selects how the manifests are written to the spoke cluster, see the ApplyMode constants.
+	ApplyModeAnnotation = "multicluster.x-k8s.io/apply-mode"
+	// ForceConflictsAnnotation set to "false" makes server side apply fail instead of taking over fields owned by others.
+	ForceConflictsAnnotation = "multicluster.x-k8s.io/force-conflicts"
+	// DryRunAnnotation set to "true" makes the spoke cluster validate the manifests without persisting them.
+	DryRunAnnotation = "multicluster.x-k8s.io/dry-run"
+	// AllowPruneAnnotation set to "true" allows the stale resources of a work to be pruned even if there are
+	// more of them than the prune limit of the controller.
+	AllowPruneAnnotation = "multicluster.x-k8s.io/allow-mass-prune"
+	// FieldManagerAnnotation is the field manager the manifests of a work are written with instead of the one
+	// of the controller, so that the works of different teams own their fields separately.
+	FieldManagerAnnotation = "multicluster.x-k8s.io/field-manager"
+)
+
+// PausedAnnotation set to "true" on the object of a manifest, rather than on its work, freezes the manifest:
+// it is not applied until the annotation is removed, and the resource applied before is left as it is.
+const PausedAnnotation = "multicluster.x-k8s.io/paused"
+
+// maxFieldManagerLength is the longest field manager the api server accepts.
+const maxFieldManagerLength = 128
+
+const (
+	// ApplyModeServerSide updates the existing objects with server side apply only.
+	ApplyModeServerSide = "ServerSideApply"
+	// ApplyModeClientSide updates the existing objects with a plain update only.
+	ApplyModeClientSide = "ClientSideApply"
+	// ApplyModeStrategicMerge updates the existing objects with a strategic merge patch of the manifest.
+	// Only the built-in kinds support it.
+	ApplyModeStrategicMerge = "StrategicMergePatch"
+)
+
+// applyOptions controls how the manifests of a work are applied.
+type applyOptions struct {
+	// mode is one of the ApplyMode constants, empty means we try server side apply and fall back to an update
+	mode           string
+	forceConflicts bool
+	dryRun         bool
+	// forceApply re-applies the manifests even if their spec hash didn't change
+	forceApply bool
+	// detectDrift re-applies the manifests whose object on the spoke cluster no longer matches their spec hash
+	detectDrift bool
+	// namespaceOverride is the namespace the namespaced manifests are applied to instead of their own, if not empty
+	namespaceOverride string
+	// defaultNamespace is the namespace of the namespaced manifests that don't have one
+	defaultNamespace string
+	// preserveFields are the paths of the fields that keep their live value when the manifest doesn't set them
+	preserveFields []string
+	// preservedAnnotationPrefixes are the prefixes of the annotations that keep their live value when the manifest
+	// doesn't set them, their changes on the spoke cluster are not a drift
+	preservedAnnotationPrefixes []string
+	// adoptExisting takes over the existing resources the work doesn't own yet instead of failing on them
+	adoptExisting bool
+	// applyVersions are the versions the manifests are applied as instead of the ones they declare, keyed by ordinal
+	applyVersions map[int]string
+	// applyModes are the modes the manifests are applied in instead of being reconciled, keyed by ordinal
+	applyModes map[int]workv1alpha1.ManifestApplyModeType
+	// createOnly leaves the existing object of a manifest untouched, it is set per manifest from the applyModes
+	createOnly bool
+	// overlays are the JSON patches of the manifests on this spoke cluster, keyed by ordinal
+	overlays map[int][]workv1alpha1.JSONPatchOperation
+	// healthChecks are the compiled health checks the availability of the manifests is checked with, keyed by ordinal
+	healthChecks map[int]*manifestHealthCheck
+	// allOrNothing rolls back the resources created by an apply if any manifest fails
+	allOrNothing bool
+	// fieldManager is the field manager we write the manifests with, empty means the DefaultFieldManager
+	fieldManager string
+	// variables are the values substituted for the variables the manifests reference, keyed by variable
+	variables map[string]string
+	// labels and annotations are set on the applied objects whose manifests don't set them
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// buildApplyOptions builds the apply options of a work from its spec and annotations.
+// Invalid annotation values are ignored so that a typo doesn't block the work.
+func buildApplyOptions(work *workv1alpha1.Work) applyOptions {
+	opts := applyOptions{
+		forceConflicts: true,
+	}
+	annotations := work.GetAnnotations()
+
+	switch mode := annotations[ApplyModeAnnotation]; mode {
+	case "":
+	case ApplyModeServerSide, ApplyModeClientSide, ApplyModeStrategicMerge:
+		opts.mode = mode
+	default:
+		klog.InfoS("ignore an unknown apply mode", workKeys(work.Namespace, work.Name, "mode", mode)...)
+	}
+
+	if strategy := work.Spec.ApplyStrategy; len(strategy) != 0 {
+		opts.mode = string(strategy)
+		// server side apply asked for by the spec doesn't take over the fields of other managers by default
+		if strategy == workv1alpha1.ApplyStrategyServerSideApply {
+			opts.forceConflicts = false
+		}
+	}
+
+	if value, ok := annotations[ForceConflictsAnnotation]; ok {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			klog.InfoS("ignore an invalid force conflicts annotation", workKeys(work.Namespace, work.Name, "value", value)...)
+		} else {
+			opts.forceConflicts = force
+		}
+	}
+
+	if value, ok := annotations[DryRunAnnotation]; ok {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			klog.InfoS("ignore an invalid dry run annotation", workKeys(work.Namespace, work.Name, "value", value)...)
+		} else {
+			opts.dryRun = dryRun
+		}
+	}
+
+	if value, ok := annotations[FieldManagerAnnotation]; ok {
+		if err := ValidateFieldManager(value); err != nil {
+			klog.InfoS("ignore an invalid field manager annotation",
+				workKeys(work.Namespace, work.Name, "value", value, "err", err)...)
+		} else {
+			opts.fieldManager = value
+		}
+	}
+
+	opts.namespaceOverride = work.Spec.NamespaceOverride
+	opts.defaultNamespace = work.Namespace
+	opts.preserveFields = work.Spec.PreserveFields
+	opts.adoptExisting = work.Spec.AdoptExisting
+	opts.allOrNothing = work.Spec.ApplyPolicy == workv1alpha1.ApplyPolicyAllOrNothing
+
+	// the spec fields win over the annotations when they are set, to either value
+	if work.Spec.ForceConflicts != nil {
+		opts.forceConflicts = *work.Spec.ForceConflicts
+	}
+	if work.Spec.DryRun != nil {
+		opts.dryRun = *work.Spec.DryRun
+	}
+
+	return opts
+}
+
+// ValidateApplyModeByKind validates the apply modes configured by kind, the keys are either a kind or kind.group.
+func ValidateApplyModeByKind(modes map[string]string) error {
+	for kind, mode := range modes {
+		switch mode {
+		case ApplyModeServerSide, ApplyModeClientSide:
+		case ApplyModeStrategicMerge:
+			if !supportsStrategicMerge(schema.ParseGroupKind(kind)) {
+				return fmt.Errorf("kind %s doesn't support the %s apply mode", kind, mode)
+			}
+		default:
+			return fmt.Errorf("unknown apply mode %q of kind %s", mode, kind)
+		}
+	}
+	return nil
+}
+
+// supportsStrategicMerge checks if the kind is a built-in one that the api server can strategic merge patch.
+func supportsStrategicMerge(gk schema.GroupKind) bool {
+	for gvk := range clientgoscheme.Scheme.AllKnownTypes() {
+		if gvk.GroupKind() == gk {
+			return true
+		}
+	}
+	return false
+}
+
+// kindKeys returns the keys a setting configured by kind can be found with, from the most specific one.
+func kindKeys(gk schema.GroupKind) []string {
+	return []string{gk.String(), gk.Kind}
+}
+
+// fieldManagerName returns the FieldManager field of the create/update/patch options.
+func (o applyOptions) fieldManagerName() string {
+	if len(o.fieldManager) == 0 {
+		return DefaultFieldManager
+	}
+	return o.fieldManager
+}
+
+// ValidateFieldManager validates a field manager the way the api server does, it must be a non-empty string of at most
+// 128 printable characters.
+func ValidateFieldManager(fieldManager string) error {
+	if len(fieldManager) == 0 || len(fieldManager) > maxFieldManagerLength {
+		return fmt.Errorf("the field manager must be between 1 and %d characters long", maxFieldManagerLength)
+	}
+	for _, r := range fieldManager {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("the field manager %q must only contain printable characters", fieldManager)
+		}
+	}
+	return nil
+}
+
+// dryRunOption returns the DryRun field of the create/update/patch options.
+func (o applyOptions) dryRunOption() []string {
+	if o.dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// applyVersionsOf returns the versions the manifests of a workload are pinned to, keyed by their ordinal.
+func applyVersionsOf(workload workv1alpha1.WorkloadTemplate) map[int]string {
+	if len(workload.ApplyVersions) == 0 {
+		return nil
+	}
+	versions := make(map[int]string, len(workload.ApplyVersions))
+	for _, pin := range workload.ApplyVersions {
+		versions[pin.Ordinal] = pin.Version
+	}
+	return versions
+}
+
+// applyModesOf returns the modes the manifests of a workload are applied in, keyed by their ordinal.
+func applyModesOf(workload workv1alpha1.WorkloadTemplate) map[int]workv1alpha1.ManifestApplyModeType {
+	if len(workload.ApplyModes) == 0 {
+		return nil
+	}
+	modes := make(map[int]workv1alpha1.ManifestApplyModeType, len(workload.ApplyModes))
+	for _, mode := range workload.ApplyModes {
+		modes[mode.Ordinal] = mode.Mode
+	}
+	return modes
+}
+
+// overlaysOf returns the operations of the overlays of the manifests of a workload that apply on the spoke cluster,
+// keyed by their ordinal. The overlays of a manifest are concatenated in the order of the list.
+func overlaysOf(workload workv1alpha1.WorkloadTemplate, clusterName string) map[int][]workv1alpha1.JSONPatchOperation {
+	if len(workload.Overlays) == 0 {
+		return nil
+	}
+	overlays := make(map[int][]workv1alpha1.JSONPatchOperation, len(workload.Overlays))
+	for _, o := range workload.Overlays {
+		if overlayAppliesTo(o, clusterName) {
+			overlays[o.Ordinal] = append(overlays[o.Ordinal], o.Patch...)
+		}
+	}
+	return overlays
+}
+
+// overlayAppliesTo checks if an overlay is applied on the named spoke cluster.
+func overlayAppliesTo(o workv1alpha1.ManifestOverlay, clusterName string) bool {
+	if len(o.Clusters) == 0 {
+		return true
+	}
+	for _, cluster := range o.Clusters {
+		if cluster == clusterName {
+			return true
+		}
+	}
+	return false
+}
+
+// isPausedManifest checks if the object of a manifest is frozen by the paused annotation.
+func isPausedManifest(obj *unstructured.Unstructured) bool {
+	value, ok := obj.GetAnnotations()[PausedAnnotation]
+	if !ok {
+		return false
+	}
+	paused, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.InfoS("ignore an invalid paused annotation", objectKeys(obj, "value", value)...)
+		return false
+	}
+	return paused
+}
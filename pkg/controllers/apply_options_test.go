@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestBuildApplyOptions(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		strategy    workv1alpha1.ApplyStrategyType
+		force       *bool
+		dryRun      *bool
+		want        applyOptions
+	}{
+		"defaults": {
+			want: applyOptions{forceConflicts: true},
+		},
+		"mode from the annotation": {
+			annotations: map[string]string{ApplyModeAnnotation: ApplyModeClientSide},
+			want:        applyOptions{mode: ApplyModeClientSide, forceConflicts: true},
+		},
+		"conflicts not forced": {
+			annotations: map[string]string{ForceConflictsAnnotation: "false"},
+			want:        applyOptions{},
+		},
+		"spec strategy wins over the annotation": {
+			annotations: map[string]string{ApplyModeAnnotation: ApplyModeClientSide},
+			strategy:    workv1alpha1.ApplyStrategyServerSideApply,
+			want:        applyOptions{mode: ApplyModeServerSide},
+		},
+		"server side apply from the spec forced by the annotation": {
+			annotations: map[string]string{ForceConflictsAnnotation: "true"},
+			strategy:    workv1alpha1.ApplyStrategyServerSideApply,
+			want:        applyOptions{mode: ApplyModeServerSide, forceConflicts: true},
+		},
+		"force conflicts from the spec wins over the annotation": {
+			annotations: map[string]string{ForceConflictsAnnotation: "false"},
+			strategy:    workv1alpha1.ApplyStrategyServerSideApply,
+			force:       pointer.Bool(true),
+			want:        applyOptions{mode: ApplyModeServerSide, forceConflicts: true},
+		},
+		"conflicts not forced by the spec win over the annotation": {
+			annotations: map[string]string{ForceConflictsAnnotation: "true"},
+			force:       pointer.Bool(false),
+			want:        applyOptions{},
+		},
+		"dry run from the annotation": {
+			annotations: map[string]string{DryRunAnnotation: "true"},
+			want:        applyOptions{forceConflicts: true, dryRun: true},
+		},
+		"dry run from the spec": {
+			dryRun: pointer.Bool(true),
+			want:   applyOptions{forceConflicts: true, dryRun: true},
+		},
+		"no dry run from the spec wins over the annotation": {
+			annotations: map[string]string{DryRunAnnotation: "true"},
+			dryRun:      pointer.Bool(false),
+			want:        applyOptions{forceConflicts: true},
+		},
+		"invalid annotations are ignored": {
+			annotations: map[string]string{ApplyModeAnnotation: "Replace", ForceConflictsAnnotation: "no way", DryRunAnnotation: "maybe"},
+			want:        applyOptions{forceConflicts: true},
+		},
+		"field manager from the annotation": {
+			annotations: map[string]string{FieldManagerAnnotation: "team-a"},
+			want:        applyOptions{forceConflicts: true, fieldManager: "team-a"},
+		},
+		"invalid field manager is ignored": {
+			annotations: map[string]string{FieldManagerAnnotation: strings.Repeat("a", maxFieldManagerLength+1)},
+			want:        applyOptions{forceConflicts: true},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "work", Annotations: tt.annotations},
+				Spec:       workv1alpha1.WorkSpec{ApplyStrategy: tt.strategy, ForceConflicts: tt.force, DryRun: tt.dryRun},
+			}
+			if got := buildApplyOptions(work); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildApplyOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDryRunOption(t *testing.T) {
+	if got := (applyOptions{}).dryRunOption(); got != nil {
+		t.Errorf("dryRunOption() = %v, want nil", got)
+	}
+	if got := (applyOptions{dryRun: true}).dryRunOption(); len(got) != 1 || got[0] != metav1.DryRunAll {
+		t.Errorf("dryRunOption() = %v, want [%s]", got, metav1.DryRunAll)
+	}
+}
+
+func TestValidateFieldManager(t *testing.T) {
+	tests := map[string]struct {
+		fieldManager string
+		wantErr      bool
+	}{
+		"valid": {
+			fieldManager: "work-api east",
+		},
+		"empty": {
+			wantErr: true,
+		},
+		"too long": {
+			fieldManager: strings.Repeat("a", maxFieldManagerLength+1),
+			wantErr:      true,
+		},
+		"not printable": {
+			fieldManager: "work-api\n",
+			wantErr:      true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateFieldManager(tt.fieldManager); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFieldManager(%q) error = %v, wantErr %v", tt.fieldManager, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverlaysOf(t *testing.T) {
+	replicas := workv1alpha1.JSONPatchOperation{Op: "remove", Path: "/spec/replicas"}
+	labels := workv1alpha1.JSONPatchOperation{Op: "remove", Path: "/metadata/labels"}
+	workload := workv1alpha1.WorkloadTemplate{
+		Overlays: []workv1alpha1.ManifestOverlay{
+			{Ordinal: 0, Patch: []workv1alpha1.JSONPatchOperation{replicas}},
+			{Ordinal: 0, Clusters: []string{"cluster-a"}, Patch: []workv1alpha1.JSONPatchOperation{labels}},
+			{Ordinal: 1, Clusters: []string{"cluster-b", "cluster-c"}, Patch: []workv1alpha1.JSONPatchOperation{labels}},
+		},
+	}
+	tests := map[string]map[int][]workv1alpha1.JSONPatchOperation{
+		"cluster-a": {0: {replicas, labels}},
+		"cluster-c": {0: {replicas}, 1: {labels}},
+		"":          {0: {replicas}},
+	}
+	for cluster, want := range tests {
+		if got := overlaysOf(workload, cluster); !reflect.DeepEqual(got, want) {
+			t.Errorf("overlaysOf(%q) = %+v, want %+v", cluster, got, want)
+		}
+	}
+	if got := overlaysOf(workv1alpha1.WorkloadTemplate{}, "cluster-a"); got != nil {
+		t.Errorf("overlaysOf() without overlays = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// buildDependencies maps the ordinal of each manifest to the ordinals of the manifests it depends on.
+// The ordinals that don't point to a manifest are ignored so that a typo doesn't block the work.
+func buildDependencies(count int, dependencies []workv1alpha1.ManifestDependency) map[int][]int {
+	deps := make(map[int][]int)
+	for _, dependency := range dependencies {
+		if dependency.Ordinal < 0 || dependency.Ordinal >= count {
+			klog.InfoS("ignore the dependencies of a manifest that doesn't exist", "ordinal", dependency.Ordinal)
+			continue
+		}
+		for _, dependsOn := range dependency.DependsOn {
+			if dependsOn < 0 || dependsOn >= count || dependsOn == dependency.Ordinal {
+				klog.InfoS("ignore an invalid manifest dependency", "ordinal", dependency.Ordinal, "dependsOn", dependsOn)
+				continue
+			}
+			deps[dependency.Ordinal] = append(deps[dependency.Ordinal], dependsOn)
+		}
+	}
+	return deps
+}
+
+// findPrerequisites returns the ordinals of the manifests the others may need to exist before they can be applied,
+// i.e. the namespaces and the CRDs. The manifests that can't be decoded are not prerequisites.
+func findPrerequisites(manifests []workv1alpha1.Manifest) map[int]bool {
+	prerequisites := make(map[int]bool)
+	for i := range manifests {
+		obj, err := manifests[i].AsUnstructured()
+		if err != nil {
+			continue
+		}
+		switch obj.GroupVersionKind().GroupKind() {
+		case schema.GroupKind{Kind: "Namespace"}, schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+			prerequisites[i] = true
+		}
+	}
+	return prerequisites
+}
+
+// applyOrder sorts the ordinals of the manifests so that every manifest comes after the ones it depends on and
+// the prerequisites come before the other manifests whose dependencies allow it, the manifests keep their order
+// in the list otherwise. The manifests that are in or depend on a dependency cycle can't be sorted, they come last
+// and are also returned as a set.
+func applyOrder(count int, deps map[int][]int, prerequisites map[int]bool) ([]int, map[int]bool) {
+	sorted := make(map[int]bool, count)
+	order := make([]int, 0, count)
+	for len(order) < count {
+		next := -1
+		for ordinal := 0; ordinal < count && (next == -1 || !prerequisites[next]); ordinal++ {
+			if sorted[ordinal] || (next != -1 && !prerequisites[ordinal]) {
+				continue
+			}
+			ready := true
+			for _, dependsOn := range deps[ordinal] {
+				if !sorted[dependsOn] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = ordinal
+			}
+		}
+		if next == -1 {
+			break
+		}
+		sorted[next] = true
+		order = append(order, next)
+	}
+
+	cyclic := make(map[int]bool)
+	for ordinal := 0; ordinal < count; ordinal++ {
+		if !sorted[ordinal] {
+			cyclic[ordinal] = true
+			order = append(order, ordinal)
+		}
+	}
+	return order, cyclic
+}
+
+// checkDependencies returns an error if the manifest depends on one that wasn't applied successfully.
+func checkDependencies(ordinal int, deps map[int][]int, results []applyResult) error {
+	for _, dependsOn := range deps[ordinal] {
+		if results[dependsOn].err != nil || results[dependsOn].kindUnavailable {
+			return newManifestError(ReasonDependencyNotReady,
+				fmt.Errorf("the manifest %d it depends on is not applied", dependsOn))
+		}
+	}
+	return nil
+}
+
+// expandWorkload splits the manifests holding several YAML documents into a manifest per document, so that each
+// document gets its own condition and identifier. The ordinals of the dependencies are shifted to match, and a
+// dependency on a split manifest is a dependency on all of its documents.
+func expandWorkload(workload workv1alpha1.WorkloadTemplate) workv1alpha1.WorkloadTemplate {
+	ordinals := make([][]int, len(workload.Manifests))
+	expanded := workv1alpha1.WorkloadTemplate{}
+	split := false
+	for i := range workload.Manifests {
+		docs, err := workload.Manifests[i].Documents()
+		if err != nil || len(docs) == 0 {
+			// the manifest is applied as is so that its condition tells what is wrong with it
+			docs = []workv1alpha1.Manifest{workload.Manifests[i]}
+		}
+		split = split || len(docs) > 1
+		for _, doc := range docs {
+			ordinals[i] = append(ordinals[i], len(expanded.Manifests))
+			expanded.Manifests = append(expanded.Manifests, doc)
+		}
+	}
+	if !split {
+		return workload
+	}
+
+	for _, dependency := range workload.Dependencies {
+		if dependency.Ordinal < 0 || dependency.Ordinal >= len(ordinals) {
+			klog.InfoS("ignore the dependencies of a manifest that doesn't exist", "ordinal", dependency.Ordinal)
+			continue
+		}
+		var dependsOn []int
+		for _, ordinal := range dependency.DependsOn {
+			// the documents of a manifest don't depend on each other
+			if ordinal >= 0 && ordinal < len(ordinals) && ordinal != dependency.Ordinal {
+				dependsOn = append(dependsOn, ordinals[ordinal]...)
+			}
+		}
+		for _, ordinal := range ordinals[dependency.Ordinal] {
+			expanded.Dependencies = append(expanded.Dependencies, workv1alpha1.ManifestDependency{Ordinal: ordinal, DependsOn: dependsOn})
+		}
+	}
+	for _, pin := range workload.ApplyVersions {
+		if pin.Ordinal < 0 || pin.Ordinal >= len(ordinals) {
+			continue
+		}
+		// every document of a manifest is applied as the version the manifest is pinned to
+		for _, ordinal := range ordinals[pin.Ordinal] {
+			expanded.ApplyVersions = append(expanded.ApplyVersions, workv1alpha1.ManifestApplyVersion{Ordinal: ordinal, Version: pin.Version})
+		}
+	}
+	for _, mode := range workload.ApplyModes {
+		if mode.Ordinal < 0 || mode.Ordinal >= len(ordinals) {
+			continue
+		}
+		// every document of a manifest is applied in the mode of the manifest
+		for _, ordinal := range ordinals[mode.Ordinal] {
+			expanded.ApplyModes = append(expanded.ApplyModes, workv1alpha1.ManifestApplyMode{Ordinal: ordinal, Mode: mode.Mode})
+		}
+	}
+	for _, healthCheck := range workload.HealthChecks {
+		if healthCheck.Ordinal < 0 || healthCheck.Ordinal >= len(ordinals) {
+			continue
+		}
+		// every document of a manifest has to pass the health check of the manifest
+		for _, ordinal := range ordinals[healthCheck.Ordinal] {
+			expanded.HealthChecks = append(expanded.HealthChecks,
+				workv1alpha1.ManifestHealthCheck{Ordinal: ordinal, Expression: healthCheck.Expression})
+		}
+	}
+	for _, o := range workload.Overlays {
+		if o.Ordinal < 0 || o.Ordinal >= len(ordinals) {
+			continue
+		}
+		// every document of a manifest is patched by the overlays of the manifest
+		for _, ordinal := range ordinals[o.Ordinal] {
+			expanded.Overlays = append(expanded.Overlays, workv1alpha1.ManifestOverlay{Ordinal: ordinal, Clusters: o.Clusters, Patch: o.Patch})
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestApplyOrder(t *testing.T) {
+	tests := map[string]struct {
+		count         int
+		dependencies  []workv1alpha1.ManifestDependency
+		prerequisites map[int]bool
+		wantOrder     []int
+		wantCyclic    map[int]bool
+	}{
+		"no dependencies": {
+			count:      3,
+			wantOrder:  []int{0, 1, 2},
+			wantCyclic: map[int]bool{},
+		},
+		"a CR before its CRD": {
+			count: 3,
+			dependencies: []workv1alpha1.ManifestDependency{
+				{Ordinal: 0, DependsOn: []int{2}},
+			},
+			wantOrder:  []int{1, 2, 0},
+			wantCyclic: map[int]bool{},
+		},
+		"prerequisites first": {
+			count:         4,
+			prerequisites: map[int]bool{1: true, 3: true},
+			wantOrder:     []int{1, 3, 0, 2},
+			wantCyclic:    map[int]bool{},
+		},
+		"dependencies win over prerequisites": {
+			count: 3,
+			dependencies: []workv1alpha1.ManifestDependency{
+				{Ordinal: 2, DependsOn: []int{1}},
+			},
+			prerequisites: map[int]bool{2: true},
+			wantOrder:     []int{0, 1, 2},
+			wantCyclic:    map[int]bool{},
+		},
+		"invalid ordinals are ignored": {
+			count: 2,
+			dependencies: []workv1alpha1.ManifestDependency{
+				{Ordinal: 0, DependsOn: []int{0, 5, -1}},
+				{Ordinal: 7, DependsOn: []int{0}},
+			},
+			wantOrder:  []int{0, 1},
+			wantCyclic: map[int]bool{},
+		},
+		"a cycle and its dependent": {
+			count: 4,
+			dependencies: []workv1alpha1.ManifestDependency{
+				{Ordinal: 0, DependsOn: []int{1}},
+				{Ordinal: 1, DependsOn: []int{0}},
+				{Ordinal: 3, DependsOn: []int{1}},
+			},
+			wantOrder:  []int{2, 0, 1, 3},
+			wantCyclic: map[int]bool{0: true, 1: true, 3: true},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			order, cyclic := applyOrder(tt.count, buildDependencies(tt.count, tt.dependencies), tt.prerequisites)
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("applyOrder() order = %v, want %v", order, tt.wantOrder)
+			}
+			if !reflect.DeepEqual(cyclic, tt.wantCyclic) {
+				t.Errorf("applyOrder() cyclic = %v, want %v", cyclic, tt.wantCyclic)
+			}
+		})
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	deps := map[int][]int{2: {0, 1}}
+	results := []applyResult{{}, {err: errors.New("failed")}, {}}
+	err := checkDependencies(2, deps, results)
+	if got := applyFailureReason(err); got != ReasonDependencyNotReady {
+		t.Errorf("checkDependencies() reason = %q, want DependencyNotReady", got)
+	}
+	if err := checkDependencies(1, deps, results); err != nil {
+		t.Errorf("checkDependencies() = %v, want no error for a manifest without dependencies", err)
+	}
+}
+
+func TestExpandWorkload(t *testing.T) {
+	rawManifest := func(raw string) workv1alpha1.Manifest {
+		return workv1alpha1.Manifest{RawExtension: runtime.RawExtension{Raw: []byte(raw)}}
+	}
+	namespace := rawManifest(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"app"}}`)
+	configMaps := rawManifest("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: first\n  namespace: app\n" +
+		"---\n# nothing here\n---\n" +
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: second\n  namespace: app\n")
+	secret := rawManifest("apiVersion: v1\nkind: Secret\nmetadata:\n  name: secret\n  namespace: app\n")
+
+	workload := workv1alpha1.WorkloadTemplate{
+		Manifests: []workv1alpha1.Manifest{namespace, configMaps, secret},
+		Dependencies: []workv1alpha1.ManifestDependency{
+			{Ordinal: 1, DependsOn: []int{0}},
+			{Ordinal: 2, DependsOn: []int{1}},
+		},
+		ApplyVersions: []workv1alpha1.ManifestApplyVersion{{Ordinal: 1, Version: "v1"}},
+		ApplyModes:    []workv1alpha1.ManifestApplyMode{{Ordinal: 1, Mode: workv1alpha1.ManifestApplyModeCreateOnly}},
+		HealthChecks:  []workv1alpha1.ManifestHealthCheck{{Ordinal: 1, Expression: "has(object.data)"}},
+		Overlays:      []workv1alpha1.ManifestOverlay{{Ordinal: 2, Patch: []workv1alpha1.JSONPatchOperation{{Op: "remove", Path: "/data"}}}},
+	}
+	expanded := expandWorkload(workload)
+
+	wantNames := []string{"app", "first", "second", "secret"}
+	if len(expanded.Manifests) != len(wantNames) {
+		t.Fatalf("expandWorkload() has %d manifests, want %d", len(expanded.Manifests), len(wantNames))
+	}
+	for i, manifest := range expanded.Manifests {
+		obj, err := manifest.AsUnstructured()
+		if err != nil {
+			t.Fatalf("failed to decode manifest %d: %v", i, err)
+		}
+		if obj.GetName() != wantNames[i] {
+			t.Errorf("manifest %d is %s, want %s", i, obj.GetName(), wantNames[i])
+		}
+	}
+	// a manifest that isn't split is left as it was written
+	if string(expanded.Manifests[3].Raw) != string(secret.Raw) {
+		t.Errorf("the single document manifest became %s", expanded.Manifests[3].Raw)
+	}
+	wantDependencies := []workv1alpha1.ManifestDependency{
+		{Ordinal: 1, DependsOn: []int{0}},
+		{Ordinal: 2, DependsOn: []int{0}},
+		{Ordinal: 3, DependsOn: []int{1, 2}},
+	}
+	if !reflect.DeepEqual(expanded.Dependencies, wantDependencies) {
+		t.Errorf("expandWorkload() dependencies = %+v, want %+v", expanded.Dependencies, wantDependencies)
+	}
+	wantVersions := []workv1alpha1.ManifestApplyVersion{{Ordinal: 1, Version: "v1"}, {Ordinal: 2, Version: "v1"}}
+	if !reflect.DeepEqual(expanded.ApplyVersions, wantVersions) {
+		t.Errorf("expandWorkload() apply versions = %+v, want %+v", expanded.ApplyVersions, wantVersions)
+	}
+	wantModes := []workv1alpha1.ManifestApplyMode{
+		{Ordinal: 1, Mode: workv1alpha1.ManifestApplyModeCreateOnly},
+		{Ordinal: 2, Mode: workv1alpha1.ManifestApplyModeCreateOnly},
+	}
+	if !reflect.DeepEqual(expanded.ApplyModes, wantModes) {
+		t.Errorf("expandWorkload() apply modes = %+v, want %+v", expanded.ApplyModes, wantModes)
+	}
+	wantHealthChecks := []workv1alpha1.ManifestHealthCheck{{Ordinal: 1, Expression: "has(object.data)"}, {Ordinal: 2, Expression: "has(object.data)"}}
+	if !reflect.DeepEqual(expanded.HealthChecks, wantHealthChecks) {
+		t.Errorf("expandWorkload() health checks = %+v, want %+v", expanded.HealthChecks, wantHealthChecks)
+	}
+	if len(expanded.Overlays) != 1 || expanded.Overlays[0].Ordinal != 3 {
+		t.Errorf("expandWorkload() overlays = %+v, want the overlay of the secret at its new ordinal", expanded.Overlays)
+	}
+
+	single := workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{namespace, secret}}
+	if got := expandWorkload(single); !reflect.DeepEqual(got, single) {
+		t.Errorf("expandWorkload() = %+v, want the workload without multi-document manifests unchanged", got)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+const (
+	// RequireApprovalAnnotation set to "true" makes the changes of a work wait for an approval before they are applied.
+	RequireApprovalAnnotation = "multicluster.x-k8s.io/require-approval"
+	// ApprovedGenerationAnnotation approves the changes of the given generation of a work that requires an approval.
+	ApprovedGenerationAnnotation = "multicluster.x-k8s.io/approved-generation"
+
+	// PendingChangeCreate is the action of a change that creates a resource.
+	PendingChangeCreate = "Create"
+	// PendingChangeUpdate is the action of a change that updates a resource.
+	PendingChangeUpdate = "Update"
+)
+
+// maxDiffLength is the maximum length of the diff of a pending change we record in the work status.
+const maxDiffLength = 4096
+
+// requiresApproval checks if the current generation of the work has to be approved before it is applied.
+func requiresApproval(work *workv1alpha1.Work) bool {
+	annotations := work.GetAnnotations()
+	if annotations[RequireApprovalAnnotation] != "true" {
+		return false
+	}
+	approved, err := strconv.ParseInt(annotations[ApprovedGenerationAnnotation], 10, 64)
+	return err != nil || approved != work.Generation
+}
+
+// setPendingChanges records the pending changes of the work in its status instead of applying them.
+func setPendingChanges(work *workv1alpha1.Work, pending []workv1alpha1.PendingChange) {
+	work.Status.PendingChanges = pending
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: work.Generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPendingApproval,
+		Message: fmt.Sprintf("%d changes are waiting for the %s annotation to be set to %d",
+			len(pending), ApprovedGenerationAnnotation, work.Generation),
+	})
+}
+
+// waitForApproval saves the pending changes of the work recorded by setPendingChanges.
+func (r *ApplyWorkReconciler) waitForApproval(ctx context.Context, work *workv1alpha1.Work) (ctrl.Result, error) {
+	klog.InfoS("the changes of the work are waiting for an approval",
+		workKeys(work.Namespace, work.Name, "generation", work.Generation, "changes", len(work.Status.PendingChanges))...)
+	if err := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "update work status failed", workKeys(work.Namespace, work.Name)...)
+		return ctrl.Result{}, err
+	}
+	// setting the approval annotation triggers the next reconcile
+	return ctrl.Result{}, nil
+}
+
+// computePendingChanges compares the manifests, as they would be applied with the options, with the live resources
+// without applying anything. The manifests we can't decode or transform are left for the apply to report.
+func (r *ApplyWorkReconciler) computePendingChanges(ctx context.Context,
+	manifests []workv1alpha1.Manifest, opts applyOptions) ([]workv1alpha1.PendingChange, error) {
+	var pending []workv1alpha1.PendingChange
+	for index, manifest := range manifests {
+		gvr, desired, _, _, err := r.prepareManifest(manifest, index, opts)
+		if err != nil {
+			klog.V(logLevelDebug).InfoS("skip a manifest we can't decode when computing the pending changes", "ordinal", index, "err", err)
+			continue
+		}
+		// a paused manifest isn't applied on approval either
+		if isPausedManifest(desired) {
+			continue
+		}
+		change := workv1alpha1.PendingChange{Identifier: buildResourceIdentifier(index, desired, gvr)}
+		desiredFields := managedFields(desired.Object)
+
+		live, err := r.spokeDynamicClient.Resource(gvr).Namespace(desired.GetNamespace()).
+			Get(ctx, desired.GetName(), metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			change.Action = PendingChangeCreate
+		case err != nil:
+			return nil, err
+		default:
+			specHash, err := generateSpecHash(desired)
+			if err != nil {
+				return nil, err
+			}
+			// the apply only updates the resources whose spec hash changed
+			if specHash == live.GetAnnotations()[specHashAnnotation] {
+				continue
+			}
+			change.Action = PendingChangeUpdate
+			desiredFields = diffDesiredFields(desiredFields, live.Object)
+		}
+
+		data, err := json.Marshal(desiredFields)
+		if err != nil {
+			return nil, err
+		}
+		change.Diff = truncateOnRuneBoundary(string(data), maxDiffLength)
+		pending = append(pending, change)
+	}
+	return pending, nil
+}
+
+// managedFields returns the fields of the manifest we manage, the metadata is limited to the labels and annotations.
+func managedFields(obj map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		switch key {
+		case "status":
+		case "metadata":
+			metadata, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			managed := make(map[string]interface{})
+			for _, field := range []string{"labels", "annotations"} {
+				if fieldValue, ok := metadata[field]; ok {
+					managed[field] = fieldValue
+				}
+			}
+			if len(managed) != 0 {
+				fields[key] = managed
+			}
+		default:
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// diffDesiredFields returns the fields of the desired object whose values differ from the live ones.
+// The fields only set on the live object are not part of the diff since applying doesn't change them.
+func diffDesiredFields(desired, live map[string]interface{}) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for key, desiredValue := range desired {
+		liveValue, found := live[key]
+		desiredMap, desiredIsMap := desiredValue.(map[string]interface{})
+		liveMap, liveIsMap := liveValue.(map[string]interface{})
+		if found && desiredIsMap && liveIsMap {
+			if fieldDiff := diffDesiredFields(desiredMap, liveMap); len(fieldDiff) != 0 {
+				diff[key] = fieldDiff
+			}
+			continue
+		}
+		if !found || !reflect.DeepEqual(desiredValue, liveValue) {
+			diff[key] = desiredValue
+		}
+	}
+	return diff
+}
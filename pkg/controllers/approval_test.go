@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestRequiresApproval(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		want        bool
+	}{
+		"approval not required": {},
+		"not approved": {
+			annotations: map[string]string{RequireApprovalAnnotation: "true"},
+			want:        true,
+		},
+		"approved an older generation": {
+			annotations: map[string]string{RequireApprovalAnnotation: "true", ApprovedGenerationAnnotation: "1"},
+			want:        true,
+		},
+		"approved the current generation": {
+			annotations: map[string]string{RequireApprovalAnnotation: "true", ApprovedGenerationAnnotation: "2"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "work", Generation: 2, Annotations: tt.annotations},
+			}
+			if got := requiresApproval(work); got != tt.want {
+				t.Errorf("requiresApproval() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffDesiredFields(t *testing.T) {
+	desired := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app": "nginx"},
+		},
+		"data": map[string]interface{}{
+			"same":    "value",
+			"changed": "new",
+			"added":   "value",
+		},
+	}
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":          map[string]interface{}{"app": "nginx"},
+			"resourceVersion": "10",
+		},
+		"data": map[string]interface{}{
+			"same":    "value",
+			"changed": "old",
+			"unowned": "value",
+		},
+	}
+	want := map[string]interface{}{
+		"data": map[string]interface{}{
+			"changed": "new",
+			"added":   "value",
+		},
+	}
+	if got := diffDesiredFields(desired, live); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDesiredFields() = %v, want %v", got, want)
+	}
+}
+
+func TestComputePendingChanges(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "", "config")
+	configMap.Object["data"] = map[string]interface{}{"key": "value"}
+	large := newUnstructured("v1", "ConfigMap", "", "large")
+	large.Object["data"] = map[string]interface{}{"key": strings.Repeat("é", maxDiffLength)}
+	manifests := []workv1alpha1.Manifest{newTestManifest(t, configMap), newTestManifest(t, large)}
+	opts := applyOptions{
+		defaultNamespace:  "cluster-a",
+		namespaceOverride: "foo-tenant",
+		overlays: map[int][]workv1alpha1.JSONPatchOperation{0: {
+			{Op: "replace", Path: "/data/key", Value: &runtime.RawExtension{Raw: []byte(`"overlaid"`)}},
+		}},
+		labels: map[string]string{"team": "a"},
+	}
+	r := &ApplyWorkReconciler{spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), restMapper: newTestRESTMapper()}
+
+	pending, err := r.computePendingChanges(context.Background(), manifests, opts)
+	if err != nil {
+		t.Fatalf("computePendingChanges() error = %v", err)
+	}
+	if len(pending) != 2 || pending[0].Action != PendingChangeCreate || pending[0].Identifier.Namespace != "foo-tenant" {
+		t.Fatalf("computePendingChanges() = %+v, want the config maps created in foo-tenant", pending)
+	}
+	if diff := pending[0].Diff; !strings.Contains(diff, `"overlaid"`) || !strings.Contains(diff, `"team":"a"`) {
+		t.Errorf("computePendingChanges() diff = %s, want the overlay and the propagated label", diff)
+	}
+	if diff := pending[1].Diff; len(diff) > maxDiffLength || !utf8.ValidString(diff) {
+		t.Errorf("computePendingChanges() diff is %d bytes, valid UTF-8 %t, want it cut on a rune boundary", len(diff), utf8.ValidString(diff))
+	}
+
+	// once applied the same way, there is nothing left to approve
+	for _, result := range r.applyManifests(context.Background(), manifests, nil, nil, owner, opts) {
+		if result.err != nil {
+			t.Fatalf("applyManifests() error = %v", result.err)
+		}
+	}
+	if pending, err = r.computePendingChanges(context.Background(), manifests, opts); err != nil || len(pending) != 0 {
+		t.Errorf("computePendingChanges() after the apply = %+v, %v, want no pending change", pending, err)
+	}
+}
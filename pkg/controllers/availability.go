@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/healthcheck"
+)
+
+// availabilityChecker checks if an object is available on the spoke cluster.
+// It returns whether the object is available and a message describing why it is not.
+type availabilityChecker func(obj *unstructured.Unstructured) (bool, string)
+
+// availabilityCheckers are the checkers of the kinds whose availability we know how to tell.
+var availabilityCheckers = map[schema.GroupKind]availabilityChecker{
+	{Group: "apps", Kind: "Deployment"}:  checkDeploymentAvailability,
+	{Group: "apps", Kind: "StatefulSet"}: checkStatefulSetAvailability,
+	{Group: "apps", Kind: "DaemonSet"}:   checkDaemonSetAvailability,
+	{Group: "", Kind: "Pod"}:             checkPodAvailability,
+}
+
+// defaultAvailabilityChecker checks the kinds without a checker, they are available once they are applied.
+var defaultAvailabilityChecker availabilityChecker = func(*unstructured.Unstructured) (bool, string) {
+	return true, ""
+}
+
+// checkAvailability checks if an applied object is available on the spoke cluster.
+// It returns whether the object is available and a message describing why it is not.
+func checkAvailability(obj *unstructured.Unstructured) (bool, string) {
+	if checker, ok := availabilityCheckers[obj.GroupVersionKind().GroupKind()]; ok {
+		return checker(obj)
+	}
+	return defaultAvailabilityChecker(obj)
+}
+
+// manifestHealthCheck is the compiled health check of a manifest, or why it doesn't compile.
+type manifestHealthCheck struct {
+	check *healthcheck.Check
+	err   error
+}
+
+// compileHealthChecks compiles the health checks of a workload, keyed by the ordinal of their manifest.
+func compileHealthChecks(workload workv1alpha1.WorkloadTemplate) map[int]*manifestHealthCheck {
+	checks := make(map[int]*manifestHealthCheck, len(workload.HealthChecks))
+	for _, healthCheck := range workload.HealthChecks {
+		check, err := healthcheck.Compile(healthCheck.Expression)
+		checks[healthCheck.Ordinal] = &manifestHealthCheck{check: check, err: err}
+	}
+	return checks
+}
+
+// checkManifestAvailability checks if the applied object of a manifest is available with the health check of the
+// manifest, or with the checker of its kind if the manifest doesn't have one.
+func checkManifestAvailability(obj *unstructured.Unstructured, healthCheck *manifestHealthCheck) (bool, string) {
+	if healthCheck == nil {
+		return checkAvailability(obj)
+	}
+	if healthCheck.err != nil {
+		return false, healthCheck.err.Error()
+	}
+	healthy, err := healthCheck.check.Evaluate(obj)
+	if err != nil {
+		return false, err.Error()
+	}
+	if !healthy {
+		return false, "The health check of the manifest is false"
+	}
+	return true, ""
+}
+
+// desiredReplicas returns the replicas in the spec of a workload, the api server defaults them to 1.
+func desiredReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return replicas
+}
+
+// checkDeploymentAvailability checks if the latest spec of the deployment is rolled out and all of its replicas are available.
+func checkDeploymentAvailability(obj *unstructured.Unstructured) (bool, string) {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observedGeneration < obj.GetGeneration() {
+		return false, "The deployment controller has not observed the latest spec"
+	}
+	replicas := desiredReplicas(obj)
+	updatedReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	availableReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+	if updatedReplicas < replicas || availableReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas are updated and %d are available", updatedReplicas, replicas, availableReplicas)
+	}
+	return true, ""
+}
+
+// checkStatefulSetAvailability checks if the latest spec of the stateful set is rolled out and all of its replicas are ready.
+func checkStatefulSetAvailability(obj *unstructured.Unstructured) (bool, string) {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observedGeneration < obj.GetGeneration() {
+		return false, "The stateful set controller has not observed the latest spec"
+	}
+	replicas := desiredReplicas(obj)
+	updatedReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	readyReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	if updatedReplicas < replicas || readyReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas are updated and %d are ready", updatedReplicas, replicas, readyReplicas)
+	}
+	return true, ""
+}
+
+// checkDaemonSetAvailability checks if the latest spec of the daemon set is rolled out and available on all the nodes it's scheduled to.
+func checkDaemonSetAvailability(obj *unstructured.Unstructured) (bool, string) {
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if observedGeneration < obj.GetGeneration() {
+		return false, "The daemon set controller has not observed the latest spec"
+	}
+	desired, _, _ := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedNumberScheduled")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "numberAvailable")
+	if updated < desired || available < desired {
+		return false, fmt.Sprintf("%d of %d scheduled pods are updated and %d are available", updated, desired, available)
+	}
+	return true, ""
+}
+
+// checkPodAvailability checks if the pod is ready, or completed successfully.
+func checkPodAvailability(obj *unstructured.Unstructured) (bool, string) {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase == "Succeeded" {
+		return true, ""
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		cond, ok := condition.(map[string]interface{})
+		if ok && cond["type"] == "Ready" && cond["status"] == "True" {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("The pod is not ready, its phase is %q", phase)
+}
+
+func buildAvailableStatusCondition(available bool, message string, observedGeneration int64) metav1.Condition {
+	if !available {
+		return metav1.Condition{
+			Type:               ConditionTypeAvailable,
+			Status:             metav1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			ObservedGeneration: observedGeneration,
+			Reason:             ReasonManifestNotAvailable,
+			Message:            message,
+		}
+	}
+
+	return metav1.Condition{
+		Type:               ConditionTypeAvailable,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		ObservedGeneration: observedGeneration,
+		Reason:             ReasonManifestAvailable,
+		Message:            "Manifest is available",
+	}
+}
+
+// buildWorkAvailableCondition aggregates the availability of the manifests into the Available condition of the work.
+func buildWorkAvailableCondition(manifestConditions []workv1alpha1.ManifestCondition, observedGeneration int64) metav1.Condition {
+	notAvailable := 0
+	for _, manifestCond := range manifestConditions {
+		// a paused manifest is neutral, it may never have been applied
+		if meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypePaused) {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypeAvailable) {
+			notAvailable++
+		}
+	}
+	if notAvailable != 0 {
+		return metav1.Condition{
+			Type:               ConditionTypeAvailable,
+			Status:             metav1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			ObservedGeneration: observedGeneration,
+			Reason:             ReasonWorkNotAvailable,
+			Message:            fmt.Sprintf("%d of %d manifests are not available", notAvailable, len(manifestConditions)),
+		}
+	}
+	return metav1.Condition{
+		Type:               ConditionTypeAvailable,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		ObservedGeneration: observedGeneration,
+		Reason:             ReasonWorkAvailable,
+		Message:            "All the manifests are available",
+	}
+}
+
+// allManifestsAvailable checks if all the manifests of a work are available.
+func allManifestsAvailable(manifestConditions []workv1alpha1.ManifestCondition) bool {
+	for _, manifestCond := range manifestConditions {
+		// a paused manifest is neutral, it may never have been applied
+		if meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypePaused) {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypeAvailable) {
+			return false
+		}
+	}
+	return true
+}
+
+// availabilityPending checks if some manifests of a work are not available yet but may become so without the work
+// changing. The manifests whose kind is not served by the spoke cluster anymore don't, checking them back is pointless.
+func availabilityPending(manifestConditions []workv1alpha1.ManifestCondition) bool {
+	for _, manifestCond := range manifestConditions {
+		if meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypePaused) {
+			continue
+		}
+		available := meta.FindStatusCondition(manifestCond.Conditions, ConditionTypeAvailable)
+		if available == nil || (available.Status != metav1.ConditionTrue && available.Reason != ReasonKindUnavailable) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func newWorkload(apiVersion, kind string, spec, status map[string]interface{}) *unstructured.Unstructured {
+	obj := newUnstructured(apiVersion, kind, "default", "workload")
+	obj.SetGeneration(2)
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func TestCheckAvailability(t *testing.T) {
+	tests := map[string]struct {
+		obj  *unstructured.Unstructured
+		want bool
+	}{
+		"available deployment": {
+			obj: newWorkload("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+			want: true,
+		},
+		"deployment with the old spec": {
+			obj: newWorkload("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)},
+				map[string]interface{}{"observedGeneration": int64(1), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+		},
+		"ready stateful set": {
+			obj: newWorkload("apps/v1", "StatefulSet", map[string]interface{}{"replicas": int64(3)},
+				map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(3), "readyReplicas": int64(3)}),
+			want: true,
+		},
+		"stateful set rolling out": {
+			obj: newWorkload("apps/v1", "StatefulSet", nil,
+				map[string]interface{}{"observedGeneration": int64(2), "updatedReplicas": int64(0), "readyReplicas": int64(1)}),
+		},
+		"available daemon set": {
+			obj: newWorkload("apps/v1", "DaemonSet", nil, map[string]interface{}{"observedGeneration": int64(2),
+				"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(3)}),
+			want: true,
+		},
+		"daemon set missing pods": {
+			obj: newWorkload("apps/v1", "DaemonSet", nil, map[string]interface{}{"observedGeneration": int64(2),
+				"desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(2)}),
+		},
+		"ready pod": {
+			obj: newWorkload("v1", "Pod", nil, map[string]interface{}{"phase": "Running",
+				"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}}}),
+			want: true,
+		},
+		"pending pod": {
+			obj: newWorkload("v1", "Pod", nil, map[string]interface{}{"phase": "Pending"}),
+		},
+		"completed pod": {
+			obj:  newWorkload("v1", "Pod", nil, map[string]interface{}{"phase": "Succeeded"}),
+			want: true,
+		},
+		"unknown kind": {
+			obj:  newWorkload("v1", "ConfigMap", nil, nil),
+			want: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, msg := checkAvailability(tt.obj); got != tt.want {
+				t.Errorf("checkAvailability() = %t (%s), want %t", got, msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckManifestAvailability(t *testing.T) {
+	checks := compileHealthChecks(workv1alpha1.WorkloadTemplate{HealthChecks: []workv1alpha1.ManifestHealthCheck{
+		{Ordinal: 0, Expression: `object.status.phase == "Ready"`},
+		{Ordinal: 1, Expression: `object.status.phase ==`},
+	}})
+	tests := map[string]struct {
+		obj     *unstructured.Unstructured
+		ordinal int
+		want    bool
+	}{
+		"healthy custom resource": {
+			obj:  newWorkload("example.com/v1", "Database", nil, map[string]interface{}{"phase": "Ready"}),
+			want: true,
+		},
+		"unhealthy custom resource": {
+			obj: newWorkload("example.com/v1", "Database", nil, map[string]interface{}{"phase": "Provisioning"}),
+		},
+		"custom resource without a status yet": {
+			obj: newWorkload("example.com/v1", "Database", nil, nil),
+		},
+		"invalid health check": {
+			obj:     newWorkload("example.com/v1", "Database", nil, map[string]interface{}{"phase": "Ready"}),
+			ordinal: 1,
+		},
+		"no health check falls back to the kind": {
+			obj:     newWorkload("apps/v1", "Deployment", map[string]interface{}{"replicas": int64(2)}, nil),
+			ordinal: 2,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got, msg := checkManifestAvailability(tt.obj, checks[tt.ordinal]); got != tt.want {
+				t.Errorf("checkManifestAvailability() = %t (%s), want %t", got, msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvailabilityPending(t *testing.T) {
+	available := []metav1.Condition{{Type: ConditionTypeAvailable, Status: metav1.ConditionTrue}}
+	notAvailable := []metav1.Condition{{Type: ConditionTypeAvailable, Status: metav1.ConditionFalse}}
+	kindUnavailable := []metav1.Condition{buildKindUnavailableAvailableCondition(workv1alpha1.ResourceIdentifier{Kind: "Widget"})}
+	paused := []metav1.Condition{{Type: ConditionTypePaused, Status: metav1.ConditionTrue}}
+	tests := map[string]struct {
+		conditions [][]metav1.Condition
+		want       bool
+	}{
+		"all available":                                   {conditions: [][]metav1.Condition{available, available}},
+		"one not available":                               {conditions: [][]metav1.Condition{available, notAvailable}, want: true},
+		"one not checked yet":                             {conditions: [][]metav1.Condition{available, nil}, want: true},
+		"a kind that is not served":                       {conditions: [][]metav1.Condition{available, kindUnavailable}},
+		"a paused manifest":                               {conditions: [][]metav1.Condition{paused, available}},
+		"a kind that is not served and one not available": {conditions: [][]metav1.Condition{kindUnavailable, notAvailable}, want: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var manifestConditions []workv1alpha1.ManifestCondition
+			for _, conditions := range tt.conditions {
+				manifestConditions = append(manifestConditions, workv1alpha1.ManifestCondition{Conditions: conditions})
+			}
+			if got := availabilityPending(manifestConditions); got != tt.want {
+				t.Errorf("availabilityPending() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// the same delays the controller-runtime workqueue uses by default for failed items
+	defaultBackoffBaseDelay = 5 * time.Millisecond
+	defaultBackoffMaxDelay  = 1000 * time.Second
+)
+
+// workBackoff tracks the consecutive failures of each work to compute how long to wait before retrying it.
+// The failures are counted per generation, so a user pushing a fix to a failing work gets it applied promptly
+// instead of waiting out the backoff accumulated by the previous generation.
+type workBackoff struct {
+	mu        sync.Mutex
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	entries   map[types.NamespacedName]backoffEntry
+}
+
+type backoffEntry struct {
+	generation int64
+	failures   int
+}
+
+func newWorkBackoff(baseDelay, maxDelay time.Duration) *workBackoff {
+	return &workBackoff{
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+		entries:   make(map[types.NamespacedName]backoffEntry),
+	}
+}
+
+// next records a failure to reconcile the given generation of a work and returns how long to wait before retrying.
+func (b *workBackoff) next(key types.NamespacedName, generation int64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry := b.entries[key]
+	if entry.generation != generation {
+		// the work changed since it last failed, start over
+		entry = backoffEntry{generation: generation}
+	}
+	delay := b.baseDelay
+	for i := 0; i < entry.failures && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+	entry.failures++
+	b.entries[key] = entry
+	return delay
+}
+
+// reset forgets the failures of a work once it is reconciled successfully or deleted.
+func (b *workBackoff) reset(key types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestWorkBackoffResetsOnGenerationChange(t *testing.T) {
+	backoff := newWorkBackoff(time.Second, time.Minute)
+	key := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		if got := backoff.next(key, 1); got != want {
+			t.Fatalf("failure %d: next() = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// the user pushes a fix, the next retry must not wait out the previous backoff
+	if got := backoff.next(key, 2); got != time.Second {
+		t.Errorf("next() after a generation change = %v, want %v", got, time.Second)
+	}
+
+	// other works are not affected
+	if got := backoff.next(types.NamespacedName{Namespace: "cluster-a", Name: "other"}, 2); got != time.Second {
+		t.Errorf("next() for another work = %v, want %v", got, time.Second)
+	}
+}
+
+func TestWorkBackoffCapsAndResets(t *testing.T) {
+	backoff := newWorkBackoff(time.Second, 5*time.Second)
+	key := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+
+	var got time.Duration
+	for i := 0; i < 10; i++ {
+		got = backoff.next(key, 1)
+	}
+	if got != 5*time.Second {
+		t.Errorf("next() after many failures = %v, want the max delay %v", got, 5*time.Second)
+	}
+
+	backoff.reset(key)
+	if got := backoff.next(key, 1); got != time.Second {
+		t.Errorf("next() after reset = %v, want %v", got, time.Second)
+	}
+}
+
+func TestTransientRetryDelay(t *testing.T) {
+	key := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+
+	r := &ApplyWorkReconciler{}
+	if got := r.transientRetryDelay(key, 1); got != transientRetryInterval {
+		t.Errorf("transientRetryDelay() without a backoff = %v, want %v", got, transientRetryInterval)
+	}
+
+	// a kind whose CRD is never established is looked up less and less often
+	r.transientBackoff = newWorkBackoff(transientRetryInterval, transientRetryMaxInterval)
+	var got time.Duration
+	for i, want := range []time.Duration{transientRetryInterval, 2 * transientRetryInterval, 4 * transientRetryInterval} {
+		if got = r.transientRetryDelay(key, 1); got != want {
+			t.Fatalf("failure %d: transientRetryDelay() = %v, want %v", i+1, got, want)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		got = r.transientRetryDelay(key, 1)
+	}
+	if got != transientRetryMaxInterval {
+		t.Errorf("transientRetryDelay() after many failures = %v, want %v", got, transientRetryMaxInterval)
+	}
+}
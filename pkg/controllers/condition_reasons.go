@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// The reasons of the conditions set on the works and their manifests. They are part of the API of the controller:
+// tools can match on them, so a reason is never renamed once released.
+
+// Reasons of the Applied condition of a manifest.
+const (
+	// ReasonAppliedManifestComplete is set once the manifest is applied.
+	ReasonAppliedManifestComplete = "AppliedManifestComplete"
+	// ReasonConflictsForceResolved is set once the manifest is applied over the fields of other field managers.
+	ReasonConflictsForceResolved = "ConflictsForceResolved"
+	// ReasonNamespaceIgnored is set once a cluster scoped manifest is applied without the namespace it declares.
+	ReasonNamespaceIgnored = "NamespaceIgnored"
+	// ReasonNamespaceDefaulted is set once a namespaced manifest without a namespace is applied to the one of the work.
+	ReasonNamespaceDefaulted = "NamespaceDefaulted"
+	// ReasonKindUnavailable is set on a manifest applied before whose kind is not served by the spoke cluster anymore.
+	ReasonKindUnavailable = "KindUnavailable"
+	// ReasonCreateOnlySkipped is set on a create only manifest whose resource already exists and was left untouched.
+	ReasonCreateOnlySkipped = "CreateOnlySkipped"
+	// ReasonDryRunWouldCreate is set on a manifest of a dry run work whose resource doesn't exist yet.
+	ReasonDryRunWouldCreate = "DryRunWouldCreate"
+	// ReasonDryRunWouldUpdate is set on a manifest of a dry run work whose resource differs from it.
+	ReasonDryRunWouldUpdate = "DryRunWouldUpdate"
+	// ReasonDryRunUnchanged is set on a manifest of a dry run work whose resource is already up to date.
+	ReasonDryRunUnchanged = "DryRunUnchanged"
+
+	// ReasonAppliedManifestFailed is set on a manifest that failed for any other reason than the ones below.
+	ReasonAppliedManifestFailed = "AppliedManifestFailed"
+	// ReasonDecodeFailed is set on a manifest that can't be decoded into an object, its identifier only has its ordinal.
+	ReasonDecodeFailed = "DecodeFailed"
+	// ReasonMappingNotFound is set on a manifest whose kind is not served by the spoke cluster even after its
+	// REST mapper was refreshed, e.g. its CRD was just applied and is not established yet.
+	ReasonMappingNotFound = "MappingNotFound"
+	// ReasonResourceTypeUnavailable is set on a manifest whose kind the discovery of the spoke cluster doesn't serve
+	// at all, e.g. an Ingress on a cluster without the networking API, while no CRD of the work defines it.
+	// It is also the reason of the ResourceTypeUnavailable condition of the work.
+	ReasonResourceTypeUnavailable = "ResourceTypeUnavailable"
+	// ReasonVersionNotServed is set on a manifest pinned to a version the spoke cluster doesn't serve its kind in.
+	ReasonVersionNotServed = "VersionNotServed"
+	// ReasonOverlayFailed is set on a manifest whose overlays can't be applied to it.
+	ReasonOverlayFailed = "OverlayFailed"
+	// ReasonObjectTooLarge is set on a manifest too large to be stored by the spoke cluster.
+	ReasonObjectTooLarge = "ObjectTooLarge"
+	// ReasonApplyTimeout is set on a manifest the spoke cluster didn't apply in time.
+	ReasonApplyTimeout = "ApplyTimeout"
+	// ReasonApplyConflict is set on a manifest whose fields are owned by other field managers.
+	ReasonApplyConflict = "ApplyConflict"
+	// ReasonNotOwned is set on a manifest whose resource exists without being owned by the work.
+	ReasonNotOwned = "NotOwned"
+	// ReasonNamespaceCollision is set on a manifest that lands on the same resource as another one once its
+	// namespace is overridden.
+	ReasonNamespaceCollision = "NamespaceCollision"
+	// ReasonDependencyCycle is set on a manifest in or depending on a dependency cycle.
+	ReasonDependencyCycle = "DependencyCycle"
+	// ReasonDependencyNotReady is set on a manifest whose dependencies are not applied or available yet.
+	ReasonDependencyNotReady = "DependencyNotReady"
+	// ReasonRolledBack is set on a manifest whose resource was deleted since another manifest of its AllOrNothing
+	// work failed.
+	ReasonRolledBack = "RolledBack"
+)
+
+// Reasons of the Applied condition of a work.
+const (
+	// ReasonAppliedWorkComplete is set once all the manifests of the work are applied.
+	ReasonAppliedWorkComplete = "AppliedWorkComplete"
+	// ReasonAppliedWorkFailed is set when a manifest of the work failed.
+	ReasonAppliedWorkFailed = "AppliedWorkFailed"
+	// ReasonAppliedWorkNotAvailable is set when the manifests are applied but the work is required to be available.
+	ReasonAppliedWorkNotAvailable = "AppliedWorkNotAvailable"
+	// ReasonDryRunComplete is set once the spoke cluster validated all the manifests of a dry run work.
+	ReasonDryRunComplete = "DryRunComplete"
+	// ReasonReconcileInterrupted is set when the controller shut down while applying the work.
+	ReasonReconcileInterrupted = "ReconcileInterrupted"
+	// ReasonPendingApproval is set while the changes of the work wait for their approval.
+	ReasonPendingApproval = "PendingApproval"
+	// ReasonWorkloadRefFailed is set when the object of the workload reference of the work can't be read.
+	ReasonWorkloadRefFailed = "WorkloadRefFailed"
+	// ReasonWorkloadRefNotFound is set while the object of the workload reference of the work doesn't exist.
+	ReasonWorkloadRefNotFound = "WorkloadRefNotFound"
+	// ReasonAppliedWorkCreationFailed is set when the appliedWork of the work can't be created on the spoke cluster.
+	ReasonAppliedWorkCreationFailed = "AppliedWorkCreationFailed"
+)
+
+// Reasons of the Available conditions of a work and its manifests.
+const (
+	ReasonManifestAvailable    = "ManifestAvailable"
+	ReasonManifestNotAvailable = "ManifestNotAvailable"
+	// ReasonStatusCheckTimeout is set on a manifest whose resource was not read from the spoke cluster in time.
+	ReasonStatusCheckTimeout = "StatusCheckTimeout"
+	ReasonWorkAvailable      = "WorkAvailable"
+	ReasonWorkNotAvailable   = "WorkNotAvailable"
+)
+
+// Reasons of the other conditions of a work and its manifests.
+const (
+	// ReasonWorkChanged is the reason of the Stabilizing condition while the work is changed often.
+	ReasonWorkChanged = "WorkChanged"
+	// ReasonWorkStable is the reason of the Stabilizing condition once the work stopped changing.
+	ReasonWorkStable = "WorkStable"
+	// ReasonWorkPaused is the reason of the Paused condition of a paused work.
+	ReasonWorkPaused = "WorkPaused"
+	// ReasonManifestPaused is the reason of the Paused condition of a manifest skipped for its paused annotation.
+	ReasonManifestPaused = "ManifestPaused"
+	// ReasonPruneThresholdExceeded is the reason of the Pruned condition of a work with too many stale resources.
+	ReasonPruneThresholdExceeded = "PruneThresholdExceeded"
+	// ReasonWaitingForDeletion is the reason of the Deleting condition.
+	ReasonWaitingForDeletion = "WaitingForDeletion"
+	// ReasonAppliedWorkMisnamed is the reason of the AppliedWorkMismatch condition while the appliedWork of the work
+	// is not named after it.
+	ReasonAppliedWorkMisnamed = "AppliedWorkMisnamed"
+	// ReasonAppliedWorkRecreated is the reason of the AppliedWorkMismatch condition once the appliedWork was recreated
+	// under the name of the work.
+	ReasonAppliedWorkRecreated = "AppliedWorkRecreated"
+	// ReasonAppliedWorkDeleting is the reason of the Finalizing condition while the appliedWork of a deleted work
+	// is being deleted.
+	ReasonAppliedWorkDeleting = "AppliedWorkDeleting"
+)
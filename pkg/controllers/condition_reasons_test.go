@@ -0,0 +1,50 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestConditionReasons(t *testing.T) {
+	reasons := []string{
+		ReasonAppliedManifestComplete, ReasonConflictsForceResolved, ReasonNamespaceIgnored, ReasonNamespaceDefaulted,
+		ReasonKindUnavailable, ReasonCreateOnlySkipped, ReasonDryRunWouldCreate, ReasonDryRunWouldUpdate, ReasonDryRunUnchanged,
+		ReasonAppliedManifestFailed, ReasonDecodeFailed, ReasonMappingNotFound, ReasonResourceTypeUnavailable, ReasonVersionNotServed, ReasonOverlayFailed, ReasonObjectTooLarge,
+		ReasonApplyTimeout, ReasonApplyConflict, ReasonNotOwned, ReasonNamespaceCollision, ReasonDependencyCycle,
+		ReasonDependencyNotReady, ReasonRolledBack,
+		ReasonAppliedWorkComplete, ReasonAppliedWorkFailed, ReasonAppliedWorkNotAvailable, ReasonDryRunComplete,
+		ReasonReconcileInterrupted, ReasonPendingApproval, ReasonWorkloadRefFailed, ReasonWorkloadRefNotFound,
+		ReasonAppliedWorkCreationFailed,
+		ReasonManifestAvailable, ReasonManifestNotAvailable, ReasonStatusCheckTimeout, ReasonWorkAvailable, ReasonWorkNotAvailable,
+		ReasonWorkChanged, ReasonWorkStable, ReasonWorkPaused, ReasonManifestPaused, ReasonPruneThresholdExceeded,
+		ReasonWaitingForDeletion, ReasonAppliedWorkMisnamed, ReasonAppliedWorkRecreated, ReasonAppliedWorkDeleting,
+	}
+	// the pattern the api server validates the reasons of the conditions with
+	valid := regexp.MustCompile(`^[A-Za-z]([A-Za-z0-9_,:]*[A-Za-z0-9_])?$`)
+	seen := make(map[string]bool)
+	for _, reason := range reasons {
+		if !valid.MatchString(reason) {
+			t.Errorf("reason %q is not a valid condition reason", reason)
+		}
+		if seen[reason] {
+			t.Errorf("reason %q is defined twice", reason)
+		}
+		seen[reason] = true
+	}
+}
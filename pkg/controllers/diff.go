@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// diffContext is how many unchanged lines surround each change of a diff.
+const diffContext = 3
+
+// redactedFields are the fields the api server sets on every object, they are left out of the diffs.
+var redactedFields = [][]string{
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "selfLink"},
+	{"status"},
+}
+
+// DiffManifest returns the unified diff from the live object of a manifest on the spoke cluster to the manifest.
+// Only the fields the manifest sets are compared, so the fields defaulted by the api server don't show up.
+// A manifest whose object doesn't exist yet is diffed against an empty object, an empty diff means they are the same.
+func (r *appliedResourceTracker) DiffManifest(ctx context.Context, manifest workapi.Manifest) (string, error) {
+	gvr, desired, err := decodeUnstructured(r.restMapper, manifest)
+	if err != nil {
+		return "", err
+	}
+	live, err := r.spokeDynamicClient.Resource(gvr).Namespace(desired.GetNamespace()).Get(ctx, desired.GetName(), metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		live = &unstructured.Unstructured{Object: map[string]interface{}{}}
+	case err != nil:
+		return "", fmt.Errorf("failed to get the live object: %w", err)
+	}
+	redact(desired)
+	redact(live)
+	from, err := json.MarshalIndent(pruneToDesired(live.Object, desired.Object), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	to, err := json.MarshalIndent(desired.Object, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff("live", "desired", string(from), string(to)), nil
+}
+
+// redact removes the fields the api server sets on every object.
+func redact(obj *unstructured.Unstructured) {
+	for _, field := range redactedFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+}
+
+// pruneToDesired keeps only the fields of the live object that the desired object sets. The lists of a different
+// length are kept whole since their items can't be matched up.
+func pruneToDesired(live, desired interface{}) interface{} {
+	switch desiredValue := desired.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		pruned := make(map[string]interface{}, len(desiredValue))
+		for key, value := range desiredValue {
+			if liveValue, found := liveMap[key]; found {
+				pruned[key] = pruneToDesired(liveValue, value)
+			}
+		}
+		return pruned
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(desiredValue) {
+			return live
+		}
+		pruned := make([]interface{}, len(liveList))
+		for i := range liveList {
+			pruned[i] = pruneToDesired(liveList[i], desiredValue[i])
+		}
+		return pruned
+	default:
+		return live
+	}
+}
+
+// diffLine is a line of a diff, op is ' ' for an unchanged line, '-' for a removed one and '+' for an added one.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines finds the shortest edit from the lines of a to the lines of b through their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{op: ' ', text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{op: '-', text: a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{op: '+', text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{op: '-', text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{op: '+', text: b[j]})
+	}
+	return lines
+}
+
+// unifiedDiff returns the unified diff from one text to another, or an empty string if they are the same.
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(splitLines(from), splitLines(to))
+	// fromPos[k] and toPos[k] count the lines of each text before the k-th line of the diff
+	fromPos, toPos := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for k, line := range lines {
+		fromPos[k+1], toPos[k+1] = fromPos[k], toPos[k]
+		if line.op != '+' {
+			fromPos[k+1]++
+		}
+		if line.op != '-' {
+			toPos[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		// a hunk takes in the next changes as long as the unchanged lines between them fit in its context
+		start, end := maxInt(k-diffContext, 0), k
+		for end < len(lines) {
+			if lines[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		stop := minInt(end+diffContext, len(lines))
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(fromPos[start], fromPos[stop]), hunkRange(toPos[start], toPos[stop]))
+		for _, line := range lines[start:stop] {
+			fmt.Fprintf(&out, "%c%s\n", line.op, line.text)
+		}
+		k = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of the lines of a text in a hunk header, the lines after first up to last.
+func hunkRange(first, last int) string {
+	if last == first {
+		// an empty range names the line before it
+		return fmt.Sprintf("%d,0", first)
+	}
+	return fmt.Sprintf("%d,%d", first+1, last-first)
+}
+
+func splitLines(text string) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
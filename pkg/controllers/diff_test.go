@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := map[string]struct {
+		from, to string
+		want     string
+	}{
+		"same texts have no diff": {
+			from: "a\nb\n",
+			to:   "a\nb\n",
+		},
+		"changed line": {
+			from: "a\nb\nc\n",
+			to:   "a\nx\nc\n",
+			want: "--- live\n+++ desired\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		"added to an empty text": {
+			to:   "a\n",
+			want: "--- live\n+++ desired\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		"distant changes are separate hunks": {
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "--- live\n+++ desired\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := unifiedDiff("live", "desired", tt.from, tt.to); got != tt.want {
+				t.Errorf("unifiedDiff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffManifest(t *testing.T) {
+	newConfigMap := func(value string) *unstructured.Unstructured {
+		obj := newUnstructured("v1", "ConfigMap", "default", "config")
+		obj.Object["data"] = map[string]interface{}{"key": value}
+		return obj
+	}
+	live := newConfigMap("live")
+	live.SetResourceVersion("42")
+	live.SetLabels(map[string]string{"set-on-the-spoke": "true"})
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationUpdate}})
+	r := &appliedResourceTracker{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), live),
+		restMapper:         newTestRESTMapper(),
+	}
+
+	diff, err := r.DiffManifest(context.Background(), newTestManifest(t, newConfigMap("desired")))
+	if err != nil {
+		t.Fatalf("DiffManifest() error = %v", err)
+	}
+	for _, want := range []string{"--- live\n+++ desired\n", "-    \"key\": \"live\"\n", "+    \"key\": \"desired\"\n"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("DiffManifest() = %q, want it to contain %q", diff, want)
+		}
+	}
+	for _, unwanted := range []string{"resourceVersion", "managedFields", "set-on-the-spoke"} {
+		if strings.Contains(diff, unwanted) {
+			t.Errorf("DiffManifest() = %q, want %s left out", diff, unwanted)
+		}
+	}
+
+	diff, err = r.DiffManifest(context.Background(), newTestManifest(t, newConfigMap("live")))
+	if err != nil || diff != "" {
+		t.Errorf("DiffManifest() = %q, %v, want no diff from the live object", diff, err)
+	}
+
+	diff, err = r.DiffManifest(context.Background(), newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "missing")))
+	if err != nil || !strings.Contains(diff, "+  \"kind\": \"ConfigMap\",\n") {
+		t.Errorf("DiffManifest() = %q, %v, want the whole object added", diff, err)
+	}
+}
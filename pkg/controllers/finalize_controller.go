@@ -18,29 +18,61 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
-	"sigs.k8s.io/work-api/pkg/client/clientset/versioned"
 )
 
 // FinalizeWorkReconciler reconciles a Work object for finalization
 type FinalizeWorkReconciler struct {
 	client      client.Client
-	spokeClient *versioned.Clientset
-	restMapper  meta.RESTMapper
-	log         logr.Logger
+	spokeClient client.Client
+	// spokeDynamicClient releases the applied resources of the works deleted with the orphan policy
+	spokeDynamicClient dynamic.Interface
+	restMapper         meta.RESTMapper
+	log                logr.Logger
+	// workFilter only lets the works applied to our spoke cluster through, it can be nil
+	workFilter predicate.Predicate
+	// finalizeTimeout is how long we wait for the applied work to be deleted before we log the resources holding it up
+	// and check less often, zero removes the work finalizer as soon as the applied work is being deleted
+	finalizeTimeout time.Duration
+	// maxConcurrentReconciles is how many works we finalize at once, zero finalizes one at a time
+	maxConcurrentReconciles int
+	// clusterName is the name of the spoke cluster, it tells our controller apart from those of the other spoke clusters
+	clusterName string
+}
+
+// finalizePollInterval is how often we check if the applied work of a deleted work is gone.
+const finalizePollInterval = time.Second
+
+// finalizeRetryInterval is how soon we check the applied work of a deleted work again once we timed out waiting for it.
+const finalizeRetryInterval = 10 * time.Second
+
+func newFinalizeWorkReconciler(hubClient client.Client, spokeClient client.Client, spokeDynamicClient dynamic.Interface,
+	restMapper meta.RESTMapper) *FinalizeWorkReconciler {
+	return &FinalizeWorkReconciler{
+		client:             hubClient,
+		spokeClient:        spokeClient,
+		spokeDynamicClient: spokeDynamicClient,
+		restMapper:         restMapper,
+		log:                ctrl.Log.WithName("WorkFinalize reconcier"),
+	}
 }
 
 // Reconcile implement the control loop logic for finalizing Work object.
@@ -54,7 +86,7 @@ func (r *FinalizeWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
-	klog.InfoS("Finalize work reconcile loop triggered", "item", req.NamespacedName)
+	klog.InfoS("Finalize work reconcile loop triggered", workKeys(req.Namespace, req.Name)...)
 
 	// cleanup finalizer and resources
 	if !work.DeletionTimestamp.IsZero() {
@@ -63,12 +95,12 @@ func (r *FinalizeWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request
 
 	var appliedWork *workv1alpha1.AppliedWork
 	if controllerutil.ContainsFinalizer(work, workFinalizer) {
-		_, err = r.spokeClient.MulticlusterV1alpha1().AppliedWorks().Get(ctx, req.Name, metav1.GetOptions{})
+		_, err = fetchAppliedWork(ctx, r.spokeClient, req.NamespacedName)
 		if err != nil {
 			if errors.IsNotFound(err) {
-				klog.ErrorS(err, "the finalizer appliedWork object doesn't exist, we will add it back", "name", req.Name)
+				klog.ErrorS(err, "the finalizer appliedWork object doesn't exist, we will add it back", workKeys(req.Namespace, req.Name)...)
 			} else {
-				klog.ErrorS(err, "failed to get the  finalizer appliedWork", "name", req.Name)
+				klog.ErrorS(err, "failed to get the  finalizer appliedWork", workKeys(req.Namespace, req.Name)...)
 				return ctrl.Result{}, err
 			}
 		} else {
@@ -77,45 +109,201 @@ func (r *FinalizeWorkReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		}
 	}
 
-	klog.InfoS("appliedWork finalizer does not exist yet, we will create it", "item", req.NamespacedName)
+	klog.InfoS("appliedWork finalizer does not exist yet, we will create it", workKeys(req.Namespace, req.Name)...)
 	appliedWork = &workv1alpha1.AppliedWork{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: req.Name,
+			Name: appliedWorkName(req.Namespace, req.Name),
 		},
 		Spec: workv1alpha1.AppliedWorkSpec{
 			WorkName:      req.Name,
 			WorkNamespace: req.Namespace,
 		},
 	}
-	_, err = r.spokeClient.MulticlusterV1alpha1().AppliedWorks().Create(ctx, appliedWork, metav1.CreateOptions{})
-	if err != nil && !errors.IsAlreadyExists(err) {
-		// if this conflicts, we'll simply try again later
-		klog.ErrorS(err, "failed to create the appliedWork", "name", req.Name)
-		return ctrl.Result{}, err
+	err = r.spokeClient.Create(ctx, appliedWork)
+	switch {
+	case errors.IsAlreadyExists(err):
+		// a previous reconcile may have created it, make sure it is tracking this work before we rely on it
+		existing := &workv1alpha1.AppliedWork{}
+		if err := r.spokeClient.Get(ctx, types.NamespacedName{Name: appliedWork.Name}, existing); err != nil {
+			klog.ErrorS(err, "failed to get the existing appliedWork", "appliedWork", appliedWork.Name)
+			return ctrl.Result{}, err
+		}
+		if !isAppliedWorkOf(existing, req.NamespacedName) {
+			err = fmt.Errorf("appliedWork %s already exists for work %s/%s", existing.Name,
+				existing.Spec.WorkNamespace, existing.Spec.WorkName)
+			klog.ErrorS(err, "the appliedWork belongs to another work", workKeys(req.Namespace, req.Name)...)
+			return ctrl.Result{}, r.reportAppliedWorkFailure(ctx, work, err)
+		}
+	case err != nil:
+		// we'll try again later with backoff
+		klog.ErrorS(err, "failed to create the appliedWork", "appliedWork", appliedWork.Name)
+		return ctrl.Result{}, r.reportAppliedWorkFailure(ctx, work, err)
 	}
 
-	work.Finalizers = append(work.Finalizers, workFinalizer)
+	controllerutil.AddFinalizer(work, workFinalizer)
 	return ctrl.Result{}, r.client.Update(ctx, work, &client.UpdateOptions{})
 }
 
-// garbageCollectAppliedWork deletes the applied work
+// reportAppliedWorkFailure reports on the work that we can't create its appliedWork on the spoke cluster.
+// It returns the original error so that the work is requeued with backoff.
+func (r *FinalizeWorkReconciler) reportAppliedWorkFailure(ctx context.Context, work *workv1alpha1.Work, err error) error {
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: work.Generation,
+		Reason:             ReasonAppliedWorkCreationFailed,
+		Message:            fmt.Sprintf("Failed to create the appliedWork on the spoke cluster: %v", err),
+	})
+	if updateErr := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); updateErr != nil {
+		klog.ErrorS(updateErr, "update work status failed", workKeys(work.Namespace, work.Name)...)
+	}
+	return err
+}
+
+// garbageCollectAppliedWork deletes the applied work, the delete policy of the work decides what happens to the
+// resources the applied work owns. The work finalizer is only removed once the policy is carried out, so that
+// the resources are never left behind half released if the controller restarts in the middle.
+// Every step can be retried, a work whose applied work is already deleting or gone just gets its finalizer removed.
 func (r *FinalizeWorkReconciler) garbageCollectAppliedWork(ctx context.Context, work *workv1alpha1.Work) (ctrl.Result, error) {
-	if controllerutil.ContainsFinalizer(work, workFinalizer) {
-		deletePolicy := metav1.DeletePropagationForeground
-		err := r.spokeClient.MulticlusterV1alpha1().AppliedWorks().Delete(ctx, work.Name,
-			metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
-		if err != nil {
-			klog.ErrorS(err, "failed to delete the applied Work", work.Name)
+	if !controllerutil.ContainsFinalizer(work, workFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	appliedWork, err := fetchAppliedWork(ctx, r.spokeClient, types.NamespacedName{Namespace: work.Namespace, Name: work.Name})
+	switch {
+	case errors.IsNotFound(err):
+		klog.InfoS("the applied Work is already deleted", workKeys(work.Namespace, work.Name)...)
+	case err != nil:
+		klog.ErrorS(err, "failed to get the applied Work", workKeys(work.Namespace, work.Name)...)
+		return ctrl.Result{}, err
+	default:
+		// we only delete the applied work once its resources are released, there is nothing left to release
+		// while we wait for its deletion to complete
+		if appliedWork.DeletionTimestamp.IsZero() {
+			deletePolicy := propagationPolicyOf(work.Spec.DeletePolicy)
+			// the applied work has to be around until we are done so that we can retry the resources we missed
+			if err = r.releaseAppliedResources(ctx, appliedWork, deletePolicy); err != nil {
+				klog.ErrorS(err, "failed to release the applied resources", workKeys(work.Namespace, work.Name, "appliedWork", appliedWork.Name)...)
+				return ctrl.Result{}, err
+			}
+			err = r.spokeClient.Delete(ctx, appliedWork, client.PropagationPolicy(deletePolicy))
+			if err != nil && !errors.IsNotFound(err) {
+				klog.ErrorS(err, "failed to delete the applied Work", workKeys(work.Namespace, work.Name, "appliedWork", appliedWork.Name)...)
+				return ctrl.Result{}, err
+			}
+		}
+		if r.finalizeTimeout > 0 {
+			err = r.spokeClient.Get(ctx, types.NamespacedName{Name: appliedWork.Name}, &workv1alpha1.AppliedWork{})
+			if err == nil {
+				return r.waitForAppliedWorkDeletion(ctx, work, appliedWork)
+			}
+			if !errors.IsNotFound(err) {
+				klog.ErrorS(err, "failed to check if the applied Work is deleted", workKeys(work.Namespace, work.Name, "appliedWork", appliedWork.Name)...)
+				return ctrl.Result{}, err
+			}
+		}
+		klog.InfoS("Removed the applied Work", workKeys(work.Namespace, work.Name, "appliedWork", appliedWork.Name)...)
+	}
+	controllerutil.RemoveFinalizer(work, workFinalizer)
+	err = r.client.Update(ctx, work, &client.UpdateOptions{})
+	if errors.IsNotFound(err) {
+		// the work is gone as soon as its last finalizer is removed, a previous attempt already did it
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, err
+}
+
+// waitForAppliedWorkDeletion requeues a deleted work until its applied work is gone from the spoke cluster, we don't
+// hold the worker for the resources with slow finalizers that keep a foreground deletion going.
+// The start of the wait is recorded in the Finalizing condition of the work so that it survives the requeues and
+// restarts, the resources still holding up the deletion are logged once we waited longer than the finalize timeout.
+func (r *FinalizeWorkReconciler) waitForAppliedWorkDeletion(ctx context.Context, work *workv1alpha1.Work,
+	appliedWork *workv1alpha1.AppliedWork) (ctrl.Result, error) {
+	if !meta.IsStatusConditionTrue(work.Status.Conditions, ConditionTypeFinalizing) {
+		meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+			Type:               ConditionTypeFinalizing,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			ObservedGeneration: work.Generation,
+			Reason:             ReasonAppliedWorkDeleting,
+			Message:            fmt.Sprintf("Waiting for the appliedWork %s to be deleted from the spoke cluster", appliedWork.Name),
+		})
+		if err := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "update work status failed", workKeys(work.Namespace, work.Name)...)
 			return ctrl.Result{}, err
 		}
-		klog.Infof("Removed the applied Work %s", work.Name)
-		controllerutil.RemoveFinalizer(work, workFinalizer)
+		return ctrl.Result{RequeueAfter: finalizePollInterval}, nil
+	}
+	started := meta.FindStatusCondition(work.Status.Conditions, ConditionTypeFinalizing).LastTransitionTime
+	if time.Since(started.Time) < r.finalizeTimeout {
+		return ctrl.Result{RequeueAfter: finalizePollInterval}, nil
+	}
+	r.logBlockingResources(ctx, appliedWork)
+	return ctrl.Result{RequeueAfter: finalizeRetryInterval}, nil
+}
+
+// logBlockingResources logs the applied resources that are still on the spoke cluster, they hold up the foreground
+// deletion of the applied work until their own finalizers are done.
+func (r *FinalizeWorkReconciler) logBlockingResources(ctx context.Context, appliedWork *workv1alpha1.AppliedWork) {
+	for _, resourceMeta := range appliedWork.Status.AppliedResources {
+		gvr := schema.GroupVersionResource{Group: resourceMeta.Group, Version: resourceMeta.Version, Resource: resourceMeta.Resource}
+		obj, err := r.spokeDynamicClient.Resource(gvr).Namespace(resourceMeta.Namespace).Get(ctx, resourceMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			klog.ErrorS(err, "failed to get an applied resource of a deleted work", "appliedWork", appliedWork.Name, "resource", resourceMeta)
+			continue
+		}
+		klog.InfoS("an applied resource is still blocking the deletion of the applied Work", "appliedWork", appliedWork.Name,
+			"resource", resourceMeta, "deletionTimestamp", obj.GetDeletionTimestamp(), "finalizers", obj.GetFinalizers())
+	}
+}
+
+// releaseAppliedResources removes the owner reference of the applied work from the resources it applied, the resources
+// shared with other owners are left in place for them. The resources the applied work is the last owner of are deleted
+// with the delete policy of the work, the orphan policy leaves them in place as well.
+// The resources are deleted here rather than left to the garbage collector of the spoke cluster, the owner reference of
+// the cluster scoped applied work only gets a namespaced resource collected if a garbage collector runs on the spoke
+// cluster, which is not the case for a bare api server. The owner references remain as a safety net for the resources
+// missing from the status of the applied work.
+func (r *FinalizeWorkReconciler) releaseAppliedResources(ctx context.Context, appliedWork *workv1alpha1.AppliedWork,
+	deletePolicy metav1.DeletionPropagation) error {
+	var deleteOpts *metav1.DeleteOptions
+	if deletePolicy != metav1.DeletePropagationOrphan {
+		deleteOpts = &metav1.DeleteOptions{PropagationPolicy: &deletePolicy}
+	}
+	for _, resourceMeta := range appliedWork.Status.AppliedResources {
+		gvr := schema.GroupVersionResource{Group: resourceMeta.Group, Version: resourceMeta.Version, Resource: resourceMeta.Resource}
+		resourceClient := r.spokeDynamicClient.Resource(gvr).Namespace(resourceMeta.Namespace)
+		deleted, err := releaseAppliedResource(ctx, resourceClient, resourceMeta.Name, appliedWork.UID, deleteOpts)
+		if err != nil {
+			return err
+		}
+		klog.V(logLevelDebug).InfoS("released an applied resource of a deleted work", "appliedWork", appliedWork.Name,
+			"resource", resourceMeta, "deleted", deleted)
+	}
+	return nil
+}
+
+// propagationPolicyOf returns how the applied work is deleted for the delete policy of a work.
+func propagationPolicyOf(policy workv1alpha1.DeletePolicyType) metav1.DeletionPropagation {
+	switch policy {
+	case workv1alpha1.DeletePolicyOrphan:
+		return metav1.DeletePropagationOrphan
+	case workv1alpha1.DeletePolicyBackground:
+		return metav1.DeletePropagationBackground
+	default:
+		return metav1.DeletePropagationForeground
 	}
-	return ctrl.Result{}, r.client.Update(ctx, work, &client.UpdateOptions{})
 }
 
 // SetupWithManager wires up the controller.
 func (r *FinalizeWorkReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).For(&workv1alpha1.Work{},
-		builder.WithPredicates(predicate.GenerationChangedPredicate{})).Complete(r)
+	predicates := []predicate.Predicate{predicate.GenerationChangedPredicate{}}
+	if r.workFilter != nil {
+		predicates = append(predicates, r.workFilter)
+	}
+	return ctrl.NewControllerManagedBy(mgr).Named(controllerName("work-finalize", r.clusterName)).
+		For(&workv1alpha1.Work{}, builder.WithPredicates(predicates...)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).Complete(r)
 }
@@ -0,0 +1,340 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestFinalizeWorkReconcilerAppliedWorkAlreadyExists(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+
+	tests := map[string]struct {
+		existing      *workv1alpha1.AppliedWork
+		wantErr       bool
+		wantFinalizer bool
+	}{
+		"appliedWork created by a previous reconcile": {
+			existing: &workv1alpha1.AppliedWork{
+				ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+				Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+			},
+			wantFinalizer: true,
+		},
+		"appliedWork tracking another work": {
+			existing: &workv1alpha1.AppliedWork{
+				ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+				Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: "cluster-b", WorkName: nsWorkName.Name},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name},
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+			r := newFinalizeWorkReconciler(hubClient, fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.existing).Build(), nil, nil)
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := &workv1alpha1.Work{}
+			if err := hubClient.Get(context.Background(), nsWorkName, got); err != nil {
+				t.Fatalf("failed to get the work: %v", err)
+			}
+			if controllerutil.ContainsFinalizer(got, workFinalizer) != tt.wantFinalizer {
+				t.Errorf("work finalizers = %v, want the finalizer %v", got.Finalizers, tt.wantFinalizer)
+			}
+			if tt.wantErr {
+				cond := meta.FindStatusCondition(got.Status.Conditions, ConditionTypeApplied)
+				if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonAppliedWorkCreationFailed {
+					t.Errorf("work applied condition = %+v, want a failed appliedWork creation", cond)
+				}
+			}
+		})
+	}
+}
+
+func TestFinalizeWorkReconcilerSameWorkNameInNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	workName := strings.Repeat("w", 250)
+	nsWorkNames := []types.NamespacedName{{Namespace: "cluster-a", Name: "work"}, {Namespace: "cluster-b", Name: "work"},
+		{Namespace: "cluster-a", Name: workName}, {Namespace: "cluster-b", Name: workName}}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, nsWorkName := range nsWorkNames {
+		builder = builder.WithObjects(&workv1alpha1.Work{
+			ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name},
+		})
+	}
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := newFinalizeWorkReconciler(builder.Build(), spokeClient, nil, nil)
+
+	for _, nsWorkName := range nsWorkNames {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName}); err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", nsWorkName, err)
+		}
+	}
+
+	appliedWorks := &workv1alpha1.AppliedWorkList{}
+	if err := spokeClient.List(context.Background(), appliedWorks); err != nil {
+		t.Fatalf("failed to list the appliedWorks: %v", err)
+	}
+	if len(appliedWorks.Items) != len(nsWorkNames) {
+		t.Fatalf("got %d appliedWorks, want one for each of the %d works", len(appliedWorks.Items), len(nsWorkNames))
+	}
+	for _, nsWorkName := range nsWorkNames {
+		got, err := fetchAppliedWork(context.Background(), spokeClient, nsWorkName)
+		if err != nil {
+			t.Fatalf("fetchAppliedWork(%s) error = %v", nsWorkName, err)
+		}
+		if !isAppliedWorkOf(got, nsWorkName) {
+			t.Errorf("fetchAppliedWork(%s) = %s tracking %s/%s", nsWorkName, got.Name, got.Spec.WorkNamespace, got.Spec.WorkName)
+		}
+	}
+}
+
+func TestFinalizeWorkReconcilerDeletePolicy(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	appliedWorkOwner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(), Kind: "AppliedWork", Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name), UID: "applied-work-uid",
+	}
+	otherOwner := metav1.OwnerReference{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"}
+	configMapGVR := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	tests := map[string]struct {
+		policy       workv1alpha1.DeletePolicyType
+		wantSoleKept bool
+	}{
+		"no policy deletes the resources": {},
+		"foreground policy deletes the resources": {
+			policy: workv1alpha1.DeletePolicyForeground,
+		},
+		"background policy deletes the resources": {
+			policy: workv1alpha1.DeletePolicyBackground,
+		},
+		"orphan policy releases the resources": {
+			policy:       workv1alpha1.DeletePolicyOrphan,
+			wantSoleKept: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+			now := metav1.Now()
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: nsWorkName.Namespace, Name: nsWorkName.Name, DeletionTimestamp: &now, Finalizers: []string{workFinalizer},
+				},
+				Spec: workv1alpha1.WorkSpec{DeletePolicy: tt.policy},
+			}
+			appliedWork := &workv1alpha1.AppliedWork{
+				ObjectMeta: metav1.ObjectMeta{Name: appliedWorkOwner.Name, UID: appliedWorkOwner.UID},
+				Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+				Status: workv1alpha1.AppliedtWorkStatus{
+					AppliedResources: []workv1alpha1.AppliedResourceMeta{
+						{ResourceIdentifier: workv1alpha1.ResourceIdentifier{
+							Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "config",
+						}},
+						{ResourceIdentifier: workv1alpha1.ResourceIdentifier{
+							Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "sole",
+						}},
+					},
+				},
+			}
+			// the shared configmap outlives the work whatever its policy
+			configMap := newUnstructured("v1", "ConfigMap", "default", "config")
+			configMap.SetOwnerReferences([]metav1.OwnerReference{appliedWorkOwner, otherOwner})
+			soleOwned := newUnstructured("v1", "ConfigMap", "default", "sole")
+			soleOwned.SetOwnerReferences([]metav1.OwnerReference{appliedWorkOwner})
+
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+			spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build()
+			dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), configMap, soleOwned)
+			r := newFinalizeWorkReconciler(hubClient, spokeClient, dynamicClient, nil)
+
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			err := spokeClient.Get(context.Background(), types.NamespacedName{Name: appliedWork.Name}, &workv1alpha1.AppliedWork{})
+			if !errors.IsNotFound(err) {
+				t.Errorf("get the appliedWork error = %v, want it to be deleted", err)
+			}
+			got, err := dynamicClient.Resource(configMapGVR).Namespace("default").Get(context.Background(), "config", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the configmap: %v", err)
+			}
+			if !reflect.DeepEqual(got.GetOwnerReferences(), []metav1.OwnerReference{otherOwner}) {
+				t.Errorf("configmap owner references = %+v, want only %+v", got.GetOwnerReferences(), otherOwner)
+			}
+			got, err = dynamicClient.Resource(configMapGVR).Namespace("default").Get(context.Background(), "sole", metav1.GetOptions{})
+			switch {
+			case tt.wantSoleKept && err != nil:
+				t.Errorf("failed to get the released configmap: %v", err)
+			case tt.wantSoleKept && len(got.GetOwnerReferences()) != 0:
+				t.Errorf("released configmap owner references = %+v, want none", got.GetOwnerReferences())
+			case !tt.wantSoleKept && !errors.IsNotFound(err):
+				t.Errorf("get the sole owned configmap error = %v, want it to be deleted", err)
+			}
+			// the work is gone once its last finalizer is removed
+			gotWork := &workv1alpha1.Work{}
+			err = hubClient.Get(context.Background(), nsWorkName, gotWork)
+			if err != nil && !errors.IsNotFound(err) {
+				t.Fatalf("failed to get the work: %v", err)
+			}
+			if err == nil && controllerutil.ContainsFinalizer(gotWork, workFinalizer) {
+				t.Errorf("work finalizers = %v, want the finalizer removed", gotWork.Finalizers)
+			}
+		})
+	}
+}
+
+func TestFinalizeWorkReconcilerFinalizeTimeout(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	now := metav1.Now()
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: nsWorkName.Namespace, Name: nsWorkName.Name, DeletionTimestamp: &now, Finalizers: []string{workFinalizer},
+		},
+	}
+	// the foreground deletion of the applied work waits for the protected claim
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name), Finalizers: []string{metav1.FinalizerDeleteDependents},
+		},
+		Spec: workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+		Status: workv1alpha1.AppliedtWorkStatus{
+			AppliedResources: []workv1alpha1.AppliedResourceMeta{{ResourceIdentifier: workv1alpha1.ResourceIdentifier{
+				Version: "v1", Kind: "PersistentVolumeClaim", Resource: "persistentvolumeclaims", Namespace: "default", Name: "data",
+			}}},
+		},
+	}
+	pvc := newUnstructured("v1", "PersistentVolumeClaim", "default", "data")
+	pvc.SetFinalizers([]string{"kubernetes.io/pvc-protection"})
+
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build()
+	r := newFinalizeWorkReconciler(hubClient, spokeClient, fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), pvc), nil)
+	r.finalizeTimeout = time.Minute
+
+	hasFinalizer := func() bool {
+		got := &workv1alpha1.Work{}
+		err := hubClient.Get(context.Background(), nsWorkName, got)
+		if errors.IsNotFound(err) {
+			// the work is gone once its last finalizer is removed
+			return false
+		}
+		if err != nil {
+			t.Fatalf("failed to get the work: %v", err)
+		}
+		return controllerutil.ContainsFinalizer(got, workFinalizer)
+	}
+
+	// the reconcile doesn't wait for the deletion, it records when it started and checks back soon
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName})
+	if err != nil || result.RequeueAfter != finalizePollInterval {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue while the applied work is being deleted", result, err)
+	}
+	if !hasFinalizer() {
+		t.Fatalf("the work finalizer was removed before the applied work is deleted")
+	}
+	got := &workv1alpha1.Work{}
+	if err := hubClient.Get(context.Background(), nsWorkName, got); err != nil {
+		t.Fatalf("failed to get the work: %v", err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, ConditionTypeFinalizing)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != ReasonAppliedWorkDeleting {
+		t.Fatalf("work finalizing condition = %+v, want the start of the wait recorded", cond)
+	}
+	if result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName}); err != nil ||
+		result.RequeueAfter != finalizePollInterval {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue within the finalize timeout", result, err)
+	}
+
+	// the deletion has been going on for longer than the finalize timeout
+	cond.LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * r.finalizeTimeout))
+	if err := hubClient.Status().Update(context.Background(), got); err != nil {
+		t.Fatalf("failed to update the work status: %v", err)
+	}
+	if result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName}); err != nil ||
+		result.RequeueAfter != finalizeRetryInterval {
+		t.Fatalf("Reconcile() = %+v, %v, want a slower requeue past the finalize timeout", result, err)
+	}
+	if !hasFinalizer() {
+		t.Fatalf("the work finalizer was removed before the applied work is deleted")
+	}
+
+	// the claim is released and the deletion of the applied work completes
+	deleting := &workv1alpha1.AppliedWork{}
+	if err := spokeClient.Get(context.Background(), types.NamespacedName{Name: appliedWork.Name}, deleting); err != nil {
+		t.Fatalf("failed to get the applied work: %v", err)
+	}
+	deleting.Finalizers = nil
+	if err := spokeClient.Update(context.Background(), deleting); err != nil {
+		t.Fatalf("failed to release the applied work: %v", err)
+	}
+	if result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: nsWorkName}); err != nil || result.RequeueAfter != 0 {
+		t.Fatalf("Reconcile() = %+v, %v, want the work finalized", result, err)
+	}
+	if hasFinalizer() {
+		t.Errorf("the work finalizer is not removed once the applied work is deleted")
+	}
+}
+
+func TestPropagationPolicyOf(t *testing.T) {
+	tests := map[workv1alpha1.DeletePolicyType]metav1.DeletionPropagation{
+		"":                                  metav1.DeletePropagationForeground,
+		workv1alpha1.DeletePolicyForeground: metav1.DeletePropagationForeground,
+		workv1alpha1.DeletePolicyBackground: metav1.DeletePropagationBackground,
+		workv1alpha1.DeletePolicyOrphan:     metav1.DeletePropagationOrphan,
+	}
+	for policy, want := range tests {
+		if got := propagationPolicyOf(policy); got != want {
+			t.Errorf("propagationPolicyOf(%q) = %s, want %s", policy, got, want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+)
+
+// setLastApplied records the manifest on the object we write with a client-side create or three-way merge and checks
+// that the object still fits the size limit, since the annotation about doubles its size.
+// The objects written with server side apply or a strategic merge patch don't need it and don't carry it.
+func (r *ApplyWorkReconciler) setLastApplied(obj, manifest *unstructured.Unstructured) error {
+	if err := setLastAppliedAnnotationOf(obj, manifest); err != nil {
+		return err
+	}
+	return r.checkObjectSize(obj)
+}
+
+// setLastAppliedAnnotationOf records the manifest we apply on the object itself, like kubectl apply does,
+// so that the next update can tell the fields we stopped managing from the ones set by others.
+func setLastAppliedAnnotationOf(obj, manifest *unstructured.Unstructured) error {
+	lastApplied, err := lastAppliedConfiguration(manifest)
+	if err != nil {
+		return err
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastAppliedAnnotation] = string(lastApplied)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// lastAppliedConfiguration returns the serialized manifest without its own last applied annotation and status.
+func lastAppliedConfiguration(obj *unstructured.Unstructured) ([]byte, error) {
+	manifest := obj.DeepCopy()
+	annotations := manifest.GetAnnotations()
+	delete(annotations, lastAppliedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	manifest.SetAnnotations(annotations)
+	unstructured.RemoveNestedField(manifest.Object, "status")
+	return json.Marshal(manifest.Object)
+}
+
+// buildThreeWayMergePatch computes the patch that brings the current object to the desired one. Only the fields
+// that changed in the manifest or that the last applied manifest had but the desired one dropped are patched,
+// the fields set by others are left alone. The built-in kinds get a strategic merge patch, the others a merge patch
+// whose lists are merged by their list map keys.
+func buildThreeWayMergePatch(desired, current *unstructured.Unstructured, keys listMapKeys) (types.PatchType, []byte, error) {
+	original := []byte(current.GetAnnotations()[lastAppliedAnnotation])
+	if len(original) == 0 {
+		// the object was applied before we recorded the manifest, nothing is removed until the next update
+		original = []byte("{}")
+	}
+	modified, err := json.Marshal(desired.Object)
+	if err != nil {
+		return "", nil, err
+	}
+	return createThreeWayMergePatch(desired.GroupVersionKind(), original, modified, current, keys)
+}
+
+// buildStrategicMergePatch computes the patch that brings the fields the manifest sets on the current object to their
+// desired values. Unlike the three-way merge it never removes a field, the manifest is its own original.
+// The built-in kinds get a strategic merge patch, the others fall back to a merge patch.
+func buildStrategicMergePatch(desired, current *unstructured.Unstructured, keys listMapKeys) (types.PatchType, []byte, error) {
+	modified, err := json.Marshal(desired.Object)
+	if err != nil {
+		return "", nil, err
+	}
+	return createThreeWayMergePatch(desired.GroupVersionKind(), modified, modified, current, keys)
+}
+
+// createThreeWayMergePatch computes a strategic merge patch for the built-in kinds and a merge patch for the others,
+// whose lists the api server can't merge. The lists with list map keys are merged into the current ones before the
+// merge patch is computed, so that it keeps the items set by others and prunes the ones the manifest dropped.
+func createThreeWayMergePatch(gvk schema.GroupVersionKind, original, modified []byte,
+	current *unstructured.Unstructured, keys listMapKeys) (types.PatchType, []byte, error) {
+	currentData, err := json.Marshal(current.Object)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if typed, err := clientgoscheme.Scheme.New(gvk); err == nil {
+		patchMeta, err := strategicpatch.NewPatchMetaFromStruct(typed)
+		if err != nil {
+			return "", nil, err
+		}
+		patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, currentData, patchMeta, true)
+		return types.StrategicMergePatchType, patch, err
+	}
+	if len(keys) > 0 {
+		if modified, err = mergeListMapsOf(original, modified, current.Object, keys); err != nil {
+			return "", nil, err
+		}
+	}
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, currentData)
+	return types.MergePatchType, patch, err
+}
+
+// mergeListMapsOf merges the list maps of the serialized modified manifest into the ones of the current object.
+func mergeListMapsOf(original, modified []byte, current map[string]interface{}, keys listMapKeys) ([]byte, error) {
+	originalObj := map[string]interface{}{}
+	if err := json.Unmarshal(original, &originalObj); err != nil {
+		return nil, err
+	}
+	modifiedObj := map[string]interface{}{}
+	if err := json.Unmarshal(modified, &modifiedObj); err != nil {
+		return nil, err
+	}
+	// the current object is only read, but the merged lists share its items
+	mergeListMaps(originalObj, modifiedObj, runtime.DeepCopyJSON(current), keys, "")
+	return json.Marshal(modifiedObj)
+}
+
+// threeWayMergeUpdate updates the current object to the desired one with a three-way merge patch, and records
+// the manifest on it for the next one.
+func (r *ApplyWorkReconciler) threeWayMergeUpdate(ctx context.Context, gvr schema.GroupVersionResource,
+	desired, current, manifest *unstructured.Unstructured, opts applyOptions) (*unstructured.Unstructured, applyAction, error) {
+	if err := r.setLastApplied(desired, manifest); err != nil {
+		return nil, applyAction{}, err
+	}
+	patchType, patch, err := buildThreeWayMergePatch(desired, current, r.listMapKeysOf(desired.GroupVersionKind()))
+	if err != nil {
+		klog.ErrorS(err, "failed to compute the three-way merge patch", objectKeys(desired)...)
+		return nil, applyAction{}, err
+	}
+	actual, err := r.spokeDynamicClient.Resource(gvr).Namespace(desired.GetNamespace()).
+		Patch(ctx, desired.GetName(), patchType, patch,
+			metav1.PatchOptions{FieldManager: opts.fieldManagerName(), DryRun: opts.dryRunOption()})
+	klog.V(logLevelTrace).InfoS("work object three-way merge patched", objectKeys(desired, "patchType", patchType, "err", err)...)
+	return actual, applyAction{strategy: ApplyModeClientSide}, err
+}
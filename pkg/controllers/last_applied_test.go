@@ -0,0 +1,318 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+)
+
+// newAppliedObject returns the object as it is on the spoke cluster after the manifest was applied,
+// with the fields set by others on top of it.
+func newAppliedObject(t *testing.T, manifest *unstructured.Unstructured, setByOthers func(obj *unstructured.Unstructured)) *unstructured.Unstructured {
+	applied := manifest.DeepCopy()
+	if err := setLastAppliedAnnotationOf(applied, applied); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+	setByOthers(applied)
+	return applied
+}
+
+func TestLastAppliedConfiguration(t *testing.T) {
+	obj := newUnstructured("v1", "ConfigMap", "default", "config")
+	obj.SetAnnotations(map[string]string{"team": "a"})
+	if err := unstructured.SetNestedField(obj.Object, "value", "status", "field"); err != nil {
+		t.Fatalf("failed to set the status: %v", err)
+	}
+	if err := setLastAppliedAnnotationOf(obj, obj); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+	// applying again must not nest the previous configuration in the new one
+	if err := setLastAppliedAnnotationOf(obj, obj); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+
+	lastApplied := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(obj.GetAnnotations()[lastAppliedAnnotation]), &lastApplied); err != nil {
+		t.Fatalf("the last applied configuration is not json: %v", err)
+	}
+	if _, found := lastApplied["status"]; found {
+		t.Errorf("the last applied configuration has the status: %v", lastApplied)
+	}
+	annotations, _, _ := unstructured.NestedStringMap(lastApplied, "metadata", "annotations")
+	if _, found := annotations[lastAppliedAnnotation]; found || annotations["team"] != "a" {
+		t.Errorf("the last applied configuration has annotations %v, want only the manifest ones", annotations)
+	}
+}
+
+func TestThreeWayMergePatchKeepsUnmanagedFieldsOfBuiltInKinds(t *testing.T) {
+	manifest := newUnstructured("apps/v1", "Deployment", "default", "web")
+	manifest.SetLabels(map[string]string{"app": "web", "tier": "frontend"})
+	if err := unstructured.SetNestedSlice(manifest.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "web:v1"},
+	}, "spec", "template", "spec", "containers"); err != nil {
+		t.Fatalf("failed to set the containers: %v", err)
+	}
+	current := newAppliedObject(t, manifest, func(obj *unstructured.Unstructured) {
+		// the replicas are scaled by an autoscaler and a label is added by another controller
+		_ = unstructured.SetNestedField(obj.Object, int64(5), "spec", "replicas")
+		labels := obj.GetLabels()
+		labels["injected"] = "true"
+		obj.SetLabels(labels)
+	})
+
+	desired := manifest.DeepCopy()
+	desired.SetLabels(map[string]string{"app": "web"})
+	_ = unstructured.SetNestedSlice(desired.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "web:v2"},
+	}, "spec", "template", "spec", "containers")
+	if err := setLastAppliedAnnotationOf(desired, desired); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+
+	patchType, patch, err := buildThreeWayMergePatch(desired, current, nil)
+	if err != nil {
+		t.Fatalf("buildThreeWayMergePatch() error = %v", err)
+	}
+	if patchType != types.StrategicMergePatchType {
+		t.Fatalf("buildThreeWayMergePatch() patch type = %s, want %s", patchType, types.StrategicMergePatchType)
+	}
+	currentData, err := json.Marshal(current.Object)
+	if err != nil {
+		t.Fatalf("failed to marshal the current object: %v", err)
+	}
+	patchedData, err := strategicpatch.StrategicMergePatch(currentData, patch, &appsv1.Deployment{})
+	if err != nil {
+		t.Fatalf("failed to apply the patch %s: %v", patch, err)
+	}
+	patched := &appsv1.Deployment{}
+	if err := json.Unmarshal(patchedData, patched); err != nil {
+		t.Fatalf("failed to unmarshal the patched object: %v", err)
+	}
+
+	if patched.Spec.Replicas == nil || *patched.Spec.Replicas != 5 {
+		t.Errorf("patched replicas = %v, want the 5 set by the autoscaler", patched.Spec.Replicas)
+	}
+	if image := patched.Spec.Template.Spec.Containers[0].Image; image != "web:v2" {
+		t.Errorf("patched image = %s, want web:v2", image)
+	}
+	wantLabels := map[string]string{"app": "web", "injected": "true"}
+	if len(patched.Labels) != len(wantLabels) || patched.Labels["app"] != "web" || patched.Labels["injected"] != "true" {
+		t.Errorf("patched labels = %v, want %v", patched.Labels, wantLabels)
+	}
+}
+
+func TestThreeWayMergePatchPrunesDroppedEnvOfDeployment(t *testing.T) {
+	manifest := newUnstructured("apps/v1", "Deployment", "default", "web")
+	if err := unstructured.SetNestedSlice(manifest.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "web:v1", "env": []interface{}{
+			map[string]interface{}{"name": "A", "value": "1"},
+			map[string]interface{}{"name": "B", "value": "2"},
+		}},
+	}, "spec", "template", "spec", "containers"); err != nil {
+		t.Fatalf("failed to set the containers: %v", err)
+	}
+	current := newAppliedObject(t, manifest, func(obj *unstructured.Unstructured) {
+		// another controller injects a variable into the container
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+		container := containers[0].(map[string]interface{})
+		container["env"] = append(container["env"].([]interface{}), map[string]interface{}{"name": "INJECTED", "value": "x"})
+		_ = unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", "containers")
+	})
+
+	// the env list shrinks
+	desired := manifest.DeepCopy()
+	_ = unstructured.SetNestedSlice(desired.Object, []interface{}{
+		map[string]interface{}{"name": "web", "image": "web:v1", "env": []interface{}{
+			map[string]interface{}{"name": "A", "value": "1"},
+		}},
+	}, "spec", "template", "spec", "containers")
+	if err := setLastAppliedAnnotationOf(desired, desired); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+
+	_, patch, err := buildThreeWayMergePatch(desired, current, nil)
+	if err != nil {
+		t.Fatalf("buildThreeWayMergePatch() error = %v", err)
+	}
+	currentData, err := json.Marshal(current.Object)
+	if err != nil {
+		t.Fatalf("failed to marshal the current object: %v", err)
+	}
+	patchedData, err := strategicpatch.StrategicMergePatch(currentData, patch, &appsv1.Deployment{})
+	if err != nil {
+		t.Fatalf("failed to apply the patch %s: %v", patch, err)
+	}
+	patched := &appsv1.Deployment{}
+	if err := json.Unmarshal(patchedData, patched); err != nil {
+		t.Fatalf("failed to unmarshal the patched object: %v", err)
+	}
+	var names []string
+	for _, env := range patched.Spec.Template.Spec.Containers[0].Env {
+		names = append(names, env.Name)
+	}
+	if want := []string{"A", "INJECTED"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("patched env = %v, want %v", names, want)
+	}
+}
+
+func TestThreeWayMergeUpdateKeepsUnmanagedFieldsOfCustomResources(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	manifest := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	_ = unstructured.SetNestedField(manifest.Object, "small", "spec", "size")
+	_ = unstructured.SetNestedField(manifest.Object, "red", "spec", "color")
+	current := newAppliedObject(t, manifest, func(obj *unstructured.Unstructured) {
+		_ = unstructured.SetNestedField(obj.Object, "default", "spec", "defaultedByWebhook")
+	})
+
+	desired := manifest.DeepCopy()
+	_ = unstructured.SetNestedField(desired.Object, "large", "spec", "size")
+	unstructured.RemoveNestedField(desired.Object, "spec", "color")
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), current),
+	}
+	if _, _, err := r.threeWayMergeUpdate(context.Background(), gvr, desired, current, desired.DeepCopy(), applyOptions{}); err != nil {
+		t.Fatalf("threeWayMergeUpdate() error = %v", err)
+	}
+
+	got, err := r.spokeDynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "widget", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the widget: %v", err)
+	}
+	spec, _, _ := unstructured.NestedStringMap(got.Object, "spec")
+	want := map[string]string{"size": "large", "defaultedByWebhook": "default"}
+	if len(spec) != len(want) || spec["size"] != want["size"] || spec["defaultedByWebhook"] != want["defaultedByWebhook"] {
+		t.Errorf("widget spec = %v, want %v", spec, want)
+	}
+	if got.GetAnnotations()[lastAppliedAnnotation] != desired.GetAnnotations()[lastAppliedAnnotation] {
+		t.Errorf("the last applied configuration is not updated: %s", got.GetAnnotations()[lastAppliedAnnotation])
+	}
+}
+
+func TestApplyUnstructuredRecordsLastAppliedOnlyClientSide(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: "multicluster.x-k8s.io/v1alpha1",
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	manifest := newUnstructured("v1", "ConfigMap", "default", "config")
+	manifest.SetOwnerReferences([]metav1.OwnerReference{owner})
+	_ = unstructured.SetNestedField(manifest.Object, strings.Repeat("x", 1000), "data", "payload")
+
+	tests := map[string]struct {
+		mode          string
+		maxObjectSize int
+		wantRecorded  bool
+		wantReason    string
+	}{
+		"client side create records the manifest":        {mode: ApplyModeClientSide, wantRecorded: true},
+		"strategic merge create doesn't record it":       {mode: ApplyModeStrategicMerge},
+		"the recorded manifest counts toward the limit":  {mode: ApplyModeClientSide, maxObjectSize: 1800, wantReason: ReasonObjectTooLarge},
+		"an object without it fits the same limit":       {mode: ApplyModeStrategicMerge, maxObjectSize: 1800},
+		"our own annotations count toward the limit too": {mode: ApplyModeStrategicMerge, maxObjectSize: 1300, wantReason: ReasonObjectTooLarge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &ApplyWorkReconciler{
+				spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+				maxObjectSize:      tt.maxObjectSize,
+			}
+			_, _, err := r.applyUnstructured(context.Background(), gvr, manifest.DeepCopy(), 0, applyOptions{mode: tt.mode})
+			if len(tt.wantReason) != 0 {
+				if got := applyFailureReason(err); got != tt.wantReason {
+					t.Errorf("applyUnstructured() failed with %q (%v), want %s", got, err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyUnstructured() error = %v", err)
+			}
+			got, err := r.spokeDynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "config", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the config map: %v", err)
+			}
+			if _, recorded := got.GetAnnotations()[lastAppliedAnnotation]; recorded != tt.wantRecorded {
+				t.Errorf("last applied configuration recorded = %v, want %v", recorded, tt.wantRecorded)
+			}
+		})
+	}
+}
+
+func TestBuildStrategicMergePatch(t *testing.T) {
+	configMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	_ = unstructured.SetNestedStringMap(configMap.Object, map[string]string{"key": "desired"}, "data")
+	widget := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	_ = unstructured.SetNestedStringSlice(widget.Object, []string{"a"}, "spec", "items")
+
+	tests := map[string]struct {
+		desired       *unstructured.Unstructured
+		setByOthers   func(obj *unstructured.Unstructured)
+		wantPatchType types.PatchType
+		wantPatch     string
+	}{
+		"built-in kind": {
+			desired: configMap,
+			setByOthers: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedStringMap(obj.Object, map[string]string{"key": "live", "other": "kept"}, "data")
+			},
+			wantPatchType: types.StrategicMergePatchType,
+			wantPatch:     `{"data":{"key":"desired"}}`,
+		},
+		"custom kind falls back to a merge patch": {
+			desired: widget,
+			setByOthers: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedStringSlice(obj.Object, []string{"a", "b"}, "spec", "items")
+				_ = unstructured.SetNestedField(obj.Object, "kept", "spec", "other")
+			},
+			wantPatchType: types.MergePatchType,
+			wantPatch:     `{"spec":{"items":["a"]}}`,
+		},
+		"nothing to patch": {
+			desired:       configMap,
+			setByOthers:   func(obj *unstructured.Unstructured) { obj.SetLabels(map[string]string{"injected": "true"}) },
+			wantPatchType: types.StrategicMergePatchType,
+			wantPatch:     `{}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			current := tt.desired.DeepCopy()
+			tt.setByOthers(current)
+			patchType, patch, err := buildStrategicMergePatch(tt.desired, current, nil)
+			if err != nil {
+				t.Fatalf("buildStrategicMergePatch() error = %v", err)
+			}
+			if patchType != tt.wantPatchType || string(patch) != tt.wantPatch {
+				t.Errorf("buildStrategicMergePatch() = %s %s, want %s %s", patchType, patch, tt.wantPatchType, tt.wantPatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/klog/v2"
+	"k8s.io/kube-openapi/pkg/util/proto"
+)
+
+// openAPIRefreshInterval is how often we fetch the OpenAPI schema of the spoke cluster again when a kind is missing
+// from it, e.g. because its CRD was installed after we fetched the schema.
+const openAPIRefreshInterval = time.Minute
+
+// listMapKeys maps the path of the list fields of a kind, e.g. spec.template.spec.containers.env, to the keys their
+// items are merged by. The items of a list are transparent in the path.
+type listMapKeys map[string][]string
+
+// listMapKeyResolver finds the list map keys of the kinds in the OpenAPI schema the spoke cluster publishes.
+type listMapKeyResolver struct {
+	openAPI discovery.OpenAPISchemaInterface
+
+	mu        sync.Mutex
+	models    map[schema.GroupVersionKind]proto.Schema
+	keys      map[schema.GroupVersionKind]listMapKeys
+	fetchedAt time.Time
+}
+
+// newListMapKeyResolver creates a resolver that fetches the OpenAPI schema with the discovery client the first time
+// it is asked for a kind.
+func newListMapKeyResolver(openAPI discovery.OpenAPISchemaInterface) *listMapKeyResolver {
+	return &listMapKeyResolver{openAPI: openAPI}
+}
+
+// keysOf returns the list map keys of the kind, they are nil if the spoke cluster doesn't publish a schema for it.
+func (r *listMapKeyResolver) keysOf(gvk schema.GroupVersionKind) (listMapKeys, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if keys, found := r.keys[gvk]; found {
+		return keys, nil
+	}
+	if _, found := r.models[gvk]; !found && time.Since(r.fetchedAt) > openAPIRefreshInterval {
+		if err := r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+	model, found := r.models[gvk]
+	if !found {
+		return nil, nil
+	}
+	keys := listMapKeys{}
+	collectListMapKeys(model, "", keys, map[string]bool{})
+	r.keys[gvk] = keys
+	return keys, nil
+}
+
+// fetch gets the OpenAPI schema of the spoke cluster and indexes its models by the kinds they define.
+func (r *listMapKeyResolver) fetch() error {
+	// a spoke cluster that fails to serve its schema is not asked again right away either
+	r.fetchedAt = time.Now()
+	doc, err := r.openAPI.OpenAPISchema()
+	if err != nil {
+		return err
+	}
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		return err
+	}
+	r.models = make(map[schema.GroupVersionKind]proto.Schema)
+	r.keys = make(map[schema.GroupVersionKind]listMapKeys)
+	for _, name := range models.ListModels() {
+		model := models.LookupModel(name)
+		for _, gvk := range groupVersionKindsOf(model) {
+			r.models[gvk] = model
+		}
+	}
+	klog.V(logLevelDebug).InfoS("fetched the OpenAPI schema of the spoke cluster", "kinds", len(r.models))
+	return nil
+}
+
+// groupVersionKindsOf returns the kinds the x-kubernetes-group-version-kind extension of a model says it defines.
+func groupVersionKindsOf(model proto.Schema) []schema.GroupVersionKind {
+	extension, _ := model.GetExtensions()["x-kubernetes-group-version-kind"].([]interface{})
+	var gvks []schema.GroupVersionKind
+	for _, item := range extension {
+		fields := map[string]string{}
+		switch v := item.(type) {
+		case map[interface{}]interface{}:
+			for key, value := range v {
+				fields[stringOf(key)] = stringOf(value)
+			}
+		case map[string]interface{}:
+			for key, value := range v {
+				fields[key] = stringOf(value)
+			}
+		}
+		gvks = append(gvks, schema.GroupVersionKind{Group: fields["group"], Version: fields["version"], Kind: fields["kind"]})
+	}
+	return gvks
+}
+
+func stringOf(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// collectListMapKeys records the keys of the lists under the path of a schema. The references being visited are
+// skipped so that the recursive schemas, e.g. the ones of the CRDs, don't loop.
+func collectListMapKeys(s proto.Schema, path string, keys listMapKeys, visiting map[string]bool) {
+	switch t := s.(type) {
+	case *proto.Kind:
+		for name, field := range t.Fields {
+			collectListMapKeys(field, joinFieldPath(path, name), keys, visiting)
+		}
+	case *proto.Array:
+		if mergeKeys := mergeKeysOf(t); len(mergeKeys) > 0 {
+			keys[path] = mergeKeys
+		}
+		collectListMapKeys(t.SubType, path, keys, visiting)
+	case proto.Reference:
+		if visiting[t.Reference()] {
+			return
+		}
+		visiting[t.Reference()] = true
+		collectListMapKeys(t.SubSchema(), path, keys, visiting)
+		delete(visiting, t.Reference())
+	}
+}
+
+// mergeKeysOf returns the keys the items of a list are merged by, from either its list map keys or its patch merge key.
+func mergeKeysOf(array *proto.Array) []string {
+	extensions := array.GetExtensions()
+	if listType, _ := extensions["x-kubernetes-list-type"].(string); listType == "map" {
+		mapKeys, _ := extensions["x-kubernetes-list-map-keys"].([]interface{})
+		var keys []string
+		for _, key := range mapKeys {
+			if s := stringOf(key); s != "" {
+				keys = append(keys, s)
+			}
+		}
+		return keys
+	}
+	strategy, _ := extensions["x-kubernetes-patch-strategy"].(string)
+	if mergeKey, _ := extensions["x-kubernetes-patch-merge-key"].(string); mergeKey != "" && strings.Contains(strategy, "merge") {
+		return []string{mergeKey}
+	}
+	return nil
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// mergeListMaps merges the list maps of the modified manifest into the ones of the current object, so that a merge
+// patch, which replaces whole lists, keeps the items set by others. The items of the modified manifest replace the
+// current ones with the same keys, the items the original manifest had but the modified one dropped are pruned, and
+// the other current items are kept in place.
+func mergeListMaps(original, modified, current map[string]interface{}, keys listMapKeys, path string) {
+	for field, value := range modified {
+		fieldPath := joinFieldPath(path, field)
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if currentMap, ok := current[field].(map[string]interface{}); ok {
+				originalMap, _ := original[field].(map[string]interface{})
+				mergeListMaps(originalMap, v, currentMap, keys, fieldPath)
+			}
+		case []interface{}:
+			currentList, ok := current[field].([]interface{})
+			if mergeKeys := keys[fieldPath]; ok && len(mergeKeys) > 0 {
+				originalList, _ := original[field].([]interface{})
+				modified[field] = mergeList(originalList, v, currentList, mergeKeys, keys, fieldPath)
+			}
+		}
+	}
+}
+
+func mergeList(original, modified, current []interface{}, mergeKeys []string, keys listMapKeys, path string) []interface{} {
+	originalItems := indexListItems(original, mergeKeys)
+	modifiedItems := indexListItems(modified, mergeKeys)
+	if len(modifiedItems) != len(modified) {
+		// the items can't be told apart, the manifest keeps the whole list
+		return modified
+	}
+	merged := make([]interface{}, 0, len(current)+len(modified))
+	mergedKeys := map[string]bool{}
+	for _, item := range current {
+		key, ok := listItemKey(item, mergeKeys)
+		if !ok {
+			merged = append(merged, item)
+			continue
+		}
+		if modifiedItem, found := modifiedItems[key]; found {
+			if currentItem, isMap := item.(map[string]interface{}); isMap {
+				originalItem, _ := originalItems[key].(map[string]interface{})
+				mergeListMaps(originalItem, modifiedItem.(map[string]interface{}), currentItem, keys, path)
+			}
+			merged = append(merged, modifiedItem)
+			mergedKeys[key] = true
+			continue
+		}
+		if _, dropped := originalItems[key]; dropped {
+			continue
+		}
+		merged = append(merged, item)
+	}
+	for _, item := range modified {
+		if key, _ := listItemKey(item, mergeKeys); !mergedKeys[key] {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// indexListItems returns the items of a list that have all the merge keys by their key.
+func indexListItems(list []interface{}, mergeKeys []string) map[string]interface{} {
+	items := make(map[string]interface{}, len(list))
+	for _, item := range list {
+		if key, ok := listItemKey(item, mergeKeys); ok {
+			items[key] = item
+		}
+	}
+	return items
+}
+
+// listItemKey returns the values of the merge keys of a list item, serialized so that they can be compared.
+func listItemKey(item interface{}, mergeKeys []string) (string, bool) {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	values := make([]interface{}, 0, len(mergeKeys))
+	for _, key := range mergeKeys {
+		value, found := fields[key]
+		if !found {
+			return "", false
+		}
+		values = append(values, value)
+	}
+	key, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+	return string(key), true
+}
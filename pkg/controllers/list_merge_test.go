@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	openapi_v2 "github.com/googleapis/gnostic/openapiv2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// widgetOpenAPISchema is the OpenAPI schema a spoke cluster publishes for a custom kind with list maps.
+// The children of a widget spec are widget specs, the schema is recursive like the ones of the CRDs.
+const widgetOpenAPISchema = `
+swagger: "2.0"
+info:
+  title: test
+  version: v1
+paths: {}
+definitions:
+  com.example.v1.Widget:
+    type: object
+    x-kubernetes-group-version-kind:
+    - group: example.com
+      version: v1
+      kind: Widget
+    properties:
+      spec:
+        $ref: "#/definitions/com.example.v1.WidgetSpec"
+  com.example.v1.WidgetSpec:
+    type: object
+    properties:
+      ports:
+        type: array
+        x-kubernetes-list-type: map
+        x-kubernetes-list-map-keys:
+        - port
+        - protocol
+        items:
+          type: object
+          properties:
+            port:
+              type: integer
+            protocol:
+              type: string
+      env:
+        type: array
+        x-kubernetes-patch-merge-key: name
+        x-kubernetes-patch-strategy: merge
+        items:
+          type: object
+          properties:
+            name:
+              type: string
+            value:
+              type: string
+      tags:
+        type: array
+        items:
+          type: string
+      children:
+        type: array
+        items:
+          $ref: "#/definitions/com.example.v1.WidgetSpec"
+`
+
+// fakeOpenAPISchema serves a fixed OpenAPI schema and counts how often it is fetched.
+type fakeOpenAPISchema struct {
+	doc     *openapi_v2.Document
+	fetches int
+}
+
+func (f *fakeOpenAPISchema) OpenAPISchema() (*openapi_v2.Document, error) {
+	f.fetches++
+	return f.doc, nil
+}
+
+func TestListMapKeyResolver(t *testing.T) {
+	doc, err := openapi_v2.ParseDocument([]byte(widgetOpenAPISchema))
+	if err != nil {
+		t.Fatalf("failed to parse the OpenAPI schema: %v", err)
+	}
+	openAPI := &fakeOpenAPISchema{doc: doc}
+	r := newListMapKeyResolver(openAPI)
+
+	keys, err := r.keysOf(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"})
+	if err != nil {
+		t.Fatalf("keysOf() error = %v", err)
+	}
+	want := listMapKeys{"spec.ports": {"port", "protocol"}, "spec.env": {"name"}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keysOf() = %v, want %v", keys, want)
+	}
+
+	// an unknown kind doesn't fetch the schema again right away
+	keys, err = r.keysOf(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"})
+	if err != nil || keys != nil {
+		t.Errorf("keysOf() of an unknown kind = %v, %v, want no keys", keys, err)
+	}
+	if openAPI.fetches != 1 {
+		t.Errorf("the OpenAPI schema was fetched %d times, want once", openAPI.fetches)
+	}
+}
+
+func TestMergeListMaps(t *testing.T) {
+	keys := listMapKeys{"spec.env": {"name"}, "spec.containers": {"name"}, "spec.containers.env": {"name"}}
+	tests := map[string]struct {
+		original string
+		modified string
+		current  string
+		want     string
+	}{
+		"the dropped items are pruned and the items of others are kept": {
+			original: `{"spec":{"env":[{"name":"a","value":"1"},{"name":"b","value":"2"}]}}`,
+			modified: `{"spec":{"env":[{"name":"a","value":"3"}]}}`,
+			current:  `{"spec":{"env":[{"name":"a","value":"1"},{"name":"injected","value":"x"},{"name":"b","value":"2"}]}}`,
+			want:     `{"spec":{"env":[{"name":"a","value":"3"},{"name":"injected","value":"x"}]}}`,
+		},
+		"the new items are appended": {
+			original: `{"spec":{"env":[{"name":"a","value":"1"}]}}`,
+			modified: `{"spec":{"env":[{"name":"a","value":"1"},{"name":"c","value":"3"}]}}`,
+			current:  `{"spec":{"env":[{"name":"injected","value":"x"},{"name":"a","value":"1"}]}}`,
+			want:     `{"spec":{"env":[{"name":"injected","value":"x"},{"name":"a","value":"1"},{"name":"c","value":"3"}]}}`,
+		},
+		"the lists of the items are merged too": {
+			original: `{"spec":{"containers":[{"name":"web","env":[{"name":"a"},{"name":"b"}]}]}}`,
+			modified: `{"spec":{"containers":[{"name":"web","env":[{"name":"a"}]}]}}`,
+			current:  `{"spec":{"containers":[{"name":"web","env":[{"name":"a"},{"name":"b"},{"name":"injected"}]},{"name":"sidecar"}]}}`,
+			want:     `{"spec":{"containers":[{"name":"web","env":[{"name":"a"},{"name":"injected"}]},{"name":"sidecar"}]}}`,
+		},
+		"the items without keys keep the whole list": {
+			original: `{"spec":{"env":[{"name":"a"}]}}`,
+			modified: `{"spec":{"env":[{"value":"1"}]}}`,
+			current:  `{"spec":{"env":[{"name":"a"},{"name":"injected"}]}}`,
+			want:     `{"spec":{"env":[{"value":"1"}]}}`,
+		},
+		"the lists without keys are left alone": {
+			original: `{"spec":{"tags":["a","b"]}}`,
+			modified: `{"spec":{"tags":["a"]}}`,
+			current:  `{"spec":{"tags":["a","b","injected"]}}`,
+			want:     `{"spec":{"tags":["a"]}}`,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var original, modified, current, want map[string]interface{}
+			for _, doc := range []struct {
+				data string
+				into *map[string]interface{}
+			}{{tt.original, &original}, {tt.modified, &modified}, {tt.current, &current}, {tt.want, &want}} {
+				if err := json.Unmarshal([]byte(doc.data), doc.into); err != nil {
+					t.Fatalf("failed to unmarshal %s: %v", doc.data, err)
+				}
+			}
+			mergeListMaps(original, modified, current, keys, "")
+			if !reflect.DeepEqual(modified, want) {
+				t.Errorf("mergeListMaps() = %v, want %v", modified, want)
+			}
+		})
+	}
+}
+
+func TestThreeWayMergePatchMergesListMapsOfCustomResources(t *testing.T) {
+	manifest := newUnstructured("example.com/v1", "Widget", "default", "widget")
+	_ = unstructured.SetNestedSlice(manifest.Object, []interface{}{
+		map[string]interface{}{"name": "a", "value": "1"},
+		map[string]interface{}{"name": "b", "value": "2"},
+	}, "spec", "env")
+	current := newAppliedObject(t, manifest, func(obj *unstructured.Unstructured) {
+		env, _, _ := unstructured.NestedSlice(obj.Object, "spec", "env")
+		_ = unstructured.SetNestedSlice(obj.Object, append(env, map[string]interface{}{"name": "injected", "value": "x"}), "spec", "env")
+	})
+
+	// the env list shrinks
+	desired := manifest.DeepCopy()
+	_ = unstructured.SetNestedSlice(desired.Object, []interface{}{
+		map[string]interface{}{"name": "a", "value": "1"},
+	}, "spec", "env")
+	if err := setLastAppliedAnnotationOf(desired, desired); err != nil {
+		t.Fatalf("setLastAppliedAnnotationOf() error = %v", err)
+	}
+
+	patchType, patch, err := buildThreeWayMergePatch(desired, current, listMapKeys{"spec.env": {"name"}})
+	if err != nil {
+		t.Fatalf("buildThreeWayMergePatch() error = %v", err)
+	}
+	if patchType != types.MergePatchType {
+		t.Fatalf("buildThreeWayMergePatch() patch type = %s, want %s", patchType, types.MergePatchType)
+	}
+	currentData, err := json.Marshal(current.Object)
+	if err != nil {
+		t.Fatalf("failed to marshal the current object: %v", err)
+	}
+	patchedData, err := jsonpatch.MergePatch(currentData, patch)
+	if err != nil {
+		t.Fatalf("failed to apply the patch %s: %v", patch, err)
+	}
+	patched := &unstructured.Unstructured{}
+	if err := patched.UnmarshalJSON(patchedData); err != nil {
+		t.Fatalf("failed to unmarshal the patched object: %v", err)
+	}
+	env, _, _ := unstructured.NestedSlice(patched.Object, "spec", "env")
+	want := []interface{}{
+		map[string]interface{}{"name": "a", "value": "1"},
+		map[string]interface{}{"name": "injected", "value": "x"},
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("patched env = %v, want %v", env, want)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// The verbosity levels of the controller logs, the lines logged without a level are the ones an operator always wants.
+const (
+	// logLevelDebug logs the decisions the controllers make about a work, e.g. why one of its manifests is skipped.
+	logLevelDebug klog.Level = 3
+	// logLevelTrace logs every object the controllers read or write on the spoke cluster.
+	logLevelTrace klog.Level = 5
+)
+
+// logLevels maps the names of the log levels to the klog verbosity they enable.
+var logLevels = map[string]klog.Level{
+	"info":  0,
+	"debug": logLevelDebug,
+	"trace": logLevelTrace,
+}
+
+// LogVerbosity returns the klog verbosity of a log level, which is one of info, debug or trace.
+func LogVerbosity(level string) (klog.Level, error) {
+	verbosity, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		names := make([]string, 0, len(logLevels))
+		for name := range logLevels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("unknown log level %q, it must be one of %s", level, strings.Join(names, ", "))
+	}
+	return verbosity, nil
+}
+
+// workKeys returns the keys and values that identify a work in a log line, followed by the given ones.
+// All the lines about a work use the same work and namespace keys so that they can be filtered together.
+func workKeys(namespace, name string, keysAndValues ...interface{}) []interface{} {
+	return append([]interface{}{"work", name, "namespace", namespace}, keysAndValues...)
+}
+
+// objectKeys returns the keys and values that identify the object of a manifest in a log line, followed by the given ones.
+func objectKeys(obj *unstructured.Unstructured, keysAndValues ...interface{}) []interface{} {
+	return append([]interface{}{"gvk", obj.GroupVersionKind(), "resource", klog.KObj(obj)}, keysAndValues...)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func TestLogVerbosity(t *testing.T) {
+	tests := map[string]struct {
+		level   string
+		want    klog.Level
+		wantErr bool
+	}{
+		"info":           {level: "info", want: 0},
+		"debug":          {level: "debug", want: logLevelDebug},
+		"trace":          {level: "trace", want: logLevelTrace},
+		"case is folded": {level: "Debug", want: logLevelDebug},
+		"unknown level":  {level: "verbose", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := LogVerbosity(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LogVerbosity(%q) error = %v, wantErr %v", tt.level, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LogVerbosity(%q) = %v, want %v", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkKeys(t *testing.T) {
+	got := workKeys("cluster-a", "work", "resource", "config")
+	want := []interface{}{"work", "work", "namespace", "cluster-a", "resource", "config"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("workKeys() = %v, want %v", got, want)
+	}
+}
@@ -18,134 +18,423 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	clientset "sigs.k8s.io/work-api/pkg/client/clientset/versioned"
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
+	"sigs.k8s.io/work-api/pkg/webhook"
 )
 
 const (
 	workFinalizer      = "multicluster.x-k8s.io/work-cleanup"
 	specHashAnnotation = "multicluster.x-k8s.io/spec-hash"
+	// lastAppliedAnnotation records the last manifest we applied on a resource for the three-way merge of the next update.
+	lastAppliedAnnotation = "multicluster.x-k8s.io/last-applied-configuration"
 
-	ConditionTypeApplied = "Applied"
+	// DefaultFieldManager is the field manager of the fields we write to the spoke cluster unless configured otherwise.
+	DefaultFieldManager = "work-api agent"
+
+	// AppliedByAnnotation records the identity of the controller instance that last applied a resource.
+	// It's not part of the spec hash so it never makes a resource look changed.
+	AppliedByAnnotation = "multicluster.x-k8s.io/applied-by"
+
+	ConditionTypeApplied     = "Applied"
+	ConditionTypeAvailable   = "Available"
+	ConditionTypePruned      = "Pruned"
+	ConditionTypeStabilizing = "Stabilizing"
+	// ConditionTypePaused is true on the paused works and on the manifests skipped for their paused annotation
+	ConditionTypePaused = "Paused"
+	// ConditionTypeAppliedWorkMismatch is true while the appliedWork of a work is not named after it
+	ConditionTypeAppliedWorkMismatch = "AppliedWorkMismatch"
+	// ConditionTypeDeleting is true while resources pruned from a work are still on the spoke cluster
+	ConditionTypeDeleting = "Deleting"
+	// ConditionTypeFinalizing is true while a deleted work waits for its appliedWork to be gone from the spoke cluster
+	ConditionTypeFinalizing = "Finalizing"
+	// ConditionTypeMappingPending is true while the spoke cluster doesn't serve the kinds of some manifests of a work yet
+	ConditionTypeMappingPending = "MappingPending"
+	// ConditionTypeResourceTypeUnavailable is true while the spoke cluster has no API for the kinds of some manifests of a work
+	ConditionTypeResourceTypeUnavailable = "ResourceTypeUnavailable"
 )
 
-// Start the controllers with the supplied config
-func Start(ctx context.Context, hubCfg, spokeCfg *rest.Config, setupLog logr.Logger, opts ctrl.Options) error {
+// ControllerOptions contains the tunables of the work controllers.
+type ControllerOptions struct {
+	// StabilizationWindow is how long a work has to stay unchanged before its manifests are applied.
+	// Zero means the work is applied as soon as it changes.
+	StabilizationWindow time.Duration
+
+	// RequireAvailable makes the Applied condition of a work true only after all of its manifests are available.
+	RequireAvailable bool
+
+	// ForceReapplyInterval is how often all the manifests of a work are re-applied even if they didn't change.
+	// Zero disables the periodic re-apply.
+	ForceReapplyInterval time.Duration
+
+	// ResyncPeriod is how often the applied resources are checked for out-of-band edits, which are then
+	// corrected by re-applying their manifests. Zero disables the checks.
+	ResyncPeriod time.Duration
+
+	// WatchAppliedResources watches the kinds of the resources applied to the spoke clusters, so that the resources
+	// edited or deleted out-of-band are corrected right away rather than at the next ResyncPeriod. The watches cache
+	// every object of those kinds on the spoke clusters.
+	WatchAppliedResources bool
+
+	// AuditSink receives a record of every apply and delete made on the spoke cluster, nil disables auditing.
+	AuditSink audit.Sink
+
+	// ApplyTimeout is how long a single manifest may take to be applied, zero means no timeout.
+	ApplyTimeout time.Duration
+
+	// ApplyTimeoutByKind overrides ApplyTimeout for the manifests of some kinds.
+	// The keys are either a kind, e.g. "ConfigMap", or a kind with its group, e.g. "CustomResourceDefinition.apiextensions.k8s.io".
+	ApplyTimeoutByKind map[string]time.Duration
+
+	// ApplyQPS is the maximum rate of the calls the controllers make to each spoke cluster to apply and track
+	// the resources, zero keeps the client defaults.
+	ApplyQPS float32
+
+	// ApplyBurst is how many calls to a spoke cluster can go over ApplyQPS at once.
+	ApplyBurst int
+
+	// StatusTimeout is how long a single read or delete of an applied resource may take when the status of a work
+	// is synced, zero means no timeout.
+	StatusTimeout time.Duration
+
+	// FinalizeTimeout is how long the finalizer of a deleted work waits for its applied work to be gone before it
+	// logs the resources holding it up and checks less often. Zero removes the finalizer as soon as the applied work
+	// is being deleted.
+	FinalizeTimeout time.Duration
+
+	// TriggerAddr is the address of the endpoint that triggers the reconcile of a work, empty disables the endpoint.
+	TriggerAddr string
+
+	// TriggerToken is the bearer token a caller of the trigger endpoint has to present.
+	TriggerToken string
+
+	// TriggerCertDir is the directory of the tls.crt and tls.key the trigger endpoint is served with. Empty serves
+	// plain http, a TriggerAddr without a host only listens on localhost then so that the token doesn't leave the host.
+	TriggerCertDir string
+
+	// InstanceID identifies this controller instance on the resources it applies, empty leaves them unmarked.
+	InstanceID string
+	// FieldManager is the field manager the manifests are written with unless their work picks one, empty means the
+	// DefaultFieldManager. Controllers sharing a spoke cluster should each have their own.
+	FieldManager string
+
+	// ApplyModeByKind is the apply mode of the manifests of some kinds, used when their work doesn't pick one.
+	// The keys are either a kind or a kind with its group like ApplyTimeoutByKind.
+	ApplyModeByKind map[string]string
+
+	// PropagatedLabels and PropagatedAnnotations are set on every resource applied to the spoke clusters unless its
+	// manifest sets them itself. Their values can reference the variables of the manifests, e.g. ${WORK_NAME}.
+	PropagatedLabels      map[string]string
+	PropagatedAnnotations map[string]string
+
+	// PreservedAnnotationPrefixes are the prefixes of the annotations that other controllers set on the applied
+	// resources, e.g. DefaultPreservedAnnotationPrefixes. They keep their value on the spoke cluster when the manifest
+	// doesn't set them and their changes are not corrected as drifts. Empty preserves none of them.
+	PreservedAnnotationPrefixes []string
+
+	// MaxObjectSize is the largest serialized size in bytes of an object that is applied, zero means no limit.
+	// It should be below the request size limit of the spoke cluster so that the oversized objects fail early.
+	MaxObjectSize int
+
+	// PruneLimit is how many of the applied resources of a work can be pruned in a single reconcile.
+	PruneLimit PruneLimit
+
+	// SpokeName is the name of the spoke cluster the controller is started with, the works target it by this name.
+	// The works that don't name a target cluster are applied to it.
+	SpokeName string
+
+	// ClusterNamespace is the hub namespace of the works of the spoke cluster. The AppliedWorks created by older
+	// versions that don't record the namespace of their Work are mapped to it. Empty means the namespace the hub
+	// manager watches.
+	ClusterNamespace string
+
+	// SpokeMetricsAddr is the address the metrics of the manager of the default spoke cluster are served on,
+	// empty means :4848 and "0" disables them.
+	SpokeMetricsAddr string
+
+	// AdditionalSpokes are the other spoke clusters the controller applies works to, keyed by their names.
+	// Each of them gets its own manager and cache.
+	AdditionalSpokes map[string]*rest.Config
+
+	// SpokeLabels are the labels of the spoke clusters keyed by their names, the cluster selectors of the works
+	// are matched against them.
+	SpokeLabels map[string]map[string]string
+
+	// EnableWebhook serves the work admission webhooks with the webhook server of the hub manager.
+	EnableWebhook bool
+
+	// WebhookDefaultNamespace is the namespace the mutating webhook sets on the namespaced manifests without one,
+	// empty means the namespace of their work.
+	WebhookDefaultNamespace string
+
+	// AppliedWorkResyncPeriod is how often the resources of each AppliedWork are checked to still exist on the
+	// spoke cluster, zero keeps the default of one minute.
+	AppliedWorkResyncPeriod time.Duration
+
+	// MaxConcurrentReconciles is how many works each of the apply, status and finalize controllers of a spoke
+	// cluster reconcile at once, zero reconciles one at a time. A work is never reconciled by two workers of the
+	// same controller at once.
+	MaxConcurrentReconciles int
+}
+
+// spokeWebhookPort is the webhook port of the manager of the default spoke cluster, the additional spoke managers take
+// the ports after it.
+const spokeWebhookPort = 8443
+
+// Start the controllers with the supplied config. The works are applied to the spoke cluster of spokeCfg unless they
+// target one of the additional spoke clusters of the controller options.
+func Start(ctx context.Context, hubCfg, spokeCfg *rest.Config, setupLog logr.Logger, opts ctrl.Options, controllerOpts ControllerOptions) error {
 	hubMgr, err := ctrl.NewManager(hubCfg, opts)
 	if err != nil {
 		setupLog.Error(err, "unable to start hub manager")
 		os.Exit(1)
 	}
 
+	if err = ValidateApplyModeByKind(controllerOpts.ApplyModeByKind); err != nil {
+		setupLog.Error(err, "invalid apply modes by kind")
+		return err
+	}
+	if err = ValidatePropagatedMetadata(controllerOpts.PropagatedLabels, controllerOpts.PropagatedAnnotations); err != nil {
+		setupLog.Error(err, "invalid propagated labels or annotations")
+		return err
+	}
+
+	registry := NewSpokeRegistry(controllerOpts.SpokeName, controllerOpts.ApplyQPS, controllerOpts.ApplyBurst)
 	spokeOpts := ctrl.Options{
-		Scheme:             opts.Scheme,
-		LeaderElection:     opts.LeaderElection,
-		MetricsBindAddress: ":4848",
-		Port:               8443,
+		Scheme:                  opts.Scheme,
+		LeaderElection:          opts.LeaderElection,
+		MetricsBindAddress:      ":4848",
+		Port:                    spokeWebhookPort,
+		GracefulShutdownTimeout: opts.GracefulShutdownTimeout,
+		Controller:              opts.Controller,
+	}
+	defaultSpokeOpts := spokeOpts
+	if len(controllerOpts.SpokeMetricsAddr) != 0 {
+		defaultSpokeOpts.MetricsBindAddress = controllerOpts.SpokeMetricsAddr
 	}
-	spokeMgr, err := ctrl.NewManager(spokeCfg, spokeOpts)
+	defaultSpoke, err := registry.Add(controllerOpts.SpokeName, spokeCfg, defaultSpokeOpts)
 	if err != nil {
 		setupLog.Error(err, "unable to start member manager")
 		os.Exit(1)
 	}
+	defaultSpoke.Labels = controllerOpts.SpokeLabels[controllerOpts.SpokeName]
+	for i, name := range additionalSpokeNames(controllerOpts.AdditionalSpokes) {
+		additionalOpts := spokeOpts
+		// the metrics of the controllers are served by the hub and the default spoke managers already
+		additionalOpts.MetricsBindAddress = "0"
+		// the spoke managers serve no webhooks, but each gets a port of its own so that they can never bind the same one
+		additionalOpts.Port = spokeWebhookPort + 1 + i
+		spoke, err := registry.Add(name, controllerOpts.AdditionalSpokes[name], additionalOpts)
+		if err != nil {
+			setupLog.Error(err, "unable to start member manager", "spoke", name)
+			return err
+		}
+		spoke.Labels = controllerOpts.SpokeLabels[name]
+	}
 
-	spokeDynamicClient, err := dynamic.NewForConfig(spokeCfg)
-	if err != nil {
-		setupLog.Error(err, "unable to start manager")
-		os.Exit(1)
+	// the applied work controllers also trigger the re-apply of the works whose resources were deleted out-of-band
+	for _, name := range registry.Names() {
+		spoke, _ := registry.Get(name)
+		spoke.triggers = make(chan event.GenericEvent, triggerQueueSize)
+	}
+	if len(controllerOpts.TriggerAddr) != 0 {
+		if len(controllerOpts.TriggerToken) == 0 {
+			err = fmt.Errorf("the reconcile trigger endpoint requires a token")
+			setupLog.Error(err, "unable to serve the reconcile trigger endpoint")
+			return err
+		}
+		trigger := newTriggerServer(controllerOpts.TriggerAddr, controllerOpts.TriggerToken, hubMgr.GetClient(), registry.triggerOf)
+		trigger.certDir = controllerOpts.TriggerCertDir
+		if err = hubMgr.Add(trigger); err != nil {
+			setupLog.Error(err, "unable to add the reconcile trigger endpoint")
+			return err
+		}
 	}
 
-	restMapper, err := apiutil.NewDynamicRESTMapper(spokeCfg, apiutil.WithLazyDiscovery)
-	if err != nil {
-		setupLog.Error(err, "unable to start manager")
-		os.Exit(1)
+	for _, name := range registry.Names() {
+		spoke, _ := registry.Get(name)
+		if err = setupSpokeControllers(hubMgr, spoke, registry.workFilter(name), opts, controllerOpts); err != nil {
+			setupLog.Error(err, "unable to create the controllers of a spoke cluster", "spoke", name)
+			return err
+		}
 	}
 
-	spokeClientset, err := clientset.NewForConfig(spokeCfg)
-	if err != nil {
-		klog.Fatalf("Error building example clientset: %s", err.Error())
-	}
-	//
-	//hubClientset, err := clientset.NewForConfig(hubCfg)
-	//	if err != nil {
-	//		klog.Fatalf("Error building kubernetes clientset: %s", err.Error())
-	//	}
-	// hubInformerFactory := workinformers.NewSharedInformerFactory(hubClientset, time.Second*3)
-	// spokeInformerFactory := workinformers.NewSharedInformerFactory(spokeClientset, time.Second*3)
-
-	// TODO: Add event recorder
-	if err = newAppliedWorkReconciler(opts.Namespace, hubMgr.GetClient(), spokeMgr.GetClient(), spokeDynamicClient, restMapper).SetupWithManager(spokeMgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "AppliedWork")
-		return err
+	if controllerOpts.EnableWebhook {
+		if err = webhook.SetupWithManager(hubMgr, controllerOpts.WebhookDefaultNamespace); err != nil {
+			setupLog.Error(err, "unable to set up the work webhooks")
+			return err
+		}
 	}
 
-	if err = newWorkStatusReconciler(hubMgr.GetClient(), spokeMgr.GetClient(), spokeDynamicClient, restMapper).SetupWithManager(hubMgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "WorkStatus")
+	managers := map[string]ctrl.Manager{"hub": hubMgr}
+	for _, name := range registry.Names() {
+		spoke, _ := registry.Get(name)
+		managers["spoke "+name] = spoke.Manager
+	}
+	// the probes are served by the hub manager, it is only ready once the caches of the spoke managers are synced too
+	if err = hubMgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up the health check")
 		return err
 	}
-
-	if err = (&ApplyWorkReconciler{
-		client:             hubMgr.GetClient(),
-		spokeDynamicClient: spokeDynamicClient,
-		spokeClient:        spokeMgr.GetClient(),
-		restMapper:         restMapper,
-		log:                ctrl.Log.WithName("Work reconciler"),
-	}).SetupWithManager(hubMgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Work")
+	cacheSync := newCacheSyncChecker()
+	if err = cacheSync.track("hub", hubMgr, &workv1alpha1.Work{}); err != nil {
+		setupLog.Error(err, "unable to track the cache of the hub manager")
 		return err
 	}
-
-	if err = (&FinalizeWorkReconciler{
-		client:      hubMgr.GetClient(),
-		spokeClient: spokeClientset,
-		restMapper:  restMapper,
-		log:         ctrl.Log.WithName("WorkFinalize reconcier"),
-	}).SetupWithManager(hubMgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "WorkFinalize")
+	for _, name := range registry.Names() {
+		spoke, _ := registry.Get(name)
+		if err = cacheSync.track("spoke "+name, spoke.Manager, &workv1alpha1.AppliedWork{}); err != nil {
+			setupLog.Error(err, "unable to track the cache of a spoke manager", "spoke", name)
+			return err
+		}
+	}
+	if err = hubMgr.AddReadyzCheck("caches", cacheSync.check); err != nil {
+		setupLog.Error(err, "unable to set up the readiness check")
 		return err
 	}
+	mgrStartChan := make(chan error, len(managers))
+	for mgrName, mgr := range managers {
+		go func(mgrName string, mgr ctrl.Manager) {
+			klog.InfoS("starting manager", "manager", mgrName)
+			defer klog.InfoS("shutting down manager", "manager", mgrName)
+			if err := mgr.Start(ctx); err != nil {
+				setupLog.Error(err, "problem running manager", "manager", mgrName)
+				mgrStartChan <- err
+				return
+			}
+			mgrStartChan <- nil
+		}(mgrName, mgr)
+	}
 
-	hubMgrStartChan := make(chan error)
-	spokeMgrStartChan := make(chan error)
-	go func() {
-		klog.Info("starting hub manager")
-		defer klog.Info("shutting down hub manager")
-		if err := hubMgr.Start(ctx); err != nil {
-			hubMgrStartChan <- err
+	for range managers {
+		if mgrStartResult := <-mgrStartChan; mgrStartResult != nil {
+			return mgrStartResult
 		}
-		hubMgrStartChan <- nil
-	}()
+	}
 
-	go func() {
-		if err := spokeMgr.Start(ctx); err != nil {
-			spokeMgrStartChan <- err
-		}
-		spokeMgrStartChan <- nil
-	}()
-
-	for i := 0; i < 2; i++ {
-		select {
-		case hubMgrStartResult := <-hubMgrStartChan:
-			if hubMgrStartResult != nil {
-				setupLog.Error(hubMgrStartResult, "problem running hub manager")
-				return hubMgrStartResult
-			}
+	return nil
+}
 
-		case spokeMgrStartResult := <-spokeMgrStartChan:
-			if spokeMgrStartResult != nil {
-				setupLog.Error(spokeMgrStartResult, "problem running spoke manager")
-				return spokeMgrStartResult
-			}
+// setupSpokeControllers creates the controllers that apply the works targeting the spoke cluster.
+// The work controllers run with the hub manager and only see the works the filter lets through.
+func setupSpokeControllers(hubMgr ctrl.Manager, spoke *SpokeCluster, workFilter predicate.Predicate,
+	opts ctrl.Options, controllerOpts ControllerOptions) error {
+	spokeMgr := spoke.Manager
+	clusterNamespace := clusterNamespaceOf(opts, controllerOpts)
+	appliedWorkReconciler := newAppliedWorkReconciler(clusterNamespace, hubMgr.GetClient(), spokeMgr.GetClient(), spoke.DynamicClient,
+		spoke.RESTMapper)
+	if controllerOpts.AppliedWorkResyncPeriod > 0 {
+		appliedWorkReconciler.resyncPeriod = controllerOpts.AppliedWorkResyncPeriod
+	}
+	appliedWorkReconciler.triggers = spoke.triggers
+	appliedWorkReconciler.clusterName = spoke.Name
+	if controllerOpts.WatchAppliedResources {
+		appliedWorkReconciler.watcher = newAppliedResourceWatcher(spoke.DynamicClient, spokeMgr.GetClient(), clusterNamespace, spoke.triggers)
+		if err := spokeMgr.Add(appliedWorkReconciler.watcher); err != nil {
+			return fmt.Errorf("unable to watch the applied resources: %w", err)
 		}
 	}
+	if err := appliedWorkReconciler.SetupWithManager(spokeMgr); err != nil {
+		return fmt.Errorf("unable to create the AppliedWork controller: %w", err)
+	}
+
+	workStatusReconciler := newWorkStatusReconciler(hubMgr.GetClient(), spokeMgr.GetClient(), spoke.DynamicClient, spoke.RESTMapper,
+		hubMgr.GetEventRecorderFor("work-status-controller"), controllerOpts.AuditSink, controllerOpts.PruneLimit,
+		controllerOpts.StatusTimeout)
+	workStatusReconciler.workFilter = workFilter
+	workStatusReconciler.maxConcurrentReconciles = controllerOpts.MaxConcurrentReconciles
+	workStatusReconciler.clusterName = spoke.Name
+	if err := workStatusReconciler.SetupWithManager(hubMgr); err != nil {
+		return fmt.Errorf("unable to create the WorkStatus controller: %w", err)
+	}
+
+	applyWorkReconciler := &ApplyWorkReconciler{
+		client:               hubMgr.GetClient(),
+		spokeDynamicClient:   spoke.DynamicClient,
+		spokeClient:          spokeMgr.GetClient(),
+		restMapper:           spoke.RESTMapper,
+		log:                  ctrl.Log.WithName("Work reconciler"),
+		stabilizationWindow:  controllerOpts.StabilizationWindow,
+		requireAvailable:     controllerOpts.RequireAvailable,
+		forceReapplyInterval: controllerOpts.ForceReapplyInterval,
+		resyncPeriod:         controllerOpts.ResyncPeriod,
+		auditSink:            controllerOpts.AuditSink,
+		backoff:              newWorkBackoff(defaultBackoffBaseDelay, defaultBackoffMaxDelay),
+		transientBackoff:     newWorkBackoff(transientRetryInterval, transientRetryMaxInterval),
+		applyTimeout:         controllerOpts.ApplyTimeout,
+		applyTimeoutByKind:   controllerOpts.ApplyTimeoutByKind,
+		recorder:             hubMgr.GetEventRecorderFor("work-controller"),
+		instanceID:           controllerOpts.InstanceID,
+		applyModeByKind:      controllerOpts.ApplyModeByKind,
+		maxObjectSize:        controllerOpts.MaxObjectSize,
+		triggers:             spoke.triggers,
+		workFilter:           workFilter,
+	}
+	// the clients, the rest mapper and the backoff of the spoke cluster are safe to share between the workers
+	applyWorkReconciler.maxConcurrentReconciles = controllerOpts.MaxConcurrentReconciles
+	applyWorkReconciler.fieldManager = controllerOpts.FieldManager
+	applyWorkReconciler.clusterName = spoke.Name
+	applyWorkReconciler.watchAppliedResources = controllerOpts.WatchAppliedResources
+	applyWorkReconciler.propagatedLabels = controllerOpts.PropagatedLabels
+	applyWorkReconciler.propagatedAnnotations = controllerOpts.PropagatedAnnotations
+	applyWorkReconciler.preservedAnnotationPrefixes = controllerOpts.PreservedAnnotationPrefixes
+	if spoke.DiscoveryClient != nil {
+		applyWorkReconciler.listMapKeys = newListMapKeyResolver(spoke.DiscoveryClient)
+		applyWorkReconciler.resourceTypes = newResourceTypeChecker(spoke.DiscoveryClient)
+	}
+	if err := applyWorkReconciler.SetupWithManager(hubMgr); err != nil {
+		return fmt.Errorf("unable to create the Work controller: %w", err)
+	}
 
+	finalizeWorkReconciler := newFinalizeWorkReconciler(hubMgr.GetClient(), spokeMgr.GetClient(), spoke.DynamicClient, spoke.RESTMapper)
+	finalizeWorkReconciler.workFilter = workFilter
+	finalizeWorkReconciler.finalizeTimeout = controllerOpts.FinalizeTimeout
+	finalizeWorkReconciler.maxConcurrentReconciles = controllerOpts.MaxConcurrentReconciles
+	finalizeWorkReconciler.clusterName = spoke.Name
+	if err := finalizeWorkReconciler.SetupWithManager(hubMgr); err != nil {
+		return fmt.Errorf("unable to create the WorkFinalize controller: %w", err)
+	}
 	return nil
 }
+
+// additionalSpokeNames returns the sorted names of the additional spoke clusters, so that each of them gets the same
+// port from one start to the next.
+func additionalSpokeNames(spokes map[string]*rest.Config) []string {
+	names := make([]string, 0, len(spokes))
+	for name := range spokes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// controllerName returns the name of a controller of the spoke cluster. The controllers of each spoke cluster need
+// their own names, their metrics and logs are told apart by them.
+func controllerName(controller, clusterName string) string {
+	if len(clusterName) == 0 {
+		return controller
+	}
+	return controller + "-" + clusterName
+}
+
+// clusterNamespaceOf returns the hub namespace the AppliedWorks that don't record the namespace of their work are
+// mapped to, the one the hub manager watches unless the controller options pick one.
+func clusterNamespaceOf(opts ctrl.Options, controllerOpts ControllerOptions) string {
+	if len(controllerOpts.ClusterNamespace) != 0 {
+		return controllerOpts.ClusterNamespace
+	}
+	return opts.Namespace
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// staleResourcesDeleted counts the stale resources we pruned from the spoke cluster.
+	staleResourcesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "work_api_stale_resources_deleted_total",
+		Help: "Total number of stale resources deleted from the spoke cluster",
+	}, []string{"group", "version", "kind"})
+
+	// staleResourceDeleteFailures counts the failed attempts to prune a stale resource from the spoke cluster.
+	staleResourceDeleteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "work_api_stale_resource_delete_failures_total",
+		Help: "Total number of failures to delete a stale resource from the spoke cluster",
+	}, []string{"group", "version", "kind"})
+
+	// workApplyTotal counts the manifests we applied to the spoke cluster by their result.
+	workApplyTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "work_apply_total",
+		Help: "Total number of manifests applied to the spoke cluster, the result is applied, unchanged or failed",
+	}, []string{"group", "version", "kind", "result"})
+
+	// workApplyDuration measures how long applying a manifest to the spoke cluster takes.
+	workApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "work_apply_duration_seconds",
+		Help:    "How long applying a manifest to the spoke cluster takes in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"group", "version", "kind", "result"})
+
+	// workManifestCount observes how many manifests the works we reconcile have.
+	workManifestCount = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "work_manifest_count",
+		Help:    "Number of manifests in the works applied to the spoke cluster",
+		Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200, 500},
+	})
+)
+
+const (
+	applyResultApplied   = "applied"
+	applyResultUnchanged = "unchanged"
+	applyResultFailed    = "failed"
+)
+
+func init() {
+	// register the metrics with the controller-runtime registry so they are served on the metrics endpoint
+	metrics.Registry.MustRegister(staleResourcesDeleted, staleResourceDeleteFailures,
+		workApplyTotal, workApplyDuration, workManifestCount)
+}
+
+// recordApplyMetrics records the result and the duration of applying a manifest of the given kind.
+func recordApplyMetrics(gvk schema.GroupVersionKind, updated bool, err error, duration time.Duration) {
+	result := applyResultUnchanged
+	switch {
+	case err != nil:
+		result = applyResultFailed
+	case updated:
+		result = applyResultApplied
+	}
+	workApplyTotal.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, result).Inc()
+	workApplyDuration.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, result).Observe(duration.Seconds())
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRecordApplyMetrics(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "metrics.test", Version: "v1", Kind: "Widget"}
+	tests := map[string]struct {
+		updated bool
+		err     error
+		result  string
+	}{
+		"applied": {
+			updated: true,
+			result:  applyResultApplied,
+		},
+		"unchanged": {
+			result: applyResultUnchanged,
+		},
+		"failed": {
+			updated: true,
+			err:     errors.New("failed"),
+			result:  applyResultFailed,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			counter := workApplyTotal.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, tt.result)
+			before := testutil.ToFloat64(counter)
+			recordApplyMetrics(gvk, tt.updated, tt.err, time.Second)
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("work_apply_total{result=%q} increased by %v, want 1", tt.result, got)
+			}
+		})
+	}
+}
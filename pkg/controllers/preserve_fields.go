@@ -0,0 +1,212 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+var serviceGK = schema.GroupKind{Kind: "Service"}
+
+// defaultPreservedFields are the fields the api server allocates once that the manifests usually leave out, by kind.
+// Clearing them on an update either fails or makes the api server allocate them again.
+var defaultPreservedFields = map[schema.GroupKind][][]string{
+	serviceGK: {{"spec", "clusterIP"}, {"spec", "clusterIPs"}},
+}
+
+// DefaultPreservedAnnotationPrefixes are the prefixes of the annotations that kubectl and the autoscalers set on the
+// resources, the annotations with them keep their live value when the manifest doesn't set them.
+var DefaultPreservedAnnotationPrefixes = []string{
+	"kubectl.kubernetes.io/",
+	"deployment.kubernetes.io/",
+	"autoscaling.alpha.kubernetes.io/",
+	"cluster-autoscaler.kubernetes.io/",
+}
+
+// preserveFields copies the given fields and the allocated fields of the kind from the current object to the
+// manifest if the manifest doesn't set them, so that updating the object doesn't clear them.
+func preserveFields(workObj, curObj *unstructured.Unstructured, paths []string) {
+	gk := workObj.GroupVersionKind().GroupKind()
+	var fields [][]string
+	// an external name service has no cluster IP nor node ports to keep
+	if gk != serviceGK || !isExternalNameService(workObj) {
+		fields = append(fields, defaultPreservedFields[gk]...)
+	}
+	for _, path := range paths {
+		if field := parseFieldPath(path); len(field) != 0 {
+			fields = append(fields, field)
+		}
+	}
+	for _, field := range fields {
+		preserveField(workObj, curObj, field)
+	}
+	if gk == serviceGK {
+		preserveNodePorts(workObj, curObj)
+	}
+	preserveHelmMetadata(workObj, curObj)
+}
+
+// preserveHelmMetadata copies the annotations and the label that tie the current object to a Helm release to the
+// manifest if the manifest doesn't set them, so that the helm CLI keeps recognizing the object as part of its release.
+func preserveHelmMetadata(workObj, curObj *unstructured.Unstructured) {
+	curAnnotations := curObj.GetAnnotations()
+	annotations := workObj.GetAnnotations()
+	for _, key := range []string{workv1alpha1.HelmReleaseNameAnnotation, workv1alpha1.HelmReleaseNamespaceAnnotation} {
+		if value, found := curAnnotations[key]; found {
+			if _, set := annotations[key]; !set {
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[key] = value
+			}
+		}
+	}
+	if len(annotations) != 0 {
+		workObj.SetAnnotations(annotations)
+	}
+	if curObj.GetLabels()[workv1alpha1.HelmManagedByLabel] != workv1alpha1.HelmManagedByValue {
+		return
+	}
+	labels := workObj.GetLabels()
+	if _, set := labels[workv1alpha1.HelmManagedByLabel]; !set {
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[workv1alpha1.HelmManagedByLabel] = workv1alpha1.HelmManagedByValue
+		workObj.SetLabels(labels)
+	}
+}
+
+// preserveAnnotations copies the annotations of the current object whose key starts with one of the prefixes to the
+// manifest if the manifest doesn't set them, so that updating the object doesn't remove the annotations set by others.
+func preserveAnnotations(workObj, curObj *unstructured.Unstructured, prefixes []string) {
+	annotations := workObj.GetAnnotations()
+	for key, value := range curObj.GetAnnotations() {
+		if !hasAnyPrefix(key, prefixes) {
+			continue
+		}
+		if _, set := annotations[key]; !set {
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[key] = value
+		}
+	}
+	if len(annotations) != 0 {
+		workObj.SetAnnotations(annotations)
+	}
+}
+
+// withAppliedPreservedAnnotations returns the live annotations with the ones whose key starts with one of the prefixes
+// set back to their applied value, so that the changes others make to them don't count as a drift.
+func withAppliedPreservedAnnotations(live, applied map[string]string, prefixes []string) map[string]string {
+	annotations := make(map[string]string, len(live))
+	for key, value := range live {
+		if !hasAnyPrefix(key, prefixes) {
+			annotations[key] = value
+		}
+	}
+	for key, value := range applied {
+		if hasAnyPrefix(key, prefixes) {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFieldPath splits a path like `spec.replicas` or `.spec.replicas` into its fields.
+func parseFieldPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), ".")
+	if len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// preserveField copies a field from the current object to the manifest if only the current object has it.
+func preserveField(workObj, curObj *unstructured.Unstructured, field []string) {
+	if _, found, err := unstructured.NestedFieldNoCopy(workObj.Object, field...); found || err != nil {
+		return
+	}
+	value, found, err := unstructured.NestedFieldCopy(curObj.Object, field...)
+	if err != nil || !found {
+		return
+	}
+	_ = unstructured.SetNestedField(workObj.Object, value, field...)
+}
+
+// preserveNodePorts copies the node ports the spoke cluster allocated to the ports of the service manifest that
+// don't pick one. The ports are matched by their port and protocol.
+func preserveNodePorts(workObj, curObj *unstructured.Unstructured) {
+	serviceType, _, _ := unstructured.NestedString(workObj.Object, "spec", "type")
+	if serviceType != "NodePort" && serviceType != "LoadBalancer" {
+		// the other types of services can't have node ports
+		return
+	}
+	curPorts, _, _ := unstructured.NestedSlice(curObj.Object, "spec", "ports")
+	ports, found, _ := unstructured.NestedSlice(workObj.Object, "spec", "ports")
+	if !found {
+		return
+	}
+	for _, p := range ports {
+		port, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, found := port["nodePort"]; found {
+			continue
+		}
+		for _, cp := range curPorts {
+			curPort, ok := cp.(map[string]interface{})
+			if ok && isSameServicePort(port, curPort) && curPort["nodePort"] != nil {
+				port["nodePort"] = curPort["nodePort"]
+				break
+			}
+		}
+	}
+	_ = unstructured.SetNestedSlice(workObj.Object, ports, "spec", "ports")
+}
+
+// isSameServicePort checks if two ports of a service are the same port, the protocol defaults to TCP.
+func isSameServicePort(port1, port2 map[string]interface{}) bool {
+	protocolOf := func(port map[string]interface{}) interface{} {
+		if protocol, found := port["protocol"]; found {
+			return protocol
+		}
+		return "TCP"
+	}
+	return port1["port"] == port2["port"] && protocolOf(port1) == protocolOf(port2)
+}
+
+func isExternalNameService(obj *unstructured.Unstructured) bool {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	return serviceType == "ExternalName"
+}
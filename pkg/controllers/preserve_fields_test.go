@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// newService returns a service of the given type with a single TCP port 80 and the given node port, if any.
+func newService(serviceType string, nodePort int64) *unstructured.Unstructured {
+	service := newUnstructured("v1", "Service", "default", "web")
+	port := map[string]interface{}{"port": int64(80)}
+	if nodePort != 0 {
+		port["nodePort"] = nodePort
+	}
+	_ = unstructured.SetNestedField(service.Object, serviceType, "spec", "type")
+	_ = unstructured.SetNestedSlice(service.Object, []interface{}{port}, "spec", "ports")
+	return service
+}
+
+func TestPreserveFields(t *testing.T) {
+	liveService := newService("NodePort", 30080)
+	_ = unstructured.SetNestedField(liveService.Object, "10.0.0.10", "spec", "clusterIP")
+	_ = unstructured.SetNestedStringSlice(liveService.Object, []string{"10.0.0.10"}, "spec", "clusterIPs")
+
+	liveHelmConfigMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	liveHelmConfigMap.SetAnnotations(map[string]string{
+		workv1alpha1.HelmReleaseNameAnnotation:      "web",
+		workv1alpha1.HelmReleaseNamespaceAnnotation: "apps",
+		"other": "annotation",
+	})
+	liveHelmConfigMap.SetLabels(map[string]string{workv1alpha1.HelmManagedByLabel: workv1alpha1.HelmManagedByValue})
+	retaggedConfigMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	retaggedConfigMap.SetAnnotations(map[string]string{workv1alpha1.HelmReleaseNameAnnotation: "web-v2"})
+
+	liveDeployment := newUnstructured("apps/v1", "Deployment", "default", "web")
+	_ = unstructured.SetNestedField(liveDeployment.Object, int64(5), "spec", "replicas")
+	_ = unstructured.SetNestedField(liveDeployment.Object, "RollingUpdate", "spec", "strategy", "type")
+
+	tests := map[string]struct {
+		manifest *unstructured.Unstructured
+		current  *unstructured.Unstructured
+		paths    []string
+		// want sets the fields we expect on top of the manifest
+		want func(obj *unstructured.Unstructured)
+	}{
+		"the allocated fields of a service are preserved": {
+			manifest: newService("NodePort", 0),
+			current:  liveService,
+			want: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, "10.0.0.10", "spec", "clusterIP")
+				_ = unstructured.SetNestedStringSlice(obj.Object, []string{"10.0.0.10"}, "spec", "clusterIPs")
+				_ = unstructured.SetNestedSlice(obj.Object, []interface{}{
+					map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+				}, "spec", "ports")
+			},
+		},
+		"the node port picked by the manifest wins": {
+			manifest: newService("NodePort", 30090),
+			current:  liveService,
+			want: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, "10.0.0.10", "spec", "clusterIP")
+				_ = unstructured.SetNestedStringSlice(obj.Object, []string{"10.0.0.10"}, "spec", "clusterIPs")
+			},
+		},
+		"a cluster IP service drops its node ports": {
+			manifest: newService("ClusterIP", 0),
+			current:  liveService,
+			want: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, "10.0.0.10", "spec", "clusterIP")
+				_ = unstructured.SetNestedStringSlice(obj.Object, []string{"10.0.0.10"}, "spec", "clusterIPs")
+			},
+		},
+		"an external name service keeps nothing": {
+			manifest: newService("ExternalName", 0),
+			current:  liveService,
+			want:     func(obj *unstructured.Unstructured) {},
+		},
+		"the helm release metadata is preserved": {
+			manifest: newUnstructured("v1", "ConfigMap", "default", "config"),
+			current:  liveHelmConfigMap,
+			want: func(obj *unstructured.Unstructured) {
+				obj.SetAnnotations(map[string]string{
+					workv1alpha1.HelmReleaseNameAnnotation:      "web",
+					workv1alpha1.HelmReleaseNamespaceAnnotation: "apps",
+				})
+				obj.SetLabels(map[string]string{workv1alpha1.HelmManagedByLabel: workv1alpha1.HelmManagedByValue})
+			},
+		},
+		"the helm release set by the manifest wins": {
+			manifest: retaggedConfigMap,
+			current:  liveHelmConfigMap,
+			want: func(obj *unstructured.Unstructured) {
+				obj.SetAnnotations(map[string]string{
+					workv1alpha1.HelmReleaseNameAnnotation:      "web-v2",
+					workv1alpha1.HelmReleaseNamespaceAnnotation: "apps",
+				})
+				obj.SetLabels(map[string]string{workv1alpha1.HelmManagedByLabel: workv1alpha1.HelmManagedByValue})
+			},
+		},
+		"the requested fields are preserved": {
+			manifest: newUnstructured("apps/v1", "Deployment", "default", "web"),
+			current:  liveDeployment,
+			paths:    []string{".spec.replicas", "spec.minReadySeconds", ""},
+			want: func(obj *unstructured.Unstructured) {
+				_ = unstructured.SetNestedField(obj.Object, int64(5), "spec", "replicas")
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			want := tt.manifest.DeepCopy()
+			tt.want(want)
+			got := tt.manifest.DeepCopy()
+			preserveFields(got, tt.current, tt.paths)
+			if !reflect.DeepEqual(got.Object, want.Object) {
+				t.Errorf("preserveFields() = %v, want %v", got.Object, want.Object)
+			}
+		})
+	}
+}
+
+func TestPreserveAnnotations(t *testing.T) {
+	prefixes := []string{"kubectl.kubernetes.io/", "autoscaling.alpha.kubernetes.io/"}
+	current := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	current.SetAnnotations(map[string]string{
+		"kubectl.kubernetes.io/restartedAt":     "later",
+		"autoscaling.alpha.kubernetes.io/state": "scaled",
+		"example.com/owner":                     "someone",
+	})
+	manifest := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	manifest.SetAnnotations(map[string]string{"kubectl.kubernetes.io/restartedAt": "now"})
+
+	preserveAnnotations(manifest, current, prefixes)
+	want := map[string]string{
+		"kubectl.kubernetes.io/restartedAt":     "now",
+		"autoscaling.alpha.kubernetes.io/state": "scaled",
+	}
+	if got := manifest.GetAnnotations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("preserveAnnotations() annotations = %v, want %v", got, want)
+	}
+
+	bare := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	preserveAnnotations(bare, current, nil)
+	if got := bare.GetAnnotations(); got != nil {
+		t.Errorf("preserveAnnotations() without prefixes annotations = %v, want none", got)
+	}
+}
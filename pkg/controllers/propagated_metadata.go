@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidatePropagatedMetadata validates the keys of the labels and annotations set on every applied resource.
+func ValidatePropagatedMetadata(labels, annotations map[string]string) error {
+	for _, keys := range []map[string]string{labels, annotations} {
+		for key := range keys {
+			if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+				return fmt.Errorf("invalid propagated key %q: %s", key, strings.Join(errs, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+// expandPropagatedMetadata returns the propagated labels or annotations of a work, with the variables their values
+// reference, e.g. ${WORK_NAME}, substituted.
+func expandPropagatedMetadata(templates, variables map[string]string) map[string]string {
+	if len(templates) == 0 {
+		return nil
+	}
+	replacer := variableReplacer(variables)
+	expanded := make(map[string]string, len(templates))
+	for key, value := range templates {
+		expanded[key] = replacer.Replace(value)
+	}
+	return expanded
+}
+
+// propagateMetadata sets the propagated labels and annotations on an object, the ones its manifest sets itself win.
+// They become part of the manifest, so they are written with every update and tracked by the last applied configuration.
+func propagateMetadata(obj *unstructured.Unstructured, labels, annotations map[string]string) {
+	if len(labels) != 0 {
+		obj.SetLabels(mergeMapOverrideWithDst(labels, obj.GetLabels()))
+	}
+	if len(annotations) != 0 {
+		obj.SetAnnotations(mergeMapOverrideWithDst(annotations, obj.GetAnnotations()))
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestValidatePropagatedMetadata(t *testing.T) {
+	valid := map[string]string{"multicluster.x-k8s.io/work-name": VariableWorkName}
+	if err := ValidatePropagatedMetadata(valid, valid); err != nil {
+		t.Errorf("ValidatePropagatedMetadata() error = %v, want none", err)
+	}
+	if err := ValidatePropagatedMetadata(nil, map[string]string{"not a key": "value"}); err == nil {
+		t.Errorf("ValidatePropagatedMetadata() of an invalid key returned no error")
+	}
+}
+
+func TestExpandPropagatedMetadata(t *testing.T) {
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"}}
+	got := expandPropagatedMetadata(map[string]string{
+		"multicluster.x-k8s.io/work-name":      VariableWorkName,
+		"multicluster.x-k8s.io/work-namespace": VariableWorkNamespace,
+		"team":                                 "platform",
+	}, manifestVariables(work))
+	want := map[string]string{
+		"multicluster.x-k8s.io/work-name":      "work",
+		"multicluster.x-k8s.io/work-namespace": "cluster-a",
+		"team":                                 "platform",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandPropagatedMetadata() = %v, want %v", got, want)
+	}
+	if got := expandPropagatedMetadata(nil, manifestVariables(work)); got != nil {
+		t.Errorf("expandPropagatedMetadata() without templates = %v, want nil", got)
+	}
+}
+
+func TestApplyManifestsPropagatesMetadata(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	dynamicClient.PrependReactor("patch", "configmaps", typedPatchReactor(dynamicClient.Tracker(), gvr, &corev1.ConfigMap{}))
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+	opts := applyOptions{
+		mode:        ApplyModeClientSide,
+		labels:      map[string]string{"multicluster.x-k8s.io/work-name": "work", "team": "platform"},
+		annotations: map[string]string{"multicluster.x-k8s.io/work-namespace": "cluster-a"},
+	}
+	manifest := newUnstructured("v1", "ConfigMap", "default", "config")
+	// the label the manifest sets itself wins
+	manifest.SetLabels(map[string]string{"team": "web"})
+
+	wantLabels := map[string]string{"multicluster.x-k8s.io/work-name": "work", "team": "web"}
+	for _, data := range []string{"first", "second"} {
+		manifest.Object["data"] = map[string]interface{}{"key": data}
+		results := r.applyManifests(context.Background(), []workv1alpha1.Manifest{newTestManifest(t, manifest)}, nil, nil, owner, opts)
+		if results[0].err != nil {
+			t.Fatalf("applyManifests() of the %s manifest error = %v", data, results[0].err)
+		}
+		obj, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "config", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get the applied config map: %v", err)
+		}
+		if got, _, _ := unstructured.NestedString(obj.Object, "data", "key"); got != data {
+			t.Errorf("data of the applied config map = %q, want %q", got, data)
+		}
+		if !reflect.DeepEqual(obj.GetLabels(), wantLabels) {
+			t.Errorf("labels of the %s manifest = %v, want %v", data, obj.GetLabels(), wantLabels)
+		}
+		if got := obj.GetAnnotations()["multicluster.x-k8s.io/work-namespace"]; got != "cluster-a" {
+			t.Errorf("propagated annotation of the %s manifest = %q, want cluster-a", data, got)
+		}
+	}
+}
+
+func TestApplyManifestsPreservesAnnotations(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		prefixes        []string
+		wantRestartedAt string
+	}{
+		"preserved": {prefixes: DefaultPreservedAnnotationPrefixes, wantRestartedAt: "later"},
+		// the three-way merge removes the annotation the manifest stopped setting
+		"not preserved": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+			dynamicClient.PrependReactor("patch", "configmaps", typedPatchReactor(dynamicClient.Tracker(), gvr, &corev1.ConfigMap{}))
+			r := &ApplyWorkReconciler{spokeDynamicClient: dynamicClient, restMapper: newTestRESTMapper()}
+			opts := applyOptions{mode: ApplyModeClientSide, preservedAnnotationPrefixes: tt.prefixes}
+
+			manifest := newUnstructured("v1", "ConfigMap", "default", "config")
+			manifest.SetAnnotations(map[string]string{"kubectl.kubernetes.io/restartedAt": "now"})
+			manifest.Object["data"] = map[string]interface{}{"key": "first"}
+			results := r.applyManifests(ctx, []workv1alpha1.Manifest{newTestManifest(t, manifest)}, nil, nil, owner, opts)
+			if results[0].err != nil {
+				t.Fatalf("applyManifests() of the first manifest error = %v", results[0].err)
+			}
+
+			// other controllers annotate the config map on the spoke cluster
+			live, err := dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "config", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the applied config map: %v", err)
+			}
+			annotations := live.GetAnnotations()
+			annotations["kubectl.kubernetes.io/restartedAt"] = "later"
+			annotations["autoscaling.alpha.kubernetes.io/conditions"] = "scaled"
+			live.SetAnnotations(annotations)
+			if _, err := dynamicClient.Resource(gvr).Namespace("default").Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				t.Fatalf("failed to annotate the config map: %v", err)
+			}
+
+			// the work is updated and no longer sets the annotation
+			manifest.SetAnnotations(nil)
+			manifest.Object["data"] = map[string]interface{}{"key": "second"}
+			results = r.applyManifests(ctx, []workv1alpha1.Manifest{newTestManifest(t, manifest)}, nil, nil, owner, opts)
+			if results[0].err != nil {
+				t.Fatalf("applyManifests() of the second manifest error = %v", results[0].err)
+			}
+			obj, err := dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "config", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get the applied config map: %v", err)
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "data", "key"); got != "second" {
+				t.Errorf("data of the applied config map = %q, want second", got)
+			}
+			if got := obj.GetAnnotations()["kubectl.kubernetes.io/restartedAt"]; got != tt.wantRestartedAt {
+				t.Errorf("restartedAt annotation = %q, want %q", got, tt.wantRestartedAt)
+			}
+			if got := obj.GetAnnotations()["autoscaling.alpha.kubernetes.io/conditions"]; got != "scaled" {
+				t.Errorf("annotation added by others = %q, want it kept", got)
+			}
+		})
+	}
+}
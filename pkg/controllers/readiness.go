@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cacheSyncChecker is a readiness check that only passes once the caches of all the managers it tracks are synced,
+// so that a controller isn't reported ready while it is still listing the works of a large hub.
+type cacheSyncChecker struct {
+	mu sync.Mutex
+	// pending are the names of the managers whose caches are not synced yet
+	pending map[string]bool
+}
+
+func newCacheSyncChecker() *cacheSyncChecker {
+	return &cacheSyncChecker{pending: make(map[string]bool)}
+}
+
+// track adds a runnable to the manager that waits for the informer of the object kind and the rest of its cache
+// to be synced. The informer is created by the runnable so that the cache isn't reported synced before the
+// controllers started their informers.
+func (c *cacheSyncChecker) track(name string, mgr ctrl.Manager, obj client.Object) error {
+	c.mu.Lock()
+	c.pending[name] = true
+	c.mu.Unlock()
+	return mgr.Add(&cacheSyncWaiter{name: name, cache: mgr.GetCache(), obj: obj, synced: c.synced})
+}
+
+func (c *cacheSyncChecker) synced(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, name)
+}
+
+// check is the healthz.Checker of the readiness endpoint.
+func (c *cacheSyncChecker) check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.pending))
+	for name := range c.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("the caches of the %s managers are not synced yet", strings.Join(names, ", "))
+}
+
+// cacheSyncWaiter reports when the cache of a manager is synced.
+type cacheSyncWaiter struct {
+	name   string
+	cache  cache.Cache
+	obj    client.Object
+	synced func(name string)
+}
+
+// Start waits for the cache to be synced, it implements manager.Runnable.
+func (w *cacheSyncWaiter) Start(ctx context.Context) error {
+	// getting the informer waits for it to be synced
+	if _, err := w.cache.GetInformer(ctx, w.obj); err != nil {
+		klog.ErrorS(err, "failed to wait for the cache of a manager to be synced", "manager", w.name)
+		return err
+	}
+	if !w.cache.WaitForCacheSync(ctx) {
+		// the manager is stopping
+		return nil
+	}
+	klog.InfoS("the cache of the manager is synced", "manager", w.name)
+	w.synced(w.name)
+	return nil
+}
+
+// NeedLeaderElection returns false so that the replicas waiting for the leader election are ready too,
+// it implements manager.LeaderElectionRunnable.
+func (w *cacheSyncWaiter) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestCacheSyncChecker(t *testing.T) {
+	c := newCacheSyncChecker()
+	c.pending["hub"] = true
+	c.pending["spoke a"] = true
+	if err := c.check(nil); err == nil {
+		t.Fatalf("check() passed before any cache is synced")
+	}
+
+	scheme := newWorkloadRefScheme()
+	notSynced := false
+	spokeWaiter := &cacheSyncWaiter{name: "spoke a", cache: &informertest.FakeInformers{Scheme: scheme, Synced: &notSynced},
+		obj: &workv1alpha1.AppliedWork{}, synced: c.synced}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := spokeWaiter.Start(ctx); err != nil {
+		t.Fatalf("Start() of a stopped manager error = %v", err)
+	}
+	if err := c.check(nil); err == nil {
+		t.Fatalf("check() passed with the caches of a stopped manager not synced")
+	}
+
+	for _, name := range []string{"hub", "spoke a"} {
+		waiter := &cacheSyncWaiter{name: name, cache: &informertest.FakeInformers{Scheme: scheme}, obj: &workv1alpha1.Work{}, synced: c.synced}
+		if err := waiter.Start(context.Background()); err != nil {
+			t.Fatalf("Start() of the %s waiter error = %v", name, err)
+		}
+	}
+	if err := c.check(nil); err != nil {
+		t.Errorf("check() of the synced caches error = %v", err)
+	}
+}
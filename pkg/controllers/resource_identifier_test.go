@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func newUnstructured(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestBuildResourceIdentifierRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		obj  *unstructured.Unstructured
+		gvr  schema.GroupVersionResource
+		want workv1alpha1.ResourceIdentifier
+	}{
+		"namespaced resource in a group": {
+			obj: newUnstructured("apps/v1", "Deployment", "default", "nginx"),
+			gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			want: workv1alpha1.ResourceIdentifier{
+				Ordinal: 1, Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments", Namespace: "default", Name: "nginx",
+			},
+		},
+		"namespaced resource in the core group": {
+			obj: newUnstructured("v1", "ConfigMap", "default", "config"),
+			gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			want: workv1alpha1.ResourceIdentifier{
+				Ordinal: 1, Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "config",
+			},
+		},
+		"cluster scoped resource": {
+			obj: newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRole", "", "reader"),
+			gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"},
+			want: workv1alpha1.ResourceIdentifier{
+				Ordinal: 1, Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole", Resource: "clusterroles", Name: "reader",
+			},
+		},
+		"resource mapped to a different group": {
+			obj: newUnstructured("extensions/v1beta1", "Ingress", "default", "web"),
+			gvr: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+			want: workv1alpha1.ResourceIdentifier{
+				Ordinal: 1, Group: "networking.k8s.io", Version: "v1", Kind: "Ingress", Resource: "ingresses", Namespace: "default", Name: "web",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			identifier := buildResourceIdentifier(1, tt.obj, tt.gvr)
+			if identifier != tt.want {
+				t.Fatalf("buildResourceIdentifier() = %+v, want %+v", identifier, tt.want)
+			}
+
+			// the identifier is stored in the appliedWork status once the manifest is applied
+			appliedMeta := workv1alpha1.AppliedResourceMeta{ResourceIdentifier: identifier}
+			if !isSameResource(appliedMeta, identifier) {
+				t.Errorf("isSameResource() = false for the identifier it was built from %+v", identifier)
+			}
+
+			// the ordinal changes when the manifests are reordered but it is still the same resource
+			reordered := identifier
+			reordered.Ordinal = 3
+			if !isSameResource(appliedMeta, reordered) {
+				t.Errorf("isSameResource() = false for a reordered identifier %+v", reordered)
+			}
+
+			// the gvr we rebuild to delete a stale resource must be the one we applied with
+			gvr := schema.GroupVersionResource{Group: appliedMeta.Group, Version: appliedMeta.Version, Resource: appliedMeta.Resource}
+			if gvr != tt.gvr {
+				t.Errorf("stored gvr = %v, want %v", gvr, tt.gvr)
+			}
+		})
+	}
+}
+
+func TestIsSameResourceMismatch(t *testing.T) {
+	base := workv1alpha1.ResourceIdentifier{
+		Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments", Namespace: "default", Name: "nginx",
+	}
+	appliedMeta := workv1alpha1.AppliedResourceMeta{ResourceIdentifier: base}
+
+	tests := map[string]func(*workv1alpha1.ResourceIdentifier){
+		"different group":     func(id *workv1alpha1.ResourceIdentifier) { id.Group = "" },
+		"different version":   func(id *workv1alpha1.ResourceIdentifier) { id.Version = "v1beta1" },
+		"different resource":  func(id *workv1alpha1.ResourceIdentifier) { id.Resource = "statefulsets" },
+		"different namespace": func(id *workv1alpha1.ResourceIdentifier) { id.Namespace = "kube-system" },
+		"cluster scoped":      func(id *workv1alpha1.ResourceIdentifier) { id.Namespace = "" },
+		"different name":      func(id *workv1alpha1.ResourceIdentifier) { id.Name = "apache" },
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			identifier := base
+			mutate(&identifier)
+			if isSameResource(appliedMeta, identifier) {
+				t.Errorf("isSameResource() = true for %+v and %+v", appliedMeta, identifier)
+			}
+		})
+	}
+}
+
+func TestDescribeResource(t *testing.T) {
+	tests := map[string]struct {
+		identifier workv1alpha1.ResourceIdentifier
+		want       string
+	}{
+		"namespaced resource": {
+			identifier: workv1alpha1.ResourceIdentifier{Group: "apps", Version: "v1", Kind: "Deployment", Namespace: "default", Name: "nginx"},
+			want:       "apps/v1, Kind=Deployment default/nginx",
+		},
+		"cluster scoped resource": {
+			identifier: workv1alpha1.ResourceIdentifier{Version: "v1", Kind: "Namespace", Name: "test"},
+			want:       "/v1, Kind=Namespace test",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := describeResource(tt.identifier); got != tt.want {
+				t.Errorf("describeResource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,18 +18,28 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
 )
 
+// appliedWorkNameHashLength is the length of the hash that keeps the truncated appliedWork names unique.
+const appliedWorkNameHashLength = 10
+
 type appliedResourceTracker struct {
 	hubClient          client.Client
 	spokeClient        client.Client
@@ -47,36 +57,36 @@ type appliedResourceTracker struct {
 
 func (r *appliedResourceTracker) fetchWorks(ctx context.Context, nsWorkName types.NamespacedName) (*workapi.Work, *workapi.AppliedWork, error) {
 	work := &workapi.Work{}
-	appliedWork := &workapi.AppliedWork{}
+	var appliedWork *workapi.AppliedWork
 
 	// fetch work CR from the member cluster
 	err := r.hubClient.Get(ctx, nsWorkName, work)
 	switch {
 	case errors.IsNotFound(err):
-		klog.InfoS("work does not exist", "item", nsWorkName)
+		klog.InfoS("work does not exist", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 		work = nil
 	case err != nil:
-		klog.ErrorS(err, "failed to get work", "item", nsWorkName)
+		klog.ErrorS(err, "failed to get work", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 		return nil, nil, err
 	default:
-		klog.V(8).InfoS("work exists in the hub cluster", "item", nsWorkName)
+		klog.V(logLevelTrace).InfoS("work exists in the hub cluster", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 	}
 
 	// fetch appliedWork CR from the member cluster
-	err = r.spokeClient.Get(ctx, nsWorkName, appliedWork)
+	appliedWork, err = fetchAppliedWork(ctx, r.spokeClient, nsWorkName)
 	switch {
 	case errors.IsNotFound(err):
-		klog.InfoS("appliedWork does not exist", "item", nsWorkName)
+		klog.InfoS("appliedWork does not exist", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 		appliedWork = nil
 	case err != nil:
-		klog.ErrorS(err, "failed to get appliedWork", "item", nsWorkName)
+		klog.ErrorS(err, "failed to get appliedWork", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 		return nil, nil, err
 	default:
-		klog.V(8).InfoS("appliedWork exists in the member cluster", "item", nsWorkName)
+		klog.V(logLevelTrace).InfoS("appliedWork exists in the member cluster", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 	}
 
 	if err := checkConsistentExist(work, appliedWork, nsWorkName); err != nil {
-		klog.ErrorS(err, "applied/work object existence not consistent", "item", nsWorkName)
+		klog.ErrorS(err, "applied/work object existence not consistent", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
 		return nil, nil, err
 	}
 
@@ -93,7 +103,267 @@ func checkConsistentExist(work *workapi.Work, appliedWork *workapi.AppliedWork,
 		return fmt.Errorf("work controller didn't create the appliedWork %s", workName)
 	}
 	if work == nil && appliedWork == nil {
-		klog.InfoS("both applied and work are garbage collected", "item", workName)
+		klog.InfoS("both applied and work are garbage collected", workKeys(workName.Namespace, workName.Name)...)
+	}
+	// the appliedWork is looked up by name so it may be tracking another work
+	if appliedWork != nil && !isAppliedWorkOf(appliedWork, workName) {
+		return fmt.Errorf("appliedWork %s tracks work %s/%s instead of %s", appliedWork.Name,
+			appliedWork.Spec.WorkNamespace, appliedWork.Spec.WorkName, workName)
 	}
 	return nil
 }
+
+// appliedWorkName returns the name of the appliedWork that tracks the given work.
+// AppliedWork is cluster scoped so we include the work namespace in its name to avoid collisions
+// between works with the same name in different namespaces. A namespace can't contain a dot so the name is unique.
+// A name longer than an object name can be is cut short and suffixed with a hash of the work namespace and name,
+// which keeps it unique.
+func appliedWorkName(workNamespace, workName string) string {
+	name := workNamespace + "." + workName
+	if len(name) <= validation.DNS1123SubdomainMaxLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(workNamespace+"/"+workName)))[:appliedWorkNameHashLength]
+	// the cut may end a DNS label with a separator, which a valid name can't
+	prefix := strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(hash)-1], ".-")
+	return prefix + "-" + hash
+}
+
+// hasExpectedName checks if an appliedWork is named after the work it tracks, either {work namespace}.{work name}
+// or the work name alone for the appliedWorks created by older versions.
+func hasExpectedName(appliedWork *workapi.AppliedWork) bool {
+	return appliedWork.Name == appliedWorkName(appliedWork.Spec.WorkNamespace, appliedWork.Spec.WorkName) ||
+		appliedWork.Name == appliedWork.Spec.WorkName
+}
+
+// isAppliedWorkOf checks if an appliedWork is tracking the given work.
+func isAppliedWorkOf(appliedWork *workapi.AppliedWork, nsWorkName types.NamespacedName) bool {
+	return appliedWork.Spec.WorkNamespace == nsWorkName.Namespace && appliedWork.Spec.WorkName == nsWorkName.Name
+}
+
+// fetchAppliedWork gets the appliedWork that tracks the given work.
+// AppliedWorks created by older versions are named after the work only, we keep using them if they
+// track the same work so that the resources they own are not disturbed.
+func fetchAppliedWork(ctx context.Context, spokeClient client.Client, nsWorkName types.NamespacedName) (*workapi.AppliedWork, error) {
+	appliedWork := &workapi.AppliedWork{}
+	err := spokeClient.Get(ctx, types.NamespacedName{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)}, appliedWork)
+	if err == nil || !errors.IsNotFound(err) {
+		return appliedWork, err
+	}
+	legacyAppliedWork := &workapi.AppliedWork{}
+	if legacyErr := spokeClient.Get(ctx, types.NamespacedName{Name: nsWorkName.Name}, legacyAppliedWork); legacyErr == nil &&
+		isAppliedWorkOf(legacyAppliedWork, nsWorkName) {
+		klog.V(logLevelDebug).InfoS("found a legacy appliedWork named after the work", workKeys(nsWorkName.Namespace, nsWorkName.Name)...)
+		return legacyAppliedWork, nil
+	}
+	return nil, err
+}
+
+// trackAppliedResources adds the applied resources of the manifest conditions that the appliedWork doesn't track yet.
+// It returns whether the appliedWork changed.
+func trackAppliedResources(appliedWork *workapi.AppliedWork, manifestConditions ...[]workapi.ManifestCondition) bool {
+	changed := false
+	for _, conditions := range manifestConditions {
+		for _, manifestCond := range conditions {
+			if !meta.IsStatusConditionTrue(manifestCond.Conditions, ConditionTypeApplied) {
+				continue
+			}
+			if !tracksResource(appliedWork, manifestCond.Identifier) {
+				appliedWork.Status.AppliedResources = append(appliedWork.Status.AppliedResources,
+					workapi.AppliedResourceMeta{ResourceIdentifier: manifestCond.Identifier})
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// tracksResource checks if the appliedWork tracks the resource.
+func tracksResource(appliedWork *workapi.AppliedWork, identifier workapi.ResourceIdentifier) bool {
+	for _, resourceMeta := range appliedWork.Status.AppliedResources {
+		if isSameResource(resourceMeta, identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferAppliedResources makes the "to" appliedWork own and track the given resources of the "from" appliedWork
+// in its place, so that deleting the "from" appliedWork or pruning the resources from it leaves them alone.
+// The resources keep their UID and generations since they are neither deleted nor recreated.
+func (r *appliedResourceTracker) transferAppliedResources(ctx context.Context, from, to *workapi.AppliedWork,
+	resources []workapi.AppliedResourceMeta) error {
+	newOwner := metav1.OwnerReference{
+		APIVersion: workapi.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       to.Name,
+		UID:        to.UID,
+	}
+	for _, resourceMeta := range resources {
+		gvr := schema.GroupVersionResource{
+			Group:    resourceMeta.Group,
+			Version:  resourceMeta.Version,
+			Resource: resourceMeta.Resource,
+		}
+		resourceClient := r.spokeDynamicClient.Resource(gvr).Namespace(resourceMeta.Namespace)
+		obj, err := resourceClient.Get(ctx, resourceMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var owners []metav1.OwnerReference
+		found := false
+		for _, owner := range obj.GetOwnerReferences() {
+			if owner.UID == from.UID {
+				continue
+			}
+			found = found || owner.UID == newOwner.UID
+			owners = append(owners, owner)
+		}
+		if !found {
+			owners = append(owners, newOwner)
+		}
+		obj.SetOwnerReferences(owners)
+		if _, err := resourceClient.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	trackedBefore := len(to.Status.AppliedResources)
+	for _, resourceMeta := range resources {
+		tracked := false
+		for _, toMeta := range to.Status.AppliedResources {
+			if isSameResource(toMeta, resourceMeta.ResourceIdentifier) {
+				tracked = true
+				break
+			}
+		}
+		if !tracked {
+			to.Status.AppliedResources = append(to.Status.AppliedResources, resourceMeta)
+		}
+	}
+	if len(to.Status.AppliedResources) == trackedBefore {
+		return nil
+	}
+	summarizeAppliedResources(to)
+	return r.spokeClient.Status().Update(ctx, to, &client.UpdateOptions{})
+}
+
+// summarizeAppliedResources refreshes the summary of the resources tracked by the appliedWork before its status is written.
+func summarizeAppliedResources(appliedWork *workapi.AppliedWork) {
+	now := metav1.Now()
+	appliedWork.Status.AppliedResourceCount = len(appliedWork.Status.AppliedResources)
+	appliedWork.Status.LastReconcileTime = &now
+}
+
+// recordAppliedGenerations records the generation and the UID of the resources we wrote and when we wrote them on the
+// appliedWork, so that the resources modified or recreated by others since then can be told apart.
+// It returns whether the appliedWork changed.
+func recordAppliedGenerations(appliedWork *workapi.AppliedWork, results []applyResult, appliedTime metav1.Time) bool {
+	changed := false
+	for _, result := range results {
+		if result.err != nil || !result.updated {
+			continue
+		}
+		for i := range appliedWork.Status.AppliedResources {
+			resourceMeta := &appliedWork.Status.AppliedResources[i]
+			if isSameResource(*resourceMeta, result.identifier) {
+				resourceMeta.ObservedGeneration = result.generation
+				if len(result.uid) != 0 {
+					resourceMeta.UID = result.uid
+				}
+				resourceMeta.LastAppliedTime = appliedTime.DeepCopy()
+				changed = true
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// recordAudit sends a record of an action we took on a resource of the work to the audit sink if there is one.
+func recordAudit(sink audit.Sink, nsWorkName types.NamespacedName, identifier workapi.ResourceIdentifier, action audit.Action, err error) {
+	if sink == nil {
+		return
+	}
+	record := audit.Record{
+		Timestamp:     time.Now(),
+		WorkNamespace: nsWorkName.Namespace,
+		WorkName:      nsWorkName.Name,
+		Resource:      identifier,
+		Action:        action,
+		Outcome:       audit.OutcomeSucceeded,
+	}
+	if err != nil {
+		record.Outcome = audit.OutcomeFailed
+		record.Message = err.Error()
+	}
+	sink.Record(record)
+}
+
+// describeResource describes the resource an identifier points to in the events, e.g. "apps/v1, Kind=Deployment default/nginx".
+func describeResource(identifier workapi.ResourceIdentifier) string {
+	gvk := schema.GroupVersionKind{Group: identifier.Group, Version: identifier.Version, Kind: identifier.Kind}
+	if len(identifier.Namespace) == 0 {
+		return fmt.Sprintf("%s %s", gvk, identifier.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", gvk, identifier.Namespace, identifier.Name)
+}
+
+// releaseAppliedResource removes the owner reference of the applied work from a resource it applied, the other
+// owners of a shared resource keep it alive. The resource is deleted instead if the applied work was its last owner,
+// unless deleteOpts is nil. It returns whether the resource was deleted, a resource that is already gone is neither.
+func releaseAppliedResource(ctx context.Context, resourceClient dynamic.ResourceInterface, name string, ownerUID types.UID,
+	deleteOpts *metav1.DeleteOptions) (bool, error) {
+	obj, err := resourceClient.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	owners := obj.GetOwnerReferences()
+	remaining := make([]metav1.OwnerReference, 0, len(owners))
+	for _, owner := range owners {
+		if owner.UID != ownerUID {
+			remaining = append(remaining, owner)
+		}
+	}
+	if len(remaining) == 0 && deleteOpts != nil {
+		err = resourceClient.Delete(ctx, name, *deleteOpts)
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if len(remaining) == len(owners) {
+		return false, nil
+	}
+	obj.SetOwnerReferences(remaining)
+	_, err = resourceClient.Update(ctx, obj, metav1.UpdateOptions{FieldManager: DefaultFieldManager})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// resettableRESTMapper is a RESTMapper that can forget what it discovered, like the deferred discovery mapper.
+// It is the meta.ResettableRESTMapper of the later apimachinery releases.
+type resettableRESTMapper interface {
+	meta.RESTMapper
+	Reset()
+}
+
+// resetRESTMapper makes the mapper discover the kinds served by the cluster again if it can.
+// It returns false if the mapper can't be reset.
+func resetRESTMapper(restMapper meta.RESTMapper) bool {
+	resettable, ok := restMapper.(resettableRESTMapper)
+	if !ok {
+		return false
+	}
+	klog.V(logLevelDebug).InfoS("reset the rest mapper to discover the new kinds")
+	resettable.Reset()
+	return true
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
+)
+
+func TestAppliedWorkName(t *testing.T) {
+	if got := appliedWorkName("cluster-a", "work"); got != "cluster-a.work" {
+		t.Errorf("appliedWorkName() = %s, want cluster-a.work", got)
+	}
+	if appliedWorkName("cluster-a", "work") == appliedWorkName("cluster-b", "work") {
+		t.Errorf("appliedWorkName() gives the same name to the works of different namespaces")
+	}
+
+	// the longest work names only differ past the length of an object name once the namespace is added
+	longName := strings.Repeat("w", validation.DNS1123SubdomainMaxLength-1)
+	names := map[string]bool{}
+	for _, nsWorkName := range []types.NamespacedName{
+		{Namespace: "cluster-a", Name: longName + "1"},
+		{Namespace: "cluster-a", Name: longName + "2"},
+		{Namespace: "cluster-b", Name: longName + "1"},
+		{Namespace: strings.Repeat("n", validation.DNS1123LabelMaxLength), Name: strings.Repeat("w.", 120) + "w"},
+	} {
+		name := appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			t.Errorf("appliedWorkName(%s) = %s, not a valid name: %v", nsWorkName, name, errs)
+		}
+		if names[name] {
+			t.Errorf("appliedWorkName(%s) = %s, already given to another work", nsWorkName, name)
+		}
+		names[name] = true
+		if name != appliedWorkName(nsWorkName.Namespace, nsWorkName.Name) {
+			t.Errorf("appliedWorkName(%s) is not stable", nsWorkName)
+		}
+	}
+}
+
+func TestFetchAppliedWork(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	current := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name)},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+	}
+	legacy := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: nsWorkName.Name},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+	}
+	legacyOfOtherNamespace := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: nsWorkName.Name},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: "cluster-b", WorkName: nsWorkName.Name},
+	}
+
+	tests := map[string]struct {
+		existing     []*workv1alpha1.AppliedWork
+		wantName     string
+		wantNotFound bool
+	}{
+		"named after the work namespace and name": {
+			existing: []*workv1alpha1.AppliedWork{current, legacy},
+			wantName: current.Name,
+		},
+		"legacy appliedWork of the work": {
+			existing: []*workv1alpha1.AppliedWork{legacy},
+			wantName: legacy.Name,
+		},
+		"legacy appliedWork of the same named work in another namespace": {
+			existing:     []*workv1alpha1.AppliedWork{legacyOfOtherNamespace},
+			wantNotFound: true,
+		},
+		"no appliedWork": {
+			wantNotFound: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			for _, appliedWork := range tt.existing {
+				builder = builder.WithObjects(appliedWork.DeepCopy())
+			}
+
+			got, err := fetchAppliedWork(context.Background(), builder.Build(), nsWorkName)
+			if tt.wantNotFound {
+				if !errors.IsNotFound(err) {
+					t.Errorf("fetchAppliedWork() = %v, %v, want not found", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchAppliedWork() error = %v", err)
+			}
+			if got.Name != tt.wantName {
+				t.Errorf("fetchAppliedWork() = %s, want %s", got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+// auditRecorder keeps the audit records it receives in memory.
+type auditRecorder struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (r *auditRecorder) Record(record audit.Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+func TestAuditRecords(t *testing.T) {
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name, Generation: 1, Finalizers: []string{workFinalizer}},
+		Spec: workv1alpha1.WorkSpec{Workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{
+			newTestManifest(t, newUnstructured("v1", "ConfigMap", "default", "config")),
+		}}},
+	}
+	appliedWork := &workv1alpha1.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name), UID: "applied-work-uid"},
+		Spec:       workv1alpha1.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+	}
+	stale := newUnstructured("v1", "ConfigMap", "default", "stale")
+	stale.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: workv1alpha1.GroupVersion.String(), Kind: "AppliedWork", Name: appliedWork.Name, UID: appliedWork.UID,
+	}})
+	held := stale.DeepCopy()
+	held.SetName("held")
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), stale, held)
+	// the held config map can't be deleted
+	dynamicClient.PrependReactor("delete", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.(clienttesting.DeleteAction).GetName() != "held" {
+			return false, nil, nil
+		}
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "held", fmt.Errorf("denied"))
+	})
+	sink := &auditRecorder{}
+	ctx := context.Background()
+
+	applyReconciler := &ApplyWorkReconciler{
+		client:             fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build(),
+		spokeClient:        fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build(),
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+		recorder:           record.NewFakeRecorder(10),
+		auditSink:          sink,
+		backoff:            newWorkBackoff(time.Second, time.Minute),
+		transientBackoff:   newWorkBackoff(time.Second, time.Minute),
+	}
+	if _, err := applyReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	statusReconciler := newWorkStatusReconciler(nil, nil, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), sink, PruneLimit{}, 0)
+	if _, err := statusReconciler.deleteStaleWork(ctx, work, appliedWork, []workv1alpha1.AppliedResourceMeta{
+		{ResourceIdentifier: workv1alpha1.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "stale"}},
+		{ResourceIdentifier: workv1alpha1.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "held"}},
+	}); err == nil {
+		t.Fatalf("deleteStaleWork() succeeded, want the held config map failing")
+	}
+
+	want := []struct {
+		name    string
+		action  audit.Action
+		outcome audit.Outcome
+	}{
+		{name: "config", action: audit.ActionApply, outcome: audit.OutcomeSucceeded},
+		{name: "stale", action: audit.ActionDelete, outcome: audit.OutcomeSucceeded},
+		{name: "held", action: audit.ActionDelete, outcome: audit.OutcomeFailed},
+	}
+	if len(sink.records) != len(want) {
+		t.Fatalf("audit records = %+v, want %d records", sink.records, len(want))
+	}
+	for i, w := range want {
+		got := sink.records[i]
+		if got.WorkNamespace != nsWorkName.Namespace || got.WorkName != nsWorkName.Name || got.Resource.Name != w.name ||
+			got.Action != w.action || got.Outcome != w.outcome || got.Timestamp.IsZero() {
+			t.Errorf("audit record %d = %+v, want %s %s of %s", i, got, w.outcome, w.action, w.name)
+		}
+		if (w.outcome == audit.OutcomeFailed) != (len(got.Message) != 0) {
+			t.Errorf("audit record %d message = %q, want one only for the failure", i, got.Message)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// resourceTypeRecheckInterval is how long we trust what the discovery of the spoke cluster told about a kind,
+// so that an API installed later, e.g. by an ingress controller, is found without restarting the controller.
+const resourceTypeRecheckInterval = time.Minute
+
+// groupVersionResourcesGetter is the part of the discovery client we need, the resources served in a group version.
+type groupVersionResourcesGetter interface {
+	ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error)
+}
+
+// resourceTypeChecker tells with the discovery of the spoke cluster whether it serves a kind at all, so that a
+// manifest of a missing API, e.g. an Ingress on a cluster without the networking API, fails with a clear reason
+// instead of being retried as if its CRD was about to be established.
+type resourceTypeChecker struct {
+	discovery groupVersionResourcesGetter
+	now       func() time.Time
+
+	mu      sync.Mutex
+	checked map[schema.GroupVersionKind]resourceTypeCheck
+}
+
+type resourceTypeCheck struct {
+	served    bool
+	checkedAt time.Time
+}
+
+func newResourceTypeChecker(discovery groupVersionResourcesGetter) *resourceTypeChecker {
+	return &resourceTypeChecker{
+		discovery: discovery,
+		now:       time.Now,
+		checked:   make(map[schema.GroupVersionKind]resourceTypeCheck),
+	}
+}
+
+// isServed checks if the spoke cluster serves the kind in its version. It returns an error if the discovery of the
+// spoke cluster fails, in which case we can't tell.
+func (c *resourceTypeChecker) isServed(gvk schema.GroupVersionKind) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if check, found := c.checked[gvk]; found && c.now().Sub(check.checkedAt) < resourceTypeRecheckInterval {
+		return check.served, nil
+	}
+	served := false
+	resources, err := c.discovery.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	switch {
+	case apierrors.IsNotFound(err):
+		// the spoke cluster doesn't serve the group version at all
+	case err != nil:
+		return false, err
+	default:
+		for _, resource := range resources.APIResources {
+			// the subresources have the kind of their parent resource
+			if resource.Kind == gvk.Kind && !strings.Contains(resource.Name, "/") {
+				served = true
+				break
+			}
+		}
+	}
+	c.checked[gvk] = resourceTypeCheck{served: served, checkedAt: c.now()}
+	return served, nil
+}
+
+// crdKindsOf returns the kinds defined by the CRD manifests of a work, in every version they serve. The spoke cluster
+// may not serve those kinds yet since their CRDs are applied in the same reconcile.
+func crdKindsOf(manifests []workv1alpha1.Manifest) map[schema.GroupKind]bool {
+	kinds := make(map[schema.GroupKind]bool)
+	for i := range manifests {
+		obj, err := manifests[i].AsUnstructured()
+		if err != nil || obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		kinds[schema.GroupKind{Group: group, Kind: kind}] = true
+	}
+	return kinds
+}
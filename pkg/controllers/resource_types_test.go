@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// fakeDiscovery serves the resources of some group versions, the others are not found like on a real api server.
+type fakeDiscovery struct {
+	resources map[string][]metav1.APIResource
+	err       error
+	calls     int
+}
+
+func (d *fakeDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	d.calls++
+	if d.err != nil {
+		return nil, d.err
+	}
+	resources, found := d.resources[groupVersion]
+	if !found {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, groupVersion)
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: resources}, nil
+}
+
+func TestResourceTypeCheckerIsServed(t *testing.T) {
+	discovery := &fakeDiscovery{resources: map[string][]metav1.APIResource{
+		"apps/v1": {{Name: "deployments", Kind: "Deployment"}, {Name: "deployments/scale", Kind: "Scale"}},
+	}}
+	c := newResourceTypeChecker(discovery)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	tests := map[schema.GroupVersionKind]bool{
+		{Group: "apps", Version: "v1", Kind: "Deployment"}:                true,
+		{Group: "apps", Version: "v1", Kind: "Scale"}:                     false,
+		{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}:      false,
+		{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}: false,
+	}
+	for gvk, want := range tests {
+		if got, err := c.isServed(gvk); err != nil || got != want {
+			t.Errorf("isServed(%s) = %t, %v, want %t", gvk, got, err, want)
+		}
+	}
+
+	ingress := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"}
+	calls := discovery.calls
+	if served, _ := c.isServed(ingress); served || discovery.calls != calls {
+		t.Errorf("isServed() asked the discovery again for a kind it just checked")
+	}
+	// the networking API is installed
+	discovery.resources["networking.k8s.io/v1"] = []metav1.APIResource{{Name: "ingresses", Kind: "Ingress"}}
+	now = now.Add(resourceTypeRecheckInterval)
+	if served, err := c.isServed(ingress); !served || err != nil {
+		t.Errorf("isServed() = %t, %v once the API is installed and the check expired, want true", served, err)
+	}
+
+	discovery.err = fmt.Errorf("connection refused")
+	now = now.Add(resourceTypeRecheckInterval)
+	if _, err := c.isServed(ingress); err == nil {
+		t.Errorf("isServed() hid the failure of the discovery")
+	}
+}
+
+func TestApplyManifestsResourceTypeUnavailable(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()),
+		restMapper:         newTestRESTMapper(),
+		resourceTypes: newResourceTypeChecker(&fakeDiscovery{resources: map[string][]metav1.APIResource{
+			"apiextensions.k8s.io/v1": {{Name: "customresourcedefinitions", Kind: "CustomResourceDefinition"}},
+		}}),
+	}
+	crd := newUnstructured("apiextensions.k8s.io/v1", "CustomResourceDefinition", "", "widgets.example.com")
+	crd.Object["spec"] = map[string]interface{}{"group": "example.com", "names": map[string]interface{}{"kind": "Widget"}}
+	manifests := []workv1alpha1.Manifest{
+		newTestManifest(t, newUnstructured("networking.k8s.io/v1", "Ingress", "default", "web")),
+		newTestManifest(t, crd),
+		newTestManifest(t, newUnstructured("example.com/v1", "Widget", "default", "widget")),
+	}
+
+	results := r.applyManifests(context.Background(), manifests, nil, nil, owner, applyOptions{})
+	if got := applyFailureReason(results[0].err); got != ReasonResourceTypeUnavailable || isTransientFailure(results[0].err) {
+		t.Errorf("applyManifests() failed the ingress with %q (%v), want %s", got, results[0].err, ReasonResourceTypeUnavailable)
+	}
+	// the test mapper never learns the kinds, they are pending since the spoke cluster serves CRDs
+	for _, i := range []int{1, 2} {
+		if got := applyFailureReason(results[i].err); got != ReasonMappingNotFound {
+			t.Errorf("applyManifests() failed manifest %d with %q (%v), want %s", i, got, results[i].err, ReasonMappingNotFound)
+		}
+	}
+
+	status := &workv1alpha1.WorkStatus{}
+	setResourceTypeUnavailableCondition(status, results, 1)
+	cond := meta.FindStatusCondition(status.Conditions, ConditionTypeResourceTypeUnavailable)
+	if cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "Ingress.networking.k8s.io") ||
+		strings.Contains(cond.Message, "Widget") {
+		t.Fatalf("setResourceTypeUnavailableCondition() = %+v, want a true condition naming only the ingresses", cond)
+	}
+	setResourceTypeUnavailableCondition(status, results[1:], 1)
+	if cond := meta.FindStatusCondition(status.Conditions, ConditionTypeResourceTypeUnavailable); cond != nil {
+		t.Errorf("setResourceTypeUnavailableCondition() kept %+v without unavailable kinds", cond)
+	}
+}
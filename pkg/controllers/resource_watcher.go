@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// appliedResourceWatcher watches the resources of the kinds applied to a spoke cluster and triggers the re-apply of
+// the work of a resource edited or deleted out-of-band, so that it is corrected right away instead of at the next resync.
+// The kinds are watched once the applied work controller finds them in the status of an appliedWork.
+type appliedResourceWatcher struct {
+	factory          dynamicinformer.DynamicSharedInformerFactory
+	spokeClient      client.Client
+	clusterNameSpace string
+	triggers         chan<- event.GenericEvent
+
+	mu      sync.Mutex
+	watched map[schema.GroupVersionResource]bool
+	// stopCh is closed when the manager stops, it is nil until the manager starts the watcher
+	stopCh <-chan struct{}
+}
+
+func newAppliedResourceWatcher(spokeDynamicClient dynamic.Interface, spokeClient client.Client, clusterNameSpace string,
+	triggers chan<- event.GenericEvent) *appliedResourceWatcher {
+	return &appliedResourceWatcher{
+		// the informers are never resynced, the applied work controller already checks the resources periodically
+		factory:          dynamicinformer.NewDynamicSharedInformerFactory(spokeDynamicClient, 0),
+		spokeClient:      spokeClient,
+		clusterNameSpace: clusterNameSpace,
+		triggers:         triggers,
+		watched:          make(map[schema.GroupVersionResource]bool),
+	}
+}
+
+// Start starts the informers of the kinds watched so far and the ones of the kinds watched later, it implements
+// manager.Runnable.
+func (w *appliedResourceWatcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	w.stopCh = ctx.Done()
+	w.factory.Start(w.stopCh)
+	w.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+// watch starts watching the kinds of the resources of an appliedWork that are not watched yet.
+func (w *appliedResourceWatcher) watch(resources []workapi.AppliedResourceMeta) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	added := false
+	for _, resource := range resources {
+		gvr := schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource}
+		if len(gvr.Resource) == 0 || w.watched[gvr] {
+			continue
+		}
+		w.watched[gvr] = true
+		w.factory.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				if oldRes, ok := oldObj.(*unstructured.Unstructured); ok {
+					if newRes, ok := newObj.(*unstructured.Unstructured); ok && isOutOfBandEdit(oldRes, newRes) {
+						w.triggerReapply(newRes, "edited")
+					}
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if res, ok := obj.(*unstructured.Unstructured); ok {
+					w.triggerReapply(res, "deleted")
+				}
+			},
+		})
+		klog.V(logLevelDebug).InfoS("watch the applied resources of a kind", "gvr", gvr)
+		added = true
+	}
+	if added && w.stopCh != nil {
+		// only the informers that are not running yet are started
+		w.factory.Start(w.stopCh)
+	}
+}
+
+// isOutOfBandEdit checks if an update of a resource may have made it drift from its manifest. The status updates
+// leave the generation of the resources that have one alone, so they are ignored.
+func isOutOfBandEdit(oldRes, newRes *unstructured.Unstructured) bool {
+	if oldRes.GetResourceVersion() == newRes.GetResourceVersion() {
+		return false
+	}
+	if newRes.GetGeneration() == 0 {
+		// the resource has no spec to tell from its status, e.g. a config map
+		return true
+	}
+	return oldRes.GetGeneration() != newRes.GetGeneration() ||
+		!reflect.DeepEqual(oldRes.GetLabels(), newRes.GetLabels()) ||
+		!reflect.DeepEqual(oldRes.GetAnnotations(), newRes.GetAnnotations())
+}
+
+// triggerReapply asks the work controller to re-apply the works of the appliedWorks that own the resource.
+// We never block the informer, the resource is still checked at the next resync if the trigger is dropped.
+func (w *appliedResourceWatcher) triggerReapply(res *unstructured.Unstructured, change string) {
+	for _, owner := range res.GetOwnerReferences() {
+		if owner.Kind != "AppliedWork" || owner.APIVersion != workapi.GroupVersion.String() {
+			continue
+		}
+		appliedWork := &workapi.AppliedWork{}
+		if err := w.spokeClient.Get(context.Background(), types.NamespacedName{Name: owner.Name}, appliedWork); err != nil {
+			klog.V(logLevelDebug).InfoS("can't find the appliedWork of a resource", objectKeys(res, "appliedWork", owner.Name, "err", err)...)
+			continue
+		}
+		work := &workapi.Work{}
+		work.Namespace, work.Name = appliedWork.Spec.WorkNamespace, appliedWork.Spec.WorkName
+		if len(work.Namespace) == 0 {
+			work.Namespace = w.clusterNameSpace
+		}
+		select {
+		case w.triggers <- event.GenericEvent{Object: work}:
+			klog.V(logLevelDebug).InfoS("re-apply the work of a resource changed out-of-band",
+				workKeys(work.Namespace, work.Name, "resource", klog.KObj(res), "kind", res.GetKind(), "change", change)...)
+		default:
+			klog.V(logLevelDebug).InfoS("too many pending reconciles, re-apply the work at the next resync",
+				workKeys(work.Namespace, work.Name)...)
+		}
+	}
+}
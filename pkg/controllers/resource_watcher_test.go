@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestIsOutOfBandEdit(t *testing.T) {
+	newResource := func(resourceVersion string, generation int64, labels map[string]string) *unstructured.Unstructured {
+		res := newUnstructured("apps/v1", "Deployment", "default", "web")
+		res.SetResourceVersion(resourceVersion)
+		res.SetGeneration(generation)
+		res.SetLabels(labels)
+		return res
+	}
+	tests := map[string]struct {
+		oldRes, newRes *unstructured.Unstructured
+		want           bool
+	}{
+		"a resync": {
+			oldRes: newResource("1", 1, nil),
+			newRes: newResource("1", 1, nil),
+		},
+		"a status update": {
+			oldRes: newResource("1", 1, nil),
+			newRes: newResource("2", 1, nil),
+		},
+		"a spec edit": {
+			oldRes: newResource("1", 1, nil),
+			newRes: newResource("2", 2, nil),
+			want:   true,
+		},
+		"a label edit": {
+			oldRes: newResource("1", 1, nil),
+			newRes: newResource("2", 1, map[string]string{"app": "web"}),
+			want:   true,
+		},
+		"an edit of a resource without a generation": {
+			oldRes: newResource("1", 0, nil),
+			newRes: newResource("2", 0, nil),
+			want:   true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := isOutOfBandEdit(tt.oldRes, tt.newRes); got != tt.want {
+				t.Errorf("isOutOfBandEdit() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppliedResourceWatcherTriggersReapply(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	configMap := newUnstructured("v1", "ConfigMap", "default", "config")
+	configMap.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: workapi.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.work",
+		UID:        "applied-work-uid",
+	}})
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ConfigMapList"}, configMap)
+	appliedWork := &workapi.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-a.work"},
+		Spec:       workapi.AppliedWorkSpec{WorkName: "work", WorkNamespace: "cluster-a"},
+	}
+	spokeClient := fake.NewClientBuilder().WithScheme(newWorkloadRefScheme()).WithObjects(appliedWork).Build()
+	triggers := make(chan event.GenericEvent, 1)
+	w := newAppliedResourceWatcher(dynamicClient, spokeClient, "", triggers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = w.Start(ctx)
+	}()
+	w.watch([]workapi.AppliedResourceMeta{{ResourceIdentifier: workapi.ResourceIdentifier{
+		Version: "v1", Resource: "configmaps", Namespace: "default", Name: "config",
+	}}})
+
+	// the informer may not have listed the config map yet, so we edit it until the watcher sees an edit
+	deadline := time.After(10 * time.Second)
+	for i := 0; ; i++ {
+		edited := configMap.DeepCopy()
+		edited.Object["data"] = map[string]interface{}{"key": time.Now().String()}
+		// the fake client doesn't bump the resource versions itself
+		edited.SetResourceVersion(strconv.Itoa(i + 1))
+		if _, err := dynamicClient.Resource(gvr).Namespace("default").Update(ctx, edited, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("failed to edit the config map: %v", err)
+		}
+		select {
+		case trigger := <-triggers:
+			if trigger.Object.GetNamespace() != "cluster-a" || trigger.Object.GetName() != "work" {
+				t.Errorf("triggered the reapply of %s/%s, want cluster-a/work", trigger.Object.GetNamespace(), trigger.Object.GetName())
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("the edit of the config map didn't trigger the reapply of its work")
+		}
+	}
+}
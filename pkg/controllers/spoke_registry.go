@@ -0,0 +1,215 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	clientset "sigs.k8s.io/work-api/pkg/client/clientset/versioned"
+)
+
+// TargetClusterLabel names the spoke cluster a work is applied to, the targetCluster field of the work spec wins over it.
+const TargetClusterLabel = "multicluster.x-k8s.io/target-cluster"
+
+// SpokeCluster is a spoke cluster the controller applies works to, with its own manager and cache.
+type SpokeCluster struct {
+	// Name is how the works target the spoke cluster.
+	Name string
+	// Labels are matched against the cluster selectors of the works.
+	Labels        map[string]string
+	Manager       ctrl.Manager
+	DynamicClient dynamic.Interface
+	RESTMapper    meta.RESTMapper
+	WorkClient    clientset.Interface
+	// DiscoveryClient serves the OpenAPI schema of the spoke cluster.
+	DiscoveryClient discovery.DiscoveryInterface
+
+	// triggers receives the works of the spoke cluster to reconcile right away
+	triggers chan event.GenericEvent
+}
+
+// SpokeRegistry maps the names of the spoke clusters to their clients.
+// The works that don't name a target cluster are applied to the default spoke cluster.
+type SpokeRegistry struct {
+	defaultName string
+	clusters    map[string]*SpokeCluster
+	// applyQPS and applyBurst limit the rate of the dynamic client calls to each spoke cluster, zero keeps the client defaults
+	applyQPS   float32
+	applyBurst int
+}
+
+// NewSpokeRegistry creates an empty registry whose default spoke cluster is the given one.
+// The dynamic client calls to each spoke cluster are limited to applyQPS with bursts of applyBurst, a zero
+// applyQPS keeps the rate limit of the client defaults.
+func NewSpokeRegistry(defaultName string, applyQPS float32, applyBurst int) *SpokeRegistry {
+	return &SpokeRegistry{
+		defaultName: defaultName,
+		clusters:    make(map[string]*SpokeCluster),
+		applyQPS:    applyQPS,
+		applyBurst:  applyBurst,
+	}
+}
+
+// Add creates the manager and the clients of a spoke cluster and registers it under the name.
+func (r *SpokeRegistry) Add(name string, cfg *rest.Config, opts ctrl.Options) (*SpokeCluster, error) {
+	if _, found := r.clusters[name]; found {
+		return nil, fmt.Errorf("spoke cluster %q is already registered", name)
+	}
+	mgr, err := ctrl.NewManager(cfg, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the manager of spoke cluster %q: %w", name, err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(r.rateLimited(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the dynamic client of spoke cluster %q: %w", name, err)
+	}
+	workClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the work clientset of spoke cluster %q: %w", name, err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the discovery client of spoke cluster %q: %w", name, err)
+	}
+	spoke := &SpokeCluster{
+		Name:            name,
+		Manager:         mgr,
+		DynamicClient:   dynamicClient,
+		RESTMapper:      newSpokeRESTMapper(discoveryClient),
+		WorkClient:      workClient,
+		DiscoveryClient: discoveryClient,
+	}
+	r.clusters[name] = spoke
+	return spoke, nil
+}
+
+// newSpokeRESTMapper returns the rest mapper of a spoke cluster. It discovers the kinds served by the spoke cluster
+// once and can be reset to discover them again, e.g. once the CRD of a work is established.
+func newSpokeRESTMapper(discoveryClient discovery.DiscoveryInterface) meta.RESTMapper {
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+}
+
+// the rest mappers of the spoke clusters have to be resettable for the kinds installed later to be discovered
+var _ resettableRESTMapper = &restmapper.DeferredDiscoveryRESTMapper{}
+
+// rateLimited returns the config of the dynamic client of a spoke cluster. All the works of the spoke cluster share
+// the single dynamic client we create from it, so they share its token bucket and can't overwhelm the api server together.
+func (r *SpokeRegistry) rateLimited(cfg *rest.Config) *rest.Config {
+	if r.applyQPS <= 0 {
+		return cfg
+	}
+	limited := rest.CopyConfig(cfg)
+	limited.QPS = r.applyQPS
+	limited.Burst = r.applyBurst
+	limited.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(r.applyQPS, r.applyBurst)
+	return limited
+}
+
+// Get returns the spoke cluster registered under the name.
+func (r *SpokeRegistry) Get(name string) (*SpokeCluster, bool) {
+	spoke, found := r.clusters[name]
+	return spoke, found
+}
+
+// Names returns the sorted names of the registered spoke clusters.
+func (r *SpokeRegistry) Names() []string {
+	names := make([]string, 0, len(r.clusters))
+	for name := range r.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClusterOf returns the spoke cluster the work is applied to, false if the controller doesn't serve it
+// or the work doesn't select it.
+func (r *SpokeRegistry) ClusterOf(work *workv1alpha1.Work) (*SpokeCluster, bool) {
+	spoke, found := r.Get(r.targetOf(work))
+	if !found || !selects(work, spoke) {
+		return nil, false
+	}
+	return spoke, true
+}
+
+// routes checks if the work is applied to the named spoke cluster.
+func (r *SpokeRegistry) routes(work client.Object, name string) bool {
+	w, ok := work.(*workv1alpha1.Work)
+	if !ok || r.targetOf(w) != name {
+		return false
+	}
+	spoke, found := r.Get(name)
+	// a deleted work is let through even if it no longer selects the spoke cluster, so that its finalizer is removed
+	return found && (!w.DeletionTimestamp.IsZero() || selects(w, spoke))
+}
+
+// selects checks if the cluster selector of the work matches the labels of the spoke cluster.
+// A work without a cluster selector selects every spoke cluster, one with an invalid selector selects none.
+func selects(work *workv1alpha1.Work, spoke *SpokeCluster) bool {
+	if work.Spec.ClusterSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(work.Spec.ClusterSelector)
+	if err != nil {
+		klog.ErrorS(err, "invalid cluster selector", workKeys(work.Namespace, work.Name)...)
+		return false
+	}
+	return selector.Matches(labels.Set(spoke.Labels))
+}
+
+// targetOf returns the name of the spoke cluster the work targets.
+func (r *SpokeRegistry) targetOf(work *workv1alpha1.Work) string {
+	if len(work.Spec.TargetCluster) != 0 {
+		return work.Spec.TargetCluster
+	}
+	if target, found := work.GetLabels()[TargetClusterLabel]; found {
+		return target
+	}
+	return r.defaultName
+}
+
+// workFilter only lets the works applied to the named spoke cluster through.
+func (r *SpokeRegistry) workFilter(name string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return r.routes(obj, name)
+	})
+}
+
+// triggerOf returns the trigger channel of the spoke cluster the work is applied to, nil if there's none.
+func (r *SpokeRegistry) triggerOf(work *workv1alpha1.Work) chan<- event.GenericEvent {
+	spoke, found := r.ClusterOf(work)
+	if !found || spoke.triggers == nil {
+		return nil
+	}
+	return spoke.triggers
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestSpokeRegistryRouting(t *testing.T) {
+	registry := NewSpokeRegistry("default", 0, 0)
+	defaultTriggers := make(chan event.GenericEvent, 1)
+	registry.clusters["default"] = &SpokeCluster{Name: "default", triggers: defaultTriggers}
+	registry.clusters["east"] = &SpokeCluster{Name: "east"}
+
+	tests := map[string]struct {
+		targetCluster string
+		labels        map[string]string
+		want          string
+		wantServed    bool
+		wantTriggers  bool
+	}{
+		"no target goes to the default spoke": {
+			want:         "default",
+			wantServed:   true,
+			wantTriggers: true,
+		},
+		"target from the spec": {
+			targetCluster: "east",
+			want:          "east",
+			wantServed:    true,
+		},
+		"target from the label": {
+			labels:     map[string]string{TargetClusterLabel: "east"},
+			want:       "east",
+			wantServed: true,
+		},
+		"spec wins over the label": {
+			targetCluster: "default",
+			labels:        map[string]string{TargetClusterLabel: "east"},
+			want:          "default",
+			wantServed:    true,
+			wantTriggers:  true,
+		},
+		"unknown target": {
+			targetCluster: "west",
+			want:          "west",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "work", Namespace: "cluster", Labels: tt.labels},
+				Spec:       workv1alpha1.WorkSpec{TargetCluster: tt.targetCluster},
+			}
+			if got := registry.targetOf(work); got != tt.want {
+				t.Errorf("targetOf() = %q, want %q", got, tt.want)
+			}
+			spoke, served := registry.ClusterOf(work)
+			if served != tt.wantServed || (served && spoke.Name != tt.want) {
+				t.Errorf("ClusterOf() = %+v, %v, want %q served %v", spoke, served, tt.want, tt.wantServed)
+			}
+			for _, spokeName := range registry.Names() {
+				filtered := registry.workFilter(spokeName).Generic(event.GenericEvent{Object: work})
+				if want := spokeName == tt.want; filtered != want {
+					t.Errorf("workFilter(%q) = %v, want %v", spokeName, filtered, want)
+				}
+			}
+			if gotTriggers := registry.triggerOf(work) != nil; gotTriggers != tt.wantTriggers {
+				t.Errorf("triggerOf() returned a channel %v, want %v", gotTriggers, tt.wantTriggers)
+			}
+		})
+	}
+}
+
+func TestSpokeRegistryClusterSelector(t *testing.T) {
+	registry := NewSpokeRegistry("default", 0, 0)
+	registry.clusters["default"] = &SpokeCluster{Name: "default", Labels: map[string]string{"env": "prod"}}
+
+	tests := map[string]struct {
+		selector   *metav1.LabelSelector
+		deleted    bool
+		wantServed bool
+	}{
+		"no selector": {
+			wantServed: true,
+		},
+		"matching selector": {
+			selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			wantServed: true,
+		},
+		"selector of other clusters": {
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+		},
+		"invalid selector": {
+			selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Near"}}},
+		},
+		"deleted work that no longer selects the cluster": {
+			selector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}},
+			deleted:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "work", Namespace: "cluster"},
+				Spec:       workv1alpha1.WorkSpec{ClusterSelector: tt.selector},
+			}
+			if tt.deleted {
+				now := metav1.Now()
+				work.DeletionTimestamp = &now
+			}
+			if _, served := registry.ClusterOf(work); served != tt.wantServed {
+				t.Errorf("ClusterOf() served = %v, want %v", served, tt.wantServed)
+			}
+			// the finalizer of a deleted work has to be removed whether it selects the cluster or not
+			wantFiltered := tt.wantServed || tt.deleted
+			if filtered := registry.workFilter("default").Generic(event.GenericEvent{Object: work}); filtered != wantFiltered {
+				t.Errorf("workFilter() = %v, want %v", filtered, wantFiltered)
+			}
+		})
+	}
+}
+
+func TestSpokeRegistryRateLimited(t *testing.T) {
+	cfg := &rest.Config{Host: "https://spoke"}
+	if got := NewSpokeRegistry("", 0, 0).rateLimited(cfg); got != cfg || got.RateLimiter != nil {
+		t.Errorf("rateLimited() = %+v, want the config unchanged without a qps", got)
+	}
+
+	got := NewSpokeRegistry("", 20, 40).rateLimited(cfg)
+	if got.RateLimiter == nil || got.RateLimiter.QPS() != 20 || got.QPS != 20 || got.Burst != 40 {
+		t.Errorf("rateLimited() = %+v, want a token bucket of 20 qps and 40 burst", got)
+	}
+	if cfg.RateLimiter != nil {
+		t.Errorf("rateLimited() changed the config of the spoke cluster")
+	}
+}
+
+func TestSpokeControllerNames(t *testing.T) {
+	if got := controllerName("work-apply", ""); got != "work-apply" {
+		t.Errorf("controllerName() = %q, want work-apply without a spoke name", got)
+	}
+	if got := controllerName("work-apply", "east"); got != "work-apply-east" {
+		t.Errorf("controllerName() = %q, want work-apply-east", got)
+	}
+
+	names := additionalSpokeNames(map[string]*rest.Config{"west": {}, "east": {}, "north": {}})
+	if !reflect.DeepEqual(names, []string{"east", "north", "west"}) {
+		t.Errorf("additionalSpokeNames() = %v, want the names sorted", names)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -80,7 +81,9 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(err).NotTo(HaveOccurred())
 
 	go func() {
-		if err := Start(ctrl.SetupSignalHandler(), cfg, cfg, setupLog, opts); err != nil {
+		// resync the applied works often so that the resources deleted out-of-band are restored within the test timeouts
+		controllerOpts := ControllerOptions{AppliedWorkResyncPeriod: 3 * time.Second}
+		if err := Start(ctrl.SetupSignalHandler(), cfg, cfg, setupLog, opts, controllerOpts); err != nil {
 			setupLog.Error(err, "problem running controllers")
 			os.Exit(1)
 		}
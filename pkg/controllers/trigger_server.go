@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+const (
+	// triggerPath is the path of the endpoint that triggers the reconcile of a work.
+	triggerPath = "/reconcile"
+
+	// triggerQueueSize is how many triggers can wait to be picked up by the work controller.
+	triggerQueueSize = 100
+)
+
+// triggerServer serves an endpoint that enqueues a work for an immediate reconcile by the work controller.
+// A caller has to present the configured token as a bearer token.
+type triggerServer struct {
+	addr   string
+	token  string
+	client client.Client
+	// certDir contains the tls.crt and tls.key the endpoint is served with, empty serves plain http
+	certDir string
+	// route returns the triggers channel of the spoke cluster a work is applied to, nil if it's not served
+	route func(work *workv1alpha1.Work) chan<- event.GenericEvent
+}
+
+// newTriggerServer creates a trigger server that sends the works to reconcile to the triggers channel route returns.
+func newTriggerServer(addr, token string, hubClient client.Client,
+	route func(work *workv1alpha1.Work) chan<- event.GenericEvent) *triggerServer {
+	return &triggerServer{
+		addr:   addr,
+		token:  token,
+		client: hubClient,
+		route:  route,
+	}
+}
+
+// Start serves the trigger endpoint until the context is done, it implements manager.Runnable.
+func (s *triggerServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(triggerPath, s)
+	addr, err := triggerListenAddr(s.addr, len(s.certDir) != 0)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	errChan := make(chan error, 1)
+	go func() {
+		klog.InfoS("start serving the reconcile trigger endpoint", "addr", addr, "tls", len(s.certDir) != 0)
+		if len(s.certDir) == 0 {
+			errChan <- server.ListenAndServe()
+			return
+		}
+		errChan <- server.ListenAndServeTLS(filepath.Join(s.certDir, "tls.crt"), filepath.Join(s.certDir, "tls.key"))
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// triggerListenAddr returns the address the trigger endpoint listens on. Without tls the bearer token goes over plain
+// http, so an address without a host only listens on localhost then.
+func triggerListenAddr(addr string, tls bool) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if len(host) != 0 || tls {
+		return addr, nil
+	}
+	return net.JoinHostPort("127.0.0.1", port), nil
+}
+
+// ServeHTTP enqueues the work given by the namespace and name query parameters and returns its current status.
+func (s *triggerServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	key := types.NamespacedName{
+		Namespace: req.URL.Query().Get("namespace"),
+		Name:      req.URL.Query().Get("name"),
+	}
+	if len(key.Namespace) == 0 || len(key.Name) == 0 {
+		http.Error(w, "both the namespace and the name of the work are required", http.StatusBadRequest)
+		return
+	}
+
+	work := &workv1alpha1.Work{}
+	if err := s.client.Get(req.Context(), key, work); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, "work not found", http.StatusNotFound)
+			return
+		}
+		klog.ErrorS(err, "failed to get the work to trigger", workKeys(key.Namespace, key.Name)...)
+		http.Error(w, "failed to get the work", http.StatusInternalServerError)
+		return
+	}
+
+	triggers := s.route(work)
+	if triggers == nil {
+		http.Error(w, "the work doesn't target a spoke cluster of this controller", http.StatusNotFound)
+		return
+	}
+	select {
+	case triggers <- event.GenericEvent{Object: work}:
+	default:
+		http.Error(w, "too many pending reconciles, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	klog.InfoS("triggered the reconcile of a work", workKeys(key.Namespace, key.Name)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(work.Status); err != nil {
+		klog.ErrorS(err, "failed to write the work status", workKeys(key.Namespace, key.Name)...)
+	}
+}
+
+// authorized checks if the request carries the expected bearer token.
+func (s *triggerServer) authorized(req *http.Request) bool {
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if len(s.token) == 0 || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(s.token)) == 1
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestTriggerServer(t *testing.T) {
+	tests := map[string]struct {
+		method      string
+		auth        string
+		query       string
+		wantCode    int
+		wantTrigger bool
+	}{
+		"trigger an existing work": {
+			method:      http.MethodPost,
+			auth:        "Bearer secret",
+			query:       "namespace=cluster-a&name=work",
+			wantCode:    http.StatusAccepted,
+			wantTrigger: true,
+		},
+		"missing token": {
+			method:   http.MethodPost,
+			query:    "namespace=cluster-a&name=work",
+			wantCode: http.StatusUnauthorized,
+		},
+		"wrong token": {
+			method:   http.MethodPost,
+			auth:     "Bearer guess",
+			query:    "namespace=cluster-a&name=work",
+			wantCode: http.StatusUnauthorized,
+		},
+		"wrong method": {
+			method:   http.MethodGet,
+			auth:     "Bearer secret",
+			query:    "namespace=cluster-a&name=work",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		"missing name": {
+			method:   http.MethodPost,
+			auth:     "Bearer secret",
+			query:    "namespace=cluster-a",
+			wantCode: http.StatusBadRequest,
+		},
+		"work not found": {
+			method:   http.MethodPost,
+			auth:     "Bearer secret",
+			query:    "namespace=cluster-a&name=missing",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+			}
+			hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+			triggers := make(chan event.GenericEvent, 1)
+			s := newTriggerServer(":0", "secret", hubClient, func(*workv1alpha1.Work) chan<- event.GenericEvent { return triggers })
+
+			req := httptest.NewRequest(tt.method, triggerPath+"?"+tt.query, nil)
+			if len(tt.auth) != 0 {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("ServeHTTP() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if gotTrigger := len(triggers) == 1; gotTrigger != tt.wantTrigger {
+				t.Errorf("ServeHTTP() triggered = %t, want %t", gotTrigger, tt.wantTrigger)
+			}
+		})
+	}
+}
+
+func TestTriggerListenAddr(t *testing.T) {
+	tests := map[string]struct {
+		addr    string
+		tls     bool
+		want    string
+		wantErr bool
+	}{
+		"plain http without a host listens on localhost": {addr: ":8090", want: "127.0.0.1:8090"},
+		"plain http with a host":                         {addr: "10.0.0.1:8090", want: "10.0.0.1:8090"},
+		"tls without a host listens everywhere":          {addr: ":8090", tls: true, want: ":8090"},
+		"an address without a port":                      {addr: "8090", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := triggerListenAddr(tt.addr, tt.tls)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("triggerListenAddr() = %q, %v, want %q with error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
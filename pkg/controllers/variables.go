@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// The variables the string values of a manifest can reference, e.g. to give its resources names unique to the work.
+// They are substituted before the manifest is applied, any other ${...} is left as it is.
+const (
+	// VariableWorkName is replaced with the name of the work.
+	VariableWorkName = "${WORK_NAME}"
+	// VariableWorkNamespace is replaced with the namespace of the work on the hub cluster.
+	VariableWorkNamespace = "${WORK_NAMESPACE}"
+)
+
+// manifestVariables returns the values of the variables for the manifests of a work.
+func manifestVariables(work *workv1alpha1.Work) map[string]string {
+	return map[string]string{
+		VariableWorkName:      work.Name,
+		VariableWorkNamespace: work.Namespace,
+	}
+}
+
+// substituteVariables replaces the variables in all the string values of a decoded object in place,
+// the keys of its maps are left untouched.
+func substituteVariables(obj map[string]interface{}, variables map[string]string) {
+	if len(variables) == 0 {
+		return
+	}
+	substitute(obj, variableReplacer(variables))
+}
+
+// variableReplacer returns a replacer of the variables with their values.
+func variableReplacer(variables map[string]string) *strings.Replacer {
+	oldnew := make([]string, 0, 2*len(variables))
+	for variable, value := range variables {
+		oldnew = append(oldnew, variable, value)
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func substitute(value interface{}, replacer *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case string:
+		return replacer.Replace(v)
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = substitute(field, replacer)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substitute(item, replacer)
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestSubstituteVariables(t *testing.T) {
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "frontend"}}
+	obj := newUnstructured("v1", "ConfigMap", "default", "config-${WORK_NAME}")
+	obj.SetLabels(map[string]string{"work": "${WORK_NAMESPACE}.${WORK_NAME}", "${WORK_NAME}": "key"})
+	obj.Object["data"] = map[string]interface{}{
+		"script": "echo ${HOME} ${WORK_NAME}",
+		"items":  []interface{}{"${WORK_NAMESPACE}", int64(1)},
+	}
+
+	substituteVariables(obj.Object, manifestVariables(work))
+	if got := obj.GetName(); got != "config-frontend" {
+		t.Errorf("substituteVariables() name = %q, want %q", got, "config-frontend")
+	}
+	wantLabels := map[string]string{"work": "cluster-a.frontend", "${WORK_NAME}": "key"}
+	if got := obj.GetLabels(); !reflect.DeepEqual(got, wantLabels) {
+		t.Errorf("substituteVariables() labels = %v, want %v with the keys untouched", got, wantLabels)
+	}
+	wantData := map[string]interface{}{
+		"script": "echo ${HOME} frontend",
+		"items":  []interface{}{"cluster-a", int64(1)},
+	}
+	if got := obj.Object["data"]; !reflect.DeepEqual(got, wantData) {
+		t.Errorf("substituteVariables() data = %v, want %v with the unknown variables left as they are", got, wantData)
+	}
+}
+
+func TestApplyManifestsSubstitutesVariables(t *testing.T) {
+	owner := metav1.OwnerReference{
+		APIVersion: workv1alpha1.GroupVersion.String(),
+		Kind:       "AppliedWork",
+		Name:       "cluster-a.frontend",
+		UID:        "applied-work-uid",
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	r := &ApplyWorkReconciler{
+		spokeDynamicClient: dynamicClient,
+		restMapper:         newTestRESTMapper(),
+	}
+	work := &workv1alpha1.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "frontend"}}
+	cm := newUnstructured("v1", "ConfigMap", "default", "config-${WORK_NAME}")
+	cm.SetLabels(map[string]string{"app": "${WORK_NAME}"})
+
+	opts := applyOptions{variables: manifestVariables(work)}
+	results := r.applyManifests(context.Background(), []workv1alpha1.Manifest{newTestManifest(t, cm)}, nil, nil, owner, opts)
+	if results[0].err != nil {
+		t.Fatalf("applyManifests() failed: %v", results[0].err)
+	}
+	if results[0].identifier.Name != "config-frontend" {
+		t.Errorf("applyManifests() identifier = %+v, want the substituted name", results[0].identifier)
+	}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	applied, err := dynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "config-frontend", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the applied config map: %v", err)
+	}
+	if got := applied.GetLabels()["app"]; got != "frontend" {
+		t.Errorf("applied config map label = %q, want %q", got, "frontend")
+	}
+}
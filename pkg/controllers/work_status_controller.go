@@ -18,42 +18,94 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/audit"
 )
 
 // WorkStatusReconciler reconciles a Work object when its status changes
 type WorkStatusReconciler struct {
 	appliedResourceTracker
+	auditSink audit.Sink
+	// recorder emits the events of the pruned resources on the work
+	recorder record.EventRecorder
+	// pruneLimit stops a single reconcile from deleting too many resources at once
+	pruneLimit PruneLimit
+	// statusTimeout is how long we wait for a single get or delete on the spoke cluster, zero means no timeout
+	statusTimeout time.Duration
+	// workFilter only lets the works applied to our spoke cluster through, it can be nil
+	workFilter predicate.Predicate
+	// maxConcurrentReconciles is how many works we sync the status of at once, zero syncs one at a time
+	maxConcurrentReconciles int
+	// clusterName is the name of the spoke cluster, it tells our controller apart from those of the other spoke clusters
+	clusterName string
 }
 
-func newWorkStatusReconciler(hubClient client.Client, spokeClient client.Client, spokeDynamicClient dynamic.Interface, restMapper meta.RESTMapper) *WorkStatusReconciler {
+// PruneLimit is how many of the applied resources of a work can be pruned in a single reconcile.
+// A zero field doesn't limit the pruning.
+type PruneLimit struct {
+	// MaxResources is the maximum number of resources to prune at once.
+	MaxResources int
+	// MaxPercent is the maximum percentage of the applied resources to prune at once.
+	MaxPercent int
+}
+
+// exceeded checks if pruning the stale resources out of all the applied ones goes over the limit.
+func (l PruneLimit) exceeded(stale, applied int) bool {
+	if l.MaxResources > 0 && stale > l.MaxResources {
+		return true
+	}
+	return l.MaxPercent > 0 && applied > 0 && stale*100 > l.MaxPercent*applied
+}
+
+func newWorkStatusReconciler(hubClient client.Client, spokeClient client.Client, spokeDynamicClient dynamic.Interface,
+	restMapper meta.RESTMapper, recorder record.EventRecorder, auditSink audit.Sink, pruneLimit PruneLimit,
+	statusTimeout time.Duration) *WorkStatusReconciler {
 	return &WorkStatusReconciler{
-		appliedResourceTracker{
+		appliedResourceTracker: appliedResourceTracker{
 			hubClient:          hubClient,
 			spokeClient:        spokeClient,
 			spokeDynamicClient: spokeDynamicClient,
 			restMapper:         restMapper,
 		},
+		auditSink:     auditSink,
+		recorder:      recorder,
+		pruneLimit:    pruneLimit,
+		statusTimeout: statusTimeout,
 	}
 }
 
+// withStatusTimeout returns the context of a single call to the spoke cluster.
+func (r *WorkStatusReconciler) withStatusTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.statusTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.statusTimeout)
+}
+
 // Reconcile implement the control loop logic for Work Status.
 func (r *WorkStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	klog.InfoS("work status reconcile loop triggered", "item", req.NamespacedName)
+	klog.InfoS("work status reconcile loop triggered", workKeys(req.Namespace, req.Name)...)
 	work, appliedWork, err := r.fetchWorks(ctx, req.NamespacedName)
 	if err != nil {
 		return ctrl.Result{}, err
@@ -63,30 +115,264 @@ func (r *WorkStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	// a paused work keeps its resources, stale or not, as they are until it is resumed
+	if work.Spec.Paused {
+		klog.V(logLevelDebug).InfoS("skip the status of a paused work", workKeys(req.Namespace, req.Name)...)
+		return ctrl.Result{}, nil
+	}
+
 	// from now on both work objects should exist
-	newRes, staleRes := r.calculateNewAppliedWork(work, appliedWork)
-	if err = r.deleteStaleWork(ctx, staleRes); err != nil {
-		klog.ErrorS(err, "failed to delete all the stale work", "work", req.NamespacedName)
+	claims, err := r.findResourceClaims(ctx, work, appliedWork)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	newRes, staleRes, handoffs := r.calculateNewAppliedWork(ctx, work, appliedWork, claims)
+	for _, handoff := range handoffs {
+		if err = r.transferAppliedResources(ctx, appliedWork, handoff.to, []workapi.AppliedResourceMeta{handoff.resource}); err != nil {
+			klog.ErrorS(err, "failed to hand a resource over to another work",
+				workKeys(req.Namespace, req.Name, "resource", handoff.resource, "appliedWork", handoff.to.Name)...)
+			return ctrl.Result{}, err
+		}
+		klog.InfoS("handed a resource over to another work",
+			workKeys(req.Namespace, req.Name, "resource", handoff.resource, "appliedWork", handoff.to.Name)...)
+		r.recorder.Eventf(work, corev1.EventTypeNormal, "HandedOffResource", "Handed the %s over to work %s/%s",
+			describeResource(handoff.resource.ResourceIdentifier), handoff.to.Spec.WorkNamespace, handoff.to.Spec.WorkName)
+	}
+	if r.pruneLimit.exceeded(len(staleRes), len(appliedWork.Status.AppliedResources)) &&
+		work.GetAnnotations()[AllowPruneAnnotation] != "true" {
+		// we leave the appliedWork alone so the stale resources are still tracked once the prune is allowed
+		klog.InfoS("refuse to prune more resources than allowed at once",
+			workKeys(req.Namespace, req.Name, "stale", len(staleRes), "applied", len(appliedWork.Status.AppliedResources))...)
+		return ctrl.Result{}, r.updatePrunedCondition(ctx, work, buildPruneThresholdExceededCondition(len(staleRes), work.Generation))
+	}
+	if err = r.updatePrunedCondition(ctx, work, nil); err != nil {
+		return ctrl.Result{}, err
+	}
+	deleted, err := r.deleteStaleWork(ctx, work, appliedWork, staleRes)
+	if err != nil {
+		klog.ErrorS(err, "failed to delete all the stale work", workKeys(req.Namespace, req.Name)...)
 		// we can't proceed to update the applied
 		return ctrl.Result{}, err
 	}
 
 	// update the appliedWork with the new work
 	appliedWork.Status.AppliedResources = newRes
+	summarizeAppliedResources(appliedWork)
 	if err = r.spokeClient.Status().Update(ctx, appliedWork, &client.UpdateOptions{}); err != nil {
-		klog.ErrorS(err, "update appliedWork status failed", "appliedWork", appliedWork.GetName())
+		klog.ErrorS(err, "update appliedWork status failed", workKeys(req.Namespace, req.Name, "appliedWork", appliedWork.GetName())...)
 		return ctrl.Result{}, err
 	}
 
+	deleting, err := r.syncDeletingResources(ctx, work, deleted)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	settled, err := r.syncAvailability(ctx, work)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !settled || deleting {
+		// the spoke objects don't trigger a reconcile when they become available or go away so we need to check back
+		return ctrl.Result{RequeueAfter: availabilityRequeueInterval}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
+// syncDeletingResources keeps the stale resources we deleted in the deleting resources of the work status until they
+// are gone from the spoke cluster, along with a Deleting condition, so that a deletion stuck on a finalizer shows.
+// It returns whether some of the resources are still being deleted.
+func (r *WorkStatusReconciler) syncDeletingResources(ctx context.Context, work *workapi.Work, deleted []workapi.ResourceIdentifier) (bool, error) {
+	candidates := make([]workapi.ResourceIdentifier, 0, len(work.Status.DeletingResources)+len(deleted))
+	candidates = append(candidates, work.Status.DeletingResources...)
+	candidates = append(candidates, deleted...)
+	manifests := make([]workapi.ResourceIdentifier, 0, len(work.Status.ManifestConditions))
+	for _, manifestCond := range work.Status.ManifestConditions {
+		manifests = append(manifests, manifestCond.Identifier)
+	}
+	var deleting []workapi.ResourceIdentifier
+	for _, identifier := range candidates {
+		// a resource added back to the work is applied again under the same name, the one we find is no longer
+		// the one we deleted
+		if containsResource(deleting, identifier) || containsResource(manifests, identifier) {
+			continue
+		}
+		gvr := schema.GroupVersionResource{Group: identifier.Group, Version: identifier.Version, Resource: identifier.Resource}
+		getCtx, cancel := r.withStatusTimeout(ctx)
+		_, err := r.spokeDynamicClient.Resource(gvr).Namespace(identifier.Namespace).Get(getCtx, identifier.Name, metav1.GetOptions{})
+		cancel()
+		switch {
+		case errors.IsNotFound(err):
+			klog.V(logLevelDebug).InfoS("a deleted stale resource is gone", workKeys(work.Namespace, work.Name, "resource", identifier)...)
+		case err != nil:
+			klog.ErrorS(err, "failed to check if a deleted stale resource is gone", workKeys(work.Namespace, work.Name, "resource", identifier)...)
+			return false, err
+		default:
+			deleting = append(deleting, identifier)
+		}
+	}
+
+	oldStatus := work.Status.DeepCopy()
+	work.Status.DeletingResources = deleting
+	if len(deleting) == 0 {
+		meta.RemoveStatusCondition(&work.Status.Conditions, ConditionTypeDeleting)
+	} else {
+		meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+			Type:               ConditionTypeDeleting,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: work.Generation,
+			LastTransitionTime: metav1.Now(),
+			Reason:             ReasonWaitingForDeletion,
+			Message:            fmt.Sprintf("%d resources pruned from the work are still being deleted on the spoke cluster", len(deleting)),
+		})
+	}
+	if equality.Semantic.DeepEqual(oldStatus, &work.Status) {
+		return len(deleting) != 0, nil
+	}
+	if err := r.hubClient.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "failed to update the deleting resources of the work", workKeys(work.Namespace, work.Name)...)
+		return false, err
+	}
+	return len(deleting) != 0, nil
+}
+
+// containsResource checks if the identifiers contain the resource the given identifier points to.
+func containsResource(identifiers []workapi.ResourceIdentifier, identifier workapi.ResourceIdentifier) bool {
+	for _, candidate := range identifiers {
+		if isSameResource(workapi.AppliedResourceMeta{ResourceIdentifier: candidate}, identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncAvailability checks the live objects of the applied manifests and updates the Available conditions of the
+// manifests and of the work accordingly. It returns whether the work is as available as it gets, the manifests whose
+// kind is not served by the spoke cluster anymore don't become available by checking them back.
+func (r *WorkStatusReconciler) syncAvailability(ctx context.Context, work *workapi.Work) (bool, error) {
+	// the manifests of the workload reference are split into documents along with the inline ones, they shift the
+	// ordinals of the health checks once they are expanded
+	workload, err := resolveWorkload(ctx, r.hubClient, work)
+	if err != nil {
+		klog.ErrorS(err, "failed to read the workload reference of the work", workKeys(work.Namespace, work.Name)...)
+		return false, err
+	}
+	oldStatus := work.Status.DeepCopy()
+	// the ordinals of the manifest conditions are the ones of the documents the manifests are split into
+	healthChecks := compileHealthChecks(expandWorkload(workload))
+	for i := range work.Status.ManifestConditions {
+		manifestCond := &work.Status.ManifestConditions[i]
+		// we can only tell if the manifest is available once it is applied
+		applied := meta.FindStatusCondition(manifestCond.Conditions, ConditionTypeApplied)
+		switch {
+		case applied != nil && applied.Reason == ReasonKindUnavailable:
+			meta.SetStatusCondition(&manifestCond.Conditions, buildKindUnavailableAvailableCondition(manifestCond.Identifier))
+			continue
+		case applied == nil || applied.Status != metav1.ConditionTrue:
+			meta.SetStatusCondition(&manifestCond.Conditions,
+				buildAvailableStatusCondition(false, "The manifest is not applied", 0))
+			continue
+		}
+		identifier := manifestCond.Identifier
+		gvr := schema.GroupVersionResource{Group: identifier.Group, Version: identifier.Version, Resource: identifier.Resource}
+		getCtx, cancel := r.withStatusTimeout(ctx)
+		obj, err := r.spokeDynamicClient.Resource(gvr).Namespace(identifier.Namespace).Get(getCtx, identifier.Name, metav1.GetOptions{})
+		timedOut := getCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		switch {
+		case err != nil && timedOut:
+			// a slow spoke cluster doesn't fail the whole work, we check the manifest again with the next requeue
+			klog.InfoS("timed out getting the applied object", workKeys(work.Namespace, work.Name, "resource", identifier, "timeout", r.statusTimeout)...)
+			meta.SetStatusCondition(&manifestCond.Conditions, metav1.Condition{
+				Type:               ConditionTypeAvailable,
+				Status:             metav1.ConditionUnknown,
+				LastTransitionTime: metav1.Now(),
+				Reason:             ReasonStatusCheckTimeout,
+				Message:            fmt.Sprintf("The object was not read from the spoke cluster within %s", r.statusTimeout),
+			})
+		case errors.IsNotFound(err):
+			meta.SetStatusCondition(&manifestCond.Conditions,
+				buildAvailableStatusCondition(false, "The object is not found on the spoke cluster", 0))
+		case err != nil:
+			klog.ErrorS(err, "failed to get the applied object", workKeys(work.Namespace, work.Name, "resource", identifier)...)
+			return false, err
+		default:
+			available, message := checkManifestAvailability(obj, healthChecks[identifier.Ordinal])
+			meta.SetStatusCondition(&manifestCond.Conditions, buildAvailableStatusCondition(available, message, obj.GetGeneration()))
+		}
+	}
+	workCond := buildWorkAvailableCondition(work.Status.ManifestConditions, work.Generation)
+	meta.SetStatusCondition(&work.Status.Conditions, workCond)
+
+	if !equality.Semantic.DeepEqual(oldStatus, &work.Status) {
+		if err := r.hubClient.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+			klog.ErrorS(err, "failed to update the availability of the work", workKeys(work.Namespace, work.Name)...)
+			return false, err
+		}
+	}
+	return !availabilityPending(work.Status.ManifestConditions), nil
+}
+
+// resourceClaim is a resource that another work applies to the spoke cluster, with the appliedWork tracking that work.
+type resourceClaim struct {
+	identifier workapi.ResourceIdentifier
+	to         *workapi.AppliedWork
+}
+
+// resourceHandoff is a resource removed from a work that is handed over to the appliedWork of the work now applying it.
+type resourceHandoff struct {
+	resource workapi.AppliedResourceMeta
+	to       *workapi.AppliedWork
+}
+
+// findResourceClaims finds the resources tracked by the appliedWork that other works in the same namespace apply too,
+// so that a manifest moved from one work to another is handed over instead of deleted and recreated.
+// Only the works with an appliedWork on our spoke cluster can take a resource over.
+func (r *WorkStatusReconciler) findResourceClaims(ctx context.Context, work *workapi.Work, appliedWork *workapi.AppliedWork) ([]resourceClaim, error) {
+	works := &workapi.WorkList{}
+	if err := r.hubClient.List(ctx, works, client.InNamespace(work.Namespace)); err != nil {
+		klog.ErrorS(err, "failed to list the works", workKeys(work.Namespace, work.Name)...)
+		return nil, err
+	}
+	var claims []resourceClaim
+	for i := range works.Items {
+		other := &works.Items[i]
+		if other.Name == work.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		var claimed []workapi.ResourceIdentifier
+		for _, manifestCond := range other.Status.ManifestConditions {
+			if tracksResource(appliedWork, manifestCond.Identifier) {
+				claimed = append(claimed, manifestCond.Identifier)
+			}
+		}
+		if len(claimed) == 0 {
+			continue
+		}
+		otherAppliedWork, err := fetchAppliedWork(ctx, r.spokeClient, types.NamespacedName{Namespace: other.Namespace, Name: other.Name})
+		if errors.IsNotFound(err) {
+			// the other work is not applied to our spoke cluster, or not yet
+			continue
+		}
+		if err != nil {
+			klog.ErrorS(err, "failed to get the appliedWork of another work", workKeys(other.Namespace, other.Name)...)
+			return nil, err
+		}
+		for _, identifier := range claimed {
+			claims = append(claims, resourceClaim{identifier: identifier, to: otherAppliedWork})
+		}
+	}
+	return claims, nil
+}
+
 // calculateNewAppliedWork check the difference between what is supposed to be applied  (tracked by the work CR status)
 // and what was applied in the member cluster (tracked by the appliedWork CR).
-// What is in the `appliedWork` but not in the `work` should be deleted from the member cluster
-// What is in the `work` but not in the `appliedWork` should be added to the appliedWork status
-func (r *WorkStatusReconciler) calculateNewAppliedWork(work *workapi.Work, appliedWork *workapi.AppliedWork) ([]workapi.AppliedResourceMeta, []workapi.AppliedResourceMeta) {
+// What is in the `appliedWork` but not in the `work` should be deleted from the member cluster,
+// unless another work claims it now in which case it is handed over to the appliedWork of that work.
+// What is in the `work` but not in the `appliedWork` should be added to the appliedWork status, with the UID of its resource.
+func (r *WorkStatusReconciler) calculateNewAppliedWork(ctx context.Context, work *workapi.Work, appliedWork *workapi.AppliedWork,
+	claims []resourceClaim) ([]workapi.AppliedResourceMeta, []workapi.AppliedResourceMeta, []resourceHandoff) {
 	var staleRes, newRes []workapi.AppliedResourceMeta
+	var handoffs []resourceHandoff
 
 	for _, resourceMeta := range appliedWork.Status.AppliedResources {
 		resStillExist := false
@@ -96,45 +382,83 @@ func (r *WorkStatusReconciler) calculateNewAppliedWork(work *workapi.Work, appli
 				break
 			}
 		}
-		if !resStillExist {
-			klog.V(3).InfoS("find an orphaned resource", "parent work", work.GetObjectKind().GroupVersionKind(),
-				"name", work.GetName(), "resource", resourceMeta)
-			staleRes = append(staleRes, resourceMeta)
+		if resStillExist {
+			continue
+		}
+		if claim := claimOf(claims, resourceMeta); claim != nil {
+			klog.V(logLevelDebug).InfoS("find a resource moved to another work",
+				workKeys(work.Namespace, work.Name, "resource", resourceMeta, "appliedWork", claim.to.Name)...)
+			handoffs = append(handoffs, resourceHandoff{resource: resourceMeta, to: claim.to})
+			continue
 		}
+		klog.V(logLevelDebug).InfoS("find an orphaned resource", workKeys(work.Namespace, work.Name, "resource", resourceMeta)...)
+		staleRes = append(staleRes, resourceMeta)
 	}
 
 	for _, manifestCond := range work.Status.ManifestConditions {
 		ac := meta.FindStatusCondition(manifestCond.Conditions, ConditionTypeApplied)
 		if ac == nil {
-			klog.Errorf("find one work %+v that has no applied condition", manifestCond.Identifier)
+			klog.ErrorS(fmt.Errorf("the manifest has no applied condition"), "find a manifest that is not applied yet",
+				workKeys(work.Namespace, work.Name, "resource", manifestCond.Identifier)...)
 			continue
 		}
-		// we only add the applied one to the appliedWork status
-		if ac.Status == metav1.ConditionTrue {
-			resRecorded := false
-			// we keep the existing resourceMeta since it has the UID
-			for _, resourceMeta := range appliedWork.Status.AppliedResources {
-				if isSameResource(resourceMeta, manifestCond.Identifier) {
-					resRecorded = true
-					newRes = append(newRes, resourceMeta)
-					break
-				}
-			}
-			if !resRecorded {
-				klog.V(5).InfoS("find a new resource", "parent work", work.GetObjectKind().GroupVersionKind(),
-					"name", work.GetName(), "resource", manifestCond.Identifier)
-				newRes = append(newRes, workapi.AppliedResourceMeta{
-					ResourceIdentifier: manifestCond.Identifier,
-				})
+		resRecorded := false
+		// we keep the existing resourceMeta since it has the UID, even if the manifest fails to apply now
+		// so that the resource is still cleaned up once it is removed from the work
+		for _, resourceMeta := range appliedWork.Status.AppliedResources {
+			if isSameResource(resourceMeta, manifestCond.Identifier) {
+				resRecorded = true
+				newRes = append(newRes, resourceMeta)
+				break
 			}
 		}
+		// we only add the applied one to the appliedWork status
+		if !resRecorded && ac.Status == metav1.ConditionTrue {
+			klog.V(logLevelTrace).InfoS("find a new resource", workKeys(work.Namespace, work.Name, "resource", manifestCond.Identifier)...)
+			newRes = append(newRes, workapi.AppliedResourceMeta{
+				ResourceIdentifier: manifestCond.Identifier,
+				UID:                r.liveUIDOf(ctx, work, manifestCond.Identifier),
+			})
+		}
 	}
 
-	return newRes, staleRes
+	return newRes, staleRes, handoffs
+}
+
+// liveUIDOf reads the UID of a resource from the spoke cluster. It returns an empty UID if the resource can't be read,
+// the appliedWork controller records it at its next check then.
+func (r *WorkStatusReconciler) liveUIDOf(ctx context.Context, work *workapi.Work, identifier workapi.ResourceIdentifier) types.UID {
+	gvr := schema.GroupVersionResource{Group: identifier.Group, Version: identifier.Version, Resource: identifier.Resource}
+	getCtx, cancel := r.withStatusTimeout(ctx)
+	defer cancel()
+	obj, err := r.spokeDynamicClient.Resource(gvr).Namespace(identifier.Namespace).Get(getCtx, identifier.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.V(logLevelDebug).InfoS("failed to read the UID of a new resource", workKeys(work.Namespace, work.Name, "resource", identifier, "error", err)...)
+		return ""
+	}
+	return obj.GetUID()
+}
+
+// claimOf returns the claim another work has on the resource, or nil if no other work applies it.
+func claimOf(claims []resourceClaim, resourceMeta workapi.AppliedResourceMeta) *resourceClaim {
+	for i := range claims {
+		if isSameResource(resourceMeta, claims[i].identifier) {
+			return &claims[i]
+		}
+	}
+	return nil
 }
 
-func (r *WorkStatusReconciler) deleteStaleWork(ctx context.Context, staleWorks []workapi.AppliedResourceMeta) error {
+// deleteStaleWork deletes the stale resources the applied work applied, the stale resources shared with
+// other owners only lose the owner reference of the applied work.
+// The applied work is still around, so unlike the deletion of a work nothing is left to the garbage collector here.
+// It returns the resources it deleted, they may linger on the spoke cluster until their finalizers are done.
+func (r *WorkStatusReconciler) deleteStaleWork(ctx context.Context, work *workapi.Work, appliedWork *workapi.AppliedWork,
+	staleWorks []workapi.AppliedResourceMeta) ([]workapi.ResourceIdentifier, error) {
 	var errs []error
+	var deleted []workapi.ResourceIdentifier
+	nsWorkName := types.NamespacedName{Namespace: work.GetNamespace(), Name: work.GetName()}
+	propagation := stalePropagationPolicyOf(work.Spec.StaleDeletePropagation)
 
 	for _, staleWork := range staleWorks {
 		gvr := schema.GroupVersionResource{
@@ -142,15 +466,74 @@ func (r *WorkStatusReconciler) deleteStaleWork(ctx context.Context, staleWorks [
 			Version:  staleWork.Version,
 			Resource: staleWork.Resource,
 		}
-		err := r.spokeDynamicClient.Resource(gvr).Namespace(staleWork.Namespace).
-			Delete(ctx, staleWork.Name, metav1.DeleteOptions{})
-		if err != nil && !errors.IsGone(err) {
-			klog.ErrorS(err, "failed to delete a stale work", "work", staleWork)
+		deleteCtx, cancel := r.withStatusTimeout(ctx)
+		removed, err := releaseAppliedResource(deleteCtx, r.spokeDynamicClient.Resource(gvr).Namespace(staleWork.Namespace),
+			staleWork.Name, appliedWork.UID, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+		cancel()
+		switch {
+		case err == nil && !removed:
+			klog.V(logLevelDebug).InfoS("released a stale resource", workKeys(nsWorkName.Namespace, nsWorkName.Name, "resource", staleWork)...)
+		case err == nil:
+			deleted = append(deleted, staleWork.ResourceIdentifier)
+			staleResourcesDeleted.WithLabelValues(staleWork.Group, staleWork.Version, staleWork.Kind).Inc()
+			recordAudit(r.auditSink, nsWorkName, staleWork.ResourceIdentifier, audit.ActionDelete, nil)
+			r.recorder.Eventf(work, corev1.EventTypeNormal, "DeletedStaleResource", "Deleted the stale %s",
+				describeResource(staleWork.ResourceIdentifier))
+		case !errors.IsGone(err):
+			klog.ErrorS(err, "failed to delete a stale resource", workKeys(nsWorkName.Namespace, nsWorkName.Name, "resource", staleWork)...)
+			staleResourceDeleteFailures.WithLabelValues(staleWork.Group, staleWork.Version, staleWork.Kind).Inc()
+			recordAudit(r.auditSink, nsWorkName, staleWork.ResourceIdentifier, audit.ActionDelete, err)
+			r.recorder.Eventf(work, corev1.EventTypeWarning, "DeleteStaleResourceFailed", "Failed to delete the stale %s: %v",
+				describeResource(staleWork.ResourceIdentifier), err)
 			errs = append(errs, err)
 		}
+	}
+	return deleted, utilerrors.NewAggregate(errs)
+}
+
+// stalePropagationPolicyOf returns how the dependents of the stale resources of a work are deleted.
+func stalePropagationPolicyOf(propagation workapi.StaleDeletePropagationType) metav1.DeletionPropagation {
+	if propagation == workapi.StaleDeletePropagationForeground {
+		return metav1.DeletePropagationForeground
+	}
+	return metav1.DeletePropagationBackground
+}
+
+// updatePrunedCondition sets the pruned condition of the work, or removes it if the condition is nil.
+// The work status is only updated if the condition changes.
+func (r *WorkStatusReconciler) updatePrunedCondition(ctx context.Context, work *workapi.Work, condition *metav1.Condition) error {
+	if condition == nil {
+		if meta.FindStatusCondition(work.Status.Conditions, ConditionTypePruned) == nil {
+			return nil
+		}
+		meta.RemoveStatusCondition(&work.Status.Conditions, ConditionTypePruned)
+	} else {
+		existing := meta.FindStatusCondition(work.Status.Conditions, ConditionTypePruned)
+		if existing != nil && existing.Status == condition.Status && existing.Reason == condition.Reason &&
+			existing.Message == condition.Message && existing.ObservedGeneration == condition.ObservedGeneration {
+			return nil
+		}
+		meta.SetStatusCondition(&work.Status.Conditions, *condition)
+	}
+	if err := r.hubClient.Status().Update(ctx, work, &client.UpdateOptions{}); err != nil {
+		klog.ErrorS(err, "failed to update the pruned condition of the work", workKeys(work.Namespace, work.Name)...)
+		return err
+	}
+	return nil
+}
 
+// buildPruneThresholdExceededCondition builds the condition of a work whose stale resources are not pruned
+// because there are too many of them.
+func buildPruneThresholdExceededCondition(stale int, observedGeneration int64) *metav1.Condition {
+	return &metav1.Condition{
+		Type:               ConditionTypePruned,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: observedGeneration,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonPruneThresholdExceeded,
+		Message: fmt.Sprintf("Refuse to prune %d resources at once, set the %s annotation to \"true\" to prune them",
+			stale, AllowPruneAnnotation),
 	}
-	return utilerrors.NewAggregate(errs)
 }
 
 // isSameResource checks if an appliedMeta is referring to the same resource that a resourceId is pointing to
@@ -162,8 +545,13 @@ func isSameResource(appliedMeta workapi.AppliedResourceMeta, resourceId workapi.
 
 // SetupWithManager wires up the controller.
 func (r *WorkStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).For(&workapi.Work{},
-		builder.WithPredicates(UpdateOnlyPredicate{}, predicate.ResourceVersionChangedPredicate{})).Complete(r)
+	predicates := []predicate.Predicate{UpdateOnlyPredicate{}, predicate.ResourceVersionChangedPredicate{}}
+	if r.workFilter != nil {
+		predicates = append(predicates, r.workFilter)
+	}
+	return ctrl.NewControllerManagedBy(mgr).Named(controllerName("work-status", r.clusterName)).
+		For(&workapi.Work{}, builder.WithPredicates(predicates...)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles}).Complete(r)
 }
 
 // We only need to process the update event
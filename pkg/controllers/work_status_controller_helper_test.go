@@ -0,0 +1,520 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	workapi "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func TestPruneLimitExceeded(t *testing.T) {
+	tests := map[string]struct {
+		limit   PruneLimit
+		stale   int
+		applied int
+		want    bool
+	}{
+		"no limit": {
+			stale:   10,
+			applied: 10,
+		},
+		"under the count limit": {
+			limit:   PruneLimit{MaxResources: 3},
+			stale:   3,
+			applied: 10,
+		},
+		"over the count limit": {
+			limit:   PruneLimit{MaxResources: 3},
+			stale:   4,
+			applied: 10,
+			want:    true,
+		},
+		"at the percentage limit": {
+			limit:   PruneLimit{MaxPercent: 50},
+			stale:   5,
+			applied: 10,
+		},
+		"over the percentage limit": {
+			limit:   PruneLimit{MaxPercent: 50},
+			stale:   6,
+			applied: 10,
+			want:    true,
+		},
+		"emptied work": {
+			limit:   PruneLimit{MaxResources: 100, MaxPercent: 50},
+			stale:   2,
+			applied: 2,
+			want:    true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.limit.exceeded(tt.stale, tt.applied); got != tt.want {
+				t.Errorf("exceeded(%d, %d) = %t, want %t", tt.stale, tt.applied, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackAppliedResources(t *testing.T) {
+	tracked := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "tracked"}
+	dropped := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "dropped"}
+	failed := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "failed"}
+	manifestCondition := func(identifier workapi.ResourceIdentifier, status metav1.ConditionStatus) workapi.ManifestCondition {
+		return workapi.ManifestCondition{
+			Identifier: identifier,
+			Conditions: []metav1.Condition{{Type: ConditionTypeApplied, Status: status}},
+		}
+	}
+
+	appliedWork := &workapi.AppliedWork{}
+	appliedWork.Status.AppliedResources = []workapi.AppliedResourceMeta{{ResourceIdentifier: tracked}}
+	// the dropped manifest was applied by the previous generation but the status controller didn't record it yet
+	oldConditions := []workapi.ManifestCondition{
+		manifestCondition(tracked, metav1.ConditionTrue),
+		manifestCondition(dropped, metav1.ConditionTrue),
+	}
+	newConditions := []workapi.ManifestCondition{
+		manifestCondition(tracked, metav1.ConditionTrue),
+		manifestCondition(failed, metav1.ConditionFalse),
+	}
+
+	if !trackAppliedResources(appliedWork, oldConditions, newConditions) {
+		t.Fatalf("trackAppliedResources() = false, want true")
+	}
+	if len(appliedWork.Status.AppliedResources) != 2 {
+		t.Fatalf("got %d applied resources, want 2: %+v", len(appliedWork.Status.AppliedResources), appliedWork.Status.AppliedResources)
+	}
+	if !isSameResource(appliedWork.Status.AppliedResources[1], dropped) {
+		t.Errorf("got applied resource %+v, want %+v", appliedWork.Status.AppliedResources[1], dropped)
+	}
+	if trackAppliedResources(appliedWork, oldConditions, newConditions) {
+		t.Errorf("trackAppliedResources() = true for resources that are all tracked")
+	}
+}
+
+func TestRecordAppliedGenerations(t *testing.T) {
+	written := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "written"}
+	unchanged := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "unchanged"}
+	failed := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "failed"}
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+	appliedWork := &workapi.AppliedWork{}
+	appliedWork.Status.AppliedResources = []workapi.AppliedResourceMeta{
+		{ResourceIdentifier: written, ObservedGeneration: 1, LastAppliedTime: &earlier},
+		{ResourceIdentifier: unchanged, ObservedGeneration: 1, LastAppliedTime: &earlier},
+		{ResourceIdentifier: failed, ObservedGeneration: 1, LastAppliedTime: &earlier},
+	}
+	results := []applyResult{
+		{identifier: written, generation: 2, uid: "written-uid", updated: true},
+		{identifier: unchanged, generation: 3},
+		{identifier: failed, generation: 4, updated: true, err: fmt.Errorf("failed")},
+	}
+
+	now := metav1.Now()
+	if !recordAppliedGenerations(appliedWork, results, now) {
+		t.Fatalf("recordAppliedGenerations() = false, want true")
+	}
+	want := []struct {
+		generation  int64
+		appliedTime metav1.Time
+	}{{2, now}, {1, earlier}, {1, earlier}}
+	for i, resourceMeta := range appliedWork.Status.AppliedResources {
+		if resourceMeta.ObservedGeneration != want[i].generation || !resourceMeta.LastAppliedTime.Equal(&want[i].appliedTime) {
+			t.Errorf("applied resource %s has generation %d applied at %v, want %d applied at %v", resourceMeta.Name,
+				resourceMeta.ObservedGeneration, resourceMeta.LastAppliedTime, want[i].generation, want[i].appliedTime)
+		}
+	}
+	if uid := appliedWork.Status.AppliedResources[0].UID; uid != "written-uid" {
+		t.Errorf("applied resource %s has UID %q, want the UID of the written resource", written.Name, uid)
+	}
+	if recordAppliedGenerations(appliedWork, results[1:], now) {
+		t.Errorf("recordAppliedGenerations() = true without any resource written")
+	}
+}
+
+func TestCalculateNewAppliedWorkRecordsUID(t *testing.T) {
+	live := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "live"}
+	gone := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "gone"}
+	applied := []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionTrue, Reason: ReasonAppliedManifestComplete}}
+	work := &workapi.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+		Status: workapi.WorkStatus{ManifestConditions: []workapi.ManifestCondition{
+			{Identifier: live, Conditions: applied},
+			{Identifier: gone, Conditions: applied},
+		}},
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "default", "live")
+	configMap.SetUID("live-uid")
+	r := newWorkStatusReconciler(nil, nil, fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), configMap),
+		newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+
+	newRes, _, _ := r.calculateNewAppliedWork(context.Background(), work, &workapi.AppliedWork{}, nil)
+	if len(newRes) != 2 {
+		t.Fatalf("calculateNewAppliedWork() = %+v, want both resources", newRes)
+	}
+	if newRes[0].UID != "live-uid" {
+		t.Errorf("new resource %s has UID %q, want the UID of the live resource", live.Name, newRes[0].UID)
+	}
+	if newRes[1].UID != "" {
+		t.Errorf("new resource %s has UID %q, want none since it can't be read", gone.Name, newRes[1].UID)
+	}
+}
+
+func TestWorkStatusReconcilerHandsOffMovedResource(t *testing.T) {
+	moved := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "moved"}
+	stale := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "stale"}
+	newAppliedWork := func(workName, uid string, resources ...workapi.AppliedResourceMeta) *workapi.AppliedWork {
+		return &workapi.AppliedWork{
+			ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName("cluster-a", workName), UID: types.UID(uid)},
+			Spec:       workapi.AppliedWorkSpec{WorkNamespace: "cluster-a", WorkName: workName},
+			Status:     workapi.AppliedtWorkStatus{AppliedResources: resources},
+		}
+	}
+	// the moved config map was applied by the source work, the target work failed to apply it since it is not its owner yet
+	source := newAppliedWork("source", "source-uid",
+		workapi.AppliedResourceMeta{ResourceIdentifier: moved, UID: "moved-uid", ObservedGeneration: 3},
+		workapi.AppliedResourceMeta{ResourceIdentifier: stale, UID: "stale-uid"})
+	target := newAppliedWork("target", "target-uid")
+	sourceWork := &workapi.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "source"}}
+	targetWork := &workapi.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "target"},
+		Status: workapi.WorkStatus{ManifestConditions: []workapi.ManifestCondition{{
+			Identifier: moved,
+			Conditions: []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionFalse, Reason: ReasonNotOwned}},
+		}}},
+	}
+	sourceOwner := []metav1.OwnerReference{{
+		APIVersion: workapi.GroupVersion.String(), Kind: "AppliedWork", Name: source.Name, UID: source.UID,
+	}}
+	movedConfigMap := newUnstructured("v1", "ConfigMap", "default", "moved")
+	movedConfigMap.SetOwnerReferences(sourceOwner)
+	staleConfigMap := newUnstructured("v1", "ConfigMap", "default", "stale")
+	staleConfigMap.SetOwnerReferences(sourceOwner)
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workapi.AddToScheme(scheme))
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(sourceWork, targetWork).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(source, target).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), movedConfigMap, staleConfigMap)
+	r := newWorkStatusReconciler(hubClient, spokeClient, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "cluster-a", Name: "source"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	got, err := dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "moved", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the moved config map: %v", err)
+	}
+	if owners := got.GetOwnerReferences(); len(owners) != 1 || owners[0].UID != target.UID {
+		t.Errorf("moved config map owner references = %+v, want only the target appliedWork", owners)
+	}
+	if _, err := dynamicClient.Resource(gvr).Namespace("default").Get(ctx, "stale", metav1.GetOptions{}); err == nil {
+		t.Errorf("the stale config map is not deleted")
+	}
+
+	gotTarget := &workapi.AppliedWork{}
+	if err := spokeClient.Get(ctx, types.NamespacedName{Name: target.Name}, gotTarget); err != nil {
+		t.Fatalf("failed to get the target appliedWork: %v", err)
+	}
+	if len(gotTarget.Status.AppliedResources) != 1 || gotTarget.Status.AppliedResources[0].UID != "moved-uid" ||
+		gotTarget.Status.AppliedResources[0].ObservedGeneration != 3 {
+		t.Errorf("target appliedWork resources = %+v, want the moved config map with its UID and generation", gotTarget.Status.AppliedResources)
+	}
+	if gotTarget.Status.AppliedResourceCount != 1 || gotTarget.Status.LastReconcileTime == nil {
+		t.Errorf("target appliedWork summary = %d resources at %v, want 1 resource with a reconcile time",
+			gotTarget.Status.AppliedResourceCount, gotTarget.Status.LastReconcileTime)
+	}
+	gotSource := &workapi.AppliedWork{}
+	if err := spokeClient.Get(ctx, types.NamespacedName{Name: source.Name}, gotSource); err != nil {
+		t.Fatalf("failed to get the source appliedWork: %v", err)
+	}
+	if len(gotSource.Status.AppliedResources) != 0 {
+		t.Errorf("source appliedWork resources = %+v, want none", gotSource.Status.AppliedResources)
+	}
+	if gotSource.Status.AppliedResourceCount != 0 || gotSource.Status.LastReconcileTime == nil {
+		t.Errorf("source appliedWork summary = %d resources at %v, want no resource with a reconcile time",
+			gotSource.Status.AppliedResourceCount, gotSource.Status.LastReconcileTime)
+	}
+}
+
+func TestWorkStatusReconcilerTracksDeletingResources(t *testing.T) {
+	stale := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "stale"}
+	nsWorkName := types.NamespacedName{Namespace: "cluster-a", Name: "work"}
+	appliedWork := &workapi.AppliedWork{
+		ObjectMeta: metav1.ObjectMeta{Name: appliedWorkName(nsWorkName.Namespace, nsWorkName.Name), UID: "applied-work-uid"},
+		Spec:       workapi.AppliedWorkSpec{WorkNamespace: nsWorkName.Namespace, WorkName: nsWorkName.Name},
+		Status:     workapi.AppliedtWorkStatus{AppliedResources: []workapi.AppliedResourceMeta{{ResourceIdentifier: stale}}},
+	}
+	configMap := newUnstructured("v1", "ConfigMap", "default", "stale")
+	configMap.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: workapi.GroupVersion.String(), Kind: "AppliedWork", Name: appliedWork.Name, UID: appliedWork.UID,
+	}})
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workapi.AddToScheme(scheme))
+	work := &workapi.Work{ObjectMeta: metav1.ObjectMeta{Namespace: nsWorkName.Namespace, Name: nsWorkName.Name}}
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	spokeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appliedWork).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	// the config map has a finalizer that holds its deletion until we let it go
+	finalizing := true
+	dynamicClient.PrependReactor("delete", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		return finalizing, nil, nil
+	})
+	r := newWorkStatusReconciler(hubClient, spokeClient, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+	ctx := context.Background()
+
+	got, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName})
+	if err != nil || got.RequeueAfter == 0 {
+		t.Fatalf("Reconcile() = %+v, %v, want a requeue while the stale config map is deleted", got, err)
+	}
+	gotWork := &workapi.Work{}
+	if err := hubClient.Get(ctx, nsWorkName, gotWork); err != nil {
+		t.Fatalf("failed to get the work: %v", err)
+	}
+	if len(gotWork.Status.DeletingResources) != 1 || gotWork.Status.DeletingResources[0].Name != "stale" {
+		t.Errorf("work deleting resources = %+v, want the stale config map", gotWork.Status.DeletingResources)
+	}
+	if !meta.IsStatusConditionTrue(gotWork.Status.Conditions, ConditionTypeDeleting) {
+		t.Errorf("work conditions = %+v, want the deleting condition true", gotWork.Status.Conditions)
+	}
+
+	finalizing = false
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if err := dynamicClient.Resource(gvr).Namespace("default").Delete(ctx, "stale", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to finish the deletion of the stale config map: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: nsWorkName}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := hubClient.Get(ctx, nsWorkName, gotWork); err != nil {
+		t.Fatalf("failed to get the work: %v", err)
+	}
+	if len(gotWork.Status.DeletingResources) != 0 || meta.FindStatusCondition(gotWork.Status.Conditions, ConditionTypeDeleting) != nil {
+		t.Errorf("work status = %+v, want no deleting resources once the stale config map is gone", gotWork.Status)
+	}
+}
+
+func TestSyncDeletingResourcesAddedBack(t *testing.T) {
+	stale := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "stale"}
+	gone := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "gone"}
+	held := workapi.ResourceIdentifier{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespace: "default", Name: "held"}
+	work := &workapi.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+		Status: workapi.WorkStatus{
+			// the stale config map was added back to the work and applied again after we deleted it
+			DeletingResources: []workapi.ResourceIdentifier{stale, gone, held},
+			ManifestConditions: []workapi.ManifestCondition{{
+				Identifier: stale,
+				Conditions: []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionTrue, Reason: "Applied"}},
+			}},
+		},
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workapi.AddToScheme(scheme))
+	hubClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(work).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(),
+		newUnstructured("v1", "ConfigMap", "default", "stale"), newUnstructured("v1", "ConfigMap", "default", "held"))
+	r := newWorkStatusReconciler(hubClient, nil, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+
+	deleting, err := r.syncDeletingResources(context.Background(), work, nil)
+	if err != nil || !deleting {
+		t.Fatalf("syncDeletingResources() = %t, %v, want the held config map still being deleted", deleting, err)
+	}
+	if !reflect.DeepEqual(work.Status.DeletingResources, []workapi.ResourceIdentifier{held}) {
+		t.Errorf("work deleting resources = %+v, want only the held config map", work.Status.DeletingResources)
+	}
+}
+
+func TestSyncAvailabilityWorkloadRef(t *testing.T) {
+	first := newUnstructured("v1", "ConfigMap", "default", "first")
+	// the referenced manifests are split into three documents, the health check of the last one moves to ordinal 3
+	manifests := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "manifests"},
+		Data: map[string]string{
+			"a.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: second\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: third\n",
+			"b.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: fourth\n",
+		},
+	}
+	appliedCondition := []metav1.Condition{{Type: ConditionTypeApplied, Status: metav1.ConditionTrue, Reason: "Applied"}}
+	work := &workapi.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+		Spec: workapi.WorkSpec{
+			Workload: workapi.WorkloadTemplate{
+				Manifests:    []workapi.Manifest{newTestManifest(t, first)},
+				HealthChecks: []workapi.ManifestHealthCheck{{Ordinal: 2, Expression: `object.data.ready == "true"`}},
+			},
+			WorkloadRef: &workapi.WorkloadReference{Kind: "ConfigMap", Name: "manifests"},
+		},
+		Status: workapi.WorkStatus{ManifestConditions: []workapi.ManifestCondition{
+			{
+				Identifier: workapi.ResourceIdentifier{Ordinal: 2, Version: "v1", Kind: "ConfigMap", Resource: "configmaps",
+					Namespace: "default", Name: "third"},
+				Conditions: appliedCondition,
+			},
+			{
+				Identifier: workapi.ResourceIdentifier{Ordinal: 3, Version: "v1", Kind: "ConfigMap", Resource: "configmaps",
+					Namespace: "default", Name: "fourth"},
+				Conditions: appliedCondition,
+			},
+		}},
+	}
+	third := newUnstructured("v1", "ConfigMap", "default", "third")
+	third.Object["data"] = map[string]interface{}{"ready": "false"}
+	fourth := newUnstructured("v1", "ConfigMap", "default", "fourth")
+	fourth.Object["data"] = map[string]interface{}{"ready": "false"}
+	hubClient := fake.NewClientBuilder().WithScheme(newWorkloadRefScheme()).WithObjects(work, manifests).Build()
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), third, fourth)
+	r := newWorkStatusReconciler(hubClient, nil, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+
+	available, err := r.syncAvailability(context.Background(), work)
+	if err != nil || available {
+		t.Fatalf("syncAvailability() = %t, %v, want the work not available", available, err)
+	}
+	if !meta.IsStatusConditionTrue(work.Status.ManifestConditions[0].Conditions, ConditionTypeAvailable) {
+		t.Errorf("third config map conditions = %+v, want it available without a health check", work.Status.ManifestConditions[0].Conditions)
+	}
+	if !meta.IsStatusConditionFalse(work.Status.ManifestConditions[1].Conditions, ConditionTypeAvailable) {
+		t.Errorf("fourth config map conditions = %+v, want it not available with its health check", work.Status.ManifestConditions[1].Conditions)
+	}
+}
+
+func TestDeleteStaleWorkPropagation(t *testing.T) {
+	stale := workapi.ResourceIdentifier{Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments",
+		Namespace: "default", Name: "web"}
+	appliedWork := &workapi.AppliedWork{ObjectMeta: metav1.ObjectMeta{Name: "cluster-a.work", UID: "applied-work-uid"}}
+	tests := map[workapi.StaleDeletePropagationType]metav1.DeletionPropagation{
+		"":                                       metav1.DeletePropagationBackground,
+		workapi.StaleDeletePropagationBackground: metav1.DeletePropagationBackground,
+		workapi.StaleDeletePropagationForeground: metav1.DeletePropagationForeground,
+	}
+	for propagation, want := range tests {
+		t.Run(string(propagation), func(t *testing.T) {
+			deployment := newUnstructured("apps/v1", "Deployment", "default", "web")
+			deployment.SetOwnerReferences([]metav1.OwnerReference{{
+				APIVersion: workapi.GroupVersion.String(), Kind: "AppliedWork", Name: appliedWork.Name, UID: appliedWork.UID,
+			}})
+			dynamicClient := &deleteOptionsRecorder{Interface: fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), deployment)}
+			r := newWorkStatusReconciler(nil, nil, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+			work := &workapi.Work{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+				Spec:       workapi.WorkSpec{StaleDeletePropagation: propagation},
+			}
+
+			deleted, err := r.deleteStaleWork(context.Background(), work, appliedWork,
+				[]workapi.AppliedResourceMeta{{ResourceIdentifier: stale}})
+			if err != nil || len(deleted) != 1 {
+				t.Fatalf("deleteStaleWork() = %v, %v, want the stale deployment deleted", deleted, err)
+			}
+			if got := dynamicClient.opts.PropagationPolicy; got == nil || *got != want {
+				t.Errorf("deleteStaleWork() propagation = %v, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDeleteStaleWorkMetrics(t *testing.T) {
+	appliedWork := &workapi.AppliedWork{ObjectMeta: metav1.ObjectMeta{Name: "cluster-a.work", UID: "applied-work-uid"}}
+	owner := metav1.OwnerReference{APIVersion: workapi.GroupVersion.String(), Kind: "AppliedWork", Name: appliedWork.Name, UID: appliedWork.UID}
+	widget := newUnstructured("metrics.test/v1", "Widget", "default", "widget")
+	widget.SetOwnerReferences([]metav1.OwnerReference{owner})
+	gadget := newUnstructured("metrics.test/v1", "Gadget", "default", "gadget")
+	gadget.SetOwnerReferences([]metav1.OwnerReference{owner})
+	dynamicClient := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme(), widget, gadget)
+	// the gadgets can't be deleted
+	dynamicClient.PrependReactor("delete", "gadgets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "metrics.test", Resource: "gadgets"}, "gadget", fmt.Errorf("denied"))
+	})
+	r := newWorkStatusReconciler(nil, nil, dynamicClient, newTestRESTMapper(), record.NewFakeRecorder(10), nil, PruneLimit{}, 0)
+	work := &workapi.Work{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"}}
+
+	deletedCounter := staleResourcesDeleted.WithLabelValues("metrics.test", "v1", "Widget")
+	failureCounter := staleResourceDeleteFailures.WithLabelValues("metrics.test", "v1", "Gadget")
+	deletedBefore, failuresBefore := testutil.ToFloat64(deletedCounter), testutil.ToFloat64(failureCounter)
+	_, err := r.deleteStaleWork(context.Background(), work, appliedWork, []workapi.AppliedResourceMeta{
+		{ResourceIdentifier: workapi.ResourceIdentifier{Group: "metrics.test", Version: "v1", Kind: "Widget", Resource: "widgets",
+			Namespace: "default", Name: "widget"}},
+		{ResourceIdentifier: workapi.ResourceIdentifier{Group: "metrics.test", Version: "v1", Kind: "Gadget", Resource: "gadgets",
+			Namespace: "default", Name: "gadget"}},
+	})
+	if err == nil {
+		t.Fatalf("deleteStaleWork() succeeded, want the gadget failing")
+	}
+	if got := testutil.ToFloat64(deletedCounter) - deletedBefore; got != 1 {
+		t.Errorf("work_api_stale_resources_deleted_total{kind=Widget} increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(failureCounter) - failuresBefore; got != 1 {
+		t.Errorf("work_api_stale_resource_delete_failures_total{kind=Gadget} increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(staleResourcesDeleted.WithLabelValues("metrics.test", "v1", "Gadget")); got != 0 {
+		t.Errorf("work_api_stale_resources_deleted_total{kind=Gadget} = %v, want the failed gadget not counted", got)
+	}
+}
+
+// deleteOptionsRecorder records the options of the last delete, the fake dynamic client drops them.
+type deleteOptionsRecorder struct {
+	dynamic.Interface
+	opts metav1.DeleteOptions
+}
+
+func (r *deleteOptionsRecorder) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &deleteOptionsRecordingResource{NamespaceableResourceInterface: r.Interface.Resource(gvr), recorder: r}
+}
+
+type deleteOptionsRecordingResource struct {
+	dynamic.NamespaceableResourceInterface
+	recorder *deleteOptionsRecorder
+}
+
+func (r *deleteOptionsRecordingResource) Namespace(ns string) dynamic.ResourceInterface {
+	return &deleteOptionsRecordingNamespacedResource{ResourceInterface: r.NamespaceableResourceInterface.Namespace(ns), recorder: r.recorder}
+}
+
+type deleteOptionsRecordingNamespacedResource struct {
+	dynamic.ResourceInterface
+	recorder *deleteOptionsRecorder
+}
+
+func (r *deleteOptionsRecordingNamespacedResource) Delete(ctx context.Context, name string, opts metav1.DeleteOptions,
+	subresources ...string) error {
+	r.recorder.opts = opts
+	return r.ResourceInterface.Delete(ctx, name, opts, subresources...)
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+var _ = Describe("Work Status Controller", func() {
+	var workNamespace string
+	const timeout = time.Second * 30
+	const interval = time.Second * 1
+
+	BeforeEach(func() {
+		workNamespace = "work-" + utilrand.String(5)
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: workNamespace,
+			},
+		}
+		_, err := k8sClient.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := k8sClient.CoreV1().Namespaces().Delete(context.Background(), workNamespace, metav1.DeleteOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("Prune the resources removed from a work", func() {
+		It("Should delete the configmap whose manifest is removed", func() {
+			configMap := func(name string) workv1alpha1.Manifest {
+				return workv1alpha1.Manifest{
+					RawExtension: runtime.RawExtension{Object: &corev1.ConfigMap{
+						TypeMeta: metav1.TypeMeta{
+							APIVersion: "v1",
+							Kind:       "ConfigMap",
+						},
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      name,
+							Namespace: workNamespace,
+						},
+						Data: map[string]string{
+							"test": name,
+						},
+					}},
+				}
+			}
+			keptName, prunedName := "kept-cm", "pruned-cm"
+
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "prune-work",
+					Namespace: workNamespace,
+				},
+				Spec: workv1alpha1.WorkSpec{
+					Workload: workv1alpha1.WorkloadTemplate{
+						Manifests: []workv1alpha1.Manifest{configMap(keptName), configMap(prunedName)},
+					},
+				},
+			}
+			_, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			By("waiting for both configmaps to be applied")
+			Eventually(func() error {
+				resultWork, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				if !meta.IsStatusConditionTrue(resultWork.Status.Conditions, ConditionTypeApplied) {
+					return fmt.Errorf("expect the work to be applied")
+				}
+				for _, name := range []string{keptName, prunedName} {
+					if _, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), name, metav1.GetOptions{}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}, timeout, interval).Should(Succeed())
+
+			By("removing the second configmap from the work")
+			Eventually(func() error {
+				resultWork, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				resultWork.Spec.Workload.Manifests = []workv1alpha1.Manifest{configMap(keptName)}
+				_, err = workClient.MulticlusterV1alpha1().Works(workNamespace).Update(context.Background(), resultWork, metav1.UpdateOptions{})
+				return err
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() error {
+				_, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), prunedName, metav1.GetOptions{})
+				if apierrors.IsNotFound(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				return fmt.Errorf("expect the configmap %s to be deleted", prunedName)
+			}, timeout, interval).Should(Succeed())
+
+			_, err = k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), keptName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("Delete the resources of a deleted work", func() {
+		It("Should delete a configmap in another namespace without the garbage collector", func() {
+			// envtest runs no garbage collector, only the finalizer of the work can delete the configmap
+			resourceNamespace := "resource-" + utilrand.String(5)
+			_, err := k8sClient.CoreV1().Namespaces().Create(context.Background(),
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: resourceNamespace}}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer func() {
+				Expect(k8sClient.CoreV1().Namespaces().Delete(context.Background(), resourceNamespace, metav1.DeleteOptions{})).To(Succeed())
+			}()
+
+			cmName := "cross-namespace-cm"
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cross-namespace-work",
+					Namespace: workNamespace,
+				},
+				Spec: workv1alpha1.WorkSpec{
+					Workload: workv1alpha1.WorkloadTemplate{
+						Manifests: []workv1alpha1.Manifest{{
+							RawExtension: runtime.RawExtension{Object: &corev1.ConfigMap{
+								TypeMeta: metav1.TypeMeta{
+									APIVersion: "v1",
+									Kind:       "ConfigMap",
+								},
+								ObjectMeta: metav1.ObjectMeta{
+									Name:      cmName,
+									Namespace: resourceNamespace,
+								},
+								Data: map[string]string{
+									"test": "cross-namespace",
+								},
+							}},
+						}},
+					},
+				},
+			}
+			_, err = workClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			By("waiting for the configmap to be applied")
+			Eventually(func() error {
+				_, err := k8sClient.CoreV1().ConfigMaps(resourceNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				return err
+			}, timeout, interval).Should(Succeed())
+
+			By("deleting the work")
+			err = workClient.MulticlusterV1alpha1().Works(workNamespace).Delete(context.Background(), work.Name, metav1.DeleteOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() bool {
+				_, err := k8sClient.CoreV1().ConfigMaps(resourceNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+			Eventually(func() bool {
+				_, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("Release the resources shared by deleted works", func() {
+		It("Should only remove the owner reference of the deleted work", func() {
+			cmName := "shared-cm"
+			newWork := func(name string, adopt bool) *workv1alpha1.Work {
+				return &workv1alpha1.Work{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: workNamespace,
+					},
+					Spec: workv1alpha1.WorkSpec{
+						AdoptExisting: adopt,
+						Workload: workv1alpha1.WorkloadTemplate{
+							Manifests: []workv1alpha1.Manifest{{
+								RawExtension: runtime.RawExtension{Object: &corev1.ConfigMap{
+									TypeMeta: metav1.TypeMeta{
+										APIVersion: "v1",
+										Kind:       "ConfigMap",
+									},
+									ObjectMeta: metav1.ObjectMeta{
+										Name:      cmName,
+										Namespace: workNamespace,
+									},
+									Data: map[string]string{
+										"test": "shared",
+									},
+								}},
+							}},
+						},
+					},
+				}
+			}
+			// the second work adopts the configmap the first work applied
+			first, second := newWork("first-work", false), newWork("second-work", true)
+			appliedWorkUID := func(work *workv1alpha1.Work) types.UID {
+				appliedWork, err := workClient.MulticlusterV1alpha1().AppliedWorks().Get(context.Background(),
+					appliedWorkName(work.Namespace, work.Name), metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				return appliedWork.UID
+			}
+			ownerUIDs := func() ([]types.UID, error) {
+				cm, err := k8sClient.CoreV1().ConfigMaps(workNamespace).Get(context.Background(), cmName, metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+				var uids []types.UID
+				for _, owner := range cm.OwnerReferences {
+					uids = append(uids, owner.UID)
+				}
+				return uids, nil
+			}
+
+			By("applying the configmap with both works")
+			for _, work := range []*workv1alpha1.Work{first, second} {
+				_, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() error {
+					resultWork, err := workClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+					if err != nil {
+						return err
+					}
+					if !meta.IsStatusConditionTrue(resultWork.Status.Conditions, ConditionTypeApplied) {
+						return fmt.Errorf("expect the work %s to be applied", work.Name)
+					}
+					return nil
+				}, timeout, interval).Should(Succeed())
+			}
+			firstUID, secondUID := appliedWorkUID(first), appliedWorkUID(second)
+			Eventually(ownerUIDs, timeout, interval).Should(ConsistOf(firstUID, secondUID))
+
+			By("deleting the first work")
+			err := workClient.MulticlusterV1alpha1().Works(workNamespace).Delete(context.Background(), first.Name, metav1.DeleteOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(ownerUIDs, timeout, interval).Should(ConsistOf(secondUID))
+
+			By("deleting the second work")
+			err = workClient.MulticlusterV1alpha1().Works(workNamespace).Delete(context.Background(), second.Name, metav1.DeleteOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() bool {
+				_, err := ownerUIDs()
+				return apierrors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// The kinds a work can reference its workload from.
+const (
+	workloadRefKindConfigMap = "ConfigMap"
+	workloadRefKindSecret    = "Secret"
+)
+
+// resolveWorkload returns the workload of the work with the manifests of its workload reference appended,
+// a manifest per key of the referenced object in the order of the keys.
+func resolveWorkload(ctx context.Context, hubClient client.Client, work *workv1alpha1.Work) (workv1alpha1.WorkloadTemplate, error) {
+	workload := *work.Spec.Workload.DeepCopy()
+	ref := work.Spec.WorkloadRef
+	if ref == nil {
+		return workload, nil
+	}
+	data, err := workloadRefData(ctx, hubClient, work.Namespace, ref)
+	if err != nil {
+		return workload, err
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		workload.Manifests = append(workload.Manifests, workv1alpha1.Manifest{RawExtension: runtime.RawExtension{Raw: data[key]}})
+	}
+	return workload, nil
+}
+
+// workloadRefData returns the data of the object a workload reference points to, by key.
+func workloadRefData(ctx context.Context, hubClient client.Client, namespace string,
+	ref *workv1alpha1.WorkloadReference) (map[string][]byte, error) {
+	key := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+	switch ref.Kind {
+	case workloadRefKindConfigMap:
+		configMap := &corev1.ConfigMap{}
+		if err := hubClient.Get(ctx, key, configMap); err != nil {
+			return nil, err
+		}
+		data := make(map[string][]byte, len(configMap.Data)+len(configMap.BinaryData))
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range configMap.BinaryData {
+			data[k] = v
+		}
+		return data, nil
+	case workloadRefKindSecret:
+		secret := &corev1.Secret{}
+		if err := hubClient.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		return secret.Data, nil
+	default:
+		return nil, fmt.Errorf("the workload can't be referenced from a %s, only from a ConfigMap or a Secret", ref.Kind)
+	}
+}
+
+// markWorkloadRefFailed reports on the work that we can't read the object its workload reference points to.
+// Nothing is applied until we can, so that the work isn't applied without part of its manifests.
+func (r *ApplyWorkReconciler) markWorkloadRefFailed(ctx context.Context, work *workv1alpha1.Work, err error) error {
+	reason := ReasonWorkloadRefFailed
+	if apierrors.IsNotFound(err) {
+		// the watch on the referenced kind brings the work back once the object is created
+		reason = ReasonWorkloadRefNotFound
+	}
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:               ConditionTypeApplied,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: work.Generation,
+		Reason:             reason,
+		Message: fmt.Sprintf("Failed to read the workload of the work from %s %s: %v",
+			work.Spec.WorkloadRef.Kind, work.Spec.WorkloadRef.Name, err),
+	})
+	if updateErr := r.client.Status().Update(ctx, work, &client.UpdateOptions{}); updateErr != nil {
+		klog.ErrorS(updateErr, "update work status failed", workKeys(work.Namespace, work.Name)...)
+		return updateErr
+	}
+	return nil
+}
+
+// worksReferencing returns a function that maps an object of the kind to the works in its namespace
+// whose workload reference points to it, so that they are applied again when it changes.
+func (r *ApplyWorkReconciler) worksReferencing(kind string) func(client.Object) []reconcile.Request {
+	return func(obj client.Object) []reconcile.Request {
+		works := &workv1alpha1.WorkList{}
+		if err := r.client.List(context.Background(), works, client.InNamespace(obj.GetNamespace())); err != nil {
+			klog.ErrorS(err, "failed to list the works referencing an object", "kind", kind, "object", klog.KObj(obj))
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range works.Items {
+			work := &works.Items[i]
+			ref := work.Spec.WorkloadRef
+			if ref == nil || ref.Kind != kind || ref.Name != obj.GetName() {
+				continue
+			}
+			// the works of the other spoke clusters are applied by their own controllers
+			if r.workFilter == nil || r.workFilter.Generic(event.GenericEvent{Object: work}) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: work.Namespace, Name: work.Name}})
+			}
+		}
+		return requests
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func newWorkloadRefScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	return scheme
+}
+
+func TestResolveWorkload(t *testing.T) {
+	inline := newTestManifest(t, newUnstructured("v1", "Namespace", "", "app"))
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "manifests"},
+		Data: map[string]string{
+			"b-service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+			"a-config.yaml":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\n",
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "manifests"},
+		Data:       map[string][]byte{"secret.json": []byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"web"}}`)},
+	}
+	hubClient := fake.NewClientBuilder().WithScheme(newWorkloadRefScheme()).WithObjects(configMap, secret).Build()
+
+	tests := map[string]struct {
+		ref          *workv1alpha1.WorkloadReference
+		wantNames    []string
+		wantNotFound bool
+	}{
+		"no reference": {
+			wantNames: []string{"Namespace/app"},
+		},
+		"the keys of a config map are appended in order": {
+			ref:       &workv1alpha1.WorkloadReference{Kind: "ConfigMap", Name: "manifests"},
+			wantNames: []string{"Namespace/app", "ConfigMap/web", "Service/web"},
+		},
+		"the keys of a secret are appended": {
+			ref:       &workv1alpha1.WorkloadReference{Kind: "Secret", Name: "manifests"},
+			wantNames: []string{"Namespace/app", "Secret/web"},
+		},
+		"a missing object": {
+			ref:          &workv1alpha1.WorkloadReference{Kind: "ConfigMap", Name: "missing"},
+			wantNotFound: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			work := &workv1alpha1.Work{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+				Spec: workv1alpha1.WorkSpec{
+					Workload:    workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{inline}},
+					WorkloadRef: tt.ref,
+				},
+			}
+			workload, err := resolveWorkload(context.Background(), hubClient, work)
+			if tt.wantNotFound {
+				if !errors.IsNotFound(err) {
+					t.Errorf("resolveWorkload() error = %v, want not found", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveWorkload() error = %v", err)
+			}
+			var names []string
+			for i := range workload.Manifests {
+				obj, err := workload.Manifests[i].AsUnstructured()
+				if err != nil {
+					t.Fatalf("failed to decode manifest %d: %v", i, err)
+				}
+				names = append(names, obj.GetKind()+"/"+obj.GetName())
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("resolveWorkload() manifests = %v, want %v", names, tt.wantNames)
+			}
+			if len(work.Spec.Workload.Manifests) != 1 {
+				t.Errorf("resolveWorkload() changed the workload of the work: %d manifests", len(work.Spec.Workload.Manifests))
+			}
+		})
+	}
+}
+
+func TestWorksReferencing(t *testing.T) {
+	newWork := func(name, targetCluster string, ref *workv1alpha1.WorkloadReference) *workv1alpha1.Work {
+		return &workv1alpha1.Work{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: name},
+			Spec:       workv1alpha1.WorkSpec{TargetCluster: targetCluster, WorkloadRef: ref},
+		}
+	}
+	hubClient := fake.NewClientBuilder().WithScheme(newWorkloadRefScheme()).WithObjects(
+		newWork("referencing", "", &workv1alpha1.WorkloadReference{Kind: "ConfigMap", Name: "manifests"}),
+		newWork("other-spoke", "spoke-b", &workv1alpha1.WorkloadReference{Kind: "ConfigMap", Name: "manifests"}),
+		newWork("secret", "", &workv1alpha1.WorkloadReference{Kind: "Secret", Name: "manifests"}),
+		newWork("inline", "", nil),
+	).Build()
+	r := &ApplyWorkReconciler{
+		client: hubClient,
+		workFilter: predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.(*workv1alpha1.Work).Spec.TargetCluster == ""
+		}),
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "manifests"}}
+	got := r.worksReferencing(workloadRefKindConfigMap)(configMap)
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "cluster-a", Name: "referencing"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("worksReferencing() = %v, want %v", got, want)
+	}
+}
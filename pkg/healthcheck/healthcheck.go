@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthcheck evaluates the CEL expressions that tell if the live object of a manifest is healthy,
+// for the kinds whose availability the controllers can't tell by themselves.
+package healthcheck
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ObjectVariable is the name the live object is bound to in the expressions, e.g. `object.status.phase == "Ready"`.
+const ObjectVariable = "object"
+
+// Check is a compiled health check expression.
+type Check struct {
+	expression string
+	program    cel.Program
+}
+
+// Compile parses and type checks a health check expression, it must evaluate to a bool.
+func Compile(expression string) (*Check, error) {
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar(ObjectVariable, decls.NewMapType(decls.String, decls.Dyn))))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid health check expression: %w", issues.Err())
+	}
+	// the fields of the object are dynamic so the type of most expressions is only known once they are evaluated
+	if resultType := ast.ResultType(); !proto.Equal(resultType, decls.Bool) && !proto.Equal(resultType, decls.Dyn) {
+		return nil, fmt.Errorf("the health check expression must evaluate to a bool, not %v", resultType)
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check expression: %w", err)
+	}
+	return &Check{expression: expression, program: program}, nil
+}
+
+// Evaluate runs the check against the live object, it returns an error if the expression doesn't evaluate to a bool,
+// e.g. because it reads a field the object doesn't have yet.
+func (c *Check) Evaluate(obj *unstructured.Unstructured) (bool, error) {
+	out, _, err := c.program.Eval(map[string]interface{}{ObjectVariable: obj.Object})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate the health check %q: %w", c.expression, err)
+	}
+	healthy, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("the health check %q evaluated to %v instead of a bool", c.expression, out.Value())
+	}
+	return healthy, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthcheck
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCompile(t *testing.T) {
+	tests := map[string]struct {
+		expression string
+		wantErr    bool
+	}{
+		"field comparison": {
+			expression: `object.status.phase == "Ready"`,
+		},
+		"presence check": {
+			expression: `has(object.status) && object.status.replicas >= 1`,
+		},
+		"syntax error": {
+			expression: `object.status.phase ==`,
+			wantErr:    true,
+		},
+		"unknown variable": {
+			expression: `obj.status.phase == "Ready"`,
+			wantErr:    true,
+		},
+		"not a bool": {
+			expression: `"Ready"`,
+			wantErr:    true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Compile(tt.expression); (err != nil) != tt.wantErr {
+				t.Errorf("Compile(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Database",
+		"status": map[string]interface{}{
+			"phase":    "Ready",
+			"replicas": int64(2),
+		},
+	}}
+	tests := map[string]struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		"healthy": {
+			expression: `object.status.phase == "Ready" && object.status.replicas >= 2`,
+			want:       true,
+		},
+		"unhealthy": {
+			expression: `object.status.phase == "Failed"`,
+		},
+		"missing field": {
+			expression: `object.spec.size > 1`,
+			wantErr:    true,
+		},
+		"not a bool at runtime": {
+			expression: `object.status.phase`,
+			wantErr:    true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			check, err := Compile(tt.expression)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.expression, err)
+			}
+			got, err := check.Evaluate(obj)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package overlay applies the RFC 6902 JSON patches of the overlays of a work to its manifests, so that a work
+// distributed to several spoke clusters can be tweaked for some of them.
+package overlay
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// Validate checks that the operations form a JSON patch, without applying it.
+func Validate(patch []workv1alpha1.JSONPatchOperation) error {
+	for i, op := range patch {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return fmt.Errorf("operation %d: %s needs a value", i, op.Op)
+			}
+		case "move", "copy":
+			if len(op.From) == 0 {
+				return fmt.Errorf("operation %d: %s needs a from path", i, op.Op)
+			}
+		case "remove":
+		default:
+			return fmt.Errorf("operation %d: unknown operation %q", i, op.Op)
+		}
+	}
+	_, err := decode(patch)
+	return err
+}
+
+// Apply applies the operations to the object in place. The object is left untouched if any of them fails, and the
+// patch can't change the apiVersion or the kind of the object.
+func Apply(obj *unstructured.Unstructured, patch []workv1alpha1.JSONPatchOperation) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	decoded, err := decode(patch)
+	if err != nil {
+		return err
+	}
+	doc, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	patched, err := decoded.Apply(doc)
+	if err != nil {
+		return fmt.Errorf("failed to apply the overlay: %w", err)
+	}
+	patchedObj := &unstructured.Unstructured{}
+	if err := patchedObj.UnmarshalJSON(patched); err != nil {
+		return fmt.Errorf("the overlay doesn't leave a valid object: %w", err)
+	}
+	if patchedObj.GroupVersionKind() != obj.GroupVersionKind() {
+		return fmt.Errorf("the overlay can't change the kind of the manifest from %s to %s",
+			obj.GroupVersionKind(), patchedObj.GroupVersionKind())
+	}
+	obj.Object = patchedObj.Object
+	return nil
+}
+
+func decode(patch []workv1alpha1.JSONPatchOperation) (jsonpatch.Patch, error) {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := jsonpatch.DecodePatch(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	return decoded, nil
+}
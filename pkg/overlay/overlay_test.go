@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overlay
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func value(raw string) *runtime.RawExtension {
+	return &runtime.RawExtension{Raw: []byte(raw)}
+}
+
+func newDeployment() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "nginx:1.14.2"},
+			}}},
+		},
+	}}
+}
+
+func TestApply(t *testing.T) {
+	tests := map[string]struct {
+		patch        []workv1alpha1.JSONPatchOperation
+		wantReplicas int64
+		wantImage    string
+		wantErr      bool
+	}{
+		"scale the deployment": {
+			patch:        []workv1alpha1.JSONPatchOperation{{Op: "replace", Path: "/spec/replicas", Value: value("5")}},
+			wantReplicas: 5,
+			wantImage:    "nginx:1.14.2",
+		},
+		"scale and bump the image tag": {
+			patch: []workv1alpha1.JSONPatchOperation{
+				{Op: "test", Path: "/spec/replicas", Value: value("2")},
+				{Op: "replace", Path: "/spec/replicas", Value: value("1")},
+				{Op: "replace", Path: "/spec/template/spec/containers/0/image", Value: value(`"nginx:1.21"`)},
+			},
+			wantReplicas: 1,
+			wantImage:    "nginx:1.21",
+		},
+		"a failed test leaves the deployment alone": {
+			patch: []workv1alpha1.JSONPatchOperation{
+				{Op: "replace", Path: "/spec/replicas", Value: value("1")},
+				{Op: "test", Path: "/spec/replicas", Value: value("3")},
+			},
+			wantErr: true,
+		},
+		"a missing field": {
+			patch:   []workv1alpha1.JSONPatchOperation{{Op: "replace", Path: "/spec/paused/value", Value: value("true")}},
+			wantErr: true,
+		},
+		"a kind change": {
+			patch:   []workv1alpha1.JSONPatchOperation{{Op: "replace", Path: "/kind", Value: value(`"StatefulSet"`)}},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			obj := newDeployment()
+			err := Apply(obj, tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if replicas, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); replicas != 2 || obj.GetKind() != "Deployment" {
+					t.Errorf("Apply() changed the deployment although it failed: %v", obj.Object)
+				}
+				return
+			}
+			if replicas, _, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas"); replicas != tt.wantReplicas {
+				t.Errorf("Apply() replicas = %d, want %d", replicas, tt.wantReplicas)
+			}
+			containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+			if image := containers[0].(map[string]interface{})["image"]; image != tt.wantImage {
+				t.Errorf("Apply() image = %v, want %s", image, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		patch   []workv1alpha1.JSONPatchOperation
+		wantErr bool
+	}{
+		"replace": {
+			patch: []workv1alpha1.JSONPatchOperation{{Op: "replace", Path: "/spec/replicas", Value: value("3")}},
+		},
+		"remove": {
+			patch: []workv1alpha1.JSONPatchOperation{{Op: "remove", Path: "/spec/replicas"}},
+		},
+		"replace without a value": {
+			patch:   []workv1alpha1.JSONPatchOperation{{Op: "replace", Path: "/spec/replicas"}},
+			wantErr: true,
+		},
+		"copy without a from path": {
+			patch:   []workv1alpha1.JSONPatchOperation{{Op: "copy", Path: "/spec/replicas"}},
+			wantErr: true,
+		},
+		"unknown operation": {
+			patch:   []workv1alpha1.JSONPatchOperation{{Op: "merge", Path: "/spec"}},
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := Validate(tt.patch); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+// DefaultWorkPath is the path the work mutating webhook is served at.
+const DefaultWorkPath = "/mutate-multicluster-x-k8s-io-v1alpha1-work"
+
+// WorkDefaulter sets the namespace of the namespaced manifests that don't have one, so that the work says where they
+// land on the spoke cluster. The manifests whose kind the rest mapper doesn't know are left as they are.
+type WorkDefaulter struct {
+	decoder    *admission.Decoder
+	restMapper meta.RESTMapper
+	// defaultNamespace is the namespace the manifests get, empty means the namespace of their work
+	defaultNamespace string
+}
+
+var _ admission.Handler = &WorkDefaulter{}
+var _ admission.DecoderInjector = &WorkDefaulter{}
+
+// Handle defaults the namespaces of the manifests of the work of a create or update request.
+func (d *WorkDefaulter) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	work := &workv1alpha1.Work{}
+	if err := d.decoder.Decode(req, work); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	namespace := d.defaultNamespace
+	if len(namespace) == 0 {
+		// the namespace of a created work may only be in the request
+		namespace = req.Namespace
+	}
+	if len(namespace) == 0 || !d.defaultNamespaces(work.Spec.Workload.Manifests, namespace) {
+		return admission.Allowed("")
+	}
+	raw, err := json.Marshal(work)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	klog.V(3).InfoS("defaulted the namespace of the manifests", "work", req.Name, "namespace", req.Namespace, "manifestNamespace", namespace)
+	return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+}
+
+// InjectDecoder injects the decoder of the admission requests, it implements admission.DecoderInjector.
+func (d *WorkDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// defaultNamespaces sets the namespace of the namespaced manifests without one and returns true if any changed.
+// The manifests that can't be decoded are left for the validating webhook to reject.
+func (d *WorkDefaulter) defaultNamespaces(manifests []workv1alpha1.Manifest, namespace string) bool {
+	changed := false
+	for i := range manifests {
+		docs, err := manifests[i].Documents()
+		if err != nil {
+			continue
+		}
+		encoded := make([][]byte, 0, len(docs))
+		defaulted := false
+		for j := range docs {
+			obj, err := docs[j].AsUnstructured()
+			if err != nil {
+				break
+			}
+			if len(obj.GetNamespace()) == 0 && d.isNamespaced(obj.GroupVersionKind().GroupKind(), obj.GroupVersionKind().Version) {
+				obj.SetNamespace(namespace)
+				defaulted = true
+			}
+			raw, err := obj.MarshalJSON()
+			if err != nil {
+				break
+			}
+			encoded = append(encoded, raw)
+		}
+		if !defaulted || len(encoded) != len(docs) {
+			continue
+		}
+		raw := encoded[0]
+		if len(encoded) > 1 {
+			// a JSON document is a YAML document too, the stream is kept as a string since it isn't JSON as a whole
+			if raw, err = json.Marshal(string(bytes.Join(encoded, []byte("\n---\n")))); err != nil {
+				continue
+			}
+		}
+		manifests[i] = workv1alpha1.Manifest{RawExtension: runtime.RawExtension{Raw: raw}}
+		changed = true
+	}
+	return changed
+}
+
+// isNamespaced returns true if the rest mapper knows the kind and it is namespaced.
+func (d *WorkDefaulter) isNamespaced(gk schema.GroupKind, version string) bool {
+	mapping, err := d.restMapper.RESTMapping(gk, version)
+	if err != nil {
+		// the kind may only be served by the spoke cluster, the controller defaults its namespace when it applies it
+		klog.V(5).InfoS("can't tell the scope of a manifest kind", "kind", gk, "version", version, "err", err)
+		return false
+	}
+	return mapping.Scope != nil && mapping.Scope.Name() == meta.RESTScopeNameNamespace
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func newTestRESTMapper() meta.RESTMapper {
+	restMapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	return restMapper
+}
+
+func TestDefaultNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		manifest      string
+		wantChanged   bool
+		wantNamespace []string
+	}{
+		"namespaced manifest without a namespace": {
+			manifest:      `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config"}}`,
+			wantChanged:   true,
+			wantNamespace: []string{"cluster-a"},
+		},
+		"namespaced manifest with a namespace": {
+			manifest:      `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"app"}}`,
+			wantNamespace: []string{"app"},
+		},
+		"cluster scoped manifest": {
+			manifest:      `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"app"}}`,
+			wantNamespace: []string{""},
+		},
+		"manifest of a kind unknown to the hub": {
+			manifest:      `{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"widget"}}`,
+			wantNamespace: []string{""},
+		},
+		"multi-document yaml manifest": {
+			manifest:      "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: first\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: app\n",
+			wantChanged:   true,
+			wantNamespace: []string{"cluster-a", ""},
+		},
+		"manifest that is not json": {
+			manifest: `not json`,
+		},
+	}
+	d := &WorkDefaulter{restMapper: newTestRESTMapper()}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			manifests := []workv1alpha1.Manifest{rawManifest(tt.manifest)}
+			if changed := d.defaultNamespaces(manifests, "cluster-a"); changed != tt.wantChanged {
+				t.Errorf("defaultNamespaces() = %t, want %t", changed, tt.wantChanged)
+			}
+			if tt.wantNamespace == nil {
+				return
+			}
+			docs, err := manifests[0].Documents()
+			if err != nil {
+				t.Fatalf("failed to split the defaulted manifest: %v", err)
+			}
+			var namespaces []string
+			for i := range docs {
+				obj, err := docs[i].AsUnstructured()
+				if err != nil {
+					t.Fatalf("failed to decode the defaulted document %d: %v", i, err)
+				}
+				namespaces = append(namespaces, obj.GetNamespace())
+			}
+			if !reflect.DeepEqual(namespaces, tt.wantNamespace) {
+				t.Errorf("defaultNamespaces() namespaces = %v, want %v", namespaces, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestWorkDefaulterHandle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("failed to create the decoder: %v", err)
+	}
+
+	work := &workv1alpha1.Work{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-a", Name: "work"},
+		Spec: workv1alpha1.WorkSpec{Workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{
+			rawManifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config"}}`),
+		}}},
+	}
+	work.SetGroupVersionKind(workv1alpha1.SchemeGroupVersion.WithKind("Work"))
+	raw, err := json.Marshal(work)
+	if err != nil {
+		t.Fatalf("failed to marshal the work: %v", err)
+	}
+	newRequest := func(operation admissionv1.Operation) admission.Request {
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			Namespace: "cluster-a",
+			Name:      "work",
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+
+	tests := map[string]struct {
+		defaultNamespace string
+		operation        admissionv1.Operation
+		wantPatch        bool
+		wantNamespace    string
+	}{
+		"the namespace of the work": {
+			operation:     admissionv1.Create,
+			wantPatch:     true,
+			wantNamespace: "cluster-a",
+		},
+		"the configured default namespace": {
+			defaultNamespace: "app",
+			operation:        admissionv1.Update,
+			wantPatch:        true,
+			wantNamespace:    "app",
+		},
+		"delete is not defaulted": {
+			operation: admissionv1.Delete,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			defaulter := &WorkDefaulter{restMapper: newTestRESTMapper(), defaultNamespace: tt.defaultNamespace}
+			if err := defaulter.InjectDecoder(decoder); err != nil {
+				t.Fatalf("failed to inject the decoder: %v", err)
+			}
+			resp := defaulter.Handle(context.Background(), newRequest(tt.operation))
+			if !resp.Allowed {
+				t.Fatalf("Handle() denied the request: %v", resp.Result)
+			}
+			if !tt.wantPatch {
+				if len(resp.Patches) != 0 {
+					t.Errorf("Handle() patches = %v, want none", resp.Patches)
+				}
+				return
+			}
+			patchData, err := json.Marshal(resp.Patches)
+			if err != nil {
+				t.Fatalf("failed to marshal the patches: %v", err)
+			}
+			patch, err := jsonpatch.DecodePatch(patchData)
+			if err != nil {
+				t.Fatalf("failed to decode the patches %s: %v", patchData, err)
+			}
+			patched, err := patch.Apply(raw)
+			if err != nil {
+				t.Fatalf("failed to apply the patches %s: %v", patchData, err)
+			}
+			patchedWork := &workv1alpha1.Work{}
+			if err := json.Unmarshal(patched, patchedWork); err != nil {
+				t.Fatalf("failed to unmarshal the patched work: %v", err)
+			}
+			obj, err := patchedWork.Spec.Workload.Manifests[0].AsUnstructured()
+			if err != nil {
+				t.Fatalf("failed to decode the patched manifest: %v", err)
+			}
+			if obj.GetNamespace() != tt.wantNamespace {
+				t.Errorf("Handle() patched namespace = %q, want %q", obj.GetNamespace(), tt.wantNamespace)
+			}
+		})
+	}
+}
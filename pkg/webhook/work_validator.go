@@ -0,0 +1,209 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook serves the admission webhooks of the work api, so that the works the controllers
+// can't apply are rejected when they are submitted rather than failing later on the spoke cluster.
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/healthcheck"
+	"sigs.k8s.io/work-api/pkg/overlay"
+)
+
+// ValidateWorkPath is the path the work validating webhook is served at.
+const ValidateWorkPath = "/validate-multicluster-x-k8s-io-v1alpha1-work"
+
+// WorkValidator rejects the works whose manifests can't be decoded or that contain the same resource twice.
+type WorkValidator struct {
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &WorkValidator{}
+var _ admission.DecoderInjector = &WorkValidator{}
+
+// SetupWithManager registers the work webhooks with the webhook server of the manager.
+// The namespaced manifests without a namespace get the default namespace, empty means the namespace of their work.
+func SetupWithManager(mgr ctrl.Manager, defaultNamespace string) error {
+	mgr.GetWebhookServer().Register(ValidateWorkPath, &webhook.Admission{Handler: &WorkValidator{}})
+	mgr.GetWebhookServer().Register(DefaultWorkPath, &webhook.Admission{Handler: &WorkDefaulter{
+		restMapper:       mgr.GetRESTMapper(),
+		defaultNamespace: defaultNamespace,
+	}})
+	return nil
+}
+
+// Handle validates the work of a create or update request.
+func (v *WorkValidator) Handle(_ context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	work := &workv1alpha1.Work{}
+	if err := v.decoder.Decode(req, work); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if errs := ValidateWork(work); len(errs) != 0 {
+		klog.V(3).InfoS("rejected an invalid work", "work", req.Name, "namespace", req.Namespace, "errors", errs.ToAggregate())
+		return admission.Denied(errs.ToAggregate().Error())
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder of the admission requests, it implements admission.DecoderInjector.
+func (v *WorkValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// ValidateWork runs all the checks of the validating webhook on a work.
+func ValidateWork(work *workv1alpha1.Work) field.ErrorList {
+	errs := ValidateManifests(work.Spec.Workload.Manifests)
+	errs = append(errs, ValidateHealthChecks(work.Spec.Workload)...)
+	errs = append(errs, ValidateOverlays(work.Spec.Workload)...)
+	errs = append(errs, ValidateApplyModes(work.Spec.Workload)...)
+	return append(errs, metav1validation.ValidateLabelSelector(work.Spec.ClusterSelector, field.NewPath("spec", "clusterSelector"))...)
+}
+
+// manifestKey identifies the resource a manifest is applied to.
+type manifestKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+// ValidateManifests checks that every manifest decodes into an object with a valid kind and a name,
+// and that no two manifests are the same resource. Each document of a multi-document YAML manifest is checked.
+func ValidateManifests(manifests []workv1alpha1.Manifest) field.ErrorList {
+	var errs field.ErrorList
+	manifestsPath := field.NewPath("spec", "workload", "manifests")
+	seen := make(map[manifestKey]bool, len(manifests))
+	for index, manifest := range manifests {
+		path := manifestsPath.Index(index)
+		docs, err := manifest.Documents()
+		if err != nil {
+			errs = append(errs, field.Invalid(path, string(manifest.Raw), err.Error()))
+			continue
+		}
+		if len(docs) == 0 {
+			errs = append(errs, field.Invalid(path, string(manifest.Raw), "the manifest has no document"))
+			continue
+		}
+		for _, doc := range docs {
+			if err := validateDocument(doc, path, seen); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// validateDocument checks a single document of a manifest, seen has the resources of the documents checked before.
+func validateDocument(doc workv1alpha1.Manifest, path *field.Path, seen map[manifestKey]bool) *field.Error {
+	obj, err := doc.AsUnstructured()
+	if err != nil {
+		return field.Invalid(path, string(doc.Raw), err.Error())
+	}
+	if _, err := schema.ParseGroupVersion(obj.GetAPIVersion()); err != nil || len(obj.GetAPIVersion()) == 0 {
+		return field.Invalid(path.Child("apiVersion"), obj.GetAPIVersion(), "must be a valid api version")
+	}
+	if len(obj.GetName()) == 0 {
+		return field.Required(path.Child("metadata", "name"), "the name of the object is required")
+	}
+	key := manifestKey{gvk: obj.GroupVersionKind(), namespace: obj.GetNamespace(), name: obj.GetName()}
+	if seen[key] {
+		return field.Duplicate(path, fmt.Sprintf("%s %s/%s", key.gvk, key.namespace, key.name))
+	}
+	seen[key] = true
+	return nil
+}
+
+// ValidateHealthChecks checks that every health check points to a manifest and has an expression that compiles.
+func ValidateHealthChecks(workload workv1alpha1.WorkloadTemplate) field.ErrorList {
+	var errs field.ErrorList
+	healthChecksPath := field.NewPath("spec", "workload", "healthChecks")
+	for index, healthCheck := range workload.HealthChecks {
+		path := healthChecksPath.Index(index)
+		if healthCheck.Ordinal < 0 || healthCheck.Ordinal >= len(workload.Manifests) {
+			errs = append(errs, field.Invalid(path.Child("ordinal"), healthCheck.Ordinal, "must be the index of a manifest"))
+		}
+		if _, err := healthcheck.Compile(healthCheck.Expression); err != nil {
+			errs = append(errs, field.Invalid(path.Child("expression"), healthCheck.Expression, err.Error()))
+		}
+	}
+	return errs
+}
+
+// ValidateOverlays checks that every overlay points to a manifest and is a JSON patch that applies to every document
+// of the manifest, so that a typo in a path is rejected rather than failing the manifest on the spoke clusters.
+func ValidateOverlays(workload workv1alpha1.WorkloadTemplate) field.ErrorList {
+	var errs field.ErrorList
+	overlaysPath := field.NewPath("spec", "workload", "overlays")
+	for index, o := range workload.Overlays {
+		path := overlaysPath.Index(index)
+		if o.Ordinal < 0 || o.Ordinal >= len(workload.Manifests) {
+			errs = append(errs, field.Invalid(path.Child("ordinal"), o.Ordinal, "must be the index of a manifest"))
+			continue
+		}
+		if err := overlay.Validate(o.Patch); err != nil {
+			errs = append(errs, field.Invalid(path.Child("patch"), o.Patch, err.Error()))
+			continue
+		}
+		// the manifests that don't decode are reported by ValidateManifests
+		docs, _ := workload.Manifests[o.Ordinal].Documents()
+		for _, doc := range docs {
+			obj, err := doc.AsUnstructured()
+			if err != nil {
+				continue
+			}
+			if err := overlay.Apply(obj, o.Patch); err != nil {
+				errs = append(errs, field.Invalid(path.Child("patch"), o.Patch, err.Error()))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// ValidateApplyModes checks that every apply mode points to a manifest and that no manifest has two of them.
+func ValidateApplyModes(workload workv1alpha1.WorkloadTemplate) field.ErrorList {
+	var errs field.ErrorList
+	applyModesPath := field.NewPath("spec", "workload", "applyModes")
+	seen := make(map[int]bool, len(workload.ApplyModes))
+	for index, mode := range workload.ApplyModes {
+		path := applyModesPath.Index(index).Child("ordinal")
+		switch {
+		case mode.Ordinal < 0 || mode.Ordinal >= len(workload.Manifests):
+			errs = append(errs, field.Invalid(path, mode.Ordinal, "must be the index of a manifest"))
+		case seen[mode.Ordinal]:
+			errs = append(errs, field.Duplicate(path, mode.Ordinal))
+		}
+		seen[mode.Ordinal] = true
+	}
+	return errs
+}
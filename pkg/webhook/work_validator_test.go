@@ -0,0 +1,279 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+)
+
+func rawManifest(raw string) workv1alpha1.Manifest {
+	return workv1alpha1.Manifest{RawExtension: runtime.RawExtension{Raw: []byte(raw)}}
+}
+
+func TestValidateManifests(t *testing.T) {
+	configMap := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"default"}}`
+	tests := map[string]struct {
+		manifests []workv1alpha1.Manifest
+		wantType  field.ErrorType
+	}{
+		"valid manifests": {
+			manifests: []workv1alpha1.Manifest{
+				rawManifest(configMap),
+				rawManifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"other"}}`),
+				rawManifest(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"config","namespace":"default"}}`),
+			},
+		},
+		"manifest that is not json": {
+			manifests: []workv1alpha1.Manifest{rawManifest(`not json`)},
+			wantType:  field.ErrorTypeInvalid,
+		},
+		"manifest without a kind": {
+			manifests: []workv1alpha1.Manifest{rawManifest(`{"apiVersion":"v1","metadata":{"name":"config"}}`)},
+			wantType:  field.ErrorTypeInvalid,
+		},
+		"manifest with an invalid api version": {
+			manifests: []workv1alpha1.Manifest{rawManifest(`{"apiVersion":"a/b/c","kind":"ConfigMap","metadata":{"name":"config"}}`)},
+			wantType:  field.ErrorTypeInvalid,
+		},
+		"manifest without a name": {
+			manifests: []workv1alpha1.Manifest{rawManifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{}}`)},
+			wantType:  field.ErrorTypeRequired,
+		},
+		"duplicated manifests": {
+			manifests: []workv1alpha1.Manifest{rawManifest(configMap), rawManifest(configMap)},
+			wantType:  field.ErrorTypeDuplicate,
+		},
+		"multi-document yaml manifest": {
+			manifests: []workv1alpha1.Manifest{
+				rawManifest("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: first\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: second\n"),
+			},
+		},
+		"invalid document of a multi-document manifest": {
+			manifests: []workv1alpha1.Manifest{
+				rawManifest("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: first\n---\napiVersion: v1\nkind: ConfigMap\nmetadata: {}\n"),
+			},
+			wantType: field.ErrorTypeRequired,
+		},
+		"document duplicating another manifest": {
+			manifests: []workv1alpha1.Manifest{
+				rawManifest(configMap),
+				rawManifest("apiVersion: v1\nkind: Secret\nmetadata:\n  name: config\n  namespace: default\n---\n" +
+					"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n  namespace: default\n"),
+			},
+			wantType: field.ErrorTypeDuplicate,
+		},
+		"empty manifest": {
+			manifests: []workv1alpha1.Manifest{rawManifest("---\n")},
+			wantType:  field.ErrorTypeInvalid,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := ValidateManifests(tt.manifests)
+			if len(tt.wantType) == 0 {
+				if len(errs) != 0 {
+					t.Errorf("ValidateManifests() = %v, want no error", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Type != tt.wantType {
+				t.Errorf("ValidateManifests() = %v, want a single %s error", errs, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestWorkValidatorHandle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(workv1alpha1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatalf("failed to create the decoder: %v", err)
+	}
+	validator := &WorkValidator{}
+	if err := validator.InjectDecoder(decoder); err != nil {
+		t.Fatalf("failed to inject the decoder: %v", err)
+	}
+
+	newWorkRequest := func(operation admissionv1.Operation, work *workv1alpha1.Work) admission.Request {
+		work.SetGroupVersionKind(workv1alpha1.SchemeGroupVersion.WithKind("Work"))
+		raw, err := json.Marshal(work)
+		if err != nil {
+			t.Fatalf("failed to marshal the work: %v", err)
+		}
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+	newRequest := func(operation admissionv1.Operation, manifests ...workv1alpha1.Manifest) admission.Request {
+		return newWorkRequest(operation, &workv1alpha1.Work{
+			Spec: workv1alpha1.WorkSpec{Workload: workv1alpha1.WorkloadTemplate{Manifests: manifests}},
+		})
+	}
+	valid := rawManifest(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config","namespace":"default"}}`)
+	invalid := rawManifest(`{"apiVersion":"v1","metadata":{"name":"config"}}`)
+
+	tests := map[string]struct {
+		req         admission.Request
+		wantAllowed bool
+	}{
+		"create a valid work": {
+			req:         newRequest(admissionv1.Create, valid),
+			wantAllowed: true,
+		},
+		"create an invalid work": {
+			req: newRequest(admissionv1.Create, invalid),
+		},
+		"update to an invalid work": {
+			req: newRequest(admissionv1.Update, valid, invalid),
+		},
+		"update to duplicated manifests": {
+			req: newRequest(admissionv1.Update, valid, valid),
+		},
+		"create a work with a cluster selector": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload:        workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{valid}},
+				ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			}}),
+			wantAllowed: true,
+		},
+		"create a work with an invalid cluster selector": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{Manifests: []workv1alpha1.Manifest{valid}},
+				ClusterSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "env", Operator: metav1.LabelSelectorOpIn},
+				}},
+			}}),
+		},
+		"create a work with a health check": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests:    []workv1alpha1.Manifest{valid},
+					HealthChecks: []workv1alpha1.ManifestHealthCheck{{Ordinal: 0, Expression: `has(object.data)`}},
+				},
+			}}),
+			wantAllowed: true,
+		},
+		"create a work with an invalid health check expression": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests:    []workv1alpha1.Manifest{valid},
+					HealthChecks: []workv1alpha1.ManifestHealthCheck{{Ordinal: 0, Expression: `has(object.data`}},
+				},
+			}}),
+		},
+		"create a work with a health check of a missing manifest": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests:    []workv1alpha1.Manifest{valid},
+					HealthChecks: []workv1alpha1.ManifestHealthCheck{{Ordinal: 1, Expression: `has(object.data)`}},
+				},
+			}}),
+		},
+		"create a work with an overlay": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests: []workv1alpha1.Manifest{valid},
+					Overlays: []workv1alpha1.ManifestOverlay{{Ordinal: 0, Clusters: []string{"cluster-a"}, Patch: []workv1alpha1.JSONPatchOperation{
+						{Op: "add", Path: "/data", Value: &runtime.RawExtension{Raw: []byte(`{"replicas":"3"}`)}},
+					}}},
+				},
+			}}),
+			wantAllowed: true,
+		},
+		"create a work with an overlay of a missing field": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests: []workv1alpha1.Manifest{valid},
+					Overlays: []workv1alpha1.ManifestOverlay{{Ordinal: 0, Patch: []workv1alpha1.JSONPatchOperation{
+						{Op: "replace", Path: "/data/replicas", Value: &runtime.RawExtension{Raw: []byte(`"3"`)}},
+					}}},
+				},
+			}}),
+		},
+		"create a work with an overlay without a value": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests: []workv1alpha1.Manifest{valid},
+					Overlays:  []workv1alpha1.ManifestOverlay{{Ordinal: 0, Patch: []workv1alpha1.JSONPatchOperation{{Op: "add", Path: "/data"}}}},
+				},
+			}}),
+		},
+		"create a work with an overlay of a missing manifest": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests: []workv1alpha1.Manifest{valid},
+					Overlays:  []workv1alpha1.ManifestOverlay{{Ordinal: 1, Patch: []workv1alpha1.JSONPatchOperation{{Op: "remove", Path: "/data"}}}},
+				},
+			}}),
+		},
+		"create a work with a create only manifest": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests:  []workv1alpha1.Manifest{valid},
+					ApplyModes: []workv1alpha1.ManifestApplyMode{{Ordinal: 0, Mode: workv1alpha1.ManifestApplyModeCreateOnly}},
+				},
+			}}),
+			wantAllowed: true,
+		},
+		"create a work with the apply mode of a missing manifest": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests:  []workv1alpha1.Manifest{valid},
+					ApplyModes: []workv1alpha1.ManifestApplyMode{{Ordinal: 1, Mode: workv1alpha1.ManifestApplyModeCreateOnly}},
+				},
+			}}),
+		},
+		"create a work with two apply modes of a manifest": {
+			req: newWorkRequest(admissionv1.Create, &workv1alpha1.Work{Spec: workv1alpha1.WorkSpec{
+				Workload: workv1alpha1.WorkloadTemplate{
+					Manifests: []workv1alpha1.Manifest{valid},
+					ApplyModes: []workv1alpha1.ManifestApplyMode{
+						{Ordinal: 0, Mode: workv1alpha1.ManifestApplyModeCreateOnly},
+						{Ordinal: 0, Mode: workv1alpha1.ManifestApplyModeReconcile},
+					},
+				},
+			}}),
+		},
+		"delete is not validated": {
+			req:         admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Delete}},
+			wantAllowed: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := validator.Handle(context.Background(), tt.req)
+			if resp.Allowed != tt.wantAllowed {
+				t.Errorf("Handle() allowed = %v, want %v, result %+v", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+		})
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -94,4 +97,79 @@ var _ = ginkgo.Describe("Apply Work", func() {
 			}, eventuallyTimeout, eventuallyInterval).ShouldNot(gomega.HaveOccurred())
 		})
 	})
+
+	ginkgo.Context("Prune a deployment in the foreground", func() {
+		ginkgo.It("Should delete the pods of the pruned deployment", func() {
+			workNamespace = "default"
+			labels := map[string]string{"app": "test-foreground-nginx"}
+			replicas := int32(1)
+			deployment := &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-foreground-nginx", Namespace: workNamespace},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: labels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.14.2"}}},
+					},
+				},
+			}
+			configMap := &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-foreground-config", Namespace: workNamespace},
+			}
+			work := &workapi.Work{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-foreground-work", Namespace: workNamespace},
+				Spec: workapi.WorkSpec{
+					Workload: workapi.WorkloadTemplate{Manifests: []workapi.Manifest{
+						{RawExtension: runtime.RawExtension{Object: deployment}},
+						{RawExtension: runtime.RawExtension{Object: configMap}},
+					}},
+					StaleDeletePropagation: workapi.StaleDeletePropagationForeground,
+				},
+			}
+			work, err := hubWorkClient.MulticlusterV1alpha1().Works(workNamespace).Create(context.Background(), work, metav1.CreateOptions{})
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			podSelector := metav1.ListOptions{LabelSelector: "app=test-foreground-nginx"}
+			gomega.Eventually(func() error {
+				pods, err := spokeKubeClient.CoreV1().Pods(workNamespace).List(context.Background(), podSelector)
+				if err != nil {
+					return err
+				}
+				if len(pods.Items) == 0 {
+					return fmt.Errorf("Expect the pods of the deployment to be created")
+				}
+				return nil
+			}, eventuallyTimeout, eventuallyInterval).ShouldNot(gomega.HaveOccurred())
+
+			// drop the deployment from the work so that it is pruned
+			gomega.Eventually(func() error {
+				work, err := hubWorkClient.MulticlusterV1alpha1().Works(workNamespace).Get(context.Background(), work.Name, metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				work.Spec.Workload.Manifests = []workapi.Manifest{{RawExtension: runtime.RawExtension{Object: configMap}}}
+				_, err = hubWorkClient.MulticlusterV1alpha1().Works(workNamespace).Update(context.Background(), work, metav1.UpdateOptions{})
+				return err
+			}, eventuallyTimeout, eventuallyInterval).ShouldNot(gomega.HaveOccurred())
+
+			// the deployment is only gone once the garbage collector deleted its replica sets and pods
+			gomega.Eventually(func() error {
+				_, err := spokeKubeClient.AppsV1().Deployments(workNamespace).Get(context.Background(), deployment.Name, metav1.GetOptions{})
+				if !apierrors.IsNotFound(err) {
+					return fmt.Errorf("Expect the pruned deployment to be deleted, got %v", err)
+				}
+				pods, err := spokeKubeClient.CoreV1().Pods(workNamespace).List(context.Background(), podSelector)
+				if err != nil {
+					return err
+				}
+				if len(pods.Items) != 0 {
+					return fmt.Errorf("Expect the pods of the pruned deployment to be deleted, %d are left", len(pods.Items))
+				}
+				return nil
+			}, eventuallyTimeout, eventuallyInterval).ShouldNot(gomega.HaveOccurred())
+		})
+	})
 })
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	"sigs.k8s.io/work-api/pkg/controllers"
+)
+
+var _ = Describe("Work applied from the hub to the spoke", func() {
+	const timeout = time.Second * 30
+	const interval = time.Second * 1
+	var workNamespace, resourceNamespace string
+
+	configMapManifest := func(name, data string) workv1alpha1.Manifest {
+		return workv1alpha1.Manifest{
+			RawExtension: runtime.RawExtension{Object: &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: resourceNamespace},
+				Data:       map[string]string{"test": data},
+			}},
+		}
+	}
+
+	// appliedWorkOf finds the applied work of a work on the spoke cluster
+	appliedWorkOf := func(work *workv1alpha1.Work) (*workv1alpha1.AppliedWork, error) {
+		appliedWorks, err := spoke.workClient.MulticlusterV1alpha1().AppliedWorks().List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range appliedWorks.Items {
+			spec := appliedWorks.Items[i].Spec
+			if spec.WorkNamespace == work.Namespace && spec.WorkName == work.Name {
+				return &appliedWorks.Items[i], nil
+			}
+		}
+		return nil, fmt.Errorf("work %s/%s has no appliedWork on the spoke cluster", work.Namespace, work.Name)
+	}
+
+	BeforeEach(func() {
+		workNamespace = "work-" + utilrand.String(5)
+		resourceNamespace = "app-" + utilrand.String(5)
+		// the works live on the hub cluster and their resources on the spoke cluster
+		_, err := hub.kubeClient.CoreV1().Namespaces().Create(context.Background(),
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: workNamespace}}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = spoke.kubeClient.CoreV1().Namespaces().Create(context.Background(),
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: resourceNamespace}}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(hub.kubeClient.CoreV1().Namespaces().Delete(context.Background(), workNamespace, metav1.DeleteOptions{})).To(Succeed())
+		Expect(spoke.kubeClient.CoreV1().Namespaces().Delete(context.Background(), resourceNamespace, metav1.DeleteOptions{})).To(Succeed())
+	})
+
+	It("Should apply, update, restore and prune the resources of a work on the spoke cluster only", func() {
+		ctx := context.Background()
+		work := &workv1alpha1.Work{
+			ObjectMeta: metav1.ObjectMeta{Name: "work-" + utilrand.String(5), Namespace: workNamespace},
+			Spec: workv1alpha1.WorkSpec{Workload: workv1alpha1.WorkloadTemplate{
+				Manifests: []workv1alpha1.Manifest{configMapManifest("kept", "v1"), configMapManifest("pruned", "v1")},
+			}},
+		}
+		work, err := hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Create(ctx, work, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		By("applying the manifests to the spoke cluster")
+		Eventually(func() error {
+			got, err := hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Get(ctx, work.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !meta.IsStatusConditionTrue(got.Status.Conditions, controllers.ConditionTypeApplied) {
+				return fmt.Errorf("work is not applied yet: %+v", got.Status.Conditions)
+			}
+			return nil
+		}, timeout, interval).Should(Succeed())
+		for _, name := range []string{"kept", "pruned"} {
+			_, err = spoke.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err = hub.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Get(ctx, "kept", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "the manifests must not be applied to the hub cluster")
+		Eventually(func() error {
+			appliedWork, err := appliedWorkOf(work)
+			if err != nil {
+				return err
+			}
+			if len(appliedWork.Status.AppliedResources) != 2 {
+				return fmt.Errorf("appliedWork tracks %d resources, want 2", len(appliedWork.Status.AppliedResources))
+			}
+			return nil
+		}, timeout, interval).Should(Succeed())
+
+		By("restoring a resource deleted on the spoke cluster")
+		Expect(spoke.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Delete(ctx, "kept", metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() error {
+			_, err := spoke.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Get(ctx, "kept", metav1.GetOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+
+		By("updating the kept manifest and pruning the other one")
+		Eventually(func() error {
+			got, err := hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Get(ctx, work.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			got.Spec.Workload.Manifests = []workv1alpha1.Manifest{configMapManifest("kept", "v2")}
+			_, err = hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Update(ctx, got, metav1.UpdateOptions{})
+			return err
+		}, timeout, interval).Should(Succeed())
+		Eventually(func() error {
+			kept, err := spoke.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Get(ctx, "kept", metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if kept.Data["test"] != "v2" {
+				return fmt.Errorf("kept config map data = %v, want v2", kept.Data)
+			}
+			if _, err = spoke.kubeClient.CoreV1().ConfigMaps(resourceNamespace).Get(ctx, "pruned", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+				return fmt.Errorf("pruned config map is still there: %v", err)
+			}
+			return nil
+		}, timeout, interval).Should(Succeed())
+
+		By("removing the appliedWork from the spoke cluster once the work is deleted from the hub cluster")
+		Expect(hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Delete(ctx, work.Name, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool {
+			_, err := hub.workClient.MulticlusterV1alpha1().Works(workNamespace).Get(ctx, work.Name, metav1.GetOptions{})
+			return apierrors.IsNotFound(err)
+		}, timeout, interval).Should(BeTrue())
+		Eventually(func() error {
+			_, err := appliedWorkOf(work)
+			return err
+		}, timeout, interval).ShouldNot(Succeed())
+	})
+})
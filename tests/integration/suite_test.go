@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	workv1alpha1 "sigs.k8s.io/work-api/pkg/apis/v1alpha1"
+	workclient "sigs.k8s.io/work-api/pkg/client/clientset/versioned"
+	"sigs.k8s.io/work-api/pkg/controllers"
+)
+
+// These tests run the controllers against two control planes, a hub cluster that only knows the works and a spoke
+// cluster that only knows the applied works, wired together like in production. They catch the regressions the
+// single cluster suite of the controllers can't, e.g. a client of the wrong cluster.
+
+// cluster is an envtest control plane and the clients the tests use on it.
+type cluster struct {
+	env        *envtest.Environment
+	cfg        *rest.Config
+	kubeClient kubernetes.Interface
+	workClient workclient.Interface
+}
+
+var (
+	hub, spoke  *cluster
+	stopControl context.CancelFunc
+	setupLog    = ctrl.Log.WithName("test")
+)
+
+// startCluster starts a control plane with the given CRDs of the config/crd directory installed.
+func startCluster(crds ...string) *cluster {
+	var paths []string
+	for _, crd := range crds {
+		paths = append(paths, filepath.Join("../../", "config", "crd", crd))
+	}
+	c := &cluster{env: &envtest.Environment{CRDDirectoryPaths: paths, ErrorIfCRDPathMissing: true}}
+	var err error
+	c.cfg, err = c.env.Start()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(c.cfg).ToNot(BeNil())
+	c.kubeClient, err = kubernetes.NewForConfig(c.cfg)
+	Expect(err).ToNot(HaveOccurred())
+	c.workClient, err = workclient.NewForConfig(c.cfg)
+	Expect(err).ToNot(HaveOccurred())
+	return c
+}
+
+func TestIntegration(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecsWithDefaultAndCustomReporters(t,
+		"Hub and Spoke Integration Suite",
+		[]Reporter{printer.NewlineReporter{}})
+}
+
+var _ = BeforeSuite(func(done Done) {
+	ctrl.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+
+	By("bootstrapping the hub and the spoke clusters")
+	hub = startCluster("multicluster.x-k8s.io_works.yaml")
+	spoke = startCluster("multicluster.x-k8s.io_appliedworks.yaml")
+	Expect(workv1alpha1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+	By("starting the controllers")
+	var ctx context.Context
+	ctx, stopControl = context.WithCancel(context.Background())
+	opts := ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	}
+	controllerOpts := controllers.ControllerOptions{
+		// resync the applied works often so that the resources deleted out-of-band are restored within the test timeouts
+		AppliedWorkResyncPeriod: 3 * time.Second,
+		SpokeMetricsAddr:        "0",
+	}
+	go func() {
+		defer GinkgoRecover()
+		Expect(controllers.Start(ctx, hub.cfg, spoke.cfg, setupLog, opts, controllerOpts)).To(Succeed())
+	}()
+
+	close(done)
+}, 120)
+
+var _ = AfterSuite(func() {
+	By("tearing down the hub and the spoke clusters")
+	if stopControl != nil {
+		stopControl()
+	}
+	for _, c := range []*cluster{spoke, hub} {
+		if c != nil {
+			Expect(c.env.Stop()).To(Succeed())
+		}
+	}
+})